@@ -0,0 +1,138 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/peer"
+)
+
+func TestAutoDowngrade(t *testing.T) {
+	grpcSrv := grpc.NewServer()
+	echo.RegisterEchoServer(grpcSrv, echoService{})
+	defer grpcSrv.Stop()
+
+	cases := map[string]struct {
+		enableHTTP2      bool
+		expectDowngraded bool
+	}{
+		"HTTP/2": {
+			enableHTTP2: true,
+		},
+		"HTTP/1.1 only": {
+			expectDowngraded: true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			var (
+				mutex      sync.Mutex
+				downgraded []bool
+				numConns   int32
+			)
+			downgradingHandler := server.CreateDowngradingHandler(grpcSrv, http.NotFoundHandler())
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				mutex.Lock()
+				downgraded = append(downgraded, req.ProtoMajor == 1 && req.Header.Get("Grpc-Web-Only") != "")
+				mutex.Unlock()
+				downgradingHandler.ServeHTTP(w, req)
+			}))
+			srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					atomic.AddInt32(&numConns, 1)
+				}
+			}
+			srv.EnableHTTP2 = c.enableHTTP2
+			if !c.enableHTTP2 {
+				// Emulate an intermediary that does not support ALPN at all. Go servers would otherwise reject the
+				// side channel, which only offers "h2".
+				srv.TLS = &tls.Config{NextProtos: []string{}}
+			}
+			srv.StartTLS()
+			defer srv.Close()
+
+			certPool := x509.NewCertPool()
+			certPool.AddCert(srv.Certificate())
+			tlsConf := &tls.Config{RootCAs: certPool}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			var sideChannel client.SideChannel
+			cc, err := client.ConnectViaProxy(ctx, srv.Listener.Addr().String(), tlsConf,
+				client.WithAutoDowngrade(),
+				client.WithSideChannel(&sideChannel),
+				client.DialOpts(grpc.WithAuthority(srv.Listener.Addr().String())))
+			require.NoError(t, err)
+			defer func() { _ = cc.Close() }()
+
+			echoClient := echo.NewEchoClient(cc)
+			var p peer.Peer
+			resp, err := echoClient.UnaryEcho(ctx, &echo.EchoRequest{Message: "hello"}, grpc.Peer(&p))
+			require.NoError(t, err)
+			assert.Equal(t, "hello", resp.GetMessage())
+			connsAfterFirstCall := atomic.LoadInt32(&numConns)
+
+			for i := 0; i < 10; i++ {
+				_, err := echoClient.UnaryEcho(ctx, &echo.EchoRequest{Message: "hello"})
+				require.NoError(t, err)
+			}
+			// The decision is cached, hence the endpoint is not probed again.
+			assert.Equal(t, connsAfterFirstCall, atomic.LoadInt32(&numConns))
+
+			mutex.Lock()
+			for _, d := range downgraded {
+				assert.Equal(t, c.expectDowngraded, d)
+			}
+			mutex.Unlock()
+
+			if !c.expectDowngraded {
+				// Bidi-streaming calls only work if calls are not downgraded.
+				stream, err := echoClient.BidirectionalStreamingEcho(ctx)
+				require.NoError(t, err)
+				require.NoError(t, stream.Send(&echo.EchoRequest{Message: "hello"}))
+				resp, err := stream.Recv()
+				require.NoError(t, err)
+				assert.Equal(t, "hello", resp.GetMessage())
+				require.NoError(t, stream.CloseSend())
+			}
+
+			// The AuthInfo of the side channel is retained regardless of the decision.
+			authInfo, ok := sideChannel.AuthInfo()
+			require.True(t, ok)
+			require.IsType(t, credentials.TLSInfo{}, authInfo)
+			require.IsType(t, credentials.TLSInfo{}, p.AuthInfo)
+			assert.Equal(t, authInfo.(credentials.TLSInfo).State.PeerCertificates, p.AuthInfo.(credentials.TLSInfo).State.PeerCertificates)
+		})
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/examples/features/proto/echo"
+)
+
+func TestBufferSizes(t *testing.T) {
+	largeMsg := strings.Repeat("x", 1<<20)
+
+	cases := map[string][]client.ConnectOption{
+		"downgraded":             {client.ForceDowngrade(true), client.WithReadBufferSize(64 << 10), client.WithWriteBufferSize(64 << 10)},
+		"websocket":              {client.UseWebSocket(true), client.WithReadBufferSize(64 << 10), client.WithWriteBufferSize(64 << 10)},
+		"non-positive (default)": {client.ForceDowngrade(true), client.WithReadBufferSize(0), client.WithWriteBufferSize(-1)},
+	}
+
+	for name, clientOpts := range cases {
+		t.Run(name, func(t *testing.T) {
+			cc, _ := testutil.NewDowngradedServer(t,
+				func(s *grpc.Server) { echo.RegisterEchoServer(s, echoService{}) },
+				testutil.WithClientOptions(clientOpts...))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			resp, err := echo.NewEchoClient(cc).UnaryEcho(ctx, &echo.EchoRequest{Message: largeMsg})
+			require.NoError(t, err)
+			assert.Equal(t, largeMsg, resp.GetMessage())
+		})
+	}
+}
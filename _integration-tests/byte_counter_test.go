@@ -0,0 +1,121 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/examples/features/proto/echo"
+)
+
+type byteCount struct {
+	method         string
+	sent, received int64
+}
+
+func TestByteCounter(t *testing.T) {
+	testCfg := newTestConfig(t, false)
+	defer testCfg.TearDown()
+
+	const (
+		unaryMethod           = "/grpc.examples.echo.Echo/UnaryEcho"
+		serverStreamingMethod = "/grpc.examples.echo.Echo/ServerStreamingEcho"
+	)
+	// Frame sizes of the serialized request and response messages.
+	unaryFrameSize := int64(grpcproto.MessageHeaderLength + 2 + len("hello"))
+	streamingReqFrameSize := int64(grpcproto.MessageHeaderLength + 2 + len("a\nbb\nccc"))
+	streamingRespFrameSizes := int64(3*grpcproto.MessageHeaderLength + (2 + 1) + (2 + 2) + (2 + 3))
+
+	cases := map[string]struct {
+		opts []client.ConnectOption
+		// extraSent is the number of bytes sent in addition to the request message.
+		extraSent int64
+		// trailersReceived indicates whether the trailers are received as part of the response body.
+		trailersReceived bool
+	}{
+		"http2": {
+			opts: []client.ConnectOption{client.ForceHTTP2()},
+		},
+		"downgraded": {
+			opts:             []client.ConnectOption{client.ForceDowngrade(true)},
+			trailersReceived: true,
+		},
+		"websocket": {
+			opts:             []client.ConnectOption{client.UseWebSocket(true)},
+			extraSent:        grpcproto.MessageHeaderLength,
+			trailersReceived: true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			counts := make(chan byteCount, 2)
+			opts := append([]client.ConnectOption{
+				client.DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())),
+				client.WithByteCounter(func(method string, sent, received int64) {
+					counts <- byteCount{method: method, sent: sent, received: received}
+				}),
+			}, c.opts...)
+			cc, err := client.ConnectViaProxy(ctx, testCfg.TargetAddr(t, "downgrading-grpc"), nil, opts...)
+			require.NoError(t, err)
+			defer func() { _ = cc.Close() }()
+
+			echoClient := echo.NewEchoClient(cc)
+
+			_, err = echoClient.UnaryEcho(ctx, &echo.EchoRequest{Message: "hello"})
+			require.NoError(t, err)
+			checkByteCount(ctx, t, counts, unaryMethod, unaryFrameSize+c.extraSent, unaryFrameSize, c.trailersReceived)
+
+			stream, err := echoClient.ServerStreamingEcho(ctx, &echo.EchoRequest{Message: "a\nbb\nccc"})
+			require.NoError(t, err)
+			for {
+				if _, err := stream.Recv(); err != nil {
+					require.ErrorIs(t, err, io.EOF)
+					break
+				}
+			}
+			checkByteCount(ctx, t, counts, serverStreamingMethod, streamingReqFrameSize+c.extraSent, streamingRespFrameSizes, c.trailersReceived)
+		})
+	}
+}
+
+func checkByteCount(ctx context.Context, t *testing.T, counts <-chan byteCount, method string, sent, received int64, trailersReceived bool) {
+	var count byteCount
+	select {
+	case count = <-counts:
+	case <-ctx.Done():
+		require.FailNow(t, "byte counter was not called")
+	}
+	assert.Equal(t, method, count.method)
+	assert.Equal(t, sent, count.sent)
+	if trailersReceived {
+		// The headers and trailers are sent as frames as well, the size of which depends on the server.
+		assert.Greater(t, count.received, received)
+	} else {
+		assert.Equal(t, received, count.received)
+	}
+}
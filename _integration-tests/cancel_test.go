@@ -0,0 +1,72 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/examples/features/proto/echo"
+)
+
+func TestClientCancellationCancelsServerHandler(t *testing.T) {
+	cases := map[string][]client.ConnectOption{
+		"downgraded": {client.ForceDowngrade(true)},
+		"grpc-web":   {client.UseGRPCWeb()},
+		"websocket":  {client.UseWebSocket(true)},
+	}
+
+	for name, opts := range cases {
+		t.Run(name, func(t *testing.T) {
+			handlerStarted := make(chan struct{}, 1)
+			handlerErrs := make(chan error, 1)
+			interceptor := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				handlerStarted <- struct{}{}
+				err := handler(srv, ss)
+				// Report the state of the context once the handler returns.
+				handlerErrs <- ss.Context().Err()
+				return err
+			}
+			cc, _ := testutil.NewDowngradedServer(t,
+				func(s *grpc.Server) { echo.RegisterEchoServer(s, echoService{}) },
+				testutil.WithGRPCServerOptions(grpc.StreamInterceptor(interceptor)),
+				testutil.WithClientOptions(opts...))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			// The handler sends the first message, and then blocks until its context is done.
+			stream, err := echo.NewEchoClient(cc).ServerStreamingEcho(ctx, &echo.EchoRequest{Message: "first\nHANG"})
+			require.NoError(t, err)
+			resp, err := stream.Recv()
+			require.NoError(t, err)
+			assert.Equal(t, "first", resp.GetMessage())
+			<-handlerStarted
+
+			cancel()
+			select {
+			case err := <-handlerErrs:
+				assert.ErrorIs(t, err, context.Canceled)
+			case <-time.After(2 * time.Second):
+				t.Fatal("server handler was not canceled after the client canceled the call")
+			}
+		})
+	}
+}
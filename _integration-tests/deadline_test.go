@@ -0,0 +1,70 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/status"
+)
+
+func TestDeadlineExceededDuringServerStream(t *testing.T) {
+	testCfg := newTestConfig(t, false)
+	defer testCfg.TearDown()
+
+	// Strip the timeout header in the reverse proxy, such that the server only notices the client has given up
+	// once the connection is closed.
+	lis := listenLocal(t)
+	revProxySrv := newHTTP1Proxy(testCfg.TargetAddr(t, "downgrading-grpc"))
+	revProxyHandler := revProxySrv.Handler
+	revProxySrv.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.Header.Del("Grpc-Timeout")
+		revProxyHandler.ServeHTTP(w, req)
+	})
+	go revProxySrv.Serve(lis)
+	defer revProxySrv.Shutdown(context.Background())
+
+	dialCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	cc, err := client.ConnectViaProxy(dialCtx, lis.Addr().String(), nil,
+		client.DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())), client.ForceDowngrade(true))
+	require.NoError(t, err)
+	defer func() { _ = cc.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	stream, err := echo.NewEchoClient(cc).ServerStreamingEcho(ctx, &echo.EchoRequest{Message: "HEADERS\nfoo\nHANG"})
+	require.NoError(t, err)
+
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "foo", resp.GetMessage())
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	assert.Less(t, time.Since(start), time.Second)
+}
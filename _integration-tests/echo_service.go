@@ -33,6 +33,7 @@ var (
 // echoService implements an echo server, which also sets headers and trailers.
 // Given the 'ERROR:' keyword in the message or 'error' in the header, the call will trigger an error.
 // This allows for testing for errors during various stages of the response.
+// Given the 'HANG' line in a server-streaming request, the call blocks until its context expires.
 type echoService struct {
 	echo.UnimplementedEchoServer
 }
@@ -92,6 +93,10 @@ func (s echoService) ServerStreamingEcho(req *echo.EchoRequest, server echo.Echo
 			}
 			continue
 		}
+		if line == "HANG" {
+			<-server.Context().Done()
+			return server.Context().Err()
+		}
 		resp := &echo.EchoResponse{Message: line}
 		if err := server.Send(resp); err != nil {
 			return err
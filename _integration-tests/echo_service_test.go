@@ -151,7 +151,7 @@ func testWithEchoService(t *testing.T, serverPreferGRPCWeb bool) {
 			useProxy:                true,
 			expectUnaryOK:           true,
 			expectServerStreamOK:    true,
-			expectClientStreamOK:    false,
+			expectClientStreamOK:    true,
 			expectBidiStreamOK:      false,
 		},
 		{
@@ -179,7 +179,7 @@ func testWithEchoService(t *testing.T, serverPreferGRPCWeb bool) {
 			forceDowngrade:       true,
 			expectUnaryOK:        true,
 			expectServerStreamOK: true,
-			expectClientStreamOK: false,
+			expectClientStreamOK: true,
 			expectBidiStreamOK:   false,
 		},
 		{
@@ -189,7 +189,7 @@ func testWithEchoService(t *testing.T, serverPreferGRPCWeb bool) {
 			forceDowngrade:          true,
 			expectUnaryOK:           true,
 			expectServerStreamOK:    true,
-			expectClientStreamOK:    false,
+			expectClientStreamOK:    true,
 			expectBidiStreamOK:      false,
 		},
 		{
@@ -200,7 +200,7 @@ func testWithEchoService(t *testing.T, serverPreferGRPCWeb bool) {
 			customContentType:       "application/grpc-web",
 			expectUnaryOK:           true,
 			expectServerStreamOK:    true,
-			expectClientStreamOK:    false,
+			expectClientStreamOK:    true,
 			expectBidiStreamOK:      false,
 		},
 		{
@@ -211,7 +211,7 @@ func testWithEchoService(t *testing.T, serverPreferGRPCWeb bool) {
 			customContentType:       "application/grpc-web",
 			expectUnaryOK:           true,
 			expectServerStreamOK:    true,
-			expectClientStreamOK:    false,
+			expectClientStreamOK:    true,
 			expectBidiStreamOK:      false,
 		},
 		{
@@ -222,6 +222,25 @@ func testWithEchoService(t *testing.T, serverPreferGRPCWeb bool) {
 			customContentType:       "application/grpc-web",
 			expectUnaryOK:           true,
 			expectServerStreamOK:    true,
+			expectClientStreamOK:    true,
+			expectBidiStreamOK:      false,
+		},
+		{
+			targetID:             "downgrading-grpc",
+			useProxy:             true,
+			useGRPCWeb:           true,
+			expectUnaryOK:        true,
+			expectServerStreamOK: true,
+			expectClientStreamOK: false,
+			expectBidiStreamOK:   false,
+		},
+		{
+			targetID:                "downgrading-grpc",
+			behindHTTP1ReverseProxy: true,
+			useProxy:                true,
+			useGRPCWeb:              true,
+			expectUnaryOK:           true,
+			expectServerStreamOK:    true,
 			expectClientStreamOK:    false,
 			expectBidiStreamOK:      false,
 		},
@@ -326,6 +345,57 @@ func TestWSWithEchoService(t *testing.T) {
 			expectClientStreamOK:    true,
 			expectBidiStreamOK:      true,
 		},
+		{
+			targetID:             "downgrading-grpc-ws-compression",
+			useProxy:             true,
+			useWebSocket:         true,
+			wsCompression:        true,
+			expectUnaryOK:        true,
+			expectServerStreamOK: true,
+			expectClientStreamOK: true,
+			expectBidiStreamOK:   true,
+		},
+		{
+			targetID:                "downgrading-grpc-ws-compression",
+			behindHTTP1ReverseProxy: true,
+			useProxy:                true,
+			useWebSocket:            true,
+			wsCompression:           true,
+			expectUnaryOK:           true,
+			expectServerStreamOK:    true,
+			expectClientStreamOK:    true,
+			expectBidiStreamOK:      true,
+		},
+		{
+			targetID:             "downgrading-grpc",
+			useProxy:             true,
+			useWebSocket:         true,
+			wsKeepalive:          true,
+			expectUnaryOK:        true,
+			expectServerStreamOK: true,
+			expectClientStreamOK: true,
+			expectBidiStreamOK:   true,
+		},
+		// Compression is only used if both sides agree to it.
+		{
+			targetID:             "downgrading-grpc",
+			useProxy:             true,
+			useWebSocket:         true,
+			wsCompression:        true,
+			expectUnaryOK:        true,
+			expectServerStreamOK: true,
+			expectClientStreamOK: true,
+			expectBidiStreamOK:   true,
+		},
+		{
+			targetID:             "downgrading-grpc-ws-compression",
+			useProxy:             true,
+			useWebSocket:         true,
+			expectUnaryOK:        true,
+			expectServerStreamOK: true,
+			expectClientStreamOK: true,
+			expectBidiStreamOK:   true,
+		},
 	}
 
 	for _, c := range cases {
@@ -360,6 +430,9 @@ type testCase struct {
 	behindHTTP1ReverseProxy bool
 	useProxy                bool
 	useWebSocket            bool
+	wsCompression           bool
+	wsKeepalive             bool
+	useGRPCWeb              bool
 	forceDowngrade          bool
 	customContentType       string
 
@@ -375,6 +448,14 @@ func (c *testCase) Name() string {
 
 	if c.useWebSocket {
 		sb.WriteString("-ws")
+		if c.wsCompression {
+			sb.WriteString("-compression")
+		}
+		if c.wsKeepalive {
+			sb.WriteString("-keepalive")
+		}
+	} else if c.useGRPCWeb {
+		sb.WriteString("-grpc-web")
 	} else if c.forceDowngrade {
 		sb.WriteString("-forced-downgrade")
 	}
@@ -395,6 +476,12 @@ func (c *testCase) Name() string {
 	return sb.String()
 }
 
+// isHalfDuplex checks whether the server receives requests via HTTP/1, and hence can only respond after the client
+// has finished sending.
+func (c *testCase) isHalfDuplex() bool {
+	return c.behindHTTP1ReverseProxy && !c.useWebSocket
+}
+
 func (c *testCase) Run(t *testing.T, cfg *testConfig) {
 	targetAddr := cfg.TargetAddr(t, c.targetID)
 
@@ -433,6 +520,15 @@ func (c *testCase) Run(t *testing.T, cfg *testConfig) {
 		if len(c.customContentType) > 0 {
 			opts = append(opts, client.WithContentType(c.customContentType))
 		}
+		if c.useGRPCWeb {
+			opts = append(opts, client.UseGRPCWeb())
+		}
+		if c.wsCompression {
+			opts = append(opts, client.WebSocketCompression())
+		}
+		if c.wsKeepalive {
+			opts = append(opts, client.WebSocketKeepalive(10*time.Millisecond, time.Second))
+		}
 
 		cc, err = client.ConnectViaProxy(ctx, targetAddr, nil, opts...)
 	} else {
@@ -551,7 +647,8 @@ func (c *testCase) testClientStreamingOK(t *testing.T, client echo.EchoClient) {
 	}
 
 	assert.NoError(t, stream.Send(&echo.EchoRequest{Message: "HEADERS"}))
-	if c.expectClientStreamOK {
+	// Over HTTP/1, the response (including headers) is only sent after the client has finished sending.
+	if c.expectClientStreamOK && !c.isHalfDuplex() {
 		_, err := stream.Header()
 		assert.NoError(t, err)
 	}
@@ -801,8 +898,9 @@ func (c *testCase) testBidiStreamingMessageError(t *testing.T, client echo.EchoC
 }
 
 type testConfig struct {
-	grpcSrv *grpc.Server
-	httpSrv *http.Server
+	grpcSrv  *grpc.Server
+	httpSrvs []*http.Server
+	handlers []*server.DowngradingHandler
 
 	targetAddrs map[string]string
 }
@@ -816,24 +914,29 @@ func newTestConfig(t *testing.T, preferGRPCWeb bool) *testConfig {
 	go grpcSrv.Serve(lis)
 	targetAddrs["raw-grpc"] = lis.Addr().String()
 
-	opts := []server.Option{server.PreferGRPCWeb(preferGRPCWeb)}
+	cfg := &testConfig{
+		grpcSrv:     grpcSrv,
+		targetAddrs: targetAddrs,
+	}
+
+	cfg.addDowngradingTarget(t, "downgrading-grpc", server.PreferGRPCWeb(preferGRPCWeb))
+	cfg.addDowngradingTarget(t, "downgrading-grpc-ws-compression", server.PreferGRPCWeb(preferGRPCWeb), server.WebSocketCompression(true))
 
+	return cfg
+}
+
+func (s *testConfig) addDowngradingTarget(t *testing.T, targetID string, opts ...server.Option) {
 	downgradingSrv := &http.Server{}
 	var h2Srv http2.Server
 	require.NoError(t, http2.ConfigureServer(downgradingSrv, &h2Srv))
-	downgradingSrv.Handler = h2c.NewHandler(
-		server.CreateDowngradingHandler(grpcSrv, http.NotFoundHandler(), opts...),
-		&h2Srv)
+	handler := server.NewDowngradingHandler(s.grpcSrv, http.NotFoundHandler(), opts...)
+	downgradingSrv.Handler = h2c.NewHandler(handler, &h2Srv)
 
-	lis = listenLocal(t)
+	lis := listenLocal(t)
 	go downgradingSrv.Serve(lis)
-	targetAddrs["downgrading-grpc"] = lis.Addr().String()
-
-	return &testConfig{
-		grpcSrv:     grpcSrv,
-		httpSrv:     downgradingSrv,
-		targetAddrs: targetAddrs,
-	}
+	s.targetAddrs[targetID] = lis.Addr().String()
+	s.httpSrvs = append(s.httpSrvs, downgradingSrv)
+	s.handlers = append(s.handlers, handler)
 }
 
 func (s *testConfig) TargetAddr(t *testing.T, targetID string) string {
@@ -843,6 +946,18 @@ func (s *testConfig) TargetAddr(t *testing.T, targetID string) string {
 }
 
 func (s *testConfig) TearDown() {
+	// The gRPC server panics when gracefully stopping while streams served through a downgrading handler are still
+	// active (e.g., after the client aborted them), hence drain the handlers first.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, handler := range s.handlers {
+		if err := handler.Drain(ctx); err != nil {
+			s.grpcSrv.Stop()
+			break
+		}
+	}
 	s.grpcSrv.GracefulStop()
-	s.httpSrv.Shutdown(context.Background())
+	for _, httpSrv := range s.httpSrvs {
+		_ = httpSrv.Shutdown(context.Background())
+	}
 }
@@ -0,0 +1,78 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestFailoverEndpoints(t *testing.T) {
+	grpcSrv := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcSrv, health.NewServer())
+	defer grpcSrv.Stop()
+
+	httpSrv := httptest.NewUnstartedServer(server.CreateDowngradingHandler(grpcSrv, http.NotFoundHandler()))
+	httpSrv.EnableHTTP2 = true
+	httpSrv.StartTLS()
+	defer httpSrv.Close()
+
+	// Obtain an address nothing listens on.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	deadEndpoint := lis.Addr().String()
+	require.NoError(t, lis.Close())
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(httpSrv.Certificate())
+	tlsConf := &tls.Config{RootCAs: rootCAs, ServerName: "example.com"}
+
+	cases := map[string][]client.ConnectOption{
+		"adaptive":  nil,
+		"downgrade": {client.ForceDowngrade(true)},
+		"websocket": {client.UseWebSocket(true)},
+	}
+	for name, opts := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			opts := append([]client.ConnectOption{
+				client.WithFailoverEndpoints(httpSrv.Listener.Addr().String()),
+			}, opts...)
+			cc, err := client.ConnectViaProxy(ctx, deadEndpoint, tlsConf, opts...)
+			require.NoError(t, err)
+			defer func() { _ = cc.Close() }()
+
+			resp, err := healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{})
+			require.NoError(t, err)
+			assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+		})
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/server"
+	"golang.stackrox.io/grpc-http1/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func upload(ctx context.Context, cc *grpc.ClientConn, numChunks, chunkSize int) (int64, error) {
+	stream, err := cc.NewStream(ctx, &uploadServiceDesc.Streams[0], uploadMethod)
+	if err != nil {
+		return 0, err
+	}
+	chunk := wrapperspb.Bytes(make([]byte, chunkSize))
+	for i := 0; i < numChunks; i++ {
+		if err := stream.SendMsg(chunk); err != nil {
+			// The actual error is returned when receiving the response.
+			break
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return 0, err
+	}
+	var resp wrapperspb.Int64Value
+	if err := stream.RecvMsg(&resp); err != nil {
+		return 0, err
+	}
+	return resp.GetValue(), nil
+}
+
+func TestFrameRateLimit(t *testing.T) {
+	cases := map[string][]client.ConnectOption{
+		"downgraded": {client.ForceDowngrade(true)},
+		"websocket":  {client.UseWebSocket(true)},
+	}
+
+	for name, clientOpts := range cases {
+		t.Run(name, func(t *testing.T) {
+			cc, _ := testutil.NewDowngradedServer(t,
+				func(s *grpc.Server) { s.RegisterService(&uploadServiceDesc, struct{}{}) },
+				testutil.WithServerOptions(server.WithFrameRateLimit(10, 50)),
+				testutil.WithClientOptions(clientOpts...))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			// Large messages stay within the limit.
+			numBytes, err := upload(ctx, cc, 20, 1<<20)
+			require.NoError(t, err)
+			assert.EqualValues(t, 20<<20, numBytes)
+
+			// A flood of tiny messages does not.
+			_, err = upload(ctx, cc, 1000, 1)
+			assert.Equal(t, codes.ResourceExhausted, status.Code(err), "unexpected error: %v", err)
+		})
+	}
+}
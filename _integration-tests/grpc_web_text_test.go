@@ -0,0 +1,76 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/internal/grpcweb"
+	"google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/protobuf/proto"
+)
+
+func grpcWebFrame(flags byte, payload []byte) []byte {
+	frame := make([]byte, 5, 5+len(payload))
+	frame[0] = flags
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	return append(frame, payload...)
+}
+
+func TestGRPCWebText(t *testing.T) {
+	testCfg := newTestConfig(t, false)
+	defer testCfg.TearDown()
+
+	reqMsg, err := proto.Marshal(&echo.EchoRequest{Message: "Hello, text!"})
+	require.NoError(t, err)
+	body := base64.StdEncoding.EncodeToString(grpcWebFrame(0, reqMsg))
+
+	url := "http://" + testCfg.TargetAddr(t, "downgrading-grpc") + "/grpc.examples.echo.Echo/UnaryEcho"
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/grpc-web-text")
+	req.Header.Set("Accept", "application/grpc-web-text")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/grpc-web-text", resp.Header.Get("Content-Type"))
+
+	// The response may consist of several individually padded base64 chunks.
+	respData, err := io.ReadAll(grpcweb.NewTextReader(resp.Body))
+	require.NoError(t, err)
+
+	require.GreaterOrEqual(t, len(respData), 5)
+	require.Zero(t, respData[0])
+	msgLen := binary.BigEndian.Uint32(respData[1:5])
+	var respMsg echo.EchoResponse
+	require.NoError(t, proto.Unmarshal(respData[5:5+msgLen], &respMsg))
+	assert.Equal(t, "Hello, text!", respMsg.GetMessage())
+
+	trailerFrame := respData[5+msgLen:]
+	require.GreaterOrEqual(t, len(trailerFrame), 5)
+	assert.Equal(t, byte(0x80), trailerFrame[0])
+	assert.True(t, bytes.Contains(trailerFrame[5:], []byte("Grpc-Status: 0")))
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/server"
+	"golang.stackrox.io/grpc-http1/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestHTTPTrailers(t *testing.T) {
+	cases := map[string][]client.ConnectOption{
+		"downgraded": {client.ForceDowngrade(true)},
+		"grpc-web":   {client.UseGRPCWeb()},
+	}
+
+	for name, clientOpts := range cases {
+		t.Run(name, func(t *testing.T) {
+			cc, _ := testutil.NewDowngradedServer(t,
+				func(s *grpc.Server) { echo.RegisterEchoServer(s, echoService{}) },
+				testutil.WithServerOptions(server.WithHTTPTrailers()),
+				testutil.WithClientOptions(clientOpts...))
+			echoClient := echo.NewEchoClient(cc)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			ctx = metadata.AppendToOutgoingContext(ctx, "trailer-echo", "value")
+
+			var trailers metadata.MD
+			resp, err := echoClient.UnaryEcho(ctx, &echo.EchoRequest{Message: "hello"}, grpc.Trailer(&trailers))
+			require.NoError(t, err)
+			assert.Equal(t, "hello", resp.GetMessage())
+			assert.Equal(t, []string{"value"}, trailers.Get("trailer-echo-response"))
+
+			stream, err := echoClient.ServerStreamingEcho(ctx, &echo.EchoRequest{Message: "first\nsecond\nERROR:failed"})
+			require.NoError(t, err)
+			for _, expected := range []string{"first", "second"} {
+				resp, err := stream.Recv()
+				require.NoError(t, err)
+				assert.Equal(t, expected, resp.GetMessage())
+			}
+			_, err = stream.Recv()
+			require.NotEqual(t, io.EOF, err)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+			assert.Equal(t, "failed", status.Convert(err).Message())
+			assert.Equal(t, []string{"value"}, stream.Trailer().Get("trailer-echo-response"))
+		})
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"nhooyr.io/websocket"
+)
+
+func TestKeepAlive(t *testing.T) {
+	const numCalls = 100
+
+	grpcSrv := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcSrv, health.NewServer())
+	defer grpcSrv.Stop()
+
+	var numConns int32
+	httpSrv := httptest.NewUnstartedServer(server.CreateDowngradingHandler(grpcSrv, http.NotFoundHandler()))
+	httpSrv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&numConns, 1)
+		}
+	}
+	httpSrv.Start()
+	defer httpSrv.Close()
+
+	cases := map[bool]int32{
+		true:  1,
+		false: numCalls,
+	}
+	for keepAlive, expectedConns := range cases {
+		atomic.StoreInt32(&numConns, 0)
+		cc, err := client.ConnectViaProxy(context.Background(), httpSrv.Listener.Addr().String(), nil,
+			client.ForceDowngrade(true),
+			client.WithKeepAlive(keepAlive),
+			client.DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())))
+		require.NoError(t, err)
+
+		healthClient := healthpb.NewHealthClient(cc)
+		for i := 0; i < numCalls; i++ {
+			resp, err := healthClient.Check(context.Background(), &healthpb.HealthCheckRequest{})
+			require.NoError(t, err)
+			assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+		}
+		assert.Equalf(t, expectedConns, atomic.LoadInt32(&numConns), "unexpected number of connections with keep-alive %v", keepAlive)
+		require.NoError(t, cc.Close())
+	}
+}
+
+func TestConnectionClose(t *testing.T) {
+	const numCalls = 10
+
+	grpcSrv := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcSrv, health.NewServer())
+	defer grpcSrv.Stop()
+
+	var numConns, numCloseRequests int32
+	downgradingHandler := server.CreateDowngradingHandler(grpcSrv, http.NotFoundHandler())
+	httpSrv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// The HTTP server sets Close for requests with a `Connection: close` header.
+		if req.Close {
+			atomic.AddInt32(&numCloseRequests, 1)
+		}
+		downgradingHandler.ServeHTTP(w, req)
+	}))
+	httpSrv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&numConns, 1)
+		}
+	}
+	httpSrv.Start()
+	defer httpSrv.Close()
+
+	cc, err := client.ConnectViaProxy(context.Background(), httpSrv.Listener.Addr().String(), nil,
+		client.ForceDowngrade(true),
+		client.WithConnectionClose(),
+		client.DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())))
+	require.NoError(t, err)
+	defer func() { _ = cc.Close() }()
+
+	healthClient := healthpb.NewHealthClient(cc)
+	for i := 0; i < numCalls; i++ {
+		_, err := healthClient.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+	}
+	assert.EqualValues(t, numCalls, atomic.LoadInt32(&numCloseRequests))
+	assert.EqualValues(t, numCalls, atomic.LoadInt32(&numConns))
+}
+
+func TestWebSocketKeepalive_UnansweredPings(t *testing.T) {
+	// Simulate a peer that accepts the WebSocket connection, but never reads from it, and hence never answers pings.
+	done := make(chan struct{})
+	httpSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := websocket.Accept(w, req, nil)
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close(websocket.StatusGoingAway, "") }()
+		<-done
+	}))
+	defer httpSrv.Close()
+	defer close(done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cc, err := client.ConnectViaProxy(ctx, httpSrv.Listener.Addr().String(), nil,
+		client.UseWebSocket(true),
+		client.WebSocketKeepalive(50*time.Millisecond, 100*time.Millisecond),
+		client.DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())))
+	require.NoError(t, err)
+	defer func() { _ = cc.Close() }()
+
+	start := time.Now()
+	_, err = healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err), "unexpected error: %v", err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/status"
+)
+
+func TestMaxFrameSize(t *testing.T) {
+	testCfg := newTestConfig(t, false)
+	defer testCfg.TearDown()
+	testCfg.addDowngradingTarget(t, "downgrading-grpc-small-frames", server.WithMaxFrameSize(1024))
+
+	smallMsg := "hello"
+	largeMsg := strings.Repeat("x", 2048)
+
+	cases := map[string]struct {
+		targetID string
+		opts     []client.ConnectOption
+	}{
+		"server limit over websocket": {
+			targetID: "downgrading-grpc-small-frames",
+			opts:     []client.ConnectOption{client.UseWebSocket(true)},
+		},
+		"client limit over websocket": {
+			targetID: "downgrading-grpc",
+			opts:     []client.ConnectOption{client.UseWebSocket(true), client.WithMaxFrameSize(1024)},
+		},
+		"client limit over downgraded http": {
+			targetID: "downgrading-grpc",
+			opts:     []client.ConnectOption{client.ForceDowngrade(true), client.WithMaxFrameSize(1024)},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			opts := append([]client.ConnectOption{
+				client.DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())),
+			}, c.opts...)
+			cc, err := client.ConnectViaProxy(ctx, testCfg.TargetAddr(t, c.targetID), nil, opts...)
+			require.NoError(t, err)
+			defer func() { _ = cc.Close() }()
+
+			echoClient := echo.NewEchoClient(cc)
+
+			resp, err := echoClient.UnaryEcho(ctx, &echo.EchoRequest{Message: smallMsg})
+			require.NoError(t, err)
+			assert.Equal(t, smallMsg, resp.GetMessage())
+
+			_, err = echoClient.UnaryEcho(ctx, &echo.EchoRequest{Message: largeMsg})
+			assert.Equal(t, codes.ResourceExhausted, status.Code(err), "unexpected error: %v", err)
+		})
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/status"
+)
+
+func TestMaxResponseBytes(t *testing.T) {
+	cases := map[string][]client.ConnectOption{
+		"downgraded": {client.ForceDowngrade(true)},
+		"grpc-web":   {client.UseGRPCWeb()},
+		"websocket":  {client.UseWebSocket(true)},
+	}
+
+	for name, opts := range cases {
+		t.Run(name, func(t *testing.T) {
+			cc, _ := testutil.NewDowngradedServer(t,
+				func(s *grpc.Server) { echo.RegisterEchoServer(s, echoService{}) },
+				testutil.WithClientOptions(append(opts, client.WithMaxResponseBytes(4096))...))
+			echoClient := echo.NewEchoClient(cc)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			resp, err := echoClient.UnaryEcho(ctx, &echo.EchoRequest{Message: "hello"})
+			require.NoError(t, err)
+			assert.Equal(t, "hello", resp.GetMessage())
+
+			_, err = echoClient.UnaryEcho(ctx, &echo.EchoRequest{Message: strings.Repeat("x", 8192)})
+			assert.Equal(t, codes.ResourceExhausted, status.Code(err), "unexpected error: %v", err)
+
+			// No single message exceeds the limit, but all of them together do.
+			line := strings.Repeat("x", 1024)
+			stream, err := echoClient.ServerStreamingEcho(ctx, &echo.EchoRequest{Message: strings.Repeat(line+"\n", 7) + line})
+			require.NoError(t, err)
+			for {
+				_, err = stream.Recv()
+				if err != nil {
+					break
+				}
+			}
+			require.NotEqual(t, io.EOF, err)
+			assert.Equal(t, codes.ResourceExhausted, status.Code(err), "unexpected error: %v", err)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/server"
+	"golang.stackrox.io/grpc-http1/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestMaxMetadataBytes(t *testing.T) {
+	cases := map[string]struct {
+		opts         []testutil.Option
+		expectedCode codes.Code
+	}{
+		"client limit": {
+			opts:         []testutil.Option{testutil.WithClientOptions(client.WithMaxMetadataBytes(4096))},
+			expectedCode: codes.InvalidArgument,
+		},
+		"server limit": {
+			opts:         []testutil.Option{testutil.WithServerOptions(server.WithMaxMetadataBytes(4096))},
+			expectedCode: codes.ResourceExhausted,
+		},
+		"server limit over websocket": {
+			opts: []testutil.Option{
+				testutil.WithServerOptions(server.WithMaxMetadataBytes(4096)),
+				testutil.WithClientOptions(client.UseWebSocket(true)),
+			},
+			// The WebSocket handshake is rejected with `431 Request Header Fields Too Large`, which has no
+			// counterpart in the HTTP to gRPC status mapping.
+			expectedCode: codes.Unknown,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			cc, _ := testutil.NewDowngradedServer(t,
+				func(s *grpc.Server) { echo.RegisterEchoServer(s, echoService{}) },
+				c.opts...)
+			echoClient := echo.NewEchoClient(cc)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			smallCtx := metadata.AppendToOutgoingContext(ctx, "x-small", "value")
+			_, err := echoClient.UnaryEcho(smallCtx, &echo.EchoRequest{Message: "hello"})
+			require.NoError(t, err)
+
+			largeCtx := metadata.AppendToOutgoingContext(ctx, "x-large", strings.Repeat("a", 8192))
+			_, err = echoClient.UnaryEcho(largeCtx, &echo.EchoRequest{Message: "hello"})
+			require.Error(t, err)
+			assert.Equal(t, c.expectedCode, status.Code(err))
+			assert.Contains(t, status.Convert(err).Message(), "exceeds the limit of 4096 bytes")
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/metadata"
+)
+
+// bearerToken are per-RPC credentials adding an `authorization` header.
+type bearerToken string
+
+func (t bearerToken) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (bearerToken) RequireTransportSecurity() bool {
+	return false
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	// Binary values may contain arbitrary bytes, which are only transmittable via base64 encoding.
+	binValue := string([]byte{0x00, 0xff, 0x0a, 0x0d, 'a', ':', 0x80})
+
+	cases := map[string][]client.ConnectOption{
+		"downgraded": {client.ForceDowngrade(true)},
+		"grpc-web":   {client.UseGRPCWeb()},
+		"websocket":  {client.UseWebSocket(true)},
+	}
+
+	for name, extraOpts := range cases {
+		t.Run(name, func(t *testing.T) {
+			incomingMDs := make(chan metadata.MD, 1)
+			interceptor := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				md, _ := metadata.FromIncomingContext(ctx)
+				incomingMDs <- md
+				if err := grpc.SetHeader(ctx, metadata.Pairs("header-bin", binValue)); err != nil {
+					return nil, err
+				}
+				if err := grpc.SetTrailer(ctx, metadata.Pairs("trailer-bin", binValue)); err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			}
+
+			opts := append([]client.ConnectOption{
+				client.DialOpts(grpc.WithPerRPCCredentials(bearerToken("s3cr3t"))),
+			}, extraOpts...)
+			cc, _ := testutil.NewDowngradedServer(t,
+				func(s *grpc.Server) { echo.RegisterEchoServer(s, echoService{}) },
+				testutil.WithGRPCServerOptions(grpc.UnaryInterceptor(interceptor)),
+				testutil.WithClientOptions(opts...))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			ctx = metadata.AppendToOutgoingContext(ctx,
+				"custom-key", "value1",
+				"custom-key", "value2",
+				"custom-bin", binValue,
+			)
+
+			var header, trailer metadata.MD
+			resp, err := echo.NewEchoClient(cc).UnaryEcho(ctx, &echo.EchoRequest{Message: "hello"},
+				grpc.Header(&header), grpc.Trailer(&trailer))
+			require.NoError(t, err)
+			assert.Equal(t, "hello", resp.GetMessage())
+
+			incomingMD := <-incomingMDs
+			assert.Equal(t, []string{"Bearer s3cr3t"}, incomingMD.Get("authorization"))
+			assert.Equal(t, []string{"value1", "value2"}, incomingMD.Get("custom-key"))
+			assert.Equal(t, []string{binValue}, incomingMD.Get("custom-bin"))
+
+			assert.Equal(t, []string{binValue}, header.Get("header-bin"))
+			assert.Equal(t, []string{binValue}, trailer.Get("trailer-bin"))
+		})
+	}
+}
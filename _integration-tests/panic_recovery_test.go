@@ -0,0 +1,92 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/status"
+)
+
+// panickingEchoService panics in every method it implements.
+type panickingEchoService struct {
+	echo.UnimplementedEchoServer
+}
+
+func (panickingEchoService) UnaryEcho(context.Context, *echo.EchoRequest) (*echo.EchoResponse, error) {
+	panic("unary echo failed")
+}
+
+func (panickingEchoService) ServerStreamingEcho(_ *echo.EchoRequest, stream echo.Echo_ServerStreamingEchoServer) error {
+	if err := stream.Send(&echo.EchoResponse{Message: "first"}); err != nil {
+		return err
+	}
+	panic("server streaming echo failed")
+}
+
+func TestPanicRecovery(t *testing.T) {
+	grpcSrv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(server.UnaryRecoveryInterceptor(nil)),
+		grpc.ChainStreamInterceptor(server.StreamRecoveryInterceptor(nil)),
+	)
+	echo.RegisterEchoServer(grpcSrv, panickingEchoService{})
+	defer grpcSrv.Stop()
+
+	httpSrv := httptest.NewServer(server.CreateDowngradingHandler(grpcSrv, http.NotFoundHandler()))
+	defer httpSrv.Close()
+
+	transports := map[string]client.ConnectOption{
+		"websocket": client.UseWebSocket(true),
+		"downgrade": client.ForceDowngrade(true),
+	}
+	for name, transportOpt := range transports {
+		transportOpt := transportOpt
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			cc, err := client.ConnectViaProxy(ctx, httpSrv.Listener.Addr().String(), nil,
+				client.DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())), transportOpt)
+			require.NoError(t, err)
+			defer func() { _ = cc.Close() }()
+			echoClient := echo.NewEchoClient(cc)
+
+			_, err = echoClient.UnaryEcho(ctx, &echo.EchoRequest{Message: "hello"})
+			assert.Equal(t, codes.Internal, status.Code(err), "unexpected error: %v", err)
+
+			// The panic occurs after the response header and a message have been sent, hence the status must be
+			// conveyed in a trailer frame.
+			stream, err := echoClient.ServerStreamingEcho(ctx, &echo.EchoRequest{Message: "hello"})
+			require.NoError(t, err)
+			resp, err := stream.Recv()
+			require.NoError(t, err)
+			assert.Equal(t, "first", resp.GetMessage())
+			_, err = stream.Recv()
+			assert.Equal(t, codes.Internal, status.Code(err), "unexpected error: %v", err)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/examples/features/proto/echo"
+)
+
+func TestPathRewriter(t *testing.T) {
+	testCfg := newTestConfig(t, false)
+	defer testCfg.TearDown()
+	testCfg.addDowngradingTarget(t, "downgrading-grpc-method-header", server.WithMethodHeader())
+
+	// Simulate a router that only forwards requests to a fixed path.
+	routerAddr := testCfg.TargetAddr(t, "downgrading-grpc-method-header")
+	router := newHTTP1Proxy(routerAddr)
+	routerHandler := router.Handler
+	router.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/tunnel" {
+			http.NotFound(w, req)
+			return
+		}
+		routerHandler.ServeHTTP(w, req)
+	})
+	lis := listenLocal(t)
+	go func() { _ = router.Serve(lis) }()
+	defer func() { _ = router.Close() }()
+
+	var rewrittenMethods []string
+	rewriter := func(method string) string {
+		rewrittenMethods = append(rewrittenMethods, method)
+		return "/tunnel"
+	}
+
+	cases := map[string][]client.ConnectOption{
+		"downgraded": {client.ForceDowngrade(true)},
+		"websocket":  {client.UseWebSocket(true)},
+	}
+
+	for name, extraOpts := range cases {
+		t.Run(name, func(t *testing.T) {
+			rewrittenMethods = nil
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			opts := append([]client.ConnectOption{
+				client.DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())),
+				client.WithPathRewriter(rewriter),
+			}, extraOpts...)
+			cc, err := client.ConnectViaProxy(ctx, lis.Addr().String(), nil, opts...)
+			require.NoError(t, err)
+			defer func() { _ = cc.Close() }()
+
+			resp, err := echo.NewEchoClient(cc).UnaryEcho(ctx, &echo.EchoRequest{Message: "hello"})
+			require.NoError(t, err)
+			assert.Equal(t, "hello", resp.GetMessage())
+			assert.Equal(t, []string{"/grpc.examples.echo.Echo/UnaryEcho"}, rewrittenMethods)
+		})
+	}
+
+	// Without the rewriter, the router rejects the request.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cc, err := client.ConnectViaProxy(ctx, lis.Addr().String(), nil,
+		client.DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())), client.ForceDowngrade(true))
+	require.NoError(t, err)
+	defer func() { _ = cc.Close() }()
+	_, err = echo.NewEchoClient(cc).UnaryEcho(ctx, &echo.EchoRequest{Message: "hello"})
+	assert.ErrorContains(t, err, "404 Not Found")
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestRoundTripInterceptor(t *testing.T) {
+	cases := map[string]struct {
+		opts               []client.ConnectOption
+		expectedStatusCode int
+	}{
+		"downgraded": {
+			opts:               []client.ConnectOption{client.ForceDowngrade(true)},
+			expectedStatusCode: http.StatusOK,
+		},
+		"websocket": {
+			opts:               []client.ConnectOption{client.UseWebSocket(true)},
+			expectedStatusCode: http.StatusSwitchingProtocols,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			var mutex sync.Mutex
+			var paths []string
+			var statusCodes []int
+			onRequest := func(req *http.Request) *http.Request {
+				mutex.Lock()
+				defer mutex.Unlock()
+				paths = append(paths, req.URL.Path)
+				req = req.Clone(req.Context())
+				req.Header.Set("Header-Echo", "intercepted")
+				return req
+			}
+			onResponse := func(resp *http.Response) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				statusCodes = append(statusCodes, resp.StatusCode)
+			}
+
+			cc, _ := testutil.NewDowngradedServer(t,
+				func(s *grpc.Server) { echo.RegisterEchoServer(s, echoService{}) },
+				testutil.WithClientOptions(append(c.opts, client.WithRoundTripInterceptor(onRequest, onResponse))...))
+			echoClient := echo.NewEchoClient(cc)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			var hdr metadata.MD
+			resp, err := echoClient.UnaryEcho(ctx, &echo.EchoRequest{Message: "hello"}, grpc.Header(&hdr))
+			require.NoError(t, err)
+			assert.Equal(t, "hello", resp.GetMessage())
+			// The header added by the interceptor reaches the server.
+			assert.Equal(t, []string{"intercepted"}, hdr.Get("header-echo-response"))
+
+			stream, err := echoClient.ServerStreamingEcho(ctx, &echo.EchoRequest{Message: "hello"})
+			require.NoError(t, err)
+			resp, err = stream.Recv()
+			require.NoError(t, err)
+			assert.Equal(t, "hello", resp.GetMessage())
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			assert.Equal(t, []string{"/grpc.examples.echo.Echo/UnaryEcho", "/grpc.examples.echo.Echo/ServerStreamingEcho"}, paths)
+			assert.Equal(t, []int{c.expectedStatusCode, c.expectedStatusCode}, statusCodes)
+		})
+	}
+}
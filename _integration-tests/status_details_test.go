@@ -0,0 +1,123 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/testutil"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// richErrorService fails every call with the given status. Server-streaming calls send a message before failing,
+// such that the status is not transmitted in a Trailers-Only response.
+type richErrorService struct {
+	echo.UnimplementedEchoServer
+	st *status.Status
+}
+
+func richStatus(t *testing.T) *status.Status {
+	st, err := status.New(codes.FailedPrecondition, "quota exceeded").WithDetails(
+		&errdetails.ErrorInfo{
+			Reason:   "QUOTA_EXCEEDED",
+			Domain:   "example.com",
+			Metadata: map[string]string{"limit": "100"},
+		},
+		&errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{
+				{Field: "message", Description: "must not be empty"},
+			},
+		},
+	)
+	require.NoError(t, err)
+	return st
+}
+
+func (s richErrorService) UnaryEcho(context.Context, *echo.EchoRequest) (*echo.EchoResponse, error) {
+	return nil, s.st.Err()
+}
+
+func (s richErrorService) ServerStreamingEcho(req *echo.EchoRequest, server echo.Echo_ServerStreamingEchoServer) error {
+	if err := server.Send(&echo.EchoResponse{Message: req.GetMessage()}); err != nil {
+		return err
+	}
+	return s.st.Err()
+}
+
+func TestStatusDetailsRoundTrip(t *testing.T) {
+	expected := richStatus(t)
+
+	cases := map[string][]client.ConnectOption{
+		"downgraded": {client.ForceDowngrade(true)},
+		"grpc-web":   {client.UseGRPCWeb()},
+		"websocket":  {client.UseWebSocket(true)},
+	}
+
+	for name, clientOpts := range cases {
+		t.Run(name, func(t *testing.T) {
+			cc, _ := testutil.NewDowngradedServer(t,
+				func(s *grpc.Server) { echo.RegisterEchoServer(s, richErrorService{st: expected}) },
+				testutil.WithClientOptions(clientOpts...))
+			echoClient := echo.NewEchoClient(cc)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			_, err := echoClient.UnaryEcho(ctx, &echo.EchoRequest{Message: "hello"})
+			assertStatusDetails(t, expected, err)
+
+			stream, err := echoClient.ServerStreamingEcho(ctx, &echo.EchoRequest{Message: "hello"})
+			require.NoError(t, err)
+			resp, err := stream.Recv()
+			require.NoError(t, err)
+			assert.Equal(t, "hello", resp.GetMessage())
+			_, err = stream.Recv()
+			assertStatusDetails(t, expected, err)
+		})
+	}
+}
+
+func assertStatusDetails(t *testing.T, expected *status.Status, err error) {
+	st, ok := status.FromError(err)
+	require.Truef(t, ok, "not a status error: %v", err)
+	assert.Equal(t, expected.Code(), st.Code())
+	assert.Equal(t, expected.Message(), st.Message())
+	assert.True(t, proto.Equal(expected.Proto(), st.Proto()), "expected %v, got %v", expected.Proto(), st.Proto())
+
+	var errorInfo *errdetails.ErrorInfo
+	var badRequest *errdetails.BadRequest
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			errorInfo = d
+		case *errdetails.BadRequest:
+			badRequest = d
+		}
+	}
+	require.NotNil(t, errorInfo)
+	assert.Equal(t, "QUOTA_EXCEEDED", errorInfo.GetReason())
+	require.NotNil(t, badRequest)
+	assert.Equal(t, "message", badRequest.GetFieldViolations()[0].GetField())
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	numBeforeIdle     = 5
+	idleTestInterval  = 50 * time.Millisecond
+	streamIdleTimeout = 300 * time.Millisecond
+)
+
+// stallingEchoService streams a few messages and then stalls until the stream is aborted.
+type stallingEchoService struct {
+	echo.UnimplementedEchoServer
+}
+
+func (stallingEchoService) ServerStreamingEcho(req *echo.EchoRequest, stream echo.Echo_ServerStreamingEchoServer) error {
+	for i := 0; i < numBeforeIdle; i++ {
+		if err := stream.Send(&echo.EchoResponse{Message: req.GetMessage()}); err != nil {
+			return err
+		}
+		time.Sleep(idleTestInterval)
+	}
+	<-stream.Context().Done()
+	return status.FromContextError(stream.Context().Err()).Err()
+}
+
+// UnaryEcho takes longer than the idle timeout to respond.
+func (stallingEchoService) UnaryEcho(_ context.Context, req *echo.EchoRequest) (*echo.EchoResponse, error) {
+	time.Sleep(2 * streamIdleTimeout)
+	return &echo.EchoResponse{Message: req.GetMessage()}, nil
+}
+
+var (
+	streamIdleTimeoutCases = map[string]struct {
+		serverOpts []server.Option
+		clientOpts []client.ConnectOption
+	}{
+		"client timeout": {
+			clientOpts: []client.ConnectOption{client.WithStreamIdleTimeout(streamIdleTimeout)},
+		},
+		"server timeout": {
+			serverOpts: []server.Option{server.WithStreamIdleTimeout(streamIdleTimeout)},
+		},
+	}
+	streamIdleTimeoutTransports = map[string]client.ConnectOption{
+		"websocket": client.UseWebSocket(true),
+		"downgrade": client.ForceDowngrade(true),
+	}
+)
+
+func TestStreamIdleTimeout(t *testing.T) {
+	grpcSrv := grpc.NewServer()
+	echo.RegisterEchoServer(grpcSrv, stallingEchoService{})
+	defer grpcSrv.Stop()
+
+	for name, c := range streamIdleTimeoutCases {
+		for transportName, transportOpt := range streamIdleTimeoutTransports {
+			c, transportOpt := c, transportOpt
+			t.Run(name+"/"+transportName, func(t *testing.T) {
+				httpSrv := httptest.NewServer(server.CreateDowngradingHandler(grpcSrv, http.NotFoundHandler(), c.serverOpts...))
+				defer httpSrv.Close()
+
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+
+				opts := append([]client.ConnectOption{
+					client.DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())),
+					transportOpt,
+				}, c.clientOpts...)
+				cc, err := client.ConnectViaProxy(ctx, httpSrv.Listener.Addr().String(), nil, opts...)
+				require.NoError(t, err)
+				defer func() { _ = cc.Close() }()
+
+				stream, err := echo.NewEchoClient(cc).ServerStreamingEcho(ctx, &echo.EchoRequest{Message: "hello"})
+				require.NoError(t, err)
+
+				// Messages sent at intervals shorter than the idle timeout keep the stream alive.
+				for i := 0; i < numBeforeIdle; i++ {
+					resp, err := stream.Recv()
+					require.NoError(t, err)
+					assert.Equal(t, "hello", resp.GetMessage())
+				}
+
+				start := time.Now()
+				_, err = stream.Recv()
+				assert.Equal(t, codes.DeadlineExceeded, status.Code(err), "unexpected error: %v", err)
+				assert.Contains(t, status.Convert(err).Message(), "stream idle")
+				assert.Less(t, time.Since(start), 5*time.Second)
+			})
+		}
+	}
+}
+
+func TestStreamIdleTimeout_SlowUnaryCall(t *testing.T) {
+	grpcSrv := grpc.NewServer()
+	echo.RegisterEchoServer(grpcSrv, stallingEchoService{})
+	defer grpcSrv.Stop()
+
+	for name, c := range streamIdleTimeoutCases {
+		for transportName, transportOpt := range streamIdleTimeoutTransports {
+			c, transportOpt := c, transportOpt
+			t.Run(name+"/"+transportName, func(t *testing.T) {
+				httpSrv := httptest.NewServer(server.CreateDowngradingHandler(grpcSrv, http.NotFoundHandler(), c.serverOpts...))
+				defer httpSrv.Close()
+
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+
+				opts := append([]client.ConnectOption{
+					client.DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())),
+					transportOpt,
+				}, c.clientOpts...)
+				cc, err := client.ConnectViaProxy(ctx, httpSrv.Listener.Addr().String(), nil, opts...)
+				require.NoError(t, err)
+				defer func() { _ = cc.Close() }()
+
+				// Unary calls are not aborted while waiting for the response.
+				resp, err := echo.NewEchoClient(cc).UnaryEcho(ctx, &echo.EchoRequest{Message: "hello"})
+				require.NoError(t, err)
+				assert.Equal(t, "hello", resp.GetMessage())
+			})
+		}
+	}
+}
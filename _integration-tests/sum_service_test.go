@@ -0,0 +1,131 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	sumMethod = "/sum.Sum/Sum"
+)
+
+// sumServiceDesc describes a client-streaming service that responds with the sum of all received numbers.
+var sumServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sum.Sum",
+	HandlerType: (*interface{})(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Sum",
+			Handler:       sumHandler,
+			ClientStreams: true,
+		},
+	},
+}
+
+func sumHandler(_ interface{}, stream grpc.ServerStream) error {
+	var sum int64
+	for {
+		var n wrapperspb.Int64Value
+		if err := stream.RecvMsg(&n); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		sum += n.GetValue()
+	}
+	return stream.SendMsg(wrapperspb.Int64(sum))
+}
+
+func TestClientStreamingHalfClose(t *testing.T) {
+	grpcSrv := grpc.NewServer()
+	grpcSrv.RegisterService(&sumServiceDesc, struct{}{})
+	defer grpcSrv.Stop()
+
+	downgradingSrv := &http.Server{}
+	var h2Srv http2.Server
+	require.NoError(t, http2.ConfigureServer(downgradingSrv, &h2Srv))
+	downgradingSrv.Handler = h2c.NewHandler(server.CreateDowngradingHandler(grpcSrv, http.NotFoundHandler()), &h2Srv)
+	lis := listenLocal(t)
+	go downgradingSrv.Serve(lis)
+	defer downgradingSrv.Shutdown(context.Background())
+
+	revProxyLis := listenLocal(t)
+	revProxySrv := newHTTP1Proxy(lis.Addr().String())
+	go revProxySrv.Serve(revProxyLis)
+	defer revProxySrv.Shutdown(context.Background())
+
+	cases := map[string]struct {
+		targetAddr string
+		opts       []client.ConnectOption
+	}{
+		"websocket": {
+			targetAddr: revProxyLis.Addr().String(),
+			opts:       []client.ConnectOption{client.UseWebSocket(true)},
+		},
+		"forced-downgrade-http2": {
+			targetAddr: lis.Addr().String(),
+			opts:       []client.ConnectOption{client.ForceHTTP2(), client.ForceDowngrade(true)},
+		},
+		"forced-downgrade-http1": {
+			targetAddr: revProxyLis.Addr().String(),
+			opts:       []client.ConnectOption{client.ForceDowngrade(true)},
+		},
+		"http1": {
+			targetAddr: revProxyLis.Addr().String(),
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+
+			opts := append([]client.ConnectOption{client.DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials()))}, c.opts...)
+			cc, err := client.ConnectViaProxy(ctx, c.targetAddr, nil, opts...)
+			require.NoError(t, err)
+			defer func() { _ = cc.Close() }()
+
+			stream, err := cc.NewStream(ctx, &sumServiceDesc.Streams[0], sumMethod)
+			require.NoError(t, err)
+
+			var expectedSum int64
+			for i := int64(1); i <= 100; i++ {
+				require.NoError(t, stream.SendMsg(wrapperspb.Int64(i)))
+				expectedSum += i
+			}
+			require.NoError(t, stream.CloseSend())
+
+			var sum wrapperspb.Int64Value
+			require.NoError(t, stream.RecvMsg(&sum))
+			assert.Equal(t, expectedSum, sum.GetValue())
+		})
+	}
+}
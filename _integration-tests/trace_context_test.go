@@ -0,0 +1,87 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestTraceContextPropagation(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	// Multiple tracestate values must arrive as separate values, in order.
+	tracestate := []string{"congo=t61rcWkgMzE", "rojo=00f067aa0ba902b7,vendor=opaque-value"}
+
+	cases := map[string][]testutil.Option{
+		"native":     {testutil.WithTLS(), testutil.WithClientOptions(client.ForceDowngrade(false))},
+		"downgraded": {testutil.WithClientOptions(client.ForceDowngrade(true))},
+		"grpc-web":   {testutil.WithClientOptions(client.UseGRPCWeb())},
+		"websocket":  {testutil.WithClientOptions(client.UseWebSocket(true))},
+	}
+
+	for name, opts := range cases {
+		t.Run(name, func(t *testing.T) {
+			incomingMDs := make(chan metadata.MD, 2)
+			unaryInterceptor := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				md, _ := metadata.FromIncomingContext(ctx)
+				incomingMDs <- md
+				return handler(ctx, req)
+			}
+			streamInterceptor := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				md, _ := metadata.FromIncomingContext(ss.Context())
+				incomingMDs <- md
+				return handler(srv, ss)
+			}
+			opts := append([]testutil.Option{
+				testutil.WithGRPCServerOptions(grpc.UnaryInterceptor(unaryInterceptor), grpc.StreamInterceptor(streamInterceptor)),
+			}, opts...)
+			cc, _ := testutil.NewDowngradedServer(t,
+				func(s *grpc.Server) { echo.RegisterEchoServer(s, echoService{}) },
+				opts...)
+			echoClient := echo.NewEchoClient(cc)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			ctx = metadata.AppendToOutgoingContext(ctx,
+				"traceparent", traceparent,
+				"tracestate", tracestate[0],
+				"tracestate", tracestate[1],
+			)
+
+			_, err := echoClient.UnaryEcho(ctx, &echo.EchoRequest{Message: "hello"})
+			require.NoError(t, err)
+			md := <-incomingMDs
+			assert.Equal(t, []string{traceparent}, md.Get("traceparent"))
+			assert.Equal(t, tracestate, md.Get("tracestate"))
+
+			stream, err := echoClient.ServerStreamingEcho(ctx, &echo.EchoRequest{Message: "hello"})
+			require.NoError(t, err)
+			_, err = stream.Recv()
+			require.NoError(t, err)
+			md = <-incomingMDs
+			assert.Equal(t, []string{traceparent}, md.Get("traceparent"))
+			assert.Equal(t, tracestate, md.Get("tracestate"))
+		})
+	}
+}
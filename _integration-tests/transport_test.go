@@ -0,0 +1,83 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/server"
+	"golang.stackrox.io/grpc-http1/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/status"
+)
+
+// transportEchoService responds with the transport the downgrading handler received the call over.
+type transportEchoService struct {
+	echo.UnimplementedEchoServer
+}
+
+func (transportEchoService) UnaryEcho(ctx context.Context, _ *echo.EchoRequest) (*echo.EchoResponse, error) {
+	transport, ok := server.TransportFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Internal, "no transport in context")
+	}
+	return &echo.EchoResponse{Message: string(transport)}, nil
+}
+
+func TestTransportFromContext(t *testing.T) {
+	cases := map[string]struct {
+		opts              []testutil.Option
+		expectedTransport server.Transport
+	}{
+		"native": {
+			opts:              []testutil.Option{testutil.WithTLS(), testutil.WithClientOptions(client.ForceDowngrade(false))},
+			expectedTransport: server.TransportGRPC,
+		},
+		"downgraded": {
+			// Downgraded calls are gRPC requests sent over HTTP/1.1.
+			expectedTransport: server.TransportGRPC,
+		},
+		"grpc-web": {
+			opts:              []testutil.Option{testutil.WithClientOptions(client.UseGRPCWeb())},
+			expectedTransport: server.TransportGRPCWeb,
+		},
+		"websocket": {
+			opts:              []testutil.Option{testutil.WithClientOptions(client.UseWebSocket(true))},
+			expectedTransport: server.TransportGRPCWebSocket,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			cc, _ := testutil.NewDowngradedServer(t,
+				func(s *grpc.Server) { echo.RegisterEchoServer(s, transportEchoService{}) },
+				c.opts...)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			resp, err := echo.NewEchoClient(cc).UnaryEcho(ctx, &echo.EchoRequest{})
+			require.NoError(t, err)
+			assert.Equal(t, string(c.expectedTransport), resp.GetMessage())
+		})
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+)
+
+// countingEchoService counts the unary calls it receives.
+type countingEchoService struct {
+	echoService
+	calls int32
+}
+
+func (s *countingEchoService) UnaryEcho(ctx context.Context, req *echo.EchoRequest) (*echo.EchoResponse, error) {
+	atomic.AddInt32(&s.calls, 1)
+	return s.echoService.UnaryEcho(ctx, req)
+}
+
+func TestTunnelDialer(t *testing.T) {
+	// Simulate two replicas of a server behind HTTP/1-only infrastructure.
+	var backends []*countingEchoService
+	var addrs []resolver.Address
+	for i := 0; i < 2; i++ {
+		grpcSrv := grpc.NewServer()
+		backend := &countingEchoService{}
+		echo.RegisterEchoServer(grpcSrv, backend)
+		defer grpcSrv.Stop()
+		httpSrv := httptest.NewServer(server.CreateDowngradingHandler(grpcSrv, http.NotFoundHandler()))
+		defer httpSrv.Close()
+
+		backends = append(backends, backend)
+		addrs = append(addrs, resolver.Address{Addr: httpSrv.Listener.Addr().String()})
+	}
+
+	cases := map[string][]client.ConnectOption{
+		"downgraded": {client.ForceDowngrade(true)},
+		"websocket":  {client.UseWebSocket(true)},
+	}
+	for name, opts := range cases {
+		t.Run(name, func(t *testing.T) {
+			for _, backend := range backends {
+				atomic.StoreInt32(&backend.calls, 0)
+			}
+			res := manual.NewBuilderWithScheme("test")
+			res.InitialState(resolver.State{Addresses: addrs})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			cc, err := grpc.DialContext(ctx, res.Scheme()+":///echo",
+				grpc.WithResolvers(res),
+				grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"round_robin": {}}]}`),
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+				grpc.WithContextDialer(client.TunnelDialer(opts...)))
+			require.NoError(t, err)
+			defer func() { _ = cc.Close() }()
+
+			echoClient := echo.NewEchoClient(cc)
+			for i := 0; i < 10; i++ {
+				resp, err := echoClient.UnaryEcho(ctx, &echo.EchoRequest{Message: "hello"}, grpc.WaitForReady(true))
+				require.NoError(t, err)
+				assert.Equal(t, "hello", resp.GetMessage())
+			}
+			// The load balancer of the gRPC client spreads calls across the backends.
+			for _, backend := range backends {
+				assert.NotZero(t, atomic.LoadInt32(&backend.calls))
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/examples/features/proto/echo"
+)
+
+func TestUnixSocket(t *testing.T) {
+	// Socket paths are limited to about 100 characters, which the test's temporary directory might exceed.
+	dir, err := os.MkdirTemp("", "grpc-http1")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	grpcSrv := grpc.NewServer()
+	echo.RegisterEchoServer(grpcSrv, echoService{})
+	defer grpcSrv.Stop()
+
+	startServer := func(t *testing.T, name string, useTLS bool) (string, *tls.Config) {
+		socketPath := filepath.Join(dir, name)
+		lis, err := net.Listen("unix", socketPath)
+		require.NoError(t, err)
+
+		srv := httptest.NewUnstartedServer(server.CreateDowngradingHandler(grpcSrv, http.NotFoundHandler()))
+		_ = srv.Listener.Close()
+		srv.Listener = lis
+		t.Cleanup(srv.Close)
+		if !useTLS {
+			srv.Start()
+			return socketPath, nil
+		}
+		srv.EnableHTTP2 = true
+		srv.StartTLS()
+		certPool := x509.NewCertPool()
+		certPool.AddCert(srv.Certificate())
+		// The certificate of the test server is not valid for localhost.
+		return socketPath, &tls.Config{RootCAs: certPool, ServerName: "example.com"}
+	}
+
+	cases := map[string]struct {
+		useTLS bool
+		opts   []client.ConnectOption
+	}{
+		"downgraded": {
+			opts: []client.ConnectOption{client.ForceDowngrade(true)},
+		},
+		"websocket": {
+			opts: []client.ConnectOption{client.UseWebSocket(true)},
+		},
+		"TLS": {
+			useTLS: true,
+		},
+		"TLS downgraded": {
+			useTLS: true,
+			opts:   []client.ConnectOption{client.ForceDowngrade(true)},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			socketPath, tlsConf := startServer(t, name+".sock", c.useTLS)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			// Proxies are not used for Unix domain sockets.
+			opts := append([]client.ConnectOption{
+				client.WithProxyFunc(func(*http.Request) (*url.URL, error) {
+					t.Error("proxy function must not be called")
+					return nil, nil
+				}),
+			}, c.opts...)
+			if !c.useTLS {
+				opts = append(opts, client.DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())))
+			}
+			cc, err := client.ConnectViaProxy(ctx, "unix://"+socketPath, tlsConf, opts...)
+			require.NoError(t, err)
+			defer func() { _ = cc.Close() }()
+
+			resp, err := echo.NewEchoClient(cc).UnaryEcho(ctx, &echo.EchoRequest{Message: "hello"})
+			require.NoError(t, err)
+			assert.Equal(t, "hello", resp.GetMessage())
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"io"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	uploadMethod = "/upload.Upload/Upload"
+)
+
+// uploadServiceDesc describes a client-streaming service that responds with the number of bytes received.
+var uploadServiceDesc = grpc.ServiceDesc{
+	ServiceName: "upload.Upload",
+	HandlerType: (*interface{})(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Upload",
+			Handler:       uploadHandler,
+			ClientStreams: true,
+		},
+	},
+}
+
+func uploadHandler(_ interface{}, stream grpc.ServerStream) error {
+	var numBytes int64
+	for {
+		var chunk wrapperspb.BytesValue
+		if err := stream.RecvMsg(&chunk); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		numBytes += int64(len(chunk.GetValue()))
+	}
+	return stream.SendMsg(wrapperspb.Int64(numBytes))
+}
+
+// peakHeapSampler records the peak heap usage until stopped.
+type peakHeapSampler struct {
+	stopC chan struct{}
+	wg    sync.WaitGroup
+	peak  uint64
+}
+
+func startPeakHeapSampler() *peakHeapSampler {
+	s := &peakHeapSampler{stopC: make(chan struct{})}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+		var memStats runtime.MemStats
+		for {
+			runtime.ReadMemStats(&memStats)
+			if memStats.HeapInuse > s.peak {
+				s.peak = memStats.HeapInuse
+			}
+			select {
+			case <-s.stopC:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return s
+}
+
+func (s *peakHeapSampler) stop() uint64 {
+	close(s.stopC)
+	s.wg.Wait()
+	return s.peak
+}
+
+func TestClientStreamingUploadUsesBoundedMemory(t *testing.T) {
+	const (
+		chunkSize = 64 << 10
+		numChunks = 2048 // 128 MiB in total
+		maxGrowth = 32 << 20
+	)
+
+	cc, _ := testutil.NewDowngradedServer(t,
+		func(s *grpc.Server) { s.RegisterService(&uploadServiceDesc, struct{}{}) },
+		testutil.WithClientOptions(client.ForceDowngrade(true)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	stream, err := cc.NewStream(ctx, &uploadServiceDesc.Streams[0], uploadMethod)
+	require.NoError(t, err)
+
+	runtime.GC()
+	var baseline runtime.MemStats
+	runtime.ReadMemStats(&baseline)
+	sampler := startPeakHeapSampler()
+
+	chunk := wrapperspb.Bytes(make([]byte, chunkSize))
+	for i := 0; i < numChunks; i++ {
+		require.NoError(t, stream.SendMsg(chunk))
+	}
+	require.NoError(t, stream.CloseSend())
+
+	var numBytes wrapperspb.Int64Value
+	require.NoError(t, stream.RecvMsg(&numBytes))
+	peak := sampler.stop()
+
+	assert.Equal(t, int64(chunkSize*numChunks), numBytes.GetValue())
+	// The request is streamed to the server as it is being sent, hence memory usage is bounded by flow control
+	// windows and buffers, and does not grow with the size of the upload.
+	var growth uint64
+	if peak > baseline.HeapInuse {
+		growth = peak - baseline.HeapInuse
+	}
+	assert.Lessf(t, growth, uint64(maxGrowth), "heap grew by %d MiB during upload", growth>>20)
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestUserAgent(t *testing.T) {
+	incomingMDs := make(chan metadata.MD, 1)
+	grpcSrv := grpc.NewServer(grpc.UnaryInterceptor(
+		func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			incomingMDs <- md
+			return handler(ctx, req)
+		}))
+	echo.RegisterEchoServer(grpcSrv, echoService{})
+	defer grpcSrv.Stop()
+
+	httpUserAgents := make(chan string, 1)
+	downgradingHandler := server.CreateDowngradingHandler(grpcSrv, http.NotFoundHandler())
+	srv := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		httpUserAgents <- req.UserAgent()
+		downgradingHandler.ServeHTTP(w, req)
+	}), &http2.Server{}))
+	defer srv.Close()
+
+	cases := map[string]struct {
+		opts               []client.ConnectOption
+		expectedUserAgent  string
+		expectedXUserAgent string
+		// xUserAgentMetadata is sent as x-user-agent metadata, which must be passed on as is.
+		xUserAgentMetadata string
+	}{
+		"native gRPC with x-user-agent metadata": {
+			opts:               []client.ConnectOption{client.ForceHTTP2()},
+			xUserAgentMetadata: "grpc-web-javascript/0.1",
+		},
+		"downgraded": {
+			opts: []client.ConnectOption{client.ForceDowngrade(true)},
+		},
+		"downgraded with custom user agent": {
+			opts:              []client.ConnectOption{client.ForceDowngrade(true), client.WithUserAgent("tunnel/1.0")},
+			expectedUserAgent: "tunnel/1.0",
+		},
+		"websocket": {
+			opts: []client.ConnectOption{client.UseWebSocket(true)},
+		},
+		"websocket with custom user agent": {
+			opts:              []client.ConnectOption{client.UseWebSocket(true), client.WithUserAgent("tunnel/1.0")},
+			expectedUserAgent: "tunnel/1.0",
+		},
+		"grpc-web with X-User-Agent": {
+			opts:               []client.ConnectOption{client.UseGRPCWeb(), client.WithXUserAgent("grpc-web-javascript/0.1")},
+			expectedXUserAgent: "grpc-web-javascript/0.1",
+		},
+		"websocket with X-User-Agent": {
+			opts:               []client.ConnectOption{client.UseWebSocket(true), client.WithXUserAgent("grpc-web-javascript/0.1")},
+			expectedXUserAgent: "grpc-web-javascript/0.1",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			opts := append([]client.ConnectOption{
+				client.DialOpts(
+					grpc.WithTransportCredentials(insecure.NewCredentials()),
+					grpc.WithUserAgent("echo-client/2.0"),
+				),
+			}, c.opts...)
+			cc, err := client.ConnectViaProxy(ctx, srv.Listener.Addr().String(), nil, opts...)
+			require.NoError(t, err)
+			defer func() { _ = cc.Close() }()
+
+			if c.xUserAgentMetadata != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "x-user-agent", c.xUserAgentMetadata)
+			}
+			_, err = echo.NewEchoClient(cc).UnaryEcho(ctx, &echo.EchoRequest{Message: "hello"})
+			require.NoError(t, err)
+
+			httpUserAgent := <-httpUserAgents
+			if c.expectedUserAgent != "" {
+				assert.Equal(t, c.expectedUserAgent, httpUserAgent)
+			} else {
+				// Without WithUserAgent, the tunneling request carries the user agent of the gRPC client.
+				assert.True(t, strings.HasPrefix(httpUserAgent, "echo-client/2.0 grpc-go/"), "unexpected user agent %q", httpUserAgent)
+			}
+
+			md := <-incomingMDs
+			require.Len(t, md.Get("user-agent"), 1)
+			if c.xUserAgentMetadata != "" {
+				assert.Equal(t, []string{c.xUserAgentMetadata}, md.Get("x-user-agent"))
+			} else {
+				assert.Empty(t, md.Get("x-user-agent"))
+			}
+			if c.expectedXUserAgent != "" {
+				assert.Equal(t, c.expectedXUserAgent, md.Get("user-agent")[0])
+				return
+			}
+			// The gRPC user agent is unaffected.
+			assert.True(t, strings.HasPrefix(md.Get("user-agent")[0], "echo-client/2.0 grpc-go/"), "unexpected gRPC user agent %q", md.Get("user-agent")[0])
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/internal/grpcwebsocket"
+	"nhooyr.io/websocket"
+)
+
+func TestWSCompressionNegotiation(t *testing.T) {
+	testCfg := newTestConfig(t, false)
+	defer testCfg.TearDown()
+
+	cases := []struct {
+		targetID          string
+		expectCompression bool
+	}{
+		{targetID: "downgrading-grpc", expectCompression: false},
+		{targetID: "downgrading-grpc-ws-compression", expectCompression: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.targetID, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+
+			url := "http://" + testCfg.TargetAddr(t, c.targetID) + "/grpc.examples.echo.Echo/UnaryEcho"
+			hdr := make(http.Header)
+			hdr.Set("Content-Type", "application/grpc")
+			conn, resp, err := websocket.Dial(ctx, url, &websocket.DialOptions{
+				HTTPHeader:      hdr,
+				Subprotocols:    []string{grpcwebsocket.SubprotocolName},
+				CompressionMode: websocket.CompressionNoContextTakeover,
+			})
+			require.NoError(t, err)
+			defer func() { _ = conn.Close(websocket.StatusNormalClosure, "") }()
+
+			extensions := resp.Header.Get("Sec-WebSocket-Extensions")
+			if c.expectCompression {
+				assert.Contains(t, extensions, "permessage-deflate")
+			} else {
+				assert.Empty(t, extensions)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/status"
+)
+
+func TestWebSocketFallback(t *testing.T) {
+	grpcSrv := grpc.NewServer()
+	echo.RegisterEchoServer(grpcSrv, echoService{})
+	defer grpcSrv.Stop()
+
+	// Simulate a server (or an intermediary) that does not support WebSocket tunneling.
+	downgradingHandler := server.CreateDowngradingHandler(grpcSrv, http.NotFoundHandler())
+	httpSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+			http.Error(w, "upgrade not supported", http.StatusUpgradeRequired)
+			return
+		}
+		downgradingHandler.ServeHTTP(w, req)
+	}))
+	defer httpSrv.Close()
+
+	connect := func(t *testing.T, opts ...client.ConnectOption) echo.EchoClient {
+		opts = append([]client.ConnectOption{
+			client.UseWebSocket(true),
+			client.DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())),
+		}, opts...)
+		cc, err := client.ConnectViaProxy(context.Background(), httpSrv.Listener.Addr().String(), nil, opts...)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = cc.Close() })
+		return echo.NewEchoClient(cc)
+	}
+
+	t.Run("strict", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_, err := connect(t).UnaryEcho(ctx, &echo.EchoRequest{Message: "hello"})
+		require.Error(t, err)
+		assert.Equal(t, codes.Unimplemented, status.Code(err))
+		assert.Contains(t, status.Convert(err).Message(), "server does not support WebSocket tunneling")
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		echoClient := connect(t, client.WebSocketFallback())
+
+		resp, err := echoClient.UnaryEcho(ctx, &echo.EchoRequest{Message: "hello"})
+		require.NoError(t, err)
+		assert.Equal(t, "hello", resp.GetMessage())
+
+		stream, err := echoClient.ServerStreamingEcho(ctx, &echo.EchoRequest{Message: "a\nb"})
+		require.NoError(t, err)
+		var msgs []string
+		for {
+			resp, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			msgs = append(msgs, resp.GetMessage())
+		}
+		assert.Equal(t, []string{"a", "b"}, msgs)
+	})
+}
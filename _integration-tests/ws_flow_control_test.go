@@ -0,0 +1,102 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/examples/features/proto/echo"
+)
+
+const (
+	numFloodMessages = 200
+	floodMessageSize = 16 << 10
+)
+
+// floodingEchoService streams large messages as fast as the transport accepts them, and counts the messages sent.
+type floodingEchoService struct {
+	echo.UnimplementedEchoServer
+
+	sent *int64
+}
+
+func (s floodingEchoService) ServerStreamingEcho(_ *echo.EchoRequest, stream echo.Echo_ServerStreamingEchoServer) error {
+	msg := strings.Repeat("x", floodMessageSize)
+	for i := 0; i < numFloodMessages; i++ {
+		if err := stream.Send(&echo.EchoResponse{Message: msg}); err != nil {
+			return err
+		}
+		atomic.AddInt64(s.sent, 1)
+	}
+	return nil
+}
+
+func TestWebSocketFlowControl(t *testing.T) {
+	var sent int64
+	grpcSrv := grpc.NewServer()
+	echo.RegisterEchoServer(grpcSrv, floodingEchoService{sent: &sent})
+	defer grpcSrv.Stop()
+
+	httpSrv := httptest.NewServer(server.CreateDowngradingHandler(grpcSrv, http.NotFoundHandler()))
+	defer httpSrv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const window = 64 << 10
+	cc, err := client.ConnectViaProxy(ctx, httpSrv.Listener.Addr().String(), nil,
+		// A fixed window keeps the gRPC client from buffering more as its bandwidth estimate grows.
+		client.DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithInitialWindowSize(window)),
+		client.UseWebSocket(true),
+		client.WithWebSocketFlowControl(window))
+	require.NoError(t, err)
+	defer func() { _ = cc.Close() }()
+
+	stream, err := echo.NewEchoClient(cc).ServerStreamingEcho(ctx, &echo.EchoRequest{})
+	require.NoError(t, err)
+
+	_, err = stream.Recv()
+	require.NoError(t, err)
+	received := 1
+
+	// Simulate a slow reader. The server stops sending once the window of the tunnel and the window of the gRPC
+	// client are exhausted, plus a few messages in transit.
+	time.Sleep(500 * time.Millisecond)
+	ahead := atomic.LoadInt64(&sent) - int64(received)
+	assert.LessOrEqual(t, ahead, int64(2*window/floodMessageSize+4))
+
+	for {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		received++
+	}
+	assert.Equal(t, numFloodMessages, received)
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/examples/features/proto/echo"
+	"nhooyr.io/websocket"
+)
+
+func TestWebSocketPath(t *testing.T) {
+	grpcSrv := grpc.NewServer()
+	echo.RegisterEchoServer(grpcSrv, echoService{})
+	defer grpcSrv.Stop()
+
+	var (
+		pathsMutex sync.Mutex
+		paths      []string
+	)
+	downgradingHandler := server.CreateDowngradingHandler(grpcSrv, http.NotFoundHandler(),
+		server.WithWebSocketPath("/grpc-tunnel"), server.WithWebSocketSubprotocol("custom"))
+	httpSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		pathsMutex.Lock()
+		paths = append(paths, req.URL.Path)
+		pathsMutex.Unlock()
+		downgradingHandler.ServeHTTP(w, req)
+	}))
+	defer httpSrv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cc, err := client.ConnectViaProxy(ctx, httpSrv.Listener.Addr().String(), nil,
+		client.DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())),
+		client.UseWebSocket(true),
+		client.WithWebSocketPath("/grpc-tunnel"),
+		client.WithWebSocketSubprotocol("custom"))
+	require.NoError(t, err)
+	defer func() { _ = cc.Close() }()
+
+	resp, err := echo.NewEchoClient(cc).UnaryEcho(ctx, &echo.EchoRequest{Message: "hello"})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", resp.GetMessage())
+	pathsMutex.Lock()
+	assert.Equal(t, []string{"/grpc-tunnel"}, paths)
+	pathsMutex.Unlock()
+
+	// Upgrade requests at the path of the method are rejected.
+	_, httpResp, err := websocket.Dial(ctx, httpSrv.URL+"/grpc.examples.echo.Echo/UnaryEcho", &websocket.DialOptions{
+		Subprotocols: []string{"custom"},
+		HTTPHeader:   http.Header{"Content-Type": []string{"application/grpc"}},
+	})
+	require.Error(t, err)
+	require.NotNil(t, httpResp)
+	assert.Equal(t, http.StatusNotFound, httpResp.StatusCode)
+
+	// Upgrade requests at the tunnel path without a method are rejected.
+	_, httpResp, err = websocket.Dial(ctx, httpSrv.URL+"/grpc-tunnel", &websocket.DialOptions{
+		Subprotocols: []string{"custom"},
+		HTTPHeader:   http.Header{"Content-Type": []string{"application/grpc"}},
+	})
+	require.Error(t, err)
+	require.NotNil(t, httpResp)
+	assert.Equal(t, http.StatusBadRequest, httpResp.StatusCode)
+}
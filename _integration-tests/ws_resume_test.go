@@ -0,0 +1,166 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package integrationtests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/status"
+)
+
+const numResumeMessages = 10
+
+// resumingEchoService streams numbered messages, starting at the message the client has not received yet if the call
+// is resumed.
+type resumingEchoService struct {
+	echo.UnimplementedEchoServer
+}
+
+func (resumingEchoService) ServerStreamingEcho(req *echo.EchoRequest, stream echo.Echo_ServerStreamingEchoServer) error {
+	start, _ := server.ResumeFrom(stream.Context())
+	for i := int(start); i < numResumeMessages; i++ {
+		if err := stream.Send(&echo.EchoResponse{Message: fmt.Sprintf("%s-%d", req.GetMessage(), i)}); err != nil {
+			return err
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return nil
+}
+
+// killableRelay forwards TCP connections to a target address, and allows dropping all connections forwarded so far.
+type killableRelay struct {
+	lis    net.Listener
+	target string
+
+	mutex sync.Mutex
+	conns []net.Conn
+}
+
+func newKillableRelay(t *testing.T, target string) *killableRelay {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	r := &killableRelay{lis: lis, target: target}
+	t.Cleanup(func() {
+		_ = lis.Close()
+		r.kill()
+	})
+	go r.serve()
+	return r
+}
+
+func (r *killableRelay) serve() {
+	for {
+		conn, err := r.lis.Accept()
+		if err != nil {
+			return
+		}
+		targetConn, err := net.Dial("tcp", r.target)
+		if err != nil {
+			_ = conn.Close()
+			continue
+		}
+		r.mutex.Lock()
+		r.conns = append(r.conns, conn, targetConn)
+		r.mutex.Unlock()
+		go func() { _, _ = io.Copy(targetConn, conn); _ = targetConn.Close() }()
+		go func() { _, _ = io.Copy(conn, targetConn); _ = conn.Close() }()
+	}
+}
+
+func (r *killableRelay) kill() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, conn := range r.conns {
+		_ = conn.Close()
+	}
+	r.conns = nil
+}
+
+func TestWebSocketResume(t *testing.T) {
+	for _, serverResumes := range []bool{true, false} {
+		name := "server resumes"
+		if !serverResumes {
+			name = "server does not resume"
+		}
+		t.Run(name, func(t *testing.T) {
+			grpcSrv := grpc.NewServer()
+			echo.RegisterEchoServer(grpcSrv, resumingEchoService{})
+			defer grpcSrv.Stop()
+
+			var srvOpts []server.Option
+			if serverResumes {
+				srvOpts = append(srvOpts, server.WebSocketResume())
+			}
+			httpSrv := httptest.NewServer(server.CreateDowngradingHandler(grpcSrv, http.NotFoundHandler(), srvOpts...))
+			defer httpSrv.Close()
+
+			relay := newKillableRelay(t, httpSrv.Listener.Addr().String())
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			cc, err := client.ConnectViaProxy(ctx, relay.lis.Addr().String(), nil,
+				client.DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())),
+				client.UseWebSocket(true),
+				client.WebSocketResume(3))
+			require.NoError(t, err)
+			defer func() { _ = cc.Close() }()
+
+			stream, err := echo.NewEchoClient(cc).ServerStreamingEcho(ctx, &echo.EchoRequest{Message: "msg"})
+			require.NoError(t, err)
+
+			var received []string
+			for {
+				resp, err := stream.Recv()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					require.False(t, serverResumes, "unexpected error: %v", err)
+					assert.Equal(t, codes.Unavailable, status.Code(err), "unexpected error: %v", err)
+					return
+				}
+				received = append(received, resp.GetMessage())
+				if len(received) == 3 {
+					// Drop the WebSocket connection in the middle of the stream.
+					relay.kill()
+				}
+			}
+			require.True(t, serverResumes, "call should have failed")
+
+			var expected []string
+			for i := 0; i < numResumeMessages; i++ {
+				expected = append(expected, fmt.Sprintf("msg-%d", i))
+			}
+			assert.Equal(t, expected, received)
+		})
+	}
+}
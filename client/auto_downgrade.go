@@ -0,0 +1,144 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.stackrox.io/grpc-http1/internal/sliceutils"
+	"google.golang.org/grpc/codes"
+)
+
+type downgradeKey struct{}
+
+// autoDowngrader determines whether gRPC calls need to be downgraded by probing whether the endpoint, and any proxy
+// in between, negotiates HTTP/2 via ALPN. The outcome of the first successful probe applies for the lifetime of the
+// client connection.
+type autoDowngrader struct {
+	endpointDialer
+	endpoint string
+	// tlsConf is the TLS config for connecting to the endpoint. If nil, the connection is in plaintext, for which
+	// HTTP/2 cannot be negotiated.
+	tlsConf *tls.Config
+	// h2ALPNs are the ALPN protocols indicating HTTP/2 support.
+	h2ALPNs []string
+	// dialTimeout bounds the probe. Zero means it is only bounded by the context.
+	dialTimeout time.Duration
+
+	mutex     sync.Mutex
+	probed    bool
+	downgrade bool
+}
+
+func newAutoDowngrader(endpoint string, tlsClientConf *tls.Config, connectOpts connectOptions) *autoDowngrader {
+	d := &autoDowngrader{
+		endpointDialer: newEndpointDialer(connectOpts),
+		endpoint:       endpoint,
+		h2ALPNs:        append([]string{"h2"}, connectOpts.extraH2ALPNs...),
+		dialTimeout:    connectOpts.dialTimeout,
+	}
+	if tlsClientConf != nil {
+		d.tlsConf = tlsClientConf.Clone()
+		if d.tlsConf.ServerName == "" {
+			d.tlsConf.ServerName = endpoint
+			if host, _, err := net.SplitHostPort(endpoint); err == nil {
+				d.tlsConf.ServerName = host
+			}
+		}
+		// Offer HTTP/2 first, the same way the HTTP transport does.
+		if sliceutils.Find(d.tlsConf.NextProtos, "h2") == -1 {
+			d.tlsConf.NextProtos = append([]string{"h2"}, d.tlsConf.NextProtos...)
+		}
+		if sliceutils.Find(d.tlsConf.NextProtos, "http/1.1") == -1 {
+			d.tlsConf.NextProtos = append(d.tlsConf.NextProtos, "http/1.1")
+		}
+	}
+	return d
+}
+
+// shouldDowngrade returns whether gRPC calls need to be downgraded, probing the endpoint if this has not been
+// determined yet.
+func (d *autoDowngrader) shouldDowngrade(ctx context.Context) (bool, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.probed {
+		return d.downgrade, nil
+	}
+	var downgrade bool
+	err := dialWithTimeout(ctx, d.dialTimeout, func(ctx context.Context) error {
+		var err error
+		downgrade, err = d.probe(ctx)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	if downgrade {
+		d.getLogger().Debugf("Endpoint %s did not negotiate HTTP/2, downgrading gRPC calls", d.endpoint)
+	} else {
+		d.getLogger().Debugf("Endpoint %s negotiated HTTP/2, not downgrading gRPC calls", d.endpoint)
+	}
+	d.probed, d.downgrade = true, downgrade
+	return downgrade, nil
+}
+
+func (d *autoDowngrader) probe(ctx context.Context) (bool, error) {
+	if d.tlsConf == nil {
+		return true, nil
+	}
+	conn, err := d.DialContext(ctx, "tcp", d.endpoint)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	tlsConn := tls.Client(conn, d.tlsConf)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return false, &HandshakeError{Addr: d.endpoint, Err: err}
+	}
+	return sliceutils.Find(d.h2ALPNs, tlsConn.ConnectionState().NegotiatedProtocol) == -1, nil
+}
+
+// withAutoDowngrade marks requests for downgrading if the given autoDowngrader determines that this is needed. If it
+// fails to do so, the request fails with an error mapped by the given status mapper.
+func withAutoDowngrade(handler http.Handler, d *autoDowngrader, statusMapper func(int) codes.Code) http.Handler {
+	if d == nil {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		downgrade, err := d.shouldDowngrade(req.Context())
+		if err != nil {
+			writeError(w, errors.Wrap(err, "probing endpoint for HTTP/2 support"), statusMapper)
+			return
+		}
+		if downgrade {
+			req = req.WithContext(context.WithValue(req.Context(), downgradeKey{}, true))
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// isDowngradeRequested returns whether the request with the given context was marked for downgrading.
+func isDowngradeRequested(ctx context.Context) bool {
+	downgrade, _ := ctx.Value(downgradeKey{}).(bool)
+	return downgrade
+}
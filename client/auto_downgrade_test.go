@@ -0,0 +1,50 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoDowngrader_Plaintext(t *testing.T) {
+	// Without TLS, there is no ALPN to probe, so the endpoint is not even dialed.
+	d := newAutoDowngrader(closedAddr(t), nil, connectOptions{noProxy: true})
+	downgrade, err := d.shouldDowngrade(context.Background())
+	require.NoError(t, err)
+	assert.True(t, downgrade)
+}
+
+func TestAutoDowngrader_ProbeFailureIsNotCached(t *testing.T) {
+	d := newAutoDowngrader(closedAddr(t), &tls.Config{}, connectOptions{noProxy: true})
+	for i := 0; i < 2; i++ {
+		_, err := d.shouldDowngrade(context.Background())
+		assert.ErrorAs(t, err, new(*EndpointDialError))
+	}
+	assert.False(t, d.probed)
+}
+
+func TestNewAutoDowngrader_NextProtos(t *testing.T) {
+	tlsConf := &tls.Config{NextProtos: []string{"custom"}}
+	d := newAutoDowngrader("example.com:443", tlsConf, connectOptions{extraH2ALPNs: []string{"custom"}})
+	assert.Equal(t, []string{"h2", "custom", "http/1.1"}, d.tlsConf.NextProtos)
+	assert.Equal(t, "example.com", d.tlsConf.ServerName)
+	assert.Equal(t, []string{"h2", "custom"}, d.h2ALPNs)
+	assert.Equal(t, []string{"custom"}, tlsConf.NextProtos)
+}
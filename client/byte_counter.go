@@ -0,0 +1,115 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"golang.stackrox.io/grpc-http1/internal/ioutils"
+)
+
+// ByteCounterFunc is called once a gRPC stream is finished, with the full method name of the stream and the number
+// of bytes sent to and received from the endpoint for it.
+type ByteCounterFunc func(method string, sent, received int64)
+
+type byteCountKey struct{}
+
+// byteCount holds the number of bytes and frames transferred for a single stream.
+type byteCount struct {
+	sent, received             int64
+	framesSent, framesReceived ioutils.FrameCounter
+}
+
+// withByteCounter wraps the given handler such that the bytes of the request and response bodies exchanged with the
+// endpoint are reported to the given callback once a request is handled, along with the frames to the given stats
+// handler. Either may be nil. The request body is counted here, whereas the response body is counted by the handler
+// via countReceived and addReceived, as only the handler sees the response as it was received from the endpoint.
+func withByteCounter(handler http.Handler, cb ByteCounterFunc, stats StatsHandler) http.Handler {
+	if cb == nil && stats == nil {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		count := &byteCount{}
+		req = req.WithContext(context.WithValue(req.Context(), byteCountKey{}, count))
+		if req.Body != nil {
+			req.Body = &countingReader{ReadCloser: req.Body, count: &count.sent, frames: &count.framesSent}
+		}
+		info := StreamInfo{Method: req.URL.Path, StartTime: time.Now()}
+		if stats != nil {
+			stats.StreamStarted(info)
+		}
+		defer func() {
+			sent, received := atomic.LoadInt64(&count.sent), atomic.LoadInt64(&count.received)
+			if cb != nil {
+				cb(req.URL.Path, sent, received)
+			}
+			if stats != nil {
+				stats.StreamFinished(StreamStats{
+					StreamInfo:     info,
+					Duration:       time.Since(info.StartTime),
+					BytesSent:      sent,
+					BytesReceived:  received,
+					FramesSent:     count.framesSent.Frames(),
+					FramesReceived: count.framesReceived.Frames(),
+				})
+			}
+		}()
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// countReceived wraps the given response body such that the bytes read from it are counted towards the stream of the
+// given context, if bytes are counted.
+func countReceived(ctx context.Context, body io.ReadCloser) io.ReadCloser {
+	count, _ := ctx.Value(byteCountKey{}).(*byteCount)
+	if count == nil {
+		return body
+	}
+	return &countingReader{ReadCloser: body, count: &count.received, frames: &count.framesReceived}
+}
+
+// addSent adds a frame of n bytes sent for the stream of the given context, if bytes are counted.
+func addSent(ctx context.Context, n int) {
+	if count, _ := ctx.Value(byteCountKey{}).(*byteCount); count != nil {
+		atomic.AddInt64(&count.sent, int64(n))
+		count.framesSent.Add(1)
+	}
+}
+
+// addReceived adds a frame of n bytes received for the stream of the given context, if bytes are counted.
+func addReceived(ctx context.Context, n int) {
+	if count, _ := ctx.Value(byteCountKey{}).(*byteCount); count != nil {
+		atomic.AddInt64(&count.received, int64(n))
+		count.framesReceived.Add(1)
+	}
+}
+
+// countingReader counts the bytes and frames read from the wrapped reader.
+type countingReader struct {
+	io.ReadCloser
+	count  *int64
+	frames *ioutils.FrameCounter
+}
+
+func (r *countingReader) Read(buf []byte) (int, error) {
+	n, err := r.ReadCloser.Read(buf)
+	atomic.AddInt64(r.count, int64(n))
+	_, _ = r.frames.Write(buf[:n])
+	return n, err
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// checkPinnedCert checks that the SPKI SHA-256 fingerprint of the leaf certificate presented by the endpoint matches
+// one of the given pins, if there are any.
+func checkPinnedCert(authInfo credentials.AuthInfo, pins [][]byte) error {
+	if len(pins) == 0 {
+		return nil
+	}
+	tlsInfo, ok := authInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.PeerCertificates) == 0 {
+		return fmt.Errorf("%w: no certificate was presented", ErrCertificateNotPinned)
+	}
+	leaf := tlsInfo.State.PeerCertificates[0]
+	fingerprint := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	for _, pin := range pins {
+		if bytes.Equal(pin, fingerprint[:]) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: SPKI SHA-256 fingerprint of %q is %s", ErrCertificateNotPinned, leaf.Subject, base64.StdEncoding.EncodeToString(fingerprint[:]))
+}
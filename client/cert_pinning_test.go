@@ -0,0 +1,105 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestClientHandshake_PeerCertPinning(t *testing.T) {
+	// The side channel negotiates HTTP/2, like the gRPC server would.
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	endpoint := srv.Listener.Addr().String()
+
+	certPool := x509.NewCertPool()
+	certPool.AddCert(srv.Certificate())
+	creds := credentials.NewTLS(&tls.Config{RootCAs: certPool, ServerName: "example.com"})
+
+	pin := sha256.Sum256(srv.Certificate().RawSubjectPublicKeyInfo)
+	otherPin := sha256.Sum256([]byte("some other key"))
+
+	cases := map[string]struct {
+		creds     credentials.TransportCredentials
+		pins      [][]byte
+		expectErr bool
+	}{
+		"no pins": {
+			creds: creds,
+		},
+		"matching pin": {
+			creds: creds,
+			pins:  [][]byte{otherPin[:], pin[:]},
+		},
+		"mismatching pin": {
+			creds:     creds,
+			pins:      [][]byte{otherPin[:]},
+			expectErr: true,
+		},
+		"no certificate": {
+			creds:     insecure.NewCredentials(),
+			pins:      [][]byte{pin[:]},
+			expectErr: true,
+		},
+	}
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			var opts connectOptions
+			WithPeerCertPinning(c.pins...).apply(&opts)
+			sideChannel := newCredsFromSideChannel(endpoint, c.creds, opts)
+			_, authInfo, err := sideChannel.ClientHandshake(context.Background(), endpoint, nil)
+			if !c.expectErr {
+				require.NoError(t, err)
+				assert.NotNil(t, authInfo)
+				return
+			}
+			assert.ErrorIs(t, err, ErrCertificateNotPinned)
+			assert.ErrorAs(t, err, new(*HandshakeError))
+			assert.False(t, isTransientHandshakeError(err))
+			assert.Nil(t, authInfo)
+		})
+	}
+}
+
+func TestClientHandshake_PeerCertPinningMismatchMessage(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	pin := sha256.Sum256(srv.Certificate().RawSubjectPublicKeyInfo)
+	err := checkPinnedCert(credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{srv.Certificate()}}}, [][]byte{{1, 2, 3}})
+	require.ErrorIs(t, err, ErrCertificateNotPinned)
+	assert.Contains(t, err.Error(), base64.StdEncoding.EncodeToString(pin[:]))
+}
+
+func TestConnectViaProxy_PeerCertPinningRequiresTLS(t *testing.T) {
+	pin := sha256.Sum256([]byte("key"))
+	_, err := ConnectViaProxy(context.Background(), "localhost:443", nil, WithPeerCertPinning(pin[:]))
+	assert.ErrorContains(t, err, "requires a TLS config")
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+)
+
+// hasGenericContentType checks whether the content type of a response is missing or generic, such that it might be a
+// gRPC-Web response sent by a server that does not set the content type properly.
+func hasGenericContentType(contentType string) bool {
+	mediaType := strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	return mediaType == "" || strings.EqualFold(mediaType, "application/octet-stream")
+}
+
+// sniffGRPCWebBody checks whether body starts with a well-formed gRPC-Web frame header, i.e., one setting no flags
+// other than the compression and metadata flags, and declaring a length of at most maxFrameSize. It returns a body
+// yielding the same data as the given one, which must be used in its place.
+func sniffGRPCWebBody(body io.ReadCloser, maxFrameSize uint32) (io.ReadCloser, bool) {
+	br := bufio.NewReader(body)
+	sniffed := struct {
+		io.Reader
+		io.Closer
+	}{Reader: br, Closer: body}
+
+	hdr, err := br.Peek(grpcproto.MessageHeaderLength)
+	if err != nil {
+		return sniffed, false
+	}
+	flags, length, err := grpcproto.ParseMessageHeader(hdr)
+	if err != nil || flags&^(grpcproto.MetadataFlags|grpcproto.CompressedFlags) != 0 {
+		return sniffed, false
+	}
+	return sniffed, grpcproto.CheckFrameLength(length, maxFrameSize) == nil
+}
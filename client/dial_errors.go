@@ -0,0 +1,108 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ProxyDialError is returned if the side channel connection could not be established because determining, connecting
+// to, or negotiating the tunnel with the proxy failed. The latter includes the proxy refusing to connect to the
+// endpoint.
+type ProxyDialError struct {
+	// Proxy is the host (and port, if any) of the proxy. It is empty if determining the proxy failed.
+	Proxy string
+	// Addr is the address of the endpoint.
+	Addr string
+	Err  error
+}
+
+func (e *ProxyDialError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ProxyDialError) Unwrap() error {
+	return e.Err
+}
+
+// ProxyConfigError is returned if the proxy for connecting to the endpoint could not be determined because the proxy
+// configuration is invalid, e.g., because the `HTTPS_PROXY` environment variable is malformed, as opposed to the proxy
+// being unreachable. For the side channel connection, it is wrapped in a *ProxyDialError. See
+// `WithProxyConfigFallback` for connecting directly instead.
+type ProxyConfigError struct {
+	// Proxy is the invalid proxy URL, if the configuration yielded one.
+	Proxy string
+	Err   error
+}
+
+func (e *ProxyConfigError) Error() string {
+	return fmt.Sprintf("invalid proxy configuration: %v", e.Err)
+}
+
+func (e *ProxyConfigError) Unwrap() error {
+	return e.Err
+}
+
+// EndpointDialError is returned if the side channel connection to the endpoint could not be established when dialing
+// it directly.
+type EndpointDialError struct {
+	// Addr is the address of the endpoint.
+	Addr string
+	Err  error
+}
+
+func (e *EndpointDialError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *EndpointDialError) Unwrap() error {
+	return e.Err
+}
+
+// HandshakeError is returned if the side channel connection to the endpoint was established, but the TLS handshake
+// with the endpoint failed, e.g., because its certificate could not be verified.
+type HandshakeError struct {
+	// Addr is the address of the endpoint.
+	Addr string
+	Err  error
+}
+
+func (e *HandshakeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *HandshakeError) Unwrap() error {
+	return e.Err
+}
+
+// FailoverError is returned if failover endpoints are configured, and connecting to each of the endpoints failed.
+type FailoverError struct {
+	// Errs holds the error for every endpoint that was tried, in order. Endpoints that were not tried because the
+	// context expired are omitted.
+	Errs []error
+}
+
+func (e *FailoverError) Error() string {
+	msgs := make([]string, 0, len(e.Errs))
+	for _, err := range e.Errs {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("connecting to all endpoints failed: %s", strings.Join(msgs, "; "))
+}
+
+func (e *FailoverError) Unwrap() []error {
+	return e.Errs
+}
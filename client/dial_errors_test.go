@@ -0,0 +1,120 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// closedAddr returns an address on which no connections are accepted.
+func closedAddr(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := lis.Addr().String()
+	require.NoError(t, lis.Close())
+	return addr
+}
+
+func TestClientHandshake_EndpointDialError(t *testing.T) {
+	endpoint := closedAddr(t)
+
+	sideChannel := newCredsFromSideChannel(endpoint, insecure.NewCredentials(), connectOptions{})
+	_, _, err := sideChannel.ClientHandshake(context.Background(), endpoint, nil)
+
+	var dialErr *EndpointDialError
+	require.ErrorAs(t, err, &dialErr)
+	assert.Equal(t, endpoint, dialErr.Addr)
+	assert.ErrorAs(t, err, new(*net.OpError))
+	assert.False(t, errors.As(err, new(*ProxyDialError)))
+	assert.False(t, errors.As(err, new(*HandshakeError)))
+}
+
+func TestClientHandshake_ProxyDialError(t *testing.T) {
+	const endpoint = "grpc.example.com:443"
+
+	cases := map[string]func(t *testing.T) *url.URL{
+		"proxy unreachable": func(t *testing.T) *url.URL {
+			return &url.URL{Scheme: "http", Host: closedAddr(t)}
+		},
+		"proxy rejects CONNECT": func(t *testing.T) *url.URL {
+			return fakeProxy(t, func(conn net.Conn, _ *http.Request) {
+				_, _ = conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\nContent-Length: 0\r\n\r\n"))
+			})
+		},
+		"proxy authentication required": func(t *testing.T) *url.URL {
+			return fakeProxy(t, func(conn net.Conn, _ *http.Request) {
+				_, _ = conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\nContent-Length: 0\r\n\r\n"))
+			})
+		},
+	}
+
+	for name, makeProxy := range cases {
+		t.Run(name, func(t *testing.T) {
+			proxyURL := makeProxy(t)
+
+			var opts connectOptions
+			WithProxyFunc(http.ProxyURL(proxyURL)).apply(&opts)
+			sideChannel := newCredsFromSideChannel(endpoint, insecure.NewCredentials(), opts)
+			_, _, err := sideChannel.ClientHandshake(context.Background(), endpoint, nil)
+
+			var proxyErr *ProxyDialError
+			require.ErrorAs(t, err, &proxyErr)
+			assert.Equal(t, proxyURL.Host, proxyErr.Proxy)
+			assert.Equal(t, endpoint, proxyErr.Addr)
+			assert.Equal(t, proxyErr.Err.Error(), err.Error())
+			assert.False(t, errors.As(err, new(*EndpointDialError)))
+		})
+	}
+}
+
+func TestClientHandshake_ProxyFuncError(t *testing.T) {
+	const endpoint = "grpc.example.com:443"
+	proxyFuncErr := errors.New("no proxy for you")
+
+	var opts connectOptions
+	WithProxyFunc(func(*http.Request) (*url.URL, error) { return nil, proxyFuncErr }).apply(&opts)
+	sideChannel := newCredsFromSideChannel(endpoint, insecure.NewCredentials(), opts)
+	_, _, err := sideChannel.ClientHandshake(context.Background(), endpoint, nil)
+
+	var proxyErr *ProxyDialError
+	require.ErrorAs(t, err, &proxyErr)
+	assert.Empty(t, proxyErr.Proxy)
+	assert.ErrorIs(t, err, proxyFuncErr)
+}
+
+func TestClientHandshake_HandshakeError(t *testing.T) {
+	endpoint := fakeEndpoint(t)
+
+	creds := &failingCreds{countingCreds: countingCreds{TransportCredentials: insecure.NewCredentials()}, failures: 1, err: x509.UnknownAuthorityError{}}
+	sideChannel := newCredsFromSideChannel(endpoint, creds, connectOptions{})
+	_, _, err := sideChannel.ClientHandshake(context.Background(), endpoint, nil)
+
+	var handshakeErr *HandshakeError
+	require.ErrorAs(t, err, &handshakeErr)
+	assert.Equal(t, endpoint, handshakeErr.Addr)
+	assert.Equal(t, x509.UnknownAuthorityError{}.Error(), err.Error())
+	assert.ErrorAs(t, err, &x509.UnknownAuthorityError{})
+	assert.False(t, errors.As(err, new(*ProxyDialError)))
+}
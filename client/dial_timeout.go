@@ -0,0 +1,58 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// dialTimeoutError is returned if establishing a connection did not complete within the dial timeout.
+type dialTimeoutError struct {
+	timeout time.Duration
+	err     error
+}
+
+func (e *dialTimeoutError) Error() string {
+	return fmt.Sprintf("dial timed out after %v: %v", e.timeout, e.err)
+}
+
+func (e *dialTimeoutError) Unwrap() error {
+	return e.err
+}
+
+// Timeout indicates that this error is a timeout, in the same way as `net.Error`.
+func (e *dialTimeoutError) Timeout() bool {
+	return true
+}
+
+// dialWithTimeout invokes dial with a context that expires after the given timeout, or earlier if the given context
+// expires earlier. If dial fails because the timeout expired, the error is wrapped in a `dialTimeoutError`. A zero
+// timeout means that dial is invoked with the given context.
+func dialWithTimeout(ctx context.Context, timeout time.Duration, dial func(ctx context.Context) error) error {
+	if timeout <= 0 {
+		return dial(ctx)
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := dial(dialCtx)
+	if err != nil && ctx.Err() == nil && dialCtx.Err() == context.DeadlineExceeded {
+		return &dialTimeoutError{timeout: timeout, err: err}
+	}
+	return err
+}
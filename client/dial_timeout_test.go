@@ -0,0 +1,112 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// unresponsiveEndpoint accepts connections, but never responds.
+func unresponsiveEndpoint(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var (
+		connsMutex sync.Mutex
+		conns      []net.Conn
+	)
+	t.Cleanup(func() {
+		_ = lis.Close()
+		connsMutex.Lock()
+		defer connsMutex.Unlock()
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	})
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			connsMutex.Lock()
+			conns = append(conns, conn)
+			connsMutex.Unlock()
+		}
+	}()
+
+	return lis.Addr().String()
+}
+
+func TestDialWithTimeout(t *testing.T) {
+	waitForCtx := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	err := dialWithTimeout(context.Background(), 50*time.Millisecond, waitForCtx)
+	require.Error(t, err)
+	assert.Equal(t, "dial timed out after 50ms: context deadline exceeded", err.Error())
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	// An earlier deadline of the passed context wins, and is reported as is.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = dialWithTimeout(ctx, time.Hour, waitForCtx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// A zero timeout does not bound the dial.
+	err = dialWithTimeout(context.Background(), 0, func(ctx context.Context) error {
+		_, hasDeadline := ctx.Deadline()
+		assert.False(t, hasDeadline)
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestClientHandshake_DialTimeout(t *testing.T) {
+	endpoint := unresponsiveEndpoint(t)
+
+	sideChannel := newCredsFromSideChannel(endpoint, credentials.NewTLS(&tls.Config{}), connectOptions{dialTimeout: 100 * time.Millisecond})
+
+	start := time.Now()
+	_, _, err := sideChannel.ClientHandshake(context.Background(), endpoint, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "dial timed out after 100ms")
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestConnectViaProxy_DialTimeout(t *testing.T) {
+	endpoint := unresponsiveEndpoint(t)
+
+	start := time.Now()
+	_, err := ConnectViaProxy(context.Background(), endpoint, &tls.Config{},
+		DialOpts(grpc.WithBlock()), WithDialTimeout(100*time.Millisecond))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "dial timed out after 100ms")
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
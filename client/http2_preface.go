@@ -0,0 +1,81 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+)
+
+var (
+	// errHTTP2PriorKnowledge is returned when an HTTP/1.1 request receives an HTTP/2 connection preface in response,
+	// which the HTTP/1.1 parser would otherwise report as a malformed response.
+	errHTTP2PriorKnowledge = errors.New("endpoint speaks HTTP/2 only; use ForceHTTP2 or native gRPC")
+)
+
+// detectHTTP2Preface makes the given transport fail with errHTTP2PriorKnowledge if a connection established by it
+// starts with an HTTP/2 connection preface sent by the server. This is only useful for plaintext connections; via TLS,
+// HTTP/2 is negotiated using ALPN.
+func detectHTTP2Preface(transport *http.Transport) {
+	dial := transport.DialContext
+	if dial == nil {
+		dial = new(net.Dialer).DialContext
+	}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &http2PrefaceDetectingConn{Conn: conn}, nil
+	}
+}
+
+// http2PrefaceDetectingConn is a connection that checks whether the first data read is an HTTP/2 connection preface.
+type http2PrefaceDetectingConn struct {
+	net.Conn
+	checked bool
+}
+
+func (c *http2PrefaceDetectingConn) Read(buf []byte) (int, error) {
+	n, err := c.Conn.Read(buf)
+	if c.checked || n == 0 {
+		return n, err
+	}
+	c.checked = true
+	if isHTTP2Preface(buf[:n]) {
+		return 0, errHTTP2PriorKnowledge
+	}
+	return n, err
+}
+
+// isHTTP2Preface checks whether data starts with an HTTP/2 connection preface, i.e., the client preface (as sent back
+// by some servers) or the header of the SETTINGS frame that makes up the server preface. HTTP/1.x responses start with
+// "HTTP/", which can be told apart from either by the first five bytes.
+func isHTTP2Preface(data []byte) bool {
+	if len(data) < 5 {
+		return false
+	}
+	if bytes.HasPrefix([]byte(http2.ClientPreface), data[:5]) {
+		return true
+	}
+	// A frame header consists of a 24-bit length, the type, the flags, and the stream ID. The SETTINGS frame of the
+	// server preface does not have the ACK flag set.
+	return http2.FrameType(data[3]) == http2.FrameSettings && data[4] == 0
+}
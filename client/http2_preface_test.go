@@ -0,0 +1,74 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestIsHTTP2Preface(t *testing.T) {
+	cases := map[string]bool{
+		"PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n":     true,
+		"\x00\x00\x06\x04\x00\x00\x00\x00\x00": true,
+		"\x00\x00\x00\x04\x01\x00\x00\x00\x00": false,
+		"HTTP/1.1 200 OK\r\n":                  false,
+		"\x00\x00":                             false,
+	}
+	for data, expected := range cases {
+		assert.Equalf(t, expected, isHTTP2Preface([]byte(data)), "data: %q", data)
+	}
+}
+
+func TestHTTP2PriorKnowledgeEndpoint(t *testing.T) {
+	// A plain gRPC server only speaks HTTP/2 with prior knowledge on plaintext connections.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	grpcSrv := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcSrv, health.NewServer())
+	go func() { _ = grpcSrv.Serve(lis) }()
+	defer grpcSrv.Stop()
+
+	for _, useWebSocket := range []bool{false, true} {
+		name := "http"
+		if useWebSocket {
+			name = "websocket"
+		}
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			cc, err := ConnectViaProxy(ctx, lis.Addr().String(), nil,
+				DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())),
+				UseWebSocket(useWebSocket),
+				ForceDowngrade(true))
+			require.NoError(t, err)
+			defer func() { _ = cc.Close() }()
+
+			_, err = healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), errHTTP2PriorKnowledge.Error())
+		})
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"golang.stackrox.io/grpc-http1/internal/httputils"
+	"google.golang.org/grpc/codes"
+)
+
+// httpStatusError is an error caused by a non-OK HTTP response from the proxy or endpoint.
+type httpStatusError struct {
+	statusCode int
+	err        error
+}
+
+func (e *httpStatusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *httpStatusError) Unwrap() error {
+	return e.err
+}
+
+// DefaultHTTPStatusMapper maps an HTTP status code to a gRPC status code, following the mapping in the gRPC
+// documentation (https://github.com/grpc/grpc/blob/master/doc/http-grpc-status-mapping.md).
+func DefaultHTTPStatusMapper(statusCode int) codes.Code {
+	return httputils.GRPCCodeFromHTTPStatus(statusCode)
+}
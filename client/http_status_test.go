@@ -0,0 +1,171 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// callWithHTTPStatus performs a gRPC call against an endpoint that always responds with the given HTTP status.
+func callWithHTTPStatus(t *testing.T, statusCode int, opts ...ConnectOption) error {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "go away", statusCode)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts = append(opts, DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())))
+	cc, err := ConnectViaProxy(ctx, strings.TrimPrefix(srv.URL, "http://"), nil, opts...)
+	require.NoError(t, err)
+	defer func() { _ = cc.Close() }()
+
+	_, err = healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{})
+	return err
+}
+
+func TestHTTPStatusMapping_Default(t *testing.T) {
+	cases := map[int]codes.Code{
+		http.StatusUnauthorized:       codes.Unauthenticated,
+		http.StatusForbidden:          codes.PermissionDenied,
+		http.StatusTooManyRequests:    codes.Unavailable,
+		http.StatusBadGateway:         codes.Unavailable,
+		http.StatusServiceUnavailable: codes.Unavailable,
+		http.StatusTeapot:             codes.Unknown,
+	}
+	for statusCode, expectedCode := range cases {
+		t.Run(http.StatusText(statusCode), func(t *testing.T) {
+			err := callWithHTTPStatus(t, statusCode)
+			st, ok := status.FromError(err)
+			require.True(t, ok)
+			assert.Equal(t, expectedCode, st.Code())
+			assert.Contains(t, st.Message(), http.StatusText(statusCode))
+			assert.Contains(t, st.Message(), "go away")
+		})
+	}
+}
+
+func TestHTTPStatusMapping_Custom(t *testing.T) {
+	mapper := func(statusCode int) codes.Code {
+		if statusCode == http.StatusTooManyRequests {
+			return codes.ResourceExhausted
+		}
+		return DefaultHTTPStatusMapper(statusCode)
+	}
+
+	err := callWithHTTPStatus(t, http.StatusTooManyRequests, WithHTTPStatusMapper(mapper))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	err = callWithHTTPStatus(t, http.StatusBadGateway, WithHTTPStatusMapper(mapper))
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestNonGRPCResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html>\n<body>Welcome to nginx!</body>\n</html>\n"))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cc, err := ConnectViaProxy(ctx, strings.TrimPrefix(srv.URL, "http://"), nil,
+		DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())))
+	require.NoError(t, err)
+	defer func() { _ = cc.Close() }()
+
+	_, err = healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{})
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, codes.Unknown, st.Code())
+	assert.Contains(t, st.Message(), "HTTP/1.1 200 OK, content-type text/html: <html> <body>Welcome to nginx!</body> </html>")
+}
+
+func TestGenericContentTypeResponse(t *testing.T) {
+	grpcWebBody := append(grpcproto.MakeMessageHeader(0, 0), grpcproto.EncodeTrailers(metadata.Pairs("grpc-status", "0"))...)
+	cases := map[string]struct {
+		contentType []string
+		body        []byte
+		accepted    bool
+	}{
+		"missing content type": {
+			contentType: nil,
+			body:        grpcWebBody,
+			accepted:    true,
+		},
+		"generic content type": {
+			contentType: []string{"application/octet-stream"},
+			body:        grpcWebBody,
+			accepted:    true,
+		},
+		"generic content type without gRPC-Web framing": {
+			contentType: []string{"application/octet-stream"},
+			body:        []byte("not gRPC-Web"),
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				// A nil value prevents the content type from being sniffed.
+				w.Header()["Content-Type"] = c.contentType
+				_, _ = w.Write(c.body)
+			}))
+			defer srv.Close()
+
+			call := func(opts ...ConnectOption) error {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+
+				opts = append(opts, DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())))
+				cc, err := ConnectViaProxy(ctx, strings.TrimPrefix(srv.URL, "http://"), nil, opts...)
+				require.NoError(t, err)
+				defer func() { _ = cc.Close() }()
+
+				_, err = healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{})
+				return err
+			}
+
+			err := call()
+			if c.accepted {
+				assert.NoError(t, err)
+			} else {
+				assert.Equal(t, codes.Unknown, status.Code(err))
+				assert.Contains(t, err.Error(), "not gRPC-Web")
+			}
+
+			err = call(WithStrictContentType())
+			assert.Equal(t, codes.Unknown, status.Code(err))
+			assert.Contains(t, err.Error(), "receiving non-gRPC response from remote endpoint")
+		})
+	}
+}
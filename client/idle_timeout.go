@@ -0,0 +1,143 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.stackrox.io/grpc-http1/internal/concurrency"
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// unaryCallHeader marks the requests of unary calls for the in-process proxy. It is removed before forwarding them.
+const unaryCallHeader = "Grpc-Http1-Unary"
+
+// markUnaryCalls is a unary interceptor that marks unary calls, such that the stream idle timeout does not apply to
+// them.
+func markUnaryCalls(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(unaryCallHeader), "true")
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// withStreamIdleTimeout wraps the given handler such that a call is aborted with a `DeadlineExceeded` status once
+// neither has a frame been read from the request body, nor has one been written to the response for the given
+// duration. The call is aborted by canceling the request context, which makes the handler give up forwarding it.
+// Unary calls marked by markUnaryCalls are not subject to the timeout, as they cannot be kept active while waiting for
+// the response.
+func withStreamIdleTimeout(handler http.Handler, timeout time.Duration) http.Handler {
+	if timeout <= 0 {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get(unaryCallHeader) != "" {
+			req.Header.Del(unaryCallHeader)
+			handler.ServeHTTP(w, req)
+			return
+		}
+		ctx, cancel := context.WithCancel(req.Context())
+		defer cancel()
+		timer := concurrency.NewIdleTimer(timeout, cancel)
+		defer timer.Stop()
+
+		req = req.WithContext(ctx)
+		if req.Body != nil {
+			req.Body = &idleReader{ReadCloser: req.Body, timer: timer}
+		}
+		iw := &idleResponseWriter{ResponseWriter: w, timer: timer}
+		defer func() {
+			if !timer.Expired() {
+				return
+			}
+			// The reverse proxy aborts the response if copying the response body fails, which it does once the
+			// request context is canceled.
+			if r := recover(); r != nil && r != http.ErrAbortHandler {
+				panic(r)
+			}
+			iw.writeTimeoutStatus()
+		}()
+		handler.ServeHTTP(iw, req)
+	})
+}
+
+type idleReader struct {
+	io.ReadCloser
+	timer *concurrency.IdleTimer
+}
+
+func (r *idleReader) Read(buf []byte) (int, error) {
+	n, err := r.ReadCloser.Read(buf)
+	if n > 0 {
+		r.timer.Touch()
+	}
+	return n, err
+}
+
+// idleResponseWriter restarts the idle timer whenever a frame is written, and records whether the response header has
+// been written.
+type idleResponseWriter struct {
+	http.ResponseWriter
+	timer         *concurrency.IdleTimer
+	headerWritten bool
+}
+
+func (w *idleResponseWriter) WriteHeader(statusCode int) {
+	w.headerWritten = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *idleResponseWriter) Write(buf []byte) (int, error) {
+	w.headerWritten = true
+	w.timer.Touch()
+	return w.ResponseWriter.Write(buf)
+}
+
+func (w *idleResponseWriter) Flush() {
+	if flusher, _ := w.ResponseWriter.(http.Flusher); flusher != nil {
+		flusher.Flush()
+	}
+}
+
+func (w *idleResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// writeTimeoutStatus replaces the status the handler may have set for the aborted call, unless the call succeeded
+// right before it would have been aborted.
+func (w *idleResponseWriter) writeTimeoutStatus() {
+	hdr := w.Header()
+	okStatus := fmt.Sprintf("%d", codes.OK)
+	if hdr.Get("Grpc-Status") == okStatus || hdr.Get(http.TrailerPrefix+"Grpc-Status") == okStatus {
+		return
+	}
+	for _, k := range []string{"Grpc-Status", "Grpc-Message", "Grpc-Status-Details-Bin"} {
+		hdr.Del(k)
+		hdr.Del(http.TrailerPrefix + k)
+	}
+	if !w.headerWritten {
+		hdr.Set("Content-Type", "application/grpc")
+		w.WriteHeader(http.StatusOK)
+	}
+	hdr.Set(http.TrailerPrefix+"Grpc-Status", fmt.Sprintf("%d", codes.DeadlineExceeded))
+	msg := fmt.Sprintf("transport: stream idle for more than %v", w.timer.Timeout())
+	hdr.Set(http.TrailerPrefix+"Grpc-Message", grpcproto.EncodeGrpcMessage(msg))
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingLogger struct {
+	mutex    sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) Debugf(format string, args ...interface{}) {
+	l.record("DEBUG: "+format, args...)
+}
+
+func (l *recordingLogger) Warnf(format string, args ...interface{}) {
+	l.record("WARN: "+format, args...)
+}
+
+func (l *recordingLogger) record(format string, args ...interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
+}
+
+func TestWithLogger_CONNECT(t *testing.T) {
+	for name, status := range map[string]string{
+		"success": "200 Connection Established",
+		"failure": "403 Forbidden",
+	} {
+		t.Run(name, func(t *testing.T) {
+			proxyURL := fakeProxy(t, func(conn net.Conn, _ *http.Request) {
+				_, _ = conn.Write([]byte("HTTP/1.1 " + status + "\r\n\r\n"))
+			})
+			proxyURL.User = url.UserPassword("user", "secret")
+
+			logger := &recordingLogger{}
+			var opts connectOptions
+			for _, opt := range []ConnectOption{WithProxyFunc(http.ProxyURL(proxyURL)), WithLogger(logger)} {
+				opt.apply(&opts)
+			}
+			dialer := newEndpointDialer(opts)
+			conn, err := dialer.DialContext(context.Background(), "tcp", "example.com:443")
+			if err == nil {
+				_ = conn.Close()
+			}
+
+			redacted := proxyURL.Redacted()
+			expected := []string{"DEBUG: Connecting to example.com:443 via proxy " + redacted}
+			if name == "success" {
+				require.NoError(t, err)
+				expected = append(expected, "DEBUG: Established tunnel to example.com:443 via proxy "+redacted)
+			} else {
+				require.Error(t, err)
+				expected = append(expected, fmt.Sprintf("WARN: Connecting to example.com:443 via proxy %s failed: %v", redacted, err.(*ProxyDialError).Err))
+			}
+			assert.Equal(t, expected, logger.messages)
+			assert.NotContains(t, fmt.Sprint(logger.messages), "secret")
+		})
+	}
+}
+
+func TestWithLogger_Default(t *testing.T) {
+	assert.Equal(t, nopLogger{}, (&connectOptions{}).getLogger())
+	assert.Equal(t, nopLogger{}, (&endpointDialer{}).getLogger())
+}
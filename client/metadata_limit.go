@@ -0,0 +1,78 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"encoding/base64"
+
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// headerFieldOverhead is the overhead per header field in the size of an HTTP/2 header list (RFC 7540, section 6.5.2).
+const headerFieldOverhead = 32
+
+// metadataSize returns the size of the given metadata when sent as headers, computed like the size of an HTTP/2 header
+// list: the length of every key and value plus an overhead of 32 bytes per value. The values of binary metadata are
+// counted with their base64-encoded length.
+func metadataSize(md metadata.MD) int {
+	size := 0
+	for k, vs := range md {
+		isBinary := grpcproto.IsBinaryMetadataKey(k)
+		for _, v := range vs {
+			valueLen := len(v)
+			if isBinary {
+				valueLen = base64.RawStdEncoding.EncodedLen(valueLen)
+			}
+			size += len(k) + valueLen + headerFieldOverhead
+		}
+	}
+	return size
+}
+
+// checkMetadataSize returns an `InvalidArgument` error if the outgoing metadata of the call exceeds maxBytes.
+func checkMetadataSize(ctx context.Context, maxBytes int) error {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if size := metadataSize(md); size > maxBytes {
+		return status.Errorf(codes.InvalidArgument, "outgoing metadata of %d bytes exceeds the limit of %d bytes", size, maxBytes)
+	}
+	return nil
+}
+
+// maxMetadataBytesUnaryInterceptor returns a unary interceptor that fails calls with outgoing metadata exceeding
+// maxBytes.
+func maxMetadataBytesUnaryInterceptor(maxBytes int) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := checkMetadataSize(ctx, maxBytes); err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// maxMetadataBytesStreamInterceptor returns a stream interceptor that fails calls with outgoing metadata exceeding
+// maxBytes.
+func maxMetadataBytesStreamInterceptor(maxBytes int) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if err := checkMetadataSize(ctx, maxBytes); err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
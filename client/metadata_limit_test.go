@@ -0,0 +1,50 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestMetadataSize(t *testing.T) {
+	md := metadata.Pairs(
+		"x-a", "1",
+		"x-a", "22",
+		// Binary values count with their base64-encoded length.
+		"x-bin", "\x00\x01",
+	)
+	assert.Equal(t, (3+1+32)+(3+2+32)+(5+3+32), metadataSize(md))
+	assert.Zero(t, metadataSize(nil))
+}
+
+func TestCheckMetadataSize(t *testing.T) {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-small", "a")
+	assert.NoError(t, checkMetadataSize(ctx, 1024))
+	assert.NoError(t, checkMetadataSize(context.Background(), 1024))
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-large", strings.Repeat("a", 1024))
+	err := checkMetadataSize(ctx, 1024)
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, err.Error(), "exceeds the limit of 1024 bytes")
+}
@@ -30,6 +30,11 @@ func (w *nonBufferingWriter) flush() {
 }
 
 func (w *nonBufferingWriter) WriteHeader(statusCode int) {
+	if statusCode >= 100 && statusCode < 200 {
+		// Interim responses of the endpoint (e.g., `100 Continue`) are passed on by the reverse proxy, but the gRPC
+		// client does not expect them and would fail the call.
+		return
+	}
 	dontFlushHeaders := w.Header().Get(dontFlushHeadersHeaderKey) == "true"
 	w.Header().Del(dontFlushHeadersHeaderKey)
 	w.ResponseWriter.WriteHeader(statusCode)
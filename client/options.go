@@ -14,15 +14,83 @@
 
 package client
 
-import "google.golang.org/grpc"
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	// defaultMaxResponseHeaderBytes is the default limit on the size of the headers of responses from the endpoint or
+	// proxies.
+	defaultMaxResponseHeaderBytes = 1 << 20
+)
 
 type connectOptions struct {
-	dialOpts       []grpc.DialOption
-	extraH2ALPNs   []string
-	forceHTTP2     bool
-	forceDowngrade bool
-	useWebSocket   bool
-	contentType    string
+	dialOpts        []grpc.DialOption
+	extraH2ALPNs    []string
+	forceHTTP2      bool
+	forceDowngrade  bool
+	autoDowngrade   bool
+	useWebSocket    bool
+	wsCompression   bool
+	wsKeepalive     wsKeepaliveOption
+	wsFallback      bool
+	wsResume        int
+	wsPath          string
+	wsSubprotocol   string
+	wsWindow        uint32
+	useGRPCWeb      bool
+	contentType     string
+	proxyTLSConfig  *tls.Config
+	tunnelTLSConfig *tls.Config
+	noProxy         bool
+	proxy           func(*http.Request) (*url.URL, error)
+	proxyFallback   bool
+	dialer          ContextDialer
+
+	sideChannelAuthInfoTTL time.Duration
+	sideChannel            *SideChannel
+	sideChannelRetry       sideChannelRetryOption
+	sideChannelSessions    tls.ClientSessionCache
+	sideChannelALPNs       []string
+	httpStatusMapper       func(int) codes.Code
+	maxFrameSize           uint32
+	requestHeaders         http.Header
+	dialTimeout            time.Duration
+	byteCounter            ByteCounterFunc
+	pathRewriter           func(method string) string
+	userAgent              string
+	xUserAgent             string
+	unixSocket             bool
+	tlsServerName          string
+	hostHeader             string
+	disableKeepAlives      bool
+	readBufferSize         int
+	writeBufferSize        int
+	maxResponseHeaderBytes int
+	onRequest              func(*http.Request) *http.Request
+	onResponse             func(*http.Response)
+	failoverEndpoints      []string
+	maxMetadataBytes       int
+	maxResponseBytes       int64
+	logger                 Logger
+	strictContentType      bool
+	streamIdleTimeout      time.Duration
+	statsHandler           StatsHandler
+	peerCertPins           [][]byte
+}
+
+// ContextDialer dials a network connection to the given address.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
 }
 
 // ConnectOption is an option that can be passed to the `ConnectViaProxy` method.
@@ -46,6 +114,9 @@ func ExtraH2ALPNs(alpns ...string) ConnectOption {
 // This is required for servers that only speak HTTP/2 (e.g., the vanilla gRPC server regardless of the language), but
 // might break things if the server does not support HTTP/2 or expects HTTP/1. Generally, working with any kind of
 // server requires a TLS connection that allows for ALPN.
+// As with the side channel, connections are established via the HTTP CONNECT or SOCKS5 proxy configured in the
+// environment, if any, such that this option can be used whenever the path to the endpoint is known to support
+// HTTP/2 end-to-end.
 //
 // This option is ignored when `UseWebSocket(true)` is set.
 func ForceHTTP2() ConnectOption {
@@ -59,20 +130,439 @@ func UseWebSocket(use bool) ConnectOption {
 	return useWebSocketOption(use)
 }
 
+// WebSocketCompression returns a connection option that instructs the client to offer the permessage-deflate
+// extension (RFC 7692) when establishing a WebSocket connection. Messages are only compressed if the server agrees
+// to use the extension; otherwise, they are sent uncompressed.
+// This option has no effect unless `UseWebSocket(true)` is set.
+func WebSocketCompression() ConnectOption {
+	return wsCompressionOption{}
+}
+
+// WebSocketKeepalive returns a connection option that instructs the client to send a WebSocket ping to the server
+// every interval. If no pong is received within the given timeout (20 seconds if zero), the WebSocket connection is
+// closed and all RPCs on it fail with `codes.Unavailable`. This mirrors gRPC's own keepalive parameters and allows
+// detecting connections that were silently dropped by an intermediary.
+// This option has no effect unless `UseWebSocket(true)` is set.
+func WebSocketKeepalive(interval, timeout time.Duration) ConnectOption {
+	return wsKeepaliveOption{interval: interval, timeout: timeout}
+}
+
+// WebSocketFallback returns a connection option that instructs the client to send calls as downgraded gRPC-Web
+// requests if the server does not support WebSocket tunneling, i.e., responds to the WebSocket handshake with
+// `404 Not Found`, `405 Method Not Allowed`, `426 Upgrade Required` or `501 Not Implemented`. Note that client-streaming
+// and bidi-streaming calls only work in a limited fashion when downgraded. Without this option, such calls fail with
+// `codes.Unimplemented`.
+// This option has no effect unless `UseWebSocket(true)` is set.
+func WebSocketFallback() ConnectOption {
+	return wsFallbackOption{}
+}
+
+// WebSocketResume returns a connection option that instructs the client to reconnect up to maxAttempts times if the
+// WebSocket connection of a server-streaming call is lost before the call completes, and to resume the call from the
+// first response message not yet received. Calls are only resumed if the server announces support for it, which a
+// server using this library does if created with the `server.WebSocketResume()` option; the server handler is then
+// invoked again and must skip the messages already received (see `server.ResumeFrom`). Hence, the handler must be able
+// to reproduce the same sequence of messages, and any side effects it has may be repeated (at-least-once semantics).
+// Unary, client-streaming and bidi-streaming calls are never resumed.
+// This option has no effect unless `UseWebSocket(true)` is set.
+func WebSocketResume(maxAttempts int) ConnectOption {
+	return wsResumeOption(maxAttempts)
+}
+
+// WithWebSocketPath returns a connection option that instructs the client to send all WebSocket handshakes to the
+// given path (e.g., `/grpc-tunnel`), conveying the gRPC method in the `Grpc-Http1-Method` header instead, for
+// deployments behind routers that only forward WebSocket connections at specific paths. The server must be created
+// with the `server.WithWebSocketPath` option for the same path. Calls downgraded due to `WebSocketFallback` are not
+// affected. By default, the path of a WebSocket handshake is that of the gRPC method.
+// This option has no effect unless `UseWebSocket(true)` is set.
+func WithWebSocketPath(path string) ConnectOption {
+	return wsPathOption(path)
+}
+
+// WithWebSocketSubprotocol returns a connection option that instructs the client to request the given WebSocket
+// subprotocol instead of the default `grpc-ws`, for deployments behind routers that only forward WebSocket
+// connections with specific subprotocols. The server must be created with the `server.WithWebSocketSubprotocol`
+// option for the same subprotocol.
+// This option has no effect unless `UseWebSocket(true)` is set.
+func WithWebSocketSubprotocol(subprotocol string) ConnectOption {
+	return wsSubprotocolOption(subprotocol)
+}
+
+// WithWebSocketFlowControl returns a connection option that instructs the client to request credit-based flow control
+// for the responses of gRPC-WebSocket calls, with the given initial window in bytes. The server then stops sending
+// response messages once it has sent that many bytes more than the gRPC client has consumed, bounding the amount of
+// data buffered in the tunnel (e.g., by intermediaries) if the gRPC client reads slower than the server sends. As
+// messages are not split, the window may be exceeded by up to the size of one message. Flow control is only used if the
+// server confirms it, which a server using this library always does; other servers ignore the request, and responses
+// are then only subject to the flow control of the underlying connection, which is also the default.
+// This option has no effect unless `UseWebSocket(true)` is set.
+func WithWebSocketFlowControl(window uint32) ConnectOption {
+	return wsWindowOption(window)
+}
+
 // ForceDowngrade returns a connection option that instructs the
 // client to always force gRPC-Web downgrade for gRPC requests.
-// Client- or Bidi-streaming requests will not work.
+// Bidi-streaming requests will not work. Client-streaming requests only work with
+// servers instrumented via this library.
 // This option has no effect if websockets are being used.
 func ForceDowngrade(force bool) ConnectOption {
 	return forceDowngradeOption(force)
 }
 
+// WithAutoDowngrade returns a connection option that instructs the client to probe whether the endpoint, and any
+// proxy in between, agrees on HTTP/2 via ALPN before the first gRPC call. If so, calls are made via native gRPC over
+// HTTP/2; otherwise, e.g., because of an HTTP/1.1-only intermediary, all calls are downgraded as with
+// `ForceDowngrade(true)`. The probe is repeated until it succeeds, and its outcome then applies for the lifetime of the
+// client connection; the side channel, and hence the AuthInfo obtained from it, is unaffected by the decision.
+// Plaintext connections do not allow for ALPN and are always downgraded.
+// This option has no effect if websockets, `ForceDowngrade(true)` or `ForceHTTP2()` are being used.
+func WithAutoDowngrade() ConnectOption {
+	return autoDowngradeOption{}
+}
+
+// UseGRPCWeb returns a connection option that instructs the client to talk to the server using the gRPC-Web
+// protocol, the same way browser clients do. This allows connecting to standard gRPC-Web servers, e.g., those
+// fronted by Envoy's grpc_web filter. It implies `ForceDowngrade(true)` and, unless a custom content type is set
+// via `WithContentType`, the `application/grpc-web` content type.
+// Client-streaming and bidi-streaming calls are not supported in this mode and fail with `codes.Unimplemented`.
+// This option has no effect if websockets are being used.
+func UseGRPCWeb() ConnectOption {
+	return useGRPCWebOption{}
+}
+
 // WithContentType returns a connection option that instructs the
 // client to use a custom content type for sending requests to the server.
 func WithContentType(contentType string) ConnectOption {
 	return contentTypeOption(contentType)
 }
 
+// WithProxyTLSConfig returns a connection option that instructs the client to use the given TLS config when
+// connecting to an HTTPS proxy for establishing the side channel. If this option is not set, the certificate of the
+// proxy is verified against the system roots, and no client certificate is offered. The TLS config passed to
+// `ConnectViaProxy` is never used for proxies, as its client certificate is the identity of the caller towards the
+// endpoint, and its roots commonly only trust the endpoint. The ALPN protocols of the given config are ignored, as the
+// HTTP CONNECT request is always sent over HTTP/1.1.
+func WithProxyTLSConfig(tlsConf *tls.Config) ConnectOption {
+	return proxyTLSConfigOption{tlsConf: tlsConf}
+}
+
+// WithNoProxy returns a connection option that instructs the client to connect to the endpoint directly, both for the
+// side channel and for the connection carrying the gRPC requests. Proxies configured in the environment (via
+// `HTTP_PROXY`, `HTTPS_PROXY`, `ALL_PROXY` etc.) are ignored, regardless of `NO_PROXY`.
+func WithNoProxy() ConnectOption {
+	return noProxyOption{}
+}
+
+// WithProxyFunc returns a connection option that instructs the client to use the given function for determining the
+// proxy to connect to the endpoint through, both for the side channel and for the connection carrying the gRPC
+// requests. The function has the same semantics as the `Proxy` field of `http.Transport`: if it returns a nil URL, the
+// endpoint is connected to directly. Only the URL's scheme and host are meaningful, as the side channel is
+// established without a specific request. If this option is not set, the proxy is determined from the environment
+// like `http.ProxyFromEnvironment` does, but the environment is read when connecting instead of once per process;
+// `WithNoProxy()` takes precedence over this option. Errors returned by the function, as well as proxy URLs with an
+// unsupported scheme or without a host, are reported as *ProxyConfigError.
+func WithProxyFunc(proxy func(*http.Request) (*url.URL, error)) ConnectOption {
+	return proxyFuncOption(proxy)
+}
+
+// WithProxyConfigFallback returns a connection option that instructs the client to connect to the endpoint directly
+// if the proxy configuration is invalid (see *ProxyConfigError), e.g., because of a malformed `HTTPS_PROXY`
+// environment variable, logging a warning via the logger set with `WithLogger`. By default, connecting fails with a
+// *ProxyConfigError in this case, since connecting directly may be prohibited by the network.
+func WithProxyConfigFallback() ConnectOption {
+	return proxyFallbackOption{}
+}
+
+// WithDialer returns a connection option that instructs the client to use the given dialer for establishing the
+// side channel connection, both to the endpoint and to a proxy, if any. This allows configuring timeouts, keepalive
+// settings or a custom resolver. If this option is not set, a zero `net.Dialer` is used.
+func WithDialer(dialer ContextDialer) ConnectOption {
+	return dialerOption{dialer: dialer}
+}
+
+// WithFailoverEndpoints returns a connection option that instructs the client to fall back to the given endpoints (each
+// a host and port) if connecting to the endpoint passed to `ConnectViaProxy` fails. The endpoints are tried in the given
+// order until a connection is established, both for the side channel handshake and for the connections carrying gRPC
+// calls; if all fail, a *FailoverError is returned. All endpoints must present certificates valid for the original
+// endpoint (or the server name set in the TLS config), which is also used as the host of HTTP requests. The context
+// deadline and the dial timeout apply to the entire sequence of attempts.
+//
+// This option is ignored when connecting to a Unix domain socket.
+func WithFailoverEndpoints(endpoints ...string) ConnectOption {
+	return failoverEndpointsOption(endpoints)
+}
+
+// WithDialTimeout returns a connection option that bounds establishing a connection to the endpoint by the given
+// timeout, failing with a "dial timed out" error once it expires. This applies to every side channel handshake,
+// including connecting through a proxy, to every connection established when `ForceHTTP2()` is set, and, if the
+// `grpc.WithBlock()` dial option is passed, to `ConnectViaProxy` as a whole. The timeout does not override the
+// deadline of the context passed to `ConnectViaProxy`; whichever expires first applies.
+func WithDialTimeout(timeout time.Duration) ConnectOption {
+	return dialTimeoutOption(timeout)
+}
+
+// WithSideChannelAuthInfoTTL returns a connection option that instructs the client to re-run the side channel
+// handshake if the identity of the endpoint was established more than the given duration ago. This is useful for
+// endpoints with short-lived certificates. By default, the identity is never re-established.
+func WithSideChannelAuthInfoTTL(ttl time.Duration) ConnectOption {
+	return sideChannelAuthInfoTTLOption(ttl)
+}
+
+// WithSideChannel returns a connection option that instructs the client to store a handle to the side channel in
+// the given variable. This allows inspecting the identity of the endpoint (e.g., the validated peer certificate
+// chain) once the connection has been established. The handle is only set if a non-nil TLS config is passed to
+// `ConnectViaProxy`.
+func WithSideChannel(sideChannel *SideChannel) ConnectOption {
+	return sideChannelOption{sideChannel: sideChannel}
+}
+
+// WithSideChannelRetry returns a connection option that instructs the client to retry a failed side channel handshake
+// up to maxAttempts attempts in total, waiting baseDelay before the first retry and doubling the delay with every
+// further retry. Only transient failures, such as DNS or connection errors, are retried; failures caused by the
+// endpoint's certificate failing verification or by the endpoint or proxy rejecting the client fail immediately.
+// Retrying stops once the context of the handshake expires.
+func WithSideChannelRetry(maxAttempts int, baseDelay time.Duration) ConnectOption {
+	return sideChannelRetryOption{maxAttempts: maxAttempts, baseDelay: baseDelay}
+}
+
+// WithSideChannelSessionCache returns a connection option that instructs the client to resume TLS sessions for
+// repeated side channel handshakes (e.g., when gRPC reconnects before the identity of the endpoint could be cached,
+// or after it expired), using the given session cache. If cache is nil, an LRU cache of default capacity is used.
+// To receive the session tickets sent by TLS 1.3 servers after the handshake, side channel connections are kept
+// open for up to a second in the background instead of being closed right away. By default, sessions are not
+// resumed.
+func WithSideChannelSessionCache(cache tls.ClientSessionCache) ConnectOption {
+	if cache == nil {
+		cache = tls.NewLRUClientSessionCache(0)
+	}
+	return sideChannelSessionCacheOption{cache: cache}
+}
+
+// WithSideChannelALPN returns a connection option that instructs the client to offer exactly the given ALPN protocols
+// in the side channel handshake, e.g., `http/1.1` to match what the tunnel negotiates, or `h2` to verify that the
+// endpoint supports HTTP/2. The negotiated protocol can be obtained from the `credentials.TLSInfo` returned by
+// `SideChannel.AuthInfo`. The ALPN protocols of the connections carrying gRPC calls are not affected. By default, the
+// side channel offers the protocols of the TLS config passed to `ConnectViaProxy`, plus `h2`.
+func WithSideChannelALPN(protos ...string) ConnectOption {
+	return sideChannelALPNOption(protos)
+}
+
+// WithHTTPStatusMapper returns a connection option that instructs the client to use the given function for
+// determining the gRPC status code of a call that fails because the proxy or the endpoint responded with an HTTP
+// error status (e.g., a 502 from a load balancer). By default, `DefaultHTTPStatusMapper` is used.
+func WithHTTPStatusMapper(mapper func(statusCode int) codes.Code) ConnectOption {
+	return httpStatusMapperOption(mapper)
+}
+
+// WithMaxFrameSize sets the maximum payload size of downgraded gRPC frames received from the server. Frames
+// exceeding this size are rejected based on their header, without reading them, and the RPC fails with a
+// `ResourceExhausted` error. If size is zero, the default of 4MB is used.
+func WithMaxFrameSize(size uint32) ConnectOption {
+	return maxFrameSizeOption(size)
+}
+
+// WithMaxResponseBytes limits the total size of the response to every call received over the tunnel, across all of
+// its frames, to the given number of bytes. This complements `WithMaxFrameSize` as a defense against endpoints sending
+// unbounded data. Calls receiving larger responses fail with a `ResourceExhausted` error, and the connection they were
+// received over is closed. The limit applies to streaming calls as well, bounding the total size of all messages. If n
+// is zero or negative, the size of responses is not limited, which is the default.
+func WithMaxResponseBytes(n int64) ConnectOption {
+	return maxResponseBytesOption(n)
+}
+
+// WithMaxResponseHeaderBytes limits the size of the headers of responses to HTTP CONNECT requests sent to proxies, and
+// of responses to the HTTP requests tunneling gRPC calls, to the given number of bytes. This protects the client
+// against malicious or malfunctioning intermediaries sending unbounded headers. Calls receiving responses with larger
+// headers fail. If n is zero or negative, the default of 1MB is used.
+func WithMaxResponseHeaderBytes(n int) ConnectOption {
+	return maxResponseHeaderBytesOption(n)
+}
+
+// WithMaxMetadataBytes returns a connection option that instructs the client to fail calls with `codes.InvalidArgument`
+// before sending them if their outgoing metadata exceeds the given size. The size is computed like the size of an
+// HTTP/2 header list, i.e., as the length of every key and value (base64-encoded for binary metadata) plus 32 bytes per
+// value. Headers added by gRPC itself or via `WithRequestHeaders` are not counted.
+//
+// Metadata is sent as HTTP headers, which proxies limit in size: nginx, for instance, rejects requests with a header
+// line exceeding 8 KiB by default, and others may silently drop oversized headers. Setting a limit below the limits of
+// all intermediaries makes such calls fail early with a clear error. By default, the size is not limited.
+func WithMaxMetadataBytes(n int) ConnectOption {
+	return maxMetadataBytesOption(n)
+}
+
+// WithRequestHeaders returns a connection option that instructs the client to add the given headers to every HTTP
+// request carrying a gRPC call, e.g., for passing a static API key or a routing header to an API gateway.
+// Headers set from the metadata of the gRPC call take precedence over the given headers. Headers required for
+// tunneling (such as `Content-Type`, `TE`, `Connection`, `Upgrade`, `Expect` and `Host`, as well as all `Grpc-*` and
+// `Sec-WebSocket-*` headers) are never set, nor are the `User-Agent` and `X-User-Agent` headers (see `WithUserAgent`).
+// Use `WithHostHeader` to set the `Host` header.
+func WithRequestHeaders(hdr http.Header) ConnectOption {
+	return requestHeadersOption(hdr.Clone())
+}
+
+// WithByteCounter returns a connection option that instructs the client to call the given function once a gRPC stream
+// is finished, with the number of bytes sent to and received from the endpoint for the stream. The counts comprise
+// the gRPC frames including their 5-byte headers, as well as the headers and trailers frames of downgraded and
+// WebSocket responses and the end-of-stream frame of WebSocket requests. HTTP headers, HTTP/2 trailers, and the
+// framing of the underlying HTTP or WebSocket connection are not included. The function may be called concurrently.
+func WithByteCounter(cb ByteCounterFunc) ConnectOption {
+	return byteCounterOption(cb)
+}
+
+// WithPeerCertPinning returns a connection option that instructs the client to verify the identity of the endpoint
+// additionally by the public key of its certificate. After the side channel handshake, which verifies the certificate
+// as usual, the SHA-256 fingerprint of the DER-encoded SubjectPublicKeyInfo of the leaf certificate must match one of
+// the given fingerprints (as used for HTTP public key pinning, but not base64-encoded). Otherwise, connecting fails with
+// a *HandshakeError wrapping ErrCertificateNotPinned. Pass the fingerprints of the current and the next key in order to
+// rotate keys. Only the side channel is subject to pinning, hence a TLS config must be passed to `ConnectViaProxy`, and
+// the option has no effect for `TunnelDialer`.
+func WithPeerCertPinning(fingerprints ...[]byte) ConnectOption {
+	pins := make(peerCertPinsOption, 0, len(fingerprints))
+	for _, fingerprint := range fingerprints {
+		pins = append(pins, append([]byte(nil), fingerprint...))
+	}
+	return pins
+}
+
+// WithStatsHandler returns a connection option that instructs the client to notify the given handler whenever it
+// starts and finishes forwarding a gRPC stream, and whenever a handshake for connecting to the endpoint has completed
+// or failed, e.g., for exporting metrics (see the `metrics` package). HTTP CONNECT requests are only reported if sent
+// by the client itself, which is the case for the side channel, as well as for calls if `ForceHTTP2()` or
+// `WithFailoverEndpoints(...)` is used; otherwise, calls are forwarded via the HTTP client of the standard library.
+func WithStatsHandler(handler StatsHandler) ConnectOption {
+	return statsHandlerOption{handler: handler}
+}
+
+// WithPathRewriter returns a connection option that instructs the client to send gRPC calls to the HTTP path returned
+// by the given function for the full method name of the call (e.g., `/grpc.health.v1.Health/Check`), instead of to the
+// method name itself. This allows passing path-based routers that cannot match arbitrary gRPC method paths. The method
+// name is conveyed in the `Grpc-Http1-Method` header; a server using this library must be created with the
+// `server.WithMethodHeader()` option to take it from there. If the rewritten path merely prepends a prefix to the
+// method name, the `server.WithPathPrefix` option can be used instead.
+func WithPathRewriter(rewrite func(method string) string) ConnectOption {
+	return pathRewriterOption(rewrite)
+}
+
+// WithUserAgent returns a connection option that sets the `User-Agent` header of the HTTP requests tunneling gRPC calls,
+// as well as of HTTP CONNECT requests to proxies, to the given value. By default, tunneling requests carry the user
+// agent of the gRPC client, and CONNECT requests use `go-grpc-http1/<version>`. If set, the user agent of the gRPC
+// client is conveyed in the `X-User-Agent` header instead, from which a server using this library restores the
+// `user-agent` metadata; other servers report the given value as the gRPC user agent. This option is ignored for calls
+// sent via `ForceHTTP2()`.
+func WithUserAgent(userAgent string) ConnectOption {
+	return userAgentOption(userAgent)
+}
+
+// WithXUserAgent returns a connection option that sets the `X-User-Agent` header of the HTTP requests tunneling gRPC
+// calls to the given value, replacing the user agent of the gRPC client. Browser-based gRPC-Web clients identify
+// themselves via this header, as browsers control the `User-Agent` header, hence this is useful for impersonating such
+// clients, e.g., together with `UseGRPCWeb()`. A server using this library takes the `user-agent` metadata of
+// gRPC-Web, WebSocket and downgraded calls from the `X-User-Agent` header; for native gRPC calls, `x-user-agent` is
+// regular metadata. This option is ignored for calls sent via `ForceHTTP2()`.
+func WithXUserAgent(xUserAgent string) ConnectOption {
+	return xUserAgentOption(xUserAgent)
+}
+
+// WithTLSServerName returns a connection option that sets the server name used for TLS connections to the endpoint,
+// both for SNI and for verifying the endpoint's certificate, overriding the `ServerName` of the TLS config passed to
+// `ConnectViaProxy`. This applies to the side channel as well as to the connections carrying gRPC calls, such that an
+// endpoint can be dialed by address (e.g., `10.0.0.5:443`) while presenting a different name (e.g., `api.internal`).
+// Without this option and without a server name in the TLS config, the side channel verifies the certificate against
+// the authority of the gRPC client connection, which differs from the endpoint unless set via `grpc.WithAuthority`.
+// The option has no effect for plaintext connections.
+func WithTLSServerName(serverName string) ConnectOption {
+	return tlsServerNameOption(serverName)
+}
+
+// WithHostHeader returns a connection option that sets the `Host` header (the `:authority` for HTTP/2) of the HTTP
+// requests carrying gRPC calls, including WebSocket handshake requests, to the given value. This is useful for
+// reaching a service behind an ingress that routes by `Host` while dialing a specific address. The address dialed,
+// the target of HTTP CONNECT requests to proxies, and the TLS server name (see `WithTLSServerName`) are not affected.
+// By default, the endpoint passed to `ConnectViaProxy` is used.
+func WithHostHeader(host string) ConnectOption {
+	return hostHeaderOption(host)
+}
+
+// WithTunnelTLSConfig returns a connection option that sets the TLS config for the connections carrying gRPC calls
+// to the endpoint (the "tunnel"), e.g., to use different ALPN protocols, a session cache or cipher suites when
+// talking to a TLS-terminating proxy. The TLS config passed to `ConnectViaProxy` is then only used for the side
+// channel, which establishes the identity of the endpoint. A server name set via `WithTLSServerName` applies to both.
+// Without this option, the tunnel uses the TLS config passed to `ConnectViaProxy` as well. For `ConnectViaProxy`, the
+// option has no effect if no TLS config is passed, i.e., for plaintext connections. For `TunnelDialer`, which has no
+// TLS config of its own, this option is the only way to connect to the endpoint via TLS.
+func WithTunnelTLSConfig(tlsConf *tls.Config) ConnectOption {
+	return tunnelTLSConfigOption{tlsConf: tlsConf}
+}
+
+// WithKeepAlive returns a connection option that controls whether HTTP/1.x connections to the endpoint are kept open
+// and reused for subsequent downgraded calls. Keep-alive is enabled by default, such that frequent unary calls (e.g.,
+// health check probes) share a single TCP (and TLS) connection instead of establishing a new one per call. Passing
+// `false` closes the connection after each call, which may be needed for intermediaries that mishandle persistent
+// connections. The option has no effect on WebSocket connections, which carry a single call each, or on HTTP/2
+// connections, which are always shared.
+func WithKeepAlive(enabled bool) ConnectOption {
+	return keepAliveOption(enabled)
+}
+
+// WithConnectionClose returns a connection option that sends the HTTP/1.x requests tunneling downgraded calls with a
+// `Connection: close` header, and never reuses their connections. This works around stateful intermediaries that
+// corrupt subsequent requests on a persistent connection, at the cost of a new TCP (and TLS) handshake for every call,
+// which notably increases the latency and CPU usage of frequent unary calls. It is equivalent to
+// `WithKeepAlive(false)`, and likewise has no effect on WebSocket and HTTP/2 connections.
+func WithConnectionClose() ConnectOption {
+	return keepAliveOption(false)
+}
+
+// WithReadBufferSize returns a connection option that sets the size of the buffer used for reading from HTTP/1.x
+// connections to the endpoint (or the proxy), which carry downgraded and WebSocket calls. Larger buffers reduce the
+// number of read syscalls for workloads with large messages. A non-positive size selects the default of 4 KiB.
+func WithReadBufferSize(size int) ConnectOption {
+	return readBufferSizeOption(size)
+}
+
+// WithWriteBufferSize returns a connection option that sets the size of the buffer used for writing to HTTP/1.x
+// connections to the endpoint (or the proxy), which carry downgraded and WebSocket calls. Larger buffers reduce the
+// number of write syscalls for workloads with large messages. A non-positive size selects the default of 4 KiB.
+func WithWriteBufferSize(size int) ConnectOption {
+	return writeBufferSizeOption(size)
+}
+
+// WithRoundTripInterceptor returns a connection option that passes the HTTP requests tunneling gRPC calls to the
+// endpoint, and their responses, to the given functions, e.g., for debugging interoperability issues with
+// intermediaries. The onRequest function is called right before a request is sent, with all headers set, and returns
+// the request to send instead, or nil to send the given request. The onResponse function is called once the response
+// headers have been received, before the response is translated back to gRPC. For WebSocket connections, the functions
+// are called for the handshake only. Either function may be nil, and both may be called concurrently. Functions reading
+// or replacing request or response bodies must preserve streaming, and are responsible for the consequences otherwise.
+func WithRoundTripInterceptor(onRequest func(*http.Request) *http.Request, onResponse func(*http.Response)) ConnectOption {
+	return roundTripInterceptorOption{onRequest: onRequest, onResponse: onResponse}
+}
+
+// WithLogger returns a connection option that logs diagnostic messages to the given logger, such as the proxy used for
+// connecting to the endpoint, the outcome of HTTP CONNECT requests and side channel handshakes, whether calls are
+// downgraded, and malformed responses. By default, these messages are discarded.
+func WithLogger(logger Logger) ConnectOption {
+	return loggerOption{logger: logger}
+}
+
+// WithStrictContentType returns a connection option that instructs the client to reject downgraded responses whose
+// content type is not a gRPC or gRPC-Web one. By default, responses with a missing or generic content type (i.e.,
+// `application/octet-stream`) are accepted as gRPC-Web responses if their body starts with a well-formed gRPC-Web
+// frame, as some servers do not set the content type properly.
+func WithStrictContentType() ConnectOption {
+	return strictContentTypeOption{}
+}
+
+// WithStreamIdleTimeout returns a connection option that instructs the client to abort calls with a `DeadlineExceeded`
+// status once no gRPC frame has been sent to or received from the endpoint for the given duration, e.g., because the
+// connection silently stalled behind a proxy. Streams that are expected to be idle for longer need to send messages
+// periodically. WebSocket keepalive pings do not count as frames. Unary calls are not affected, as they cannot send
+// anything while waiting for the response; their duration is bounded by their deadline. A duration less than or equal
+// to zero disables the timeout, which is the default.
+func WithStreamIdleTimeout(d time.Duration) ConnectOption {
+	return streamIdleTimeoutOption(d)
+}
+
 type dialOptsOption []grpc.DialOption
 
 func (o dialOptsOption) apply(opts *connectOptions) {
@@ -97,14 +587,342 @@ func (o useWebSocketOption) apply(opts *connectOptions) {
 	opts.useWebSocket = bool(o)
 }
 
+type wsCompressionOption struct{}
+
+func (wsCompressionOption) apply(opts *connectOptions) {
+	opts.wsCompression = true
+}
+
+type wsFallbackOption struct{}
+
+func (wsFallbackOption) apply(opts *connectOptions) {
+	opts.wsFallback = true
+}
+
+type wsResumeOption int
+
+func (o wsResumeOption) apply(opts *connectOptions) {
+	opts.wsResume = int(o)
+}
+
+type wsPathOption string
+
+func (o wsPathOption) apply(opts *connectOptions) {
+	opts.wsPath = string(o)
+}
+
+type wsSubprotocolOption string
+
+func (o wsSubprotocolOption) apply(opts *connectOptions) {
+	opts.wsSubprotocol = string(o)
+}
+
+type wsWindowOption uint32
+
+func (o wsWindowOption) apply(opts *connectOptions) {
+	opts.wsWindow = uint32(o)
+}
+
+type wsKeepaliveOption struct {
+	interval time.Duration
+	timeout  time.Duration
+}
+
+func (o wsKeepaliveOption) apply(opts *connectOptions) {
+	opts.wsKeepalive = o
+}
+
+type useGRPCWebOption struct{}
+
+func (useGRPCWebOption) apply(opts *connectOptions) {
+	opts.useGRPCWeb = true
+}
+
 type forceDowngradeOption bool
 
 func (o forceDowngradeOption) apply(opts *connectOptions) {
 	opts.forceDowngrade = bool(o)
 }
 
+type autoDowngradeOption struct{}
+
+func (autoDowngradeOption) apply(opts *connectOptions) {
+	opts.autoDowngrade = true
+}
+
 type contentTypeOption string
 
 func (o contentTypeOption) apply(opts *connectOptions) {
 	opts.contentType = string(o)
 }
+
+type proxyTLSConfigOption struct {
+	tlsConf *tls.Config
+}
+
+func (o proxyTLSConfigOption) apply(opts *connectOptions) {
+	opts.proxyTLSConfig = o.tlsConf
+}
+
+type noProxyOption struct{}
+
+func (noProxyOption) apply(opts *connectOptions) {
+	opts.noProxy = true
+}
+
+type proxyFuncOption func(*http.Request) (*url.URL, error)
+
+func (o proxyFuncOption) apply(opts *connectOptions) {
+	opts.proxy = o
+}
+
+type proxyFallbackOption struct{}
+
+func (proxyFallbackOption) apply(opts *connectOptions) {
+	opts.proxyFallback = true
+}
+
+type dialerOption struct {
+	dialer ContextDialer
+}
+
+func (o dialerOption) apply(opts *connectOptions) {
+	opts.dialer = o.dialer
+}
+
+type dialTimeoutOption time.Duration
+
+func (o dialTimeoutOption) apply(opts *connectOptions) {
+	opts.dialTimeout = time.Duration(o)
+}
+
+type sideChannelAuthInfoTTLOption time.Duration
+
+func (o sideChannelAuthInfoTTLOption) apply(opts *connectOptions) {
+	opts.sideChannelAuthInfoTTL = time.Duration(o)
+}
+
+type sideChannelOption struct {
+	sideChannel *SideChannel
+}
+
+func (o sideChannelOption) apply(opts *connectOptions) {
+	opts.sideChannel = o.sideChannel
+}
+
+type sideChannelRetryOption struct {
+	maxAttempts int
+	baseDelay   time.Duration
+}
+
+func (o sideChannelRetryOption) apply(opts *connectOptions) {
+	opts.sideChannelRetry = o
+}
+
+type sideChannelSessionCacheOption struct {
+	cache tls.ClientSessionCache
+}
+
+func (o sideChannelSessionCacheOption) apply(opts *connectOptions) {
+	opts.sideChannelSessions = o.cache
+}
+
+type sideChannelALPNOption []string
+
+func (o sideChannelALPNOption) apply(opts *connectOptions) {
+	opts.sideChannelALPNs = append([]string{}, o...)
+}
+
+type httpStatusMapperOption func(int) codes.Code
+
+func (o httpStatusMapperOption) apply(opts *connectOptions) {
+	opts.httpStatusMapper = o
+}
+
+type maxResponseBytesOption int64
+
+func (o maxResponseBytesOption) apply(opts *connectOptions) {
+	opts.maxResponseBytes = int64(o)
+}
+
+type maxResponseHeaderBytesOption int
+
+func (o maxResponseHeaderBytesOption) apply(opts *connectOptions) {
+	opts.maxResponseHeaderBytes = int(o)
+}
+
+type maxFrameSizeOption uint32
+
+func (o maxFrameSizeOption) apply(opts *connectOptions) {
+	opts.maxFrameSize = uint32(o)
+}
+
+type maxMetadataBytesOption int
+
+func (o maxMetadataBytesOption) apply(opts *connectOptions) {
+	opts.maxMetadataBytes = int(o)
+}
+
+type requestHeadersOption http.Header
+
+func (o requestHeadersOption) apply(opts *connectOptions) {
+	opts.requestHeaders = http.Header(o)
+}
+
+type byteCounterOption ByteCounterFunc
+
+func (o byteCounterOption) apply(opts *connectOptions) {
+	opts.byteCounter = ByteCounterFunc(o)
+}
+
+type pathRewriterOption func(method string) string
+
+func (o pathRewriterOption) apply(opts *connectOptions) {
+	opts.pathRewriter = o
+}
+
+type userAgentOption string
+
+func (o userAgentOption) apply(opts *connectOptions) {
+	opts.userAgent = string(o)
+}
+
+type xUserAgentOption string
+
+func (o xUserAgentOption) apply(opts *connectOptions) {
+	opts.xUserAgent = string(o)
+}
+
+type tlsServerNameOption string
+
+func (o tlsServerNameOption) apply(opts *connectOptions) {
+	opts.tlsServerName = string(o)
+}
+
+type hostHeaderOption string
+
+func (o hostHeaderOption) apply(opts *connectOptions) {
+	opts.hostHeader = string(o)
+}
+
+type tunnelTLSConfigOption struct {
+	tlsConf *tls.Config
+}
+
+func (o tunnelTLSConfigOption) apply(opts *connectOptions) {
+	opts.tunnelTLSConfig = o.tlsConf
+}
+
+type keepAliveOption bool
+
+func (o keepAliveOption) apply(opts *connectOptions) {
+	opts.disableKeepAlives = !bool(o)
+}
+
+type readBufferSizeOption int
+
+func (o readBufferSizeOption) apply(opts *connectOptions) {
+	opts.readBufferSize = int(o)
+}
+
+type writeBufferSizeOption int
+
+func (o writeBufferSizeOption) apply(opts *connectOptions) {
+	opts.writeBufferSize = int(o)
+}
+
+type roundTripInterceptorOption struct {
+	onRequest  func(*http.Request) *http.Request
+	onResponse func(*http.Response)
+}
+
+func (o roundTripInterceptorOption) apply(opts *connectOptions) {
+	opts.onRequest = o.onRequest
+	opts.onResponse = o.onResponse
+}
+
+// newConnectOptions applies the given options, and fills in the defaults for any settings they leave unset.
+func newConnectOptions(opts []ConnectOption) connectOptions {
+	var connectOpts connectOptions
+	for _, opt := range opts {
+		opt.apply(&connectOpts)
+	}
+
+	if connectOpts.useGRPCWeb {
+		connectOpts.forceDowngrade = true
+		if connectOpts.contentType == "" {
+			connectOpts.contentType = "application/grpc-web"
+		}
+	}
+	if connectOpts.httpStatusMapper == nil {
+		connectOpts.httpStatusMapper = DefaultHTTPStatusMapper
+	}
+	if connectOpts.maxFrameSize == 0 {
+		connectOpts.maxFrameSize = grpcproto.DefaultMaxFrameSize
+	}
+	if connectOpts.maxResponseHeaderBytes <= 0 {
+		connectOpts.maxResponseHeaderBytes = defaultMaxResponseHeaderBytes
+	}
+	return connectOpts
+}
+
+// proxyFunc returns the function determining the proxy for a request to the endpoint, or nil if the endpoint is to
+// be connected to directly.
+func (o *connectOptions) proxyFunc() func(*http.Request) (*url.URL, error) {
+	if o.noProxy {
+		return nil
+	}
+	proxy := o.proxy
+	if proxy == nil {
+		proxy = proxyFromEnvironment()
+	}
+	return checkedProxyFunc(proxy, o.proxyFallback, o.getLogger())
+}
+
+type failoverEndpointsOption []string
+
+func (o failoverEndpointsOption) apply(opts *connectOptions) {
+	opts.failoverEndpoints = append(opts.failoverEndpoints, o...)
+}
+
+type strictContentTypeOption struct{}
+
+func (strictContentTypeOption) apply(opts *connectOptions) {
+	opts.strictContentType = true
+}
+
+type streamIdleTimeoutOption time.Duration
+
+func (o streamIdleTimeoutOption) apply(opts *connectOptions) {
+	opts.streamIdleTimeout = time.Duration(o)
+}
+
+type peerCertPinsOption [][]byte
+
+func (o peerCertPinsOption) apply(opts *connectOptions) {
+	opts.peerCertPins = append(opts.peerCertPins, o...)
+}
+
+type statsHandlerOption struct {
+	handler StatsHandler
+}
+
+func (o statsHandlerOption) apply(opts *connectOptions) {
+	opts.statsHandler = o.handler
+}
+
+type loggerOption struct {
+	logger Logger
+}
+
+func (o loggerOption) apply(opts *connectOptions) {
+	opts.logger = o.logger
+}
+
+// getLogger returns the logger for diagnostic messages, which discards them if none is configured.
+func (o *connectOptions) getLogger() Logger {
+	if o.logger == nil {
+		return nopLogger{}
+	}
+	return o.logger
+}
@@ -21,8 +21,8 @@ import (
 	"net"
 	"net/http"
 	"net/http/httputil"
+	"strings"
 
-	"github.com/golang/glog"
 	"github.com/pkg/errors"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
@@ -35,60 +35,131 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
 )
 
-func modifyResponse(resp *http.Response) error {
+var (
+	// responseHeadersOnly are the headers of a Trailers-Only response that pertain to the HTTP response rather than
+	// to the gRPC status or metadata.
+	responseHeadersOnly = map[string]struct{}{
+		"Content-Type":   {},
+		"Content-Length": {},
+		"Date":           {},
+		"Trailer":        {},
+	}
+)
+
+func modifyResponse(resp *http.Response, maxFrameSize uint32, maxResponseBytes int64, strictContentType bool, logger Logger) error {
 	// Check if the response is an error response right away, and attempt to display a more useful
 	// message than gRPC does by default. We still delegate to the default gRPC behavior for 200 responses
 	// which are otherwise invalid.
 	if err := httputils.ExtractResponseError(resp); err != nil {
-		return errors.Wrap(err, "receiving gRPC response from remote endpoint")
+		return &httpStatusError{
+			statusCode: resp.StatusCode,
+			err:        errors.Wrap(err, "receiving gRPC response from remote endpoint"),
+		}
+	}
+
+	if !strictContentType && resp.Body != nil && hasGenericContentType(resp.Header.Get("Content-Type")) {
+		// Some servers send gRPC-Web responses without a proper content type. Accept them if they look like one.
+		var isGRPCWeb bool
+		resp.Body, isGRPCWeb = sniffGRPCWebBody(resp.Body, maxFrameSize)
+		if isGRPCWeb {
+			logger.Debugf("Treating response with content type %q as gRPC-Web", resp.Header.Get("Content-Type"))
+			resp.Header.Set("Content-Type", "application/grpc-web")
+		}
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/grpc") {
+		// Not a gRPC response at all (e.g., an HTML page served by a misconfigured reverse proxy), which the gRPC
+		// client would only report by its content type.
+		return &httpStatusError{
+			statusCode: resp.StatusCode,
+			err:        errors.Wrap(httputils.ResponseError(resp), "receiving non-gRPC response from remote endpoint"),
+		}
+	}
+
+	grpcproto.SplitBinaryMetadata(resp.Header)
+	if resp.Header.Get("Grpc-Status") != "" {
+		// Trailers-Only response.
+		moveStatusToTrailers(resp)
 	}
 
 	if resp.ContentLength == 0 {
 		// Make sure headers do not get flushed, as otherwise the gRPC client will complain about missing trailers.
 		resp.Header.Set(dontFlushHeadersHeaderKey, "true")
 	}
-	contentType, contentSubType := stringutils.Split2(resp.Header.Get("Content-Type"), "+")
-	if contentType != "application/grpc-web" {
-		// No modification necessary if we aren't handling a gRPC web response.
-		return nil
+	if resp.Body != nil {
+		resp.Body = newLimitedResponseBody(resp.Body, maxResponseBytes)
 	}
+	contentType, contentSubType := stringutils.Split2(resp.Header.Get("Content-Type"), "+")
+	if contentType == "application/grpc-web" {
+		respCT := "application/grpc"
+		if contentSubType != "" {
+			respCT += "+" + contentSubType
+		}
+		resp.Header.Set("Content-Type", respCT)
 
-	respCT := "application/grpc"
-	if contentSubType != "" {
-		respCT += "+" + contentSubType
+		if resp.Body != nil {
+			resp.Body = grpcweb.NewResponseReader(resp.Body, &resp.Trailer, nil, maxFrameSize)
+		}
 	}
-	resp.Header.Set("Content-Type", respCT)
 
-	if resp.Body != nil {
-		resp.Body = grpcweb.NewResponseReader(resp.Body, &resp.Trailer, nil)
+	if resp.Body != nil && resp.Request != nil {
+		resp.Body = newTerminatingReader(resp.Request.Context(), resp.Body, &resp.Trailer, logger)
 	}
 	return nil
 }
 
-// Fake a gRPC status with the given transport error
-func writeError(w http.ResponseWriter, err error) {
+// moveStatusToTrailers moves the gRPC status and metadata of a Trailers-Only response from the headers to the
+// trailers. The headers might be sent to the gRPC client before it is known that the response body is empty, in which
+// case the client would not treat them as trailers and report that no trailers were received.
+func moveStatusToTrailers(resp *http.Response) {
+	if resp.Trailer == nil {
+		resp.Trailer = make(http.Header)
+	}
+	for k, vs := range resp.Header {
+		if _, ok := responseHeadersOnly[k]; ok {
+			continue
+		}
+		resp.Trailer[k] = append(resp.Trailer[k], vs...)
+		delete(resp.Header, k)
+	}
+}
+
+// Fake a gRPC status with the given transport error. If the error was caused by an HTTP error response, the
+// gRPC status code is determined by the given status mapper.
+func writeError(w http.ResponseWriter, err error, statusMapper func(int) codes.Code) {
 	w.Header().Set("Content-Type", "application/grpc")
 	w.Header().Add("Trailer", "Grpc-Status")
 	w.Header().Add("Trailer", "Grpc-Message")
 	w.WriteHeader(http.StatusOK)
 
-	w.Header().Set("Grpc-Status", fmt.Sprintf("%d", codes.Unavailable))
+	code := codes.Unavailable
+	var statusErr *httpStatusError
+	if errors.Is(err, context.DeadlineExceeded) {
+		code = codes.DeadlineExceeded
+	} else if errors.Is(err, errWebSocketUnsupported) {
+		code = codes.Unimplemented
+	} else if errors.As(err, &statusErr) {
+		code = statusMapper(statusErr.statusCode)
+	}
+	w.Header().Set("Grpc-Status", fmt.Sprintf("%d", code))
 	errMsg := errors.Wrap(err, "transport").Error()
 	w.Header().Set("Grpc-Message", grpcproto.EncodeGrpcMessage(errMsg))
 }
 
-func createReverseProxy(endpoint string, transport http.RoundTripper, insecure, forceDowngrade bool, contentType string) *httputil.ReverseProxy {
+func createReverseProxy(endpoint string, transport http.RoundTripper, insecure bool, connectOpts connectOptions) *httputil.ReverseProxy {
 	scheme := "https"
 	if insecure {
 		scheme = "http"
 	}
 	return &httputil.ReverseProxy{
 		Director: func(req *http.Request) {
-			if forceDowngrade {
+			if connectOpts.forceDowngrade || isDowngradeRequested(req.Context()) {
 				req.ProtoMajor, req.ProtoMinor, req.Proto = 1, 1, "HTTP/1.1"
-				req.Header.Del("TE")
+				// Declare support for trailers, which servers may send in the trailer section of the HTTP/1.1
+				// response. The Grpc-Web-Only header still makes the server respond in gRPC-Web format.
+				req.Header.Set("TE", "trailers")
 				req.Header.Del("Accept")
 				req.Header.Add(grpcweb.GRPCWebOnlyHeader, "true")
 			} else {
@@ -96,67 +167,154 @@ func createReverseProxy(endpoint string, transport http.RoundTripper, insecure,
 			}
 			req.Header.Add("Accept", "application/grpc-web")
 
-			if len(contentType) > 0 {
+			if len(connectOpts.contentType) > 0 {
 				// Replacing old content type (e.g., application/grpc), to an overridden content type.
 				// Without removing old header, some gRPC-Web servers will not work,
 				// because an HTTP client will send both old and new header values.
-				req.Header.Set("Content-Type", contentType)
+				req.Header.Set("Content-Type", connectOpts.contentType)
+			}
+
+			addRequestHeaders(req.Header, connectOpts.requestHeaders)
+			if !connectOpts.forceHTTP2 {
+				setUserAgent(req.Header, connectOpts.userAgent, connectOpts.xUserAgent)
 			}
+			rewritePath(req.URL, req.Header, connectOpts.pathRewriter)
 
 			req.URL.Scheme = scheme
 			req.URL.Host = endpoint
+			if connectOpts.hostHeader != "" {
+				req.Host = connectOpts.hostHeader
+			}
+		},
+		Transport: transport,
+		ModifyResponse: func(resp *http.Response) error {
+			if resp.Body != nil && resp.Request != nil {
+				resp.Body = countReceived(resp.Request.Context(), resp.Body)
+			}
+			return modifyResponse(resp, connectOpts.maxFrameSize, connectOpts.maxResponseBytes, connectOpts.strictContentType, connectOpts.getLogger())
 		},
-		Transport:      transport,
-		ModifyResponse: modifyResponse,
 		ErrorHandler: func(w http.ResponseWriter, _ *http.Request, err error) {
-			writeError(w, err)
+			writeError(w, err, connectOpts.httpStatusMapper)
 		},
 		// No need to set FlushInterval, as we force the writer to operate in unbuffered mode/flushing after every
 		// write.
 	}
 }
 
-func createTransport(tlsClientConf *tls.Config, forceHTTP2 bool, extraH2ALPNs []string) (http.RoundTripper, error) {
-	if forceHTTP2 {
+func createTransport(tlsClientConf *tls.Config, connectOpts connectOptions) (http.RoundTripper, error) {
+	if connectOpts.forceHTTP2 {
+		// Connect via the same proxy the side channel uses, if any.
+		dialer := newEndpointDialer(connectOpts)
 		transport := &http2.Transport{
-			AllowHTTP:       true,
-			TLSClientConfig: tlsClientConf,
-		}
-		if tlsClientConf == nil {
-			transport.DialTLSContext = func(_ context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
-				return net.Dial(network, addr)
-			}
+			AllowHTTP:         true,
+			TLSClientConfig:   tlsClientConf,
+			MaxHeaderListSize: uint32(connectOpts.maxResponseHeaderBytes),
+			DialTLSContext: func(ctx context.Context, network, addr string, tlsConf *tls.Config) (net.Conn, error) {
+				var conn net.Conn
+				err := dialWithTimeout(ctx, connectOpts.dialTimeout, func(ctx context.Context) error {
+					var err error
+					conn, err = dialer.DialContext(ctx, network, addr)
+					if err != nil || tlsClientConf == nil {
+						return err
+					}
+					// Do not insist on "h2" being negotiated via ALPN, as HTTP/2 is forced.
+					tlsConn := tls.Client(conn, tlsConf)
+					if err := tlsConn.HandshakeContext(ctx); err != nil {
+						_ = conn.Close()
+						return err
+					}
+					conn = tlsConn
+					return nil
+				})
+				if err != nil {
+					return nil, err
+				}
+				return conn, nil
+			},
 		}
 		return transport, nil
 	}
 
 	transport := &http.Transport{
-		ForceAttemptHTTP2: true,
-		Proxy:             http.ProxyFromEnvironment,
+		ForceAttemptHTTP2:  true,
+		Proxy:              connectOpts.proxyFunc(),
+		ProxyConnectHeader: proxyConnectHeader(connectOpts.userAgent),
+		DisableKeepAlives:  connectOpts.disableKeepAlives,
+		ReadBufferSize:     connectOpts.readBufferSize,
+		WriteBufferSize:    connectOpts.writeBufferSize,
+		// This also limits the size of the headers of responses to HTTP/2 requests.
+		MaxResponseHeaderBytes: int64(connectOpts.maxResponseHeaderBytes),
+	}
+	if connectOpts.unixSocket {
+		transport.DialContext = connectOpts.dialer.DialContext
+	} else if len(connectOpts.failoverEndpoints) > 0 || tlsClientConf != nil {
+		// Connect via the same proxy the side channel uses, if any, which also takes care of failing over. For TLS
+		// endpoints, this also keeps the TLS config of the endpoint from being used for HTTPS proxies, as
+		// http.Transport would do, which would offer the client certificate of the endpoint to the proxy.
+		dialer := newEndpointDialer(connectOpts)
+		transport.Proxy = nil
+		transport.DialContext = dialer.DialContext
 	}
 
 	if tlsClientConf != nil {
 		transport.TLSClientConfig = tlsClientConf.Clone()
+	} else {
+		detectHTTP2Preface(transport)
 	}
 	if err := http2.ConfigureTransport(transport); err != nil {
 		return nil, errors.Wrap(err, "configuring transport for HTTP/2 use")
 	}
 
 	// Make sure the transport for any extra HTTP/2-like ALPN string behaves like for HTTP/2.
-	for _, extraALPN := range extraH2ALPNs {
+	for _, extraALPN := range connectOpts.extraH2ALPNs {
 		transport.TLSNextProto[extraALPN] = transport.TLSNextProto["h2"]
 	}
 
 	return transport, nil
 }
 
-func createClientProxy(endpoint string, tlsClientConf *tls.Config, forceHTTP2, forceDowngrade bool, extraH2ALPNs []string, contentType string) (*http.Server, pipeconn.DialContextFunc, error) {
-	transport, err := createTransport(tlsClientConf, forceHTTP2, extraH2ALPNs)
+func createClientProxy(endpoint string, tlsClientConf *tls.Config, connectOpts connectOptions) (*http.Server, pipeconn.DialContextFunc, error) {
+	handler, err := createProxyHandler(endpoint, tlsClientConf, connectOpts)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "creating transport")
+		return nil, nil, err
 	}
-	proxy := createReverseProxy(endpoint, transport, tlsClientConf == nil, forceDowngrade, contentType)
-	return makeProxyServer(proxy)
+	return makeProxyServer(withStreamIdleTimeout(withByteCounter(handler, connectOpts.byteCounter, connectOpts.statsHandler), connectOpts.streamIdleTimeout), connectOpts.getLogger())
+}
+
+// createProxyHandler creates the handler that forwards gRPC requests to the endpoint, downgrading them if necessary.
+func createProxyHandler(endpoint string, tlsClientConf *tls.Config, connectOpts connectOptions) (http.Handler, error) {
+	transport, err := createTransport(tlsClientConf, connectOpts)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating transport")
+	}
+	transport = withRoundTripInterceptor(transport, connectOpts.onRequest, connectOpts.onResponse)
+	proxy := createReverseProxy(endpoint, transport, tlsClientConf == nil, connectOpts)
+	var downgrader *autoDowngrader
+	if connectOpts.autoDowngrade && !connectOpts.forceDowngrade && !connectOpts.forceHTTP2 {
+		downgrader = newAutoDowngrader(endpoint, tlsClientConf, connectOpts)
+	}
+	return withAutoDowngrade(withGRPCTimeout(proxy, connectOpts.getLogger()), downgrader, connectOpts.httpStatusMapper), nil
+}
+
+// withGRPCTimeout bounds the proxied request by the deadline conveyed in the `grpc-timeout` header, such that the
+// connection to an endpoint that stops responding (e.g., before sending trailers) is closed once the deadline expires.
+func withGRPCTimeout(handler http.Handler, logger Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		timeoutStr := req.Header.Get(grpcproto.TimeoutHeader)
+		if timeoutStr == "" {
+			handler.ServeHTTP(w, req)
+			return
+		}
+		timeout, err := grpcproto.DecodeTimeout(timeoutStr)
+		if err != nil {
+			logger.Debugf("Ignoring malformed gRPC timeout: %v", err)
+			handler.ServeHTTP(w, req)
+			return
+		}
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+		handler.ServeHTTP(w, req.WithContext(ctx))
+	})
 }
 
 // ConnectViaProxy establishes a gRPC client connection via an HTTP/2 proxy that handles endpoints behind HTTP/1.x proxies.
@@ -166,10 +324,45 @@ func createClientProxy(endpoint string, tlsClientConf *tls.Config, forceHTTP2, f
 // Using WebSocket will allow for both streaming and non-streaming gRPC requests, but is not adaptive.
 // Using gRPC-Web "downgrades" will only allow for non-streaming gRPC requests, but will only downgrade if necessary.
 // This method supports server-streaming requests, but only if there isn't a proxy in the middle that buffers chunked responses.
+//
+// The endpoint is a host and port, or a Unix domain socket of the form `unix:///absolute/path` or `unix:relative/path`.
+// Proxies are not used for connecting to Unix domain sockets, and TLS server names are verified against `localhost`
+// unless set in the TLS config.
+//
+// The TLS config is cloned, not copied into a static set of credentials, hence callbacks such as
+// `GetClientCertificate` are invoked for every handshake of the side channel and of the connections carrying calls.
 func ConnectViaProxy(ctx context.Context, endpoint string, tlsClientConf *tls.Config, opts ...ConnectOption) (*grpc.ClientConn, error) {
-	var connectOpts connectOptions
-	for _, opt := range opts {
-		opt.apply(&connectOpts)
+	connectOpts := newConnectOptions(opts)
+	if socketPath, ok := unixSocketPath(endpoint); ok {
+		if socketPath == "" {
+			return nil, errors.Errorf("invalid Unix domain socket endpoint %q", endpoint)
+		}
+		// Proxies do not apply to Unix domain sockets. All connections are established via the socket, and the
+		// endpoint only serves as the host of HTTP requests.
+		dialer := connectOpts.dialer
+		if dialer == nil {
+			dialer = new(net.Dialer)
+		}
+		connectOpts.dialer = unixSocketDialer{path: socketPath, dialer: dialer}
+		connectOpts.noProxy = true
+		connectOpts.unixSocket = true
+		connectOpts.failoverEndpoints = nil
+		endpoint = unixSocketHost
+	}
+	if tlsClientConf == nil && len(connectOpts.peerCertPins) > 0 {
+		return nil, errors.New("pinning the certificate of the endpoint requires a TLS config")
+	}
+	if tlsClientConf != nil && connectOpts.tlsServerName != "" {
+		tlsClientConf = tlsClientConf.Clone()
+		tlsClientConf.ServerName = connectOpts.tlsServerName
+	}
+
+	tunnelTLSConf := tlsClientConf
+	if tlsClientConf != nil && connectOpts.tunnelTLSConfig != nil {
+		tunnelTLSConf = connectOpts.tunnelTLSConfig.Clone()
+		if connectOpts.tlsServerName != "" {
+			tunnelTLSConf.ServerName = connectOpts.tlsServerName
+		}
 	}
 
 	var proxy *http.Server
@@ -177,19 +370,28 @@ func ConnectViaProxy(ctx context.Context, endpoint string, tlsClientConf *tls.Co
 	var err error
 
 	if connectOpts.useWebSocket {
-		proxy, dialCtx, err = createClientWSProxy(endpoint, tlsClientConf)
+		proxy, dialCtx, err = createClientWSProxy(endpoint, tunnelTLSConf, connectOpts)
 	} else {
-		proxy, dialCtx, err = createClientProxy(endpoint, tlsClientConf, connectOpts.forceHTTP2, connectOpts.forceDowngrade, connectOpts.extraH2ALPNs, connectOpts.contentType)
+		proxy, dialCtx, err = createClientProxy(endpoint, tunnelTLSConf, connectOpts)
 	}
 
 	if err != nil {
 		return nil, errors.Wrap(err, "creating client proxy")
 	}
 
-	return dialGRPCServer(ctx, proxy, makeDialOpts(endpoint, dialCtx, tlsClientConf, connectOpts))
+	var cc *grpc.ClientConn
+	err = dialWithTimeout(ctx, connectOpts.dialTimeout, func(ctx context.Context) error {
+		var err error
+		cc, err = dialGRPCServer(ctx, proxy, makeDialOpts(endpoint, dialCtx, tlsClientConf, connectOpts), connectOpts.getLogger())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cc, nil
 }
 
-func makeProxyServer(handler http.Handler) (*http.Server, pipeconn.DialContextFunc, error) {
+func makeProxyServer(handler http.Handler, logger Logger) (*http.Server, pipeconn.DialContextFunc, error) {
 	lis, dialCtx := pipeconn.NewPipeListener()
 
 	var http2Srv http2.Server
@@ -203,7 +405,7 @@ func makeProxyServer(handler http.Handler) (*http.Server, pipeconn.DialContextFu
 
 	go func() {
 		if err := srv.Serve(lis); err != nil && err != http.ErrServerClosed {
-			glog.Warningf("Unexpected error returned from serving gRPC proxy server: %v", err)
+			logger.Warnf("Unexpected error returned from serving gRPC proxy server: %v", err)
 		}
 	}()
 
@@ -216,28 +418,64 @@ func makeDialOpts(endpoint string, dialCtx pipeconn.DialContextFunc, tlsClientCo
 		return dialCtx(ctx)
 	}))
 	if tlsClientConf != nil {
-		dialOpts = append(dialOpts, grpc.WithTransportCredentials(newCredsFromSideChannel(endpoint, credentials.NewTLS(tlsClientConf))))
+		sideChannelTLSConf := tlsClientConf
+		if connectOpts.sideChannelSessions != nil {
+			sideChannelTLSConf = tlsClientConf.Clone()
+			sideChannelTLSConf.ClientSessionCache = connectOpts.sideChannelSessions
+		}
+		creds := credentials.NewTLS(sideChannelTLSConf)
+		if connectOpts.sideChannelALPNs != nil {
+			creds = newALPNCreds(sideChannelTLSConf, connectOpts.sideChannelALPNs)
+		}
+		sideChannelCreds := newCredsFromSideChannel(endpoint, creds, connectOpts)
+		if connectOpts.sideChannel != nil {
+			*connectOpts.sideChannel = sideChannelCreds
+		}
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(sideChannelCreds))
+	}
+	if connectOpts.useGRPCWeb && !connectOpts.useWebSocket {
+		dialOpts = append(dialOpts, grpc.WithChainStreamInterceptor(rejectClientStreams))
+	}
+	if connectOpts.useWebSocket && connectOpts.wsResume > 0 {
+		dialOpts = append(dialOpts, grpc.WithChainStreamInterceptor(markResumableStreams))
+	}
+	if connectOpts.streamIdleTimeout > 0 {
+		dialOpts = append(dialOpts, grpc.WithChainUnaryInterceptor(markUnaryCalls))
+	}
+	if connectOpts.maxMetadataBytes > 0 {
+		dialOpts = append(dialOpts,
+			grpc.WithChainUnaryInterceptor(maxMetadataBytesUnaryInterceptor(connectOpts.maxMetadataBytes)),
+			grpc.WithChainStreamInterceptor(maxMetadataBytesStreamInterceptor(connectOpts.maxMetadataBytes)))
 	}
 	dialOpts = append(dialOpts, connectOpts.dialOpts...)
 
 	return dialOpts
 }
 
-func dialGRPCServer(ctx context.Context, proxy *http.Server, dialOpts []grpc.DialOption) (*grpc.ClientConn, error) {
+// rejectClientStreams is a stream interceptor that fails client-streaming and bidi-streaming calls, which cannot
+// be expressed in the gRPC-Web protocol.
+func rejectClientStreams(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	if desc.ClientStreams {
+		return nil, status.Errorf(codes.Unimplemented, "method %s uses client-side streaming, which is not supported in gRPC-Web mode", method)
+	}
+	return streamer(ctx, desc, cc, method, opts...)
+}
+
+func dialGRPCServer(ctx context.Context, proxy *http.Server, dialOpts []grpc.DialOption, logger Logger) (*grpc.ClientConn, error) {
 	cc, err := grpc.DialContext(ctx, proxy.Addr, dialOpts...)
 	if err != nil {
 		_ = proxy.Close()
 		return nil, err
 	}
-	go closeServerOnConnShutdown(proxy, cc)
+	go closeServerOnConnShutdown(proxy, cc, logger)
 	return cc, nil
 }
 
-func closeServerOnConnShutdown(srv *http.Server, cc *grpc.ClientConn) {
+func closeServerOnConnShutdown(srv *http.Server, cc *grpc.ClientConn, logger Logger) {
 	for state := cc.GetState(); state != connectivity.Shutdown; state = cc.GetState() {
 		cc.WaitForStateChange(context.Background(), state)
 	}
 	if err := srv.Close(); err != nil {
-		glog.Warningf("Error closing gRPC proxy server: %v", err)
+		logger.Warnf("Error closing gRPC proxy server: %v", err)
 	}
 }
@@ -0,0 +1,91 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// proxyFromEnvironment determines the proxy for a request like `http.ProxyFromEnvironment`, but reads the environment
+// when called instead of once per process. As for curl, `ALL_PROXY` (or `all_proxy`) is used for requests for which
+// neither `HTTP_PROXY` nor `HTTPS_PROXY` applies, which is how SOCKS5 proxies are commonly configured. `NO_PROXY` is
+// honored for it as well.
+func proxyFromEnvironment() func(*http.Request) (*url.URL, error) {
+	config := httpproxy.FromEnvironment()
+	if allProxy := getEnvAny("ALL_PROXY", "all_proxy"); allProxy != "" {
+		if config.HTTPProxy == "" {
+			config.HTTPProxy = allProxy
+		}
+		if config.HTTPSProxy == "" {
+			config.HTTPSProxy = allProxy
+		}
+	}
+	proxy := config.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}
+}
+
+// getEnvAny returns the value of the first of the given environment variables that is set to a non-empty value.
+func getEnvAny(names ...string) string {
+	for _, name := range names {
+		if val := os.Getenv(name); val != "" {
+			return val
+		}
+	}
+	return ""
+}
+
+// checkedProxyFunc wraps proxy such that errors, as well as proxy URLs that cannot be connected to, are reported as
+// *ProxyConfigError. If fallback is true, the endpoint is connected to directly in that case instead.
+func checkedProxyFunc(proxy func(*http.Request) (*url.URL, error), fallback bool, logger Logger) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		proxyURL, err := proxy(req)
+		if err == nil && proxyURL != nil {
+			err = validateProxyURL(proxyURL)
+		}
+		if err == nil {
+			return proxyURL, nil
+		}
+		configErr := &ProxyConfigError{Err: err}
+		if proxyURL != nil {
+			configErr.Proxy = proxyURL.Redacted()
+		}
+		if !fallback {
+			return nil, configErr
+		}
+		logger.Warnf("Connecting to %s directly: %v", req.URL.Host, configErr)
+		return nil, nil
+	}
+}
+
+// validateProxyURL checks that proxyURL has a scheme supported by both the side channel and `http.Transport`, and a
+// host. Malformed proxy environment variables are parsed leniently, which may yield URLs lacking the latter.
+func validateProxyURL(proxyURL *url.URL) error {
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("unsupported proxy scheme %q in %s", proxyURL.Scheme, proxyURL.Redacted())
+	}
+	if proxyURL.Hostname() == "" {
+		return fmt.Errorf("proxy URL %s has no host", proxyURL.Redacted())
+	}
+	return nil
+}
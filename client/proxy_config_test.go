@@ -0,0 +1,112 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestProxyFunc_MalformedEnvironment(t *testing.T) {
+	for _, env := range []string{"HTTP_PROXY", "http_proxy", "https_proxy", "NO_PROXY", "no_proxy", "REQUEST_METHOD"} {
+		t.Setenv(env, "")
+	}
+	t.Setenv("HTTPS_PROXY", "://bad")
+	req, err := http.NewRequest(http.MethodPost, "https://grpc.example.com:443/grpc.health.v1.Health/Check", nil)
+	require.NoError(t, err)
+
+	var opts connectOptions
+	proxyURL, err := opts.proxyFunc()(req)
+	assert.Nil(t, proxyURL)
+	var configErr *ProxyConfigError
+	require.ErrorAs(t, err, &configErr)
+	// The malformed value is parsed leniently, yielding a URL without a host.
+	assert.Equal(t, "http://://bad", configErr.Proxy)
+	assert.ErrorContains(t, err, "invalid proxy configuration")
+
+	logger := &recordingLogger{}
+	WithLogger(logger).apply(&opts)
+	WithProxyConfigFallback().apply(&opts)
+	proxyURL, err = opts.proxyFunc()(req)
+	assert.NoError(t, err)
+	assert.Nil(t, proxyURL)
+	require.Len(t, logger.messages, 1)
+	assert.Contains(t, logger.messages[0], "WARN: Connecting to grpc.example.com:443 directly: invalid proxy configuration")
+}
+
+func TestClientHandshake_ProxyConfigError(t *testing.T) {
+	endpoint := fakeEndpoint(t)
+	proxyFuncErr := errors.New("no proxy for you")
+
+	cases := map[string]func(*http.Request) (*url.URL, error){
+		"error":              func(*http.Request) (*url.URL, error) { return nil, proxyFuncErr },
+		"no host":            http.ProxyURL(&url.URL{Scheme: "http", Host: ":"}),
+		"unsupported scheme": http.ProxyURL(&url.URL{Scheme: "ftp", Host: "proxy.example.com"}),
+	}
+	for name, proxyFunc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var opts connectOptions
+			WithProxyFunc(proxyFunc).apply(&opts)
+			sideChannel := newCredsFromSideChannel(endpoint, insecure.NewCredentials(), opts)
+			_, _, err := sideChannel.ClientHandshake(context.Background(), endpoint, nil)
+			assert.ErrorAs(t, err, new(*ProxyDialError))
+			assert.ErrorAs(t, err, new(*ProxyConfigError))
+			assert.False(t, errors.As(err, new(*EndpointDialError)))
+
+			// The endpoint is reachable directly.
+			WithProxyConfigFallback().apply(&opts)
+			sideChannel = newCredsFromSideChannel(endpoint, insecure.NewCredentials(), opts)
+			_, _, err = sideChannel.ClientHandshake(context.Background(), endpoint, nil)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestProxyFunc_AllProxy(t *testing.T) {
+	for _, env := range []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy", "all_proxy", "no_proxy", "REQUEST_METHOD"} {
+		t.Setenv(env, "")
+	}
+	proxyAddr, requests := fakeSOCKS5Proxy(t)
+	t.Setenv("ALL_PROXY", "socks5://"+proxyAddr)
+	t.Setenv("NO_PROXY", "internal.example.com")
+
+	var opts connectOptions
+	for _, target := range []string{"http://192.0.2.1:443", "https://192.0.2.1:443"} {
+		req, err := http.NewRequest(http.MethodPost, target, nil)
+		require.NoError(t, err)
+		proxyURL, err := opts.proxyFunc()(req)
+		require.NoError(t, err)
+		assert.Equal(t, "socks5://"+proxyAddr, proxyURL.String())
+	}
+	req, err := http.NewRequest(http.MethodPost, "https://internal.example.com:443", nil)
+	require.NoError(t, err)
+	proxyURL, err := opts.proxyFunc()(req)
+	require.NoError(t, err)
+	assert.Nil(t, proxyURL)
+
+	// The side channel connects via the SOCKS5 proxy.
+	dialer := newEndpointDialer(opts)
+	conn, err := dialer.DialContext(context.Background(), "tcp", "192.0.2.1:443")
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	assert.Equal(t, "192.0.2.1:443", (<-requests).target)
+}
@@ -0,0 +1,267 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestInterimResponseIsSkipped(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusContinue)
+
+		trailers := "grpc-status: 5\r\ngrpc-message: not here\r\n"
+		w.Header().Set("Content-Type", "application/grpc-web+proto")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(grpcproto.MakeMessageHeader(grpcproto.MetadataFlags, uint32(len(trailers))))
+		_, _ = w.Write([]byte(trailers))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cc, err := ConnectViaProxy(ctx, strings.TrimPrefix(srv.URL, "http://"), nil,
+		DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())))
+	require.NoError(t, err)
+	defer func() { _ = cc.Close() }()
+
+	_, err = healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{})
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, codes.NotFound, st.Code())
+	assert.Equal(t, "not here", st.Message())
+}
+
+func TestCreateTransport_BufferSizes(t *testing.T) {
+	var opts connectOptions
+	WithReadBufferSize(64 << 10).apply(&opts)
+	WithWriteBufferSize(32 << 10).apply(&opts)
+
+	transport, err := createTransport(nil, opts)
+	require.NoError(t, err)
+	httpTransport, ok := transport.(*http.Transport)
+	require.True(t, ok)
+	assert.Equal(t, 64<<10, httpTransport.ReadBufferSize)
+	assert.Equal(t, 32<<10, httpTransport.WriteBufferSize)
+}
+
+func TestCreateTransport_MaxResponseHeaderBytes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-Large", strings.Repeat("a", 8<<10))
+	}))
+	defer srv.Close()
+
+	var opts connectOptions
+	WithMaxResponseHeaderBytes(4 << 10).apply(&opts)
+	transport, err := createTransport(nil, opts)
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL, nil)
+	require.NoError(t, err)
+	_, err = transport.RoundTrip(req)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeded")
+}
+
+// clientCertRequestingProxy starts an HTTPS proxy that requests a client certificate and would accept any. It returns
+// the TLS config of a client that trusts the proxy, e.g., as both the proxy and the endpoint use certificates issued by
+// a private CA, and that counts the requests for its client certificate, as well as the number of connections to the
+// proxy.
+func clientCertRequestingProxy(t *testing.T) (*url.URL, *tls.Config, *int32, *int32) {
+	var proxyConns, clientCertRequests int32
+	proxySrv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	proxySrv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	proxySrv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&proxyConns, 1)
+		}
+	}
+	proxySrv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	proxySrv.StartTLS()
+	t.Cleanup(proxySrv.Close)
+	proxyURL, err := url.Parse(proxySrv.URL)
+	require.NoError(t, err)
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(proxySrv.Certificate())
+	tlsConf := &tls.Config{
+		RootCAs: rootCAs,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			atomic.AddInt32(&clientCertRequests, 1)
+			return &tls.Certificate{}, nil
+		},
+	}
+	return proxyURL, tlsConf, &proxyConns, &clientCertRequests
+}
+
+func TestConnectViaProxy_HTTPSProxyIsNotOfferedClientCert(t *testing.T) {
+	proxyURL, tlsConf, proxyConns, clientCertRequests := clientCertRequestingProxy(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cc, err := ConnectViaProxy(ctx, "grpc.example.com:443", tlsConf, WithProxyFunc(http.ProxyURL(proxyURL)))
+	require.NoError(t, err)
+	defer func() { _ = cc.Close() }()
+
+	callCtx, callCancel := context.WithTimeout(ctx, time.Second)
+	defer callCancel()
+	_, err = healthpb.NewHealthClient(cc).Check(callCtx, &healthpb.HealthCheckRequest{})
+	require.Error(t, err)
+
+	// Without a proxy TLS config, the proxy is verified against the system roots, which do not trust it, and the
+	// client certificate for the endpoint is never offered to it.
+	assert.NotZero(t, atomic.LoadInt32(proxyConns))
+	assert.Zero(t, atomic.LoadInt32(clientCertRequests))
+}
+
+func TestTunnelDialer_HTTPSProxyIsNotOfferedClientCert(t *testing.T) {
+	proxyURL, tlsConf, proxyConns, clientCertRequests := clientCertRequestingProxy(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	dialer := TunnelDialer(WithTunnelTLSConfig(tlsConf), WithProxyFunc(http.ProxyURL(proxyURL)))
+	cc, err := grpc.DialContext(ctx, "grpc.example.com:443",
+		grpc.WithContextDialer(dialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer func() { _ = cc.Close() }()
+
+	callCtx, callCancel := context.WithTimeout(ctx, time.Second)
+	defer callCancel()
+	_, err = healthpb.NewHealthClient(cc).Check(callCtx, &healthpb.HealthCheckRequest{})
+	require.Error(t, err)
+
+	// The tunnel TLS config is not used for the proxy either.
+	assert.NotZero(t, atomic.LoadInt32(proxyConns))
+	assert.Zero(t, atomic.LoadInt32(clientCertRequests))
+}
+
+// forwardTunnel connects to the target and forwards the data of the tunnel in both directions, until either side is
+// done.
+func forwardTunnel(conn net.Conn, r io.Reader, target string) {
+	targetConn, err := net.Dial("tcp", target)
+	if err != nil {
+		return
+	}
+	defer func() { _ = targetConn.Close() }()
+	go func() {
+		_, _ = io.Copy(targetConn, r)
+		_ = targetConn.Close()
+	}()
+	_, _ = io.Copy(conn, targetConn)
+}
+
+// forwardingProxy is an HTTP proxy that only supports CONNECT requests, and sends the target of each one on the
+// returned channel.
+func forwardingProxy(t *testing.T) (*url.URL, <-chan string) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = lis.Close() })
+
+	targets := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				r := bufio.NewReader(conn)
+				req, err := http.ReadRequest(r)
+				if err != nil || req.Method != http.MethodConnect {
+					return
+				}
+				targets <- req.Host
+				_, _ = conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+				forwardTunnel(conn, r, req.Host)
+			}()
+		}
+	}()
+	return &url.URL{Scheme: "http", Host: lis.Addr().String()}, targets
+}
+
+func TestConnectViaProxy_ForceHTTP2ViaProxy(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	grpcSrv := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcSrv, health.NewServer())
+	go func() { _ = grpcSrv.Serve(lis) }()
+	defer grpcSrv.Stop()
+	endpoint := lis.Addr().String()
+
+	cases := map[string]func(t *testing.T) (*url.URL, <-chan string){
+		"HTTP CONNECT": forwardingProxy,
+		"SOCKS5": func(t *testing.T) (*url.URL, <-chan string) {
+			proxyAddr, requests := fakeSOCKS5ProxyWithTunnel(t, forwardTunnel)
+			targets := make(chan string, 1)
+			go func() {
+				if req, ok := <-requests; ok {
+					targets <- req.target
+				}
+			}()
+			return &url.URL{Scheme: "socks5", Host: proxyAddr}, targets
+		},
+	}
+
+	for name, startProxy := range cases {
+		t.Run(name, func(t *testing.T) {
+			proxyURL, targets := startProxy(t)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			cc, err := ConnectViaProxy(ctx, endpoint, nil, ForceHTTP2(), WithProxyFunc(http.ProxyURL(proxyURL)),
+				DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())))
+			require.NoError(t, err)
+			defer func() { _ = cc.Close() }()
+
+			_, err = healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{})
+			require.NoError(t, err)
+
+			// The call went through the proxy, rather than directly to the endpoint.
+			select {
+			case target := <-targets:
+				assert.Equal(t, endpoint, target)
+			case <-time.After(time.Second):
+				t.Fatal("proxy was not used")
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"golang.stackrox.io/grpc-http1/internal/grpcweb"
+)
+
+var (
+	// reservedRequestHeaders are headers that are required for tunneling gRPC requests, and hence are never set from
+	// the headers passed to WithRequestHeaders.
+	reservedRequestHeaders = map[string]struct{}{
+		"Accept":                  {},
+		"Connection":              {},
+		"Content-Length":          {},
+		"Content-Type":            {},
+		"Expect":                  {},
+		"Host":                    {},
+		"Te":                      {},
+		"Trailer":                 {},
+		"Transfer-Encoding":       {},
+		"Upgrade":                 {},
+		"User-Agent":              {},
+		grpcweb.GRPCWebOnlyHeader: {},
+		grpcweb.UserAgentHeader:   {},
+	}
+
+	reservedRequestHeaderPrefixes = []string{"Grpc-", "Sec-Websocket-"}
+)
+
+func isReservedRequestHeader(key string) bool {
+	if _, ok := reservedRequestHeaders[key]; ok {
+		return true
+	}
+	for _, prefix := range reservedRequestHeaderPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// addRequestHeaders adds the given extra headers to hdr, skipping reserved headers as well as headers that are
+// already present in hdr.
+func addRequestHeaders(hdr http.Header, extraHeaders http.Header) {
+	for k, vs := range extraHeaders {
+		k = http.CanonicalHeaderKey(k)
+		if isReservedRequestHeader(k) || len(hdr[k]) > 0 {
+			continue
+		}
+		hdr[k] = append([]string(nil), vs...)
+	}
+}
+
+// rewritePath rewrites the path of the given URL using the given path rewriter, if any, and records the gRPC method in
+// the given header.
+func rewritePath(u *url.URL, hdr http.Header, rewrite func(method string) string) {
+	if rewrite == nil {
+		return
+	}
+	hdr.Set(grpcproto.MethodHeader, u.Path)
+	u.Path = rewrite(u.Path)
+	u.RawPath = ""
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestWithRequestHeaders(t *testing.T) {
+	extraHeaders := http.Header{
+		"X-Api-Key":    {"secret"},
+		"X-Route":      {"static"},
+		"Content-Type": {"text/plain"},
+		"Connection":   {"close"},
+		"Grpc-Timeout": {"1n"},
+	}
+
+	for _, useWebSocket := range []bool{false, true} {
+		name := "http"
+		if useWebSocket {
+			name = "websocket"
+		}
+		t.Run(name, func(t *testing.T) {
+			reqHeaderC := make(chan http.Header, 1)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				select {
+				case reqHeaderC <- req.Header.Clone():
+				default:
+				}
+				http.Error(w, "go away", http.StatusServiceUnavailable)
+			}))
+			defer srv.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			cc, err := ConnectViaProxy(ctx, strings.TrimPrefix(srv.URL, "http://"), nil,
+				DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())),
+				UseWebSocket(useWebSocket),
+				WithRequestHeaders(extraHeaders))
+			require.NoError(t, err)
+			defer func() { _ = cc.Close() }()
+
+			// Metadata of the call takes precedence.
+			callCtx := metadata.AppendToOutgoingContext(ctx, "x-route", "from-metadata")
+			_, err = healthpb.NewHealthClient(cc).Check(callCtx, &healthpb.HealthCheckRequest{})
+			require.Error(t, err)
+
+			reqHeader := <-reqHeaderC
+			assert.Equal(t, []string{"secret"}, reqHeader.Values("X-Api-Key"))
+			assert.Equal(t, []string{"from-metadata"}, reqHeader.Values("X-Route"))
+			assert.True(t, strings.HasPrefix(reqHeader.Get("Content-Type"), "application/grpc"))
+			assert.NotEqual(t, "close", reqHeader.Get("Connection"))
+			assert.NotEqual(t, "1n", reqHeader.Get("Grpc-Timeout"))
+		})
+	}
+}
+
+func TestWithHostHeader(t *testing.T) {
+	for _, useWebSocket := range []bool{false, true} {
+		name := "http"
+		if useWebSocket {
+			name = "websocket"
+		}
+		t.Run(name, func(t *testing.T) {
+			hostC := make(chan string, 1)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				select {
+				case hostC <- req.Host:
+				default:
+				}
+				http.Error(w, "go away", http.StatusServiceUnavailable)
+			}))
+			defer srv.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			cc, err := ConnectViaProxy(ctx, strings.TrimPrefix(srv.URL, "http://"), nil,
+				DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())),
+				UseWebSocket(useWebSocket),
+				WithHostHeader("api.example.com"))
+			require.NoError(t, err)
+			defer func() { _ = cc.Close() }()
+
+			_, err = healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{})
+			require.Error(t, err)
+
+			assert.Equal(t, "api.example.com", <-hostC)
+		})
+	}
+}
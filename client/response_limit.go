@@ -0,0 +1,119 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+)
+
+// responseTooLargeError is the error returned when reading a response exceeding the maximum response size.
+type responseTooLargeError struct {
+	limit int64
+}
+
+func (e *responseTooLargeError) Error() string {
+	return fmt.Sprintf("response exceeds the maximum response size of %d bytes", e.limit)
+}
+
+func isResponseTooLarge(err error) bool {
+	var tooLargeErr *responseTooLargeError
+	return errors.As(err, &tooLargeErr)
+}
+
+// limitedResponseBody wraps a response body consisting of gRPC frames such that reading a frame that would make the
+// total size of the response exceed limit bytes fails with a *responseTooLargeError. The check is based on the frame
+// header, such that the body ends at a frame boundary. The body is closed at that point, which also closes the
+// connection it is received over rather than draining it.
+type limitedResponseBody struct {
+	io.ReadCloser
+	limit     int64
+	remaining int64
+
+	hdr []byte
+	// pendingHdr are the bytes of the header of the current frame not yet returned.
+	pendingHdr []byte
+	// payloadRemaining is the number of payload bytes of the current frame not yet returned.
+	payloadRemaining int64
+	err              error
+}
+
+// newLimitedResponseBody returns body limited to the given number of bytes, or body itself if limit is not positive.
+func newLimitedResponseBody(body io.ReadCloser, limit int64) io.ReadCloser {
+	if limit <= 0 {
+		return body
+	}
+	return &limitedResponseBody{
+		ReadCloser: body,
+		limit:      limit,
+		remaining:  limit,
+		hdr:        make([]byte, grpcproto.MessageHeaderLength),
+	}
+}
+
+func (b *limitedResponseBody) Read(buf []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if len(b.pendingHdr) == 0 && b.payloadRemaining == 0 {
+		if err := b.nextFrame(); err != nil {
+			b.err = err
+			return 0, err
+		}
+	}
+	if len(b.pendingHdr) > 0 {
+		n := copy(buf, b.pendingHdr)
+		b.pendingHdr = b.pendingHdr[n:]
+		return n, nil
+	}
+
+	if int64(len(buf)) > b.payloadRemaining {
+		buf = buf[:b.payloadRemaining]
+	}
+	n, err := b.ReadCloser.Read(buf)
+	b.payloadRemaining -= int64(n)
+	if err == io.EOF {
+		if b.payloadRemaining > 0 {
+			err = io.ErrUnexpectedEOF
+		} else {
+			// Reported by reading the next frame header.
+			err = nil
+		}
+	}
+	return n, err
+}
+
+// nextFrame reads the header of the next frame, and checks whether the frame fits into the remaining size.
+func (b *limitedResponseBody) nextFrame() error {
+	if _, err := io.ReadFull(b.ReadCloser, b.hdr); err != nil {
+		return err
+	}
+	_, length, err := grpcproto.ParseMessageHeader(b.hdr)
+	if err != nil {
+		return err
+	}
+	frameSize := grpcproto.MessageHeaderLength + int64(length)
+	if frameSize > b.remaining {
+		_ = b.ReadCloser.Close()
+		return &responseTooLargeError{limit: b.limit}
+	}
+	b.remaining -= frameSize
+	b.pendingHdr = b.hdr
+	b.payloadRemaining = int64(length)
+	return nil
+}
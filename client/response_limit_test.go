@@ -0,0 +1,77 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+)
+
+type closeRecordingBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *closeRecordingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestLimitedResponseBody(t *testing.T) {
+	frame := func(payload string) string {
+		return string(grpcproto.MakeMessageHeader(0, uint32(len(payload)))) + payload
+	}
+	// Every frame is 10 bytes long.
+	frames := frame("hello") + frame("world") + frame("again")
+
+	t.Run("within limit", func(t *testing.T) {
+		body := &closeRecordingBody{Reader: strings.NewReader(frames)}
+		data, err := io.ReadAll(newLimitedResponseBody(body, 30))
+		require.NoError(t, err)
+		assert.Equal(t, frames, string(data))
+		assert.False(t, body.closed)
+	})
+
+	t.Run("exceeding limit", func(t *testing.T) {
+		body := &closeRecordingBody{Reader: strings.NewReader(frames)}
+		limited := newLimitedResponseBody(body, 29)
+		data, err := io.ReadAll(limited)
+		assert.True(t, isResponseTooLarge(err))
+		// The body ends after the last complete frame within the limit.
+		assert.Equal(t, frames[:20], string(data))
+		assert.True(t, body.closed)
+
+		// Subsequent reads keep failing.
+		_, err = limited.Read(make([]byte, 1))
+		assert.True(t, isResponseTooLarge(err))
+	})
+
+	t.Run("truncated frame", func(t *testing.T) {
+		body := &closeRecordingBody{Reader: strings.NewReader(frames[:15])}
+		data, err := io.ReadAll(newLimitedResponseBody(body, 30))
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+		assert.Equal(t, frames[:15], string(data))
+	})
+
+	t.Run("no limit", func(t *testing.T) {
+		body := &closeRecordingBody{Reader: strings.NewReader(frames)}
+		assert.Same(t, body, newLimitedResponseBody(body, 0))
+	})
+}
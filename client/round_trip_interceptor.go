@@ -0,0 +1,53 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"net/http"
+)
+
+// interceptingTransport is an HTTP transport that passes requests and their responses to the functions given via the
+// `WithRoundTripInterceptor` option.
+type interceptingTransport struct {
+	transport  http.RoundTripper
+	onRequest  func(*http.Request) *http.Request
+	onResponse func(*http.Response)
+}
+
+// withRoundTripInterceptor returns the given transport if both functions are nil, and an intercepting transport
+// otherwise.
+func withRoundTripInterceptor(transport http.RoundTripper, onRequest func(*http.Request) *http.Request, onResponse func(*http.Response)) http.RoundTripper {
+	if onRequest == nil && onResponse == nil {
+		return transport
+	}
+	return &interceptingTransport{
+		transport:  transport,
+		onRequest:  onRequest,
+		onResponse: onResponse,
+	}
+}
+
+func (t *interceptingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.onRequest != nil {
+		if interceptedReq := t.onRequest(req); interceptedReq != nil {
+			req = interceptedReq
+		}
+	}
+	resp, err := t.transport.RoundTrip(req)
+	if err == nil && t.onResponse != nil {
+		t.onResponse(resp)
+	}
+	return resp, err
+}
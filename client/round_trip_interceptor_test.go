@@ -0,0 +1,78 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestWithRoundTripInterceptor_NoFunctions(t *testing.T) {
+	transport := &http.Transport{}
+	assert.Same(t, transport, withRoundTripInterceptor(transport, nil, nil))
+}
+
+func TestWithRoundTripInterceptor(t *testing.T) {
+	var sentReq *http.Request
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		sentReq = req
+		if req.Header.Get("Fail") != "" {
+			return nil, errors.New("failed")
+		}
+		return &http.Response{StatusCode: http.StatusOK, Request: req}, nil
+	})
+
+	var responses []*http.Response
+	onRequest := func(req *http.Request) *http.Request {
+		if req.Header.Get("Replace") == "" {
+			return nil
+		}
+		return req.Clone(req.Context())
+	}
+	onResponse := func(resp *http.Response) {
+		responses = append(responses, resp)
+	}
+	intercepting := withRoundTripInterceptor(transport, onRequest, onResponse)
+
+	// A nil request returned by onRequest means the request is sent unchanged.
+	req, err := http.NewRequest(http.MethodPost, "http://example.com/svc/Method", nil)
+	require.NoError(t, err)
+	resp, err := intercepting.RoundTrip(req)
+	require.NoError(t, err)
+	assert.Same(t, req, sentReq)
+	assert.Equal(t, []*http.Response{resp}, responses)
+
+	req.Header.Set("Replace", "true")
+	_, err = intercepting.RoundTrip(req)
+	require.NoError(t, err)
+	assert.NotSame(t, req, sentReq)
+	assert.Equal(t, "true", sentReq.Header.Get("Replace"))
+
+	// onResponse is not called if the request fails.
+	req.Header.Set("Fail", "true")
+	_, err = intercepting.RoundTrip(req)
+	require.Error(t, err)
+	assert.Len(t, responses, 2)
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// alpnCreds are TLS transport credentials offering exactly the configured ALPN protocols. The credentials returned by
+// `credentials.NewTLS` always offer `h2` in addition, as required for gRPC connections, but not for the side channel,
+// whose connections do not carry any calls.
+type alpnCreds struct {
+	credentials.TransportCredentials
+	tlsConf *tls.Config
+}
+
+func newALPNCreds(tlsConf *tls.Config, nextProtos []string) credentials.TransportCredentials {
+	tlsConf = tlsConf.Clone()
+	tlsConf.NextProtos = nextProtos
+	return &alpnCreds{
+		TransportCredentials: credentials.NewTLS(tlsConf),
+		tlsConf:              tlsConf,
+	}
+}
+
+func (c *alpnCreds) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	tlsConf := c.tlsConf.Clone()
+	if tlsConf.ServerName == "" {
+		tlsConf.ServerName = authority
+		if host, _, err := net.SplitHostPort(authority); err == nil {
+			tlsConf.ServerName = host
+		}
+	}
+	conn := tls.Client(rawConn, tlsConf)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+	authInfo := credentials.TLSInfo{
+		State: conn.ConnectionState(),
+		CommonAuthInfo: credentials.CommonAuthInfo{
+			SecurityLevel: credentials.PrivacyAndIntegrity,
+		},
+	}
+	return conn, authInfo, nil
+}
+
+func (c *alpnCreds) Clone() credentials.TransportCredentials {
+	return newALPNCreds(c.tlsConf, c.tlsConf.NextProtos)
+}
@@ -16,94 +16,594 @@ package client
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
 	"sync"
+	"time"
 
+	"golang.org/x/net/proxy"
 	"google.golang.org/grpc/credentials"
 )
 
+const (
+	// sessionTicketTimeout is the maximum duration for which side channel connections are kept open in order to
+	// receive TLS 1.3 session tickets.
+	sessionTicketTimeout = time.Second
+	// connectResponseTimeout is the maximum duration to wait for the response of a proxy to an HTTP CONNECT request if
+	// the dial context has no deadline.
+	connectResponseTimeout = 30 * time.Second
+)
+
+var (
+	// ErrProxyAuthRequired is returned (wrapped) when the proxy rejects a CONNECT request with
+	// `407 Proxy Authentication Required`.
+	ErrProxyAuthRequired = errors.New("proxy authentication required")
+	// ErrCertificateNotPinned is returned (wrapped in a *HandshakeError) when the public key of the certificate
+	// presented by the endpoint in the side channel handshake does not match any of the pins set via
+	// `WithPeerCertPinning`.
+	ErrCertificateNotPinned = errors.New("certificate of endpoint does not match any pinned public key")
+)
+
+// SideChannel provides access to the state of the side channel that is used for establishing the identity of the
+// endpoint when connecting via TLS.
+type SideChannel interface {
+	// AuthInfo returns the AuthInfo obtained from the most recent side channel handshake, if any.
+	AuthInfo() (credentials.AuthInfo, bool)
+	// Reset discards the cached AuthInfo and closes any side channel connections still kept open, such that the next
+	// connection to the endpoint performs a new side channel handshake. This is useful, e.g., after rotating
+	// credentials, without having to close the gRPC connection. A handshake in progress while Reset is called still
+	// completes, but its result is not cached. Note that a TLS session cache passed via
+	// `WithSideChannelSessionCache` is not cleared.
+	Reset()
+}
+
 // sideChannelCreds implements gRPC transport credentials that do not modify the connection passed to `ClientHandshake`,
 // but instead takes the `AuthInfo` from a connection established via a side channel.
 type sideChannelCreds struct {
 	credentials.TransportCredentials
+	endpointDialer
 	endpoint string
 
-	authInfo      credentials.AuthInfo
+	// authInfoTTL is the duration for which the cached authInfo is valid. Zero means it never expires.
+	authInfoTTL time.Duration
+	// retry controls retrying transient handshake failures.
+	retry sideChannelRetryOption
+	// dialTimeout bounds the handshake, including retries. Zero means it is only bounded by the context.
+	dialTimeout time.Duration
+	// awaitSessionTickets indicates whether connections should be kept open after the handshake in order to
+	// receive TLS 1.3 session tickets.
+	awaitSessionTickets bool
+	// pins are the SPKI SHA-256 fingerprints the certificate of the endpoint must match one of, if any.
+	pins [][]byte
+
+	// handshakeMutex serializes side channel handshakes.
+	handshakeMutex sync.Mutex
+
+	authInfo       credentials.AuthInfo
+	authInfoExpiry time.Time
+	// generation is incremented by Reset, such that the results of handshakes started before are not cached.
+	generation uint64
+	// openConns are the side channel connections kept open for receiving TLS 1.3 session tickets.
+	openConns     map[net.Conn]struct{}
 	authInfoMutex sync.Mutex
 }
 
-func newCredsFromSideChannel(endpoint string, creds credentials.TransportCredentials) credentials.TransportCredentials {
+func newCredsFromSideChannel(endpoint string, creds credentials.TransportCredentials, connectOpts connectOptions) *sideChannelCreds {
 	return &sideChannelCreds{
 		TransportCredentials: creds,
+		endpointDialer:       newEndpointDialer(connectOpts),
 		endpoint:             endpoint,
+		authInfoTTL:          connectOpts.sideChannelAuthInfoTTL,
+		retry:                connectOpts.sideChannelRetry,
+		dialTimeout:          connectOpts.dialTimeout,
+		awaitSessionTickets:  connectOpts.sideChannelSessions != nil,
+		pins:                 connectOpts.peerCertPins,
+	}
+}
+
+func (c *sideChannelCreds) AuthInfo() (credentials.AuthInfo, bool) {
+	c.authInfoMutex.Lock()
+	defer c.authInfoMutex.Unlock()
+
+	return c.authInfo, c.authInfo != nil
+}
+
+func (c *sideChannelCreds) Reset() {
+	c.authInfoMutex.Lock()
+	defer c.authInfoMutex.Unlock()
+
+	c.authInfo = nil
+	c.authInfoExpiry = time.Time{}
+	c.generation++
+	for conn := range c.openConns {
+		_ = conn.Close()
 	}
+	c.openConns = nil
+}
+
+// cachedAuthInfo returns the cached authInfo if it has not expired, along with the current generation.
+func (c *sideChannelCreds) cachedAuthInfo() (credentials.AuthInfo, uint64) {
+	c.authInfoMutex.Lock()
+	defer c.authInfoMutex.Unlock()
+
+	if c.authInfo != nil && (c.authInfoExpiry.IsZero() || time.Now().Before(c.authInfoExpiry)) {
+		return c.authInfo, c.generation
+	}
+	return nil, c.generation
 }
 
 func (c *sideChannelCreds) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	c.handshakeMutex.Lock()
+	defer c.handshakeMutex.Unlock()
+
+	cached, generation := c.cachedAuthInfo()
+	if cached != nil {
+		return rawConn, cached, nil
+	}
+
+	var authInfo credentials.AuthInfo
+	err := dialWithTimeout(ctx, c.dialTimeout, func(ctx context.Context) error {
+		var err error
+		authInfo, err = c.handshakeWithRetry(ctx, authority)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
 	c.authInfoMutex.Lock()
 	defer c.authInfoMutex.Unlock()
 
-	if c.authInfo != nil {
-		return rawConn, c.authInfo, nil
+	if c.generation == generation {
+		c.authInfo = authInfo
+		if c.authInfoTTL > 0 {
+			c.authInfoExpiry = time.Now().Add(c.authInfoTTL)
+		}
+	}
+	return rawConn, authInfo, nil
+}
+
+// handshakeWithRetry performs the side channel handshake, retrying transient failures with exponential backoff if
+// configured.
+func (c *sideChannelCreds) handshakeWithRetry(ctx context.Context, authority string) (credentials.AuthInfo, error) {
+	delay := c.retry.baseDelay
+	for attempt := 1; ; attempt++ {
+		authInfo, err := c.handshake(ctx, authority)
+		if err == nil || attempt >= c.retry.maxAttempts || ctx.Err() != nil || !isTransientHandshakeError(err) {
+			return authInfo, err
+		}
+
+		c.getLogger().Debugf("Side channel handshake with %s failed (attempt %d of %d), retrying in %v: %v", c.endpoint, attempt, c.retry.maxAttempts, delay, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+		delay *= 2
 	}
+}
 
-	// check if c.endpoint is reached via proxy
-	destReq, err := http.NewRequest("GET", "http://"+c.endpoint, nil)
+func (c *sideChannelCreds) handshake(ctx context.Context, authority string) (credentials.AuthInfo, error) {
+	// Fail over to the next endpoint not only if it cannot be reached, but also if the handshake with it fails.
+	var authInfo credentials.AuthInfo
+	err := c.withFailover(ctx, c.endpoint, func(addr string) error {
+		var err error
+		authInfo, err = c.handshakeAddr(ctx, authority, addr)
+		return err
+	})
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to determine proxy URL for %s: %w", c.endpoint, err)
+		return nil, err
 	}
-	proxyURL, err := http.ProxyFromEnvironment(destReq)
+	return authInfo, nil
+}
+
+func (c *sideChannelCreds) handshakeAddr(ctx context.Context, authority, addr string) (credentials.AuthInfo, error) {
+	sideChannelConn, err := c.dialAddr(ctx, "tcp", addr)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to determine proxy URL for %s: %w", c.endpoint, err)
+		return nil, err
 	}
 
-	var sideChannelConn net.Conn
-	if proxyURL != nil {
-		// net dial via HTTP CONNECT tunnel if using proxy
-		sideChannelConn, err = dialViaCONNECT(ctx, c.endpoint, proxyURL)
+	start := time.Now()
+	conn, authInfo, err := c.TransportCredentials.ClientHandshake(ctx, authority, sideChannelConn)
+	if err == nil {
+		// The TLS connection is closed along with the side channel connection below.
+		err = checkPinnedCert(authInfo, c.pins)
+	}
+	reportHandshake(c.stats, HandshakeSideChannel, addr, start, err)
+	if err != nil {
+		_ = sideChannelConn.Close()
+		c.getLogger().Warnf("Side channel handshake with %s failed: %v", addr, err)
+		return nil, &HandshakeError{Addr: addr, Err: err}
+	}
+	c.getLogger().Debugf("Side channel handshake with %s succeeded", addr)
+	if c.awaitSessionTickets {
+		c.trackConn(conn)
+		go func() {
+			awaitSessionTickets(conn)
+			c.untrackConn(conn)
+		}()
 	} else {
-		sideChannelConn, err = new(net.Dialer).DialContext(ctx, "tcp", c.endpoint)
+		_ = conn.Close()
+	}
+	return authInfo, nil
+}
+
+// trackConn registers a side channel connection kept open, such that it is closed by Reset.
+func (c *sideChannelCreds) trackConn(conn net.Conn) {
+	c.authInfoMutex.Lock()
+	defer c.authInfoMutex.Unlock()
+
+	if c.openConns == nil {
+		c.openConns = make(map[net.Conn]struct{})
+	}
+	c.openConns[conn] = struct{}{}
+}
+
+func (c *sideChannelCreds) untrackConn(conn net.Conn) {
+	c.authInfoMutex.Lock()
+	defer c.authInfoMutex.Unlock()
+
+	delete(c.openConns, conn)
+}
+
+// awaitSessionTickets reads from the given connection until it is closed by the endpoint, or for at most
+// sessionTicketTimeout, before closing it. With TLS 1.3, session tickets are sent after the handshake has completed,
+// and only processed (and stored in the session cache) while reading application data.
+func awaitSessionTickets(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	if err := conn.SetReadDeadline(time.Now().Add(sessionTicketTimeout)); err != nil {
+		return
 	}
+	_, _ = io.Copy(io.Discard, conn)
+}
 
+// isTransientHandshakeError checks whether a failed side channel handshake may succeed when retried. Errors caused by
+// the endpoint or the proxy rejecting the client, or by the endpoint's certificate failing verification, are not
+// transient.
+func isTransientHandshakeError(err error) bool {
+	var (
+		certInvalidErr       x509.CertificateInvalidError
+		unknownAuthorityErr  x509.UnknownAuthorityError
+		hostnameErr          x509.HostnameError
+		constraintViolErr    x509.ConstraintViolationError
+		unhandledCriticalErr x509.UnhandledCriticalExtension
+		opErr                *net.OpError
+	)
+	switch {
+	case errors.Is(err, ErrProxyAuthRequired),
+		errors.Is(err, ErrCertificateNotPinned),
+		errors.As(err, &certInvalidErr),
+		errors.As(err, &unknownAuthorityErr),
+		errors.As(err, &hostnameErr),
+		errors.As(err, &constraintViolErr),
+		errors.As(err, &unhandledCriticalErr):
+		return false
+	case errors.As(err, &opErr) && opErr.Op == "remote error":
+		// TLS alert sent by the endpoint, e.g., because it rejected the client certificate.
+		return false
+	}
+	return true
+}
+
+// endpointDialer establishes connections to the endpoint, going through the configured proxy (if any).
+type endpointDialer struct {
+	// proxyTLSConf is the TLS config used for connecting to HTTPS proxies.
+	proxyTLSConf *tls.Config
+	// proxy determines the proxy to go through. If nil, the endpoint is dialed directly.
+	proxy func(*http.Request) (*url.URL, error)
+	// dialer is used for establishing the connection to the endpoint or the proxy.
+	dialer ContextDialer
+	// userAgent is the User-Agent of HTTP CONNECT requests, if non-empty.
+	userAgent string
+	// maxHeaderBytes limits the size of the headers of responses to HTTP CONNECT requests. If zero, the default limit
+	// is used.
+	maxHeaderBytes int
+
+	// failoverAddrs are the addresses tried, in order, if connecting to the requested address fails.
+	failoverAddrs []string
+	// logger receives diagnostic messages. If nil, they are discarded.
+	logger Logger
+	// stats is notified of handshakes. If nil, they are not reported.
+	stats StatsHandler
+}
+
+func newEndpointDialer(connectOpts connectOptions) endpointDialer {
+	return endpointDialer{
+		proxyTLSConf:   connectOpts.proxyTLSConfig,
+		proxy:          connectOpts.proxyFunc(),
+		dialer:         connectOpts.dialer,
+		userAgent:      proxyUserAgent(connectOpts.userAgent),
+		maxHeaderBytes: connectOpts.maxResponseHeaderBytes,
+		failoverAddrs:  connectOpts.failoverEndpoints,
+		logger:         connectOpts.getLogger(),
+		stats:          connectOpts.statsHandler,
+	}
+}
+
+func (c *endpointDialer) getDialer() ContextDialer {
+	if c.dialer == nil {
+		return new(net.Dialer)
+	}
+	return c.dialer
+}
+
+func (c *endpointDialer) getLogger() Logger {
+	if c.logger == nil {
+		return nopLogger{}
+	}
+	return c.logger
+}
+
+// DialContext connects to addr, either directly or via the configured HTTP CONNECT or SOCKS5 proxy. Errors are
+// returned as *EndpointDialError or *ProxyDialError, respectively, or as *FailoverError if failover addresses are
+// configured.
+func (c *endpointDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var conn net.Conn
+	err := c.withFailover(ctx, addr, func(addr string) error {
+		var err error
+		conn, err = c.dialAddr(ctx, network, addr)
+		return err
+	})
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	return conn, nil
+}
+
+// withFailover calls attempt with addr and, if that fails, with each of the failover addresses in turn, until an
+// attempt succeeds or the context expires. If no failover addresses are configured, the error of the only attempt is
+// returned as is; otherwise, the errors of all attempts are returned as a *FailoverError.
+func (c *endpointDialer) withFailover(ctx context.Context, addr string, attempt func(addr string) error) error {
+	if len(c.failoverAddrs) == 0 {
+		return attempt(addr)
+	}
+
+	var errs []error
+	for _, candidate := range append([]string{addr}, c.failoverAddrs...) {
+		err := attempt(candidate)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+		c.getLogger().Debugf("Connecting to %s failed, trying next endpoint: %v", candidate, err)
+	}
+	return &FailoverError{Errs: errs}
+}
+
+func (c *endpointDialer) dialAddr(ctx context.Context, network, addr string) (net.Conn, error) {
+	if c.proxy == nil {
+		return c.dialDirect(ctx, network, addr)
 	}
-	defer func() { _ = sideChannelConn.Close() }()
 
-	_, authInfo, err := c.TransportCredentials.ClientHandshake(ctx, authority, sideChannelConn)
+	// check if addr is reached via proxy
+	destReq, err := http.NewRequest("GET", "http://"+addr, nil)
 	if err != nil {
-		return nil, nil, err
+		return nil, &ProxyDialError{Addr: addr, Err: fmt.Errorf("failed to determine proxy URL for %s: %w", addr, err)}
+	}
+	proxyURL, err := c.proxy(destReq)
+	if err != nil {
+		return nil, &ProxyDialError{Addr: addr, Err: fmt.Errorf("failed to determine proxy URL for %s: %w", addr, err)}
 	}
 
-	c.authInfo = authInfo
-	return rawConn, authInfo, nil
+	if proxyURL == nil {
+		c.getLogger().Debugf("No proxy configured for %s, connecting directly", addr)
+		return c.dialDirect(ctx, network, addr)
+	}
+	c.getLogger().Debugf("Connecting to %s via proxy %s", addr, proxyURL.Redacted())
+	var conn net.Conn
+	start := time.Now()
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		conn, err = c.dialViaSOCKS5(ctx, addr, proxyURL)
+	default:
+		// net dial via HTTP CONNECT tunnel if using proxy
+		conn, err = c.dialViaCONNECT(ctx, addr, proxyURL)
+	}
+	reportHandshake(c.stats, HandshakeProxyConnect, addr, start, err)
+	if err != nil {
+		c.getLogger().Warnf("Connecting to %s via proxy %s failed: %v", addr, proxyURL.Redacted(), err)
+		return nil, &ProxyDialError{Proxy: proxyURL.Host, Addr: addr, Err: err}
+	}
+	c.getLogger().Debugf("Established tunnel to %s via proxy %s", addr, proxyURL.Redacted())
+	return conn, nil
+}
+
+func (c *endpointDialer) dialDirect(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := c.getDialer().DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, &EndpointDialError{Addr: addr, Err: err}
+	}
+	return conn, nil
 }
 
-// dialViaCONNECT tunnels a tcp connection to addr through proxy using HTTP CONNECT
-func dialViaCONNECT(ctx context.Context, addr string, proxy *url.URL) (net.Conn, error) {
-	proxyAddr := proxy.Host
-	if proxy.Port() == "" {
-		proxyAddr = net.JoinHostPort(proxyAddr, "80")
+// dialViaCONNECT tunnels a tcp connection to addr through proxy using HTTP CONNECT. If the proxy has the `https`
+// scheme, the connection to the proxy itself is secured using the proxy TLS config.
+func (c *endpointDialer) dialViaCONNECT(ctx context.Context, addr string, proxy *url.URL) (net.Conn, error) {
+	defaultPort := "80"
+	if proxy.Scheme == "https" {
+		defaultPort = "443"
 	}
-	conn, err := new(net.Dialer).DialContext(ctx, "tcp", proxyAddr)
+	// Hostname and Port strip the brackets of IPv6 literals, which JoinHostPort adds back.
+	proxyPort := proxy.Port()
+	if proxyPort == "" {
+		proxyPort = defaultPort
+	}
+	proxyAddr := net.JoinHostPort(proxy.Hostname(), proxyPort)
+	conn, err := c.getDialer().DialContext(ctx, "tcp", proxyAddr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial proxy %s: %w", proxyAddr, err)
 	}
-	fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", addr, proxy.Hostname())
-	rr := bufio.NewReader(conn)
-	res, err := http.ReadResponse(rr, nil)
+	if proxy.Scheme == "https" {
+		tlsConf := c.proxyTLSConf.Clone()
+		if tlsConf == nil {
+			tlsConf = &tls.Config{}
+		}
+		if tlsConf.ServerName == "" {
+			tlsConf.ServerName = proxy.Hostname()
+		}
+		// The CONNECT request is always sent as HTTP/1.1, which must therefore be negotiated with proxies supporting
+		// HTTP/2 as well. Tunnels established via HTTP/2 (extended) CONNECT do not carry a raw byte stream.
+		tlsConf.NextProtos = []string{"http/1.1"}
+		tlsConn := tls.Client(conn, tlsConf)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("failed to perform TLS handshake with proxy %s: %w", proxyAddr, err)
+		}
+		conn = tlsConn
+	}
+	// A proxy accepting the connection without ever responding would otherwise stall the dial indefinitely.
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(connectResponseTimeout)
+	}
+	_ = conn.SetDeadline(deadline)
+	tunnelConn, err := doCONNECT(conn, addr, proxy, proxyAddr, c.userAgent, c.maxHeaderBytes)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return tunnelConn, nil
+}
+
+// doCONNECT issues an HTTP CONNECT request for addr on the given connection to proxyAddr, and returns the tunneled
+// connection once the proxy has accepted the request. Responses with headers exceeding maxHeaderBytes (or the default
+// limit, if zero) are rejected.
+func doCONNECT(conn net.Conn, addr string, proxy *url.URL, proxyAddr, userAgent string, maxHeaderBytes int) (net.Conn, error) {
+	// The request target must be in authority form, with IPv6 literals in brackets. As for any request, the Host
+	// header carries the same authority.
+	host, port, err := net.SplitHostPort(addr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response from HTTP CONNECT to %s via proxy %s: %w", addr, proxyAddr, err)
+		return nil, fmt.Errorf("invalid address %s: %w", addr, err)
+	}
+	addr = net.JoinHostPort(host, port)
+
+	var req bytes.Buffer
+	fmt.Fprintf(&req, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n", addr, addr)
+	if userAgent != "" {
+		fmt.Fprintf(&req, "User-Agent: %s\r\n", userAgent)
+	}
+	if proxy.User != nil {
+		fmt.Fprintf(&req, "Proxy-Authorization: Basic %s\r\n", basicAuth(proxy.User))
+	}
+	req.WriteString("\r\n")
+	if _, err := conn.Write(req.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to send HTTP CONNECT to %s via proxy %s: %w", addr, proxyAddr, err)
+	}
+
+	if maxHeaderBytes <= 0 {
+		maxHeaderBytes = defaultMaxResponseHeaderBytes
+	}
+	// The limit applies to the final response and any interim responses taken together. Data following the response
+	// is read from the connection directly once the limit is reached.
+	limitedConn := &io.LimitedReader{R: conn, N: int64(maxHeaderBytes)}
+	rr := bufio.NewReader(limitedConn)
+	var res *http.Response
+	for {
+		res, err = http.ReadResponse(rr, nil)
+		if err != nil && limitedConn.N <= 0 {
+			return nil, fmt.Errorf("headers of response from HTTP CONNECT to %s via proxy %s exceed %d bytes", addr, proxyAddr, maxHeaderBytes)
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nil, fmt.Errorf("timed out waiting for proxy %s to respond to HTTP CONNECT to %s: %w", proxyAddr, addr, err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response from HTTP CONNECT to %s via proxy %s: %w", addr, proxyAddr, err)
+		}
+		// Skip interim responses (e.g., `100 Continue`) some proxies send before the final response.
+		if res.StatusCode < 100 || res.StatusCode >= 200 || res.StatusCode == http.StatusSwitchingProtocols {
+			break
+		}
+	}
+	if res.StatusCode == http.StatusProxyAuthRequired {
+		return nil, fmt.Errorf("failed to dial %s via %s: %w (challenge: %q)", addr, proxyAddr, ErrProxyAuthRequired, res.Header.Values("Proxy-Authenticate"))
 	}
 	if res.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("failed to dial %s via %s. response status: %v", addr, proxyAddr, res.Status)
 	}
 	if rr.Buffered() > 0 {
-		return nil, fmt.Errorf("CONNECT response from %s resulted in %d bytes of unexpected data", proxyAddr, rr.Buffered())
+		// The proxy might already have forwarded data from the endpoint along with the response. Make sure this data
+		// is returned by the first read(s) on the tunneled connection.
+		buffered, _ := rr.Peek(rr.Buffered())
+		return &prefixedConn{
+			Conn:   conn,
+			reader: io.MultiReader(bytes.NewReader(buffered), conn),
+		}, nil
 	}
 	return conn, nil
 }
+
+// prefixedConn is a net.Conn that returns data from the given reader, which usually consists of some already buffered
+// data followed by the underlying connection.
+type prefixedConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c *prefixedConn) Read(buf []byte) (int, error) {
+	return c.reader.Read(buf)
+}
+
+// basicAuth returns the base64-encoded credentials for HTTP Basic authentication.
+func basicAuth(user *url.Userinfo) string {
+	password, _ := user.Password()
+	return base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+}
+
+// dialViaSOCKS5 tunnels a tcp connection to addr through a SOCKS5 proxy, authenticating with the username and
+// password from the proxy URL if present. For the `socks5h` scheme, the destination hostname is resolved by the proxy,
+// whereas for `socks5` it is resolved locally.
+func (c *endpointDialer) dialViaSOCKS5(ctx context.Context, addr string, proxyURL *url.URL) (net.Conn, error) {
+	if proxyURL.Scheme == "socks5" {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %s: %w", addr, err)
+		}
+		if net.ParseIP(host) == nil {
+			ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve %s: %w", host, err)
+			}
+			addr = net.JoinHostPort(ips[0].IP.String(), port)
+		}
+	}
+
+	dialer, err := proxy.FromURL(proxyURL, proxyDialer{ContextDialer: c.getDialer()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SOCKS5 dialer for proxy %s: %w", proxyURL.Host, err)
+	}
+	ctxDialer, ok := dialer.(proxy.ContextDialer)
+	if !ok {
+		return nil, fmt.Errorf("SOCKS5 dialer for proxy %s does not support dialing with a context", proxyURL.Host)
+	}
+	conn, err := ctxDialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s via SOCKS5 proxy %s: %w", addr, proxyURL.Host, err)
+	}
+	return conn, nil
+}
+
+// proxyDialer adapts a ContextDialer to the proxy.Dialer interface.
+type proxyDialer struct {
+	ContextDialer
+}
+
+func (d proxyDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
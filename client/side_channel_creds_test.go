@@ -0,0 +1,1062 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/internal/sliceutils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// fakeProxy accepts a single connection, parses the CONNECT request and responds using the given function.
+func fakeProxy(t *testing.T, respond func(conn net.Conn, req *http.Request)) *url.URL {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = lis.Close() })
+
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil {
+			return
+		}
+		respond(conn, req)
+	}()
+
+	return &url.URL{Scheme: "http", Host: lis.Addr().String()}
+}
+
+func TestDialViaCONNECT_ProxyAuth(t *testing.T) {
+	proxyURL := fakeProxy(t, func(conn net.Conn, req *http.Request) {
+		if req.Method != http.MethodConnect || req.Header.Get("Proxy-Authorization") != "Basic dXNlcjpwYXNz" {
+			_, _ = conn.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
+			return
+		}
+		_, _ = conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+	})
+	proxyURL.User = url.UserPassword("user", "pass")
+
+	conn, err := new(sideChannelCreds).dialViaCONNECT(context.Background(), "example.com:443", proxyURL)
+	require.NoError(t, err)
+	_ = conn.Close()
+}
+
+func TestDialViaCONNECT_ProxyAuthRequired(t *testing.T) {
+	proxyURL := fakeProxy(t, func(conn net.Conn, _ *http.Request) {
+		_, _ = conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\nProxy-Authenticate: Basic realm=\"proxy\"\r\n\r\n"))
+	})
+
+	_, err := new(sideChannelCreds).dialViaCONNECT(context.Background(), "example.com:443", proxyURL)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrProxyAuthRequired))
+	assert.Contains(t, err.Error(), `Basic realm=\"proxy\"`)
+}
+
+func TestDialViaCONNECT_PipelinedData(t *testing.T) {
+	// Simulate an endpoint that speaks first, and a proxy that forwards its data along with the CONNECT response.
+	proxyURL := fakeProxy(t, func(conn net.Conn, _ *http.Request) {
+		_, _ = conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\nhello"))
+		_, _ = conn.Write([]byte(" world"))
+	})
+
+	conn, err := new(sideChannelCreds).dialViaCONNECT(context.Background(), "example.com:443", proxyURL)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	data, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+}
+
+func TestDialViaCONNECT_ResponseTimeout(t *testing.T) {
+	// Simulate a proxy that accepts the connection, but never responds.
+	done := make(chan struct{})
+	defer close(done)
+	proxyURL := fakeProxy(t, func(net.Conn, *http.Request) {
+		<-done
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := (&endpointDialer{proxy: http.ProxyURL(proxyURL)}).DialContext(ctx, "tcp", "example.com:443")
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	var proxyErr *ProxyDialError
+	require.True(t, errors.As(err, &proxyErr))
+	assert.Equal(t, proxyURL.Host, proxyErr.Proxy)
+	assert.Contains(t, err.Error(), "timed out waiting for proxy")
+	var netErr net.Error
+	require.True(t, errors.As(err, &netErr))
+	assert.True(t, netErr.Timeout())
+}
+
+func TestDialViaCONNECT_DeadlineCleared(t *testing.T) {
+	proxyURL := fakeProxy(t, func(conn net.Conn, _ *http.Request) {
+		_, _ = conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+		time.Sleep(300 * time.Millisecond)
+		_, _ = conn.Write([]byte("hello"))
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	conn, err := new(sideChannelCreds).dialViaCONNECT(ctx, "example.com:443", proxyURL)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	// The tunneled connection outlives the dial context.
+	data, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+}
+
+func TestDialViaCONNECT_HTTP2CapableProxy(t *testing.T) {
+	// Simulate an HTTPS proxy that prefers HTTP/2, but also accepts HTTP/1.1 CONNECT requests.
+	requests := make(chan *http.Request, 1)
+	proxySrv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests <- req
+		if req.ProtoMajor != 1 {
+			w.WriteHeader(http.StatusHTTPVersionNotSupported)
+			return
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		_, _ = conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\nhello"))
+	}))
+	proxySrv.EnableHTTP2 = true
+	proxySrv.TLS = &tls.Config{NextProtos: []string{"h2", "http/1.1"}}
+	proxySrv.StartTLS()
+	defer proxySrv.Close()
+
+	proxyURL, err := url.Parse(proxySrv.URL)
+	require.NoError(t, err)
+	certPool := x509.NewCertPool()
+	certPool.AddCert(proxySrv.Certificate())
+	// Even if the proxy TLS config offers HTTP/2 only, the CONNECT request is sent over HTTP/1.1.
+	dialer := &endpointDialer{proxyTLSConf: &tls.Config{RootCAs: certPool, NextProtos: []string{"h2"}}}
+
+	conn, err := dialer.dialViaCONNECT(context.Background(), "example.com:443", proxyURL)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	req := <-requests
+	assert.Equal(t, http.MethodConnect, req.Method)
+	assert.Equal(t, "HTTP/1.1", req.Proto)
+	assert.Equal(t, "http/1.1", req.TLS.NegotiatedProtocol)
+
+	data, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+}
+
+func TestDialViaCONNECT_UnboundedHeader(t *testing.T) {
+	// Simulate a proxy that streams a header that never ends.
+	proxyURL := fakeProxy(t, func(conn net.Conn, _ *http.Request) {
+		_, _ = conn.Write([]byte("HTTP/1.1 200 Connection Established\r\nX-Garbage: "))
+		chunk := bytes.Repeat([]byte("a"), 1024)
+		for {
+			if _, err := conn.Write(chunk); err != nil {
+				return
+			}
+		}
+	})
+
+	_, err := (&endpointDialer{maxHeaderBytes: 64 << 10}).dialViaCONNECT(context.Background(), "example.com:443", proxyURL)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceed 65536 bytes")
+}
+
+func TestDialViaCONNECT_PipelinedDataWithHeaderLimit(t *testing.T) {
+	const response = "HTTP/1.1 200 Connection Established\r\n\r\n"
+	proxyURL := fakeProxy(t, func(conn net.Conn, _ *http.Request) {
+		_, _ = conn.Write([]byte(response + "hello world"))
+	})
+
+	// Data following the response is not subject to the limit.
+	conn, err := (&endpointDialer{maxHeaderBytes: len(response) + 2}).dialViaCONNECT(context.Background(), "example.com:443", proxyURL)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	data, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+}
+
+type fakeAuthInfo struct {
+	handshake int32
+}
+
+func (fakeAuthInfo) AuthType() string {
+	return "fake"
+}
+
+// countingCreds are transport credentials that count the number of client handshakes.
+type countingCreds struct {
+	credentials.TransportCredentials
+	handshakes int32
+}
+
+func (c *countingCreds) ClientHandshake(_ context.Context, _ string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return conn, fakeAuthInfo{handshake: atomic.AddInt32(&c.handshakes, 1)}, nil
+}
+
+// fakeEndpoint accepts and immediately closes any connection.
+func fakeEndpoint(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = lis.Close() })
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	return lis.Addr().String()
+}
+
+func TestClientHandshake_AuthInfoTTL(t *testing.T) {
+	endpoint := fakeEndpoint(t)
+
+	for _, ttl := range []time.Duration{0, 50 * time.Millisecond} {
+		creds := &countingCreds{TransportCredentials: insecure.NewCredentials()}
+		sideChannel := newCredsFromSideChannel(endpoint, creds, connectOptions{sideChannelAuthInfoTTL: ttl})
+
+		_, authInfo, err := sideChannel.ClientHandshake(context.Background(), endpoint, nil)
+		require.NoError(t, err)
+		assert.Equal(t, fakeAuthInfo{handshake: 1}, authInfo)
+
+		_, authInfo, err = sideChannel.ClientHandshake(context.Background(), endpoint, nil)
+		require.NoError(t, err)
+		assert.Equal(t, fakeAuthInfo{handshake: 1}, authInfo)
+
+		time.Sleep(100 * time.Millisecond)
+
+		expectedHandshakes := int32(1)
+		if ttl > 0 {
+			expectedHandshakes = 2
+		}
+		_, authInfo, err = sideChannel.ClientHandshake(context.Background(), endpoint, nil)
+		require.NoError(t, err)
+		assert.Equal(t, fakeAuthInfo{handshake: expectedHandshakes}, authInfo)
+	}
+}
+
+func TestSideChannel_AuthInfo(t *testing.T) {
+	endpoint := fakeEndpoint(t)
+
+	var sideChannel SideChannel = newCredsFromSideChannel(endpoint, &countingCreds{TransportCredentials: insecure.NewCredentials()}, connectOptions{})
+	_, ok := sideChannel.AuthInfo()
+	assert.False(t, ok)
+
+	_, _, err := sideChannel.(credentials.TransportCredentials).ClientHandshake(context.Background(), endpoint, nil)
+	require.NoError(t, err)
+
+	authInfo, ok := sideChannel.AuthInfo()
+	assert.True(t, ok)
+	assert.Equal(t, fakeAuthInfo{handshake: 1}, authInfo)
+}
+
+func TestSideChannel_Reset(t *testing.T) {
+	endpoint := fakeEndpoint(t)
+
+	creds := &countingCreds{TransportCredentials: insecure.NewCredentials()}
+	sideChannel := newCredsFromSideChannel(endpoint, creds, connectOptions{})
+
+	_, authInfo, err := sideChannel.ClientHandshake(context.Background(), endpoint, nil)
+	require.NoError(t, err)
+	assert.Equal(t, fakeAuthInfo{handshake: 1}, authInfo)
+
+	sideChannel.Reset()
+	_, ok := sideChannel.AuthInfo()
+	assert.False(t, ok)
+
+	_, authInfo, err = sideChannel.ClientHandshake(context.Background(), endpoint, nil)
+	require.NoError(t, err)
+	assert.Equal(t, fakeAuthInfo{handshake: 2}, authInfo)
+}
+
+// blockingCreds are transport credentials whose client handshakes block until unblock is closed.
+type blockingCreds struct {
+	countingCreds
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (c *blockingCreds) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	c.started <- struct{}{}
+	<-c.unblock
+	return c.countingCreds.ClientHandshake(ctx, authority, conn)
+}
+
+func TestSideChannel_ResetDuringHandshake(t *testing.T) {
+	endpoint := fakeEndpoint(t)
+
+	creds := &blockingCreds{
+		countingCreds: countingCreds{TransportCredentials: insecure.NewCredentials()},
+		started:       make(chan struct{}, 1),
+		unblock:       make(chan struct{}),
+	}
+	sideChannel := newCredsFromSideChannel(endpoint, creds, connectOptions{})
+
+	errC := make(chan error, 1)
+	go func() {
+		_, _, err := sideChannel.ClientHandshake(context.Background(), endpoint, nil)
+		errC <- err
+	}()
+	<-creds.started
+
+	// Reset must not wait for the handshake in progress.
+	sideChannel.Reset()
+	close(creds.unblock)
+	require.NoError(t, <-errC)
+
+	// The result of the handshake started before Reset is not cached.
+	_, ok := sideChannel.AuthInfo()
+	assert.False(t, ok)
+
+	_, authInfo, err := sideChannel.ClientHandshake(context.Background(), endpoint, nil)
+	require.NoError(t, err)
+	assert.Equal(t, fakeAuthInfo{handshake: 2}, authInfo)
+}
+
+// failingCreds are transport credentials whose first client handshakes fail with the given error.
+type failingCreds struct {
+	countingCreds
+	failures int32
+	err      error
+}
+
+func (c *failingCreds) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	if atomic.AddInt32(&c.failures, -1) >= 0 {
+		atomic.AddInt32(&c.handshakes, 1)
+		return nil, nil, c.err
+	}
+	return c.countingCreds.ClientHandshake(ctx, authority, conn)
+}
+
+func TestClientHandshake_Retry(t *testing.T) {
+	endpoint := fakeEndpoint(t)
+
+	creds := &failingCreds{countingCreds: countingCreds{TransportCredentials: insecure.NewCredentials()}, failures: 2, err: io.ErrUnexpectedEOF}
+	sideChannel := newCredsFromSideChannel(endpoint, creds, connectOptions{
+		sideChannelRetry: sideChannelRetryOption{maxAttempts: 3, baseDelay: 10 * time.Millisecond},
+	})
+
+	_, authInfo, err := sideChannel.ClientHandshake(context.Background(), endpoint, nil)
+	require.NoError(t, err)
+	assert.Equal(t, fakeAuthInfo{handshake: 3}, authInfo)
+}
+
+func TestClientHandshake_RetryExhausted(t *testing.T) {
+	endpoint := fakeEndpoint(t)
+
+	creds := &failingCreds{countingCreds: countingCreds{TransportCredentials: insecure.NewCredentials()}, failures: 5, err: io.ErrUnexpectedEOF}
+	sideChannel := newCredsFromSideChannel(endpoint, creds, connectOptions{
+		sideChannelRetry: sideChannelRetryOption{maxAttempts: 3, baseDelay: time.Millisecond},
+	})
+
+	_, _, err := sideChannel.ClientHandshake(context.Background(), endpoint, nil)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&creds.handshakes))
+}
+
+func TestClientHandshake_NoRetryOnVerificationError(t *testing.T) {
+	endpoint := fakeEndpoint(t)
+
+	creds := &failingCreds{countingCreds: countingCreds{TransportCredentials: insecure.NewCredentials()}, failures: 1, err: x509.UnknownAuthorityError{}}
+	sideChannel := newCredsFromSideChannel(endpoint, creds, connectOptions{
+		sideChannelRetry: sideChannelRetryOption{maxAttempts: 3, baseDelay: time.Millisecond},
+	})
+
+	_, _, err := sideChannel.ClientHandshake(context.Background(), endpoint, nil)
+	assert.ErrorAs(t, err, &x509.UnknownAuthorityError{})
+	assert.Equal(t, int32(1), atomic.LoadInt32(&creds.handshakes))
+}
+
+func TestClientHandshake_RetryRespectsContext(t *testing.T) {
+	endpoint := fakeEndpoint(t)
+
+	creds := &failingCreds{countingCreds: countingCreds{TransportCredentials: insecure.NewCredentials()}, failures: 5, err: io.ErrUnexpectedEOF}
+	sideChannel := newCredsFromSideChannel(endpoint, creds, connectOptions{
+		sideChannelRetry: sideChannelRetryOption{maxAttempts: 5, baseDelay: time.Hour},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, err := sideChannel.ClientHandshake(ctx, endpoint, nil)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Less(t, time.Since(start), 10*time.Second)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&creds.handshakes))
+}
+
+// countingSessionCache is a TLS session cache that counts the number of stored sessions.
+type countingSessionCache struct {
+	tls.ClientSessionCache
+	puts int32
+}
+
+func (c *countingSessionCache) Put(sessionKey string, cs *tls.ClientSessionState) {
+	if cs != nil {
+		atomic.AddInt32(&c.puts, 1)
+	}
+	c.ClientSessionCache.Put(sessionKey, cs)
+}
+
+func TestClientHandshake_SessionResumption(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.EnableHTTP2 = true // gRPC requires h2 to be negotiated.
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	endpoint := srv.Listener.Addr().String()
+
+	for _, useCache := range []bool{false, true} {
+		cache := &countingSessionCache{ClientSessionCache: tls.NewLRUClientSessionCache(0)}
+		tlsConf := srv.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+		tlsConf.ServerName = "example.com"
+
+		var connectOpts connectOptions
+		if useCache {
+			WithSideChannelSessionCache(cache).apply(&connectOpts)
+			tlsConf.ClientSessionCache = connectOpts.sideChannelSessions
+		}
+		// Expire the identity right away, such that every call performs a handshake.
+		connectOpts.sideChannelAuthInfoTTL = time.Nanosecond
+		sideChannel := newCredsFromSideChannel(endpoint, credentials.NewTLS(tlsConf), connectOpts)
+
+		_, authInfo, err := sideChannel.ClientHandshake(context.Background(), endpoint, nil)
+		require.NoError(t, err)
+		assert.False(t, authInfo.(credentials.TLSInfo).State.DidResume)
+
+		if useCache {
+			assert.Eventually(t, func() bool {
+				return atomic.LoadInt32(&cache.puts) > 0
+			}, 5*time.Second, 10*time.Millisecond)
+		}
+
+		time.Sleep(time.Millisecond)
+		_, authInfo, err = sideChannel.ClientHandshake(context.Background(), endpoint, nil)
+		require.NoError(t, err)
+		assert.Equal(t, useCache, authInfo.(credentials.TLSInfo).State.DidResume)
+	}
+}
+
+func TestEndpointDialer_NoProxy(t *testing.T) {
+	proxyURL := fakeProxy(t, func(conn net.Conn, _ *http.Request) {
+		_, _ = conn.Write([]byte("HTTP/1.1 403 Forbidden\r\n\r\n"))
+	})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = lis.Close() }()
+
+	// Without the option, the proxy is consulted (and rejects the connection).
+	dialer := newEndpointDialer(connectOptions{})
+	dialer.proxy = http.ProxyURL(proxyURL)
+	_, err = dialer.DialContext(context.Background(), "tcp", lis.Addr().String())
+	assert.ErrorContains(t, err, "403 Forbidden")
+
+	var opts connectOptions
+	WithNoProxy().apply(&opts)
+	assert.Nil(t, opts.proxyFunc())
+	dialer = newEndpointDialer(opts)
+	conn, err := dialer.DialContext(context.Background(), "tcp", lis.Addr().String())
+	require.NoError(t, err)
+	_ = conn.Close()
+}
+
+func TestClientHandshake_ProxyFunc(t *testing.T) {
+	connectTargets := make(chan string, 1)
+	proxyURL := fakeProxy(t, func(conn net.Conn, req *http.Request) {
+		connectTargets <- req.Host
+		_, _ = conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+	})
+
+	const endpoint = "grpc.example.com:443"
+	var proxiedHosts []string
+	proxyFunc := func(req *http.Request) (*url.URL, error) {
+		proxiedHosts = append(proxiedHosts, req.URL.Host)
+		return proxyURL, nil
+	}
+
+	var opts connectOptions
+	WithProxyFunc(proxyFunc).apply(&opts)
+	sideChannel := newCredsFromSideChannel(endpoint, &countingCreds{TransportCredentials: insecure.NewCredentials()}, opts)
+	_, _, err := sideChannel.ClientHandshake(context.Background(), endpoint, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{endpoint}, proxiedHosts)
+	assert.Equal(t, endpoint, <-connectTargets)
+
+	// WithNoProxy takes precedence.
+	WithNoProxy().apply(&opts)
+	assert.Nil(t, opts.proxyFunc())
+}
+
+func TestConnectViaProxy_ProxyFunc(t *testing.T) {
+	var calls int32
+	proxyFunc := func(*http.Request) (*url.URL, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, nil
+	}
+
+	err := callWithHTTPStatus(t, http.StatusTeapot, WithProxyFunc(proxyFunc))
+	assert.Equal(t, codes.Unknown, status.Code(err))
+	assert.NotZero(t, atomic.LoadInt32(&calls))
+}
+
+func TestDialViaCONNECT_InterimResponse(t *testing.T) {
+	proxyURL := fakeProxy(t, func(conn net.Conn, _ *http.Request) {
+		_, _ = conn.Write([]byte("HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 200 Connection Established\r\n\r\nhello"))
+	})
+
+	conn, err := new(sideChannelCreds).dialViaCONNECT(context.Background(), "example.com:443", proxyURL)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	data, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+}
+
+// pipeProxyDialer is a dialer that records the dialed addresses, and connects to a fake proxy accepting any CONNECT
+// request via an in-memory pipe.
+type pipeProxyDialer struct {
+	dialedAddrs []string
+	requests    chan *http.Request
+}
+
+func (d *pipeProxyDialer) DialContext(_ context.Context, _, address string) (net.Conn, error) {
+	d.dialedAddrs = append(d.dialedAddrs, address)
+	clientConn, proxyConn := net.Pipe()
+	go func() {
+		defer func() { _ = proxyConn.Close() }()
+		req, err := http.ReadRequest(bufio.NewReader(proxyConn))
+		if err != nil {
+			return
+		}
+		d.requests <- req
+		_, _ = proxyConn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+	}()
+	return clientConn, nil
+}
+
+func TestDialViaCONNECT_IPv6(t *testing.T) {
+	cases := map[string]struct {
+		proxyURL, addr                    string
+		expectedProxyAddr, expectedTarget string
+	}{
+		"IPv6 destination": {
+			proxyURL:          "http://proxy.example.com:3128",
+			addr:              "[::1]:443",
+			expectedProxyAddr: "proxy.example.com:3128",
+			expectedTarget:    "[::1]:443",
+		},
+		"IPv6 proxy with port": {
+			proxyURL:          "http://[2001:db8::1]:3128",
+			addr:              "example.com:443",
+			expectedProxyAddr: "[2001:db8::1]:3128",
+			expectedTarget:    "example.com:443",
+		},
+		"IPv6 proxy without port": {
+			proxyURL:          "http://[2001:db8::1]",
+			addr:              "[2001:db8::2]:443",
+			expectedProxyAddr: "[2001:db8::1]:80",
+			expectedTarget:    "[2001:db8::2]:443",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			proxyURL, err := url.Parse(c.proxyURL)
+			require.NoError(t, err)
+			dialer := &pipeProxyDialer{requests: make(chan *http.Request, 1)}
+
+			conn, err := (&endpointDialer{dialer: dialer}).dialViaCONNECT(context.Background(), c.addr, proxyURL)
+			require.NoError(t, err)
+			_ = conn.Close()
+
+			assert.Equal(t, []string{c.expectedProxyAddr}, dialer.dialedAddrs)
+			req := <-dialer.requests
+			assert.Equal(t, http.MethodConnect, req.Method)
+			assert.Equal(t, c.expectedTarget, req.RequestURI)
+			assert.Equal(t, c.expectedTarget, req.Host)
+		})
+	}
+}
+
+func TestDialViaCONNECT_InvalidAddress(t *testing.T) {
+	proxyURL, err := url.Parse("http://proxy.example.com:3128")
+	require.NoError(t, err)
+	dialer := &pipeProxyDialer{requests: make(chan *http.Request, 1)}
+
+	_, err = (&endpointDialer{dialer: dialer}).dialViaCONNECT(context.Background(), "::1:443", proxyURL)
+	assert.ErrorContains(t, err, "invalid address ::1:443")
+}
+
+// socks5Request is a CONNECT request received by fakeSOCKS5Proxy.
+type socks5Request struct {
+	user, target string
+}
+
+// fakeSOCKS5Proxy accepts a single connection, performs a SOCKS5 handshake, optionally with username/password
+// authentication, and sends the CONNECT request it received on the returned channel. Rather than connecting to the
+// target, it echoes back everything written to the tunnel.
+func fakeSOCKS5Proxy(t *testing.T) (string, <-chan socks5Request) {
+	return fakeSOCKS5ProxyWithTunnel(t, func(conn net.Conn, r io.Reader, _ string) {
+		_, _ = io.Copy(conn, r)
+	})
+}
+
+// fakeSOCKS5ProxyWithTunnel is like fakeSOCKS5Proxy, but hands the tunnel to the given function once the CONNECT
+// request has been answered, along with the reader for the data written to it.
+func fakeSOCKS5ProxyWithTunnel(t *testing.T, tunnel func(conn net.Conn, r io.Reader, target string)) (string, <-chan socks5Request) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = lis.Close() })
+
+	requests := make(chan socks5Request, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		r := bufio.NewReader(conn)
+		readN := func(n int) []byte {
+			buf := make([]byte, n)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return nil
+			}
+			return buf
+		}
+
+		// Greeting: version, number of methods, methods.
+		hdr := readN(2)
+		if hdr == nil || hdr[0] != 5 {
+			return
+		}
+		methods := readN(int(hdr[1]))
+		var req socks5Request
+		if bytes.IndexByte(methods, 2) >= 0 {
+			_, _ = conn.Write([]byte{5, 2})
+			// Username/password authentication: version, username, password.
+			ver := readN(2)
+			if ver == nil {
+				return
+			}
+			req.user = string(readN(int(ver[1])))
+			readN(int(readN(1)[0]))
+			_, _ = conn.Write([]byte{1, 0})
+		} else {
+			_, _ = conn.Write([]byte{5, 0})
+		}
+
+		// Request: version, command, reserved, address type, address, port.
+		cmd := readN(4)
+		if cmd == nil || cmd[1] != 1 {
+			return
+		}
+		var host string
+		switch cmd[3] {
+		case 1:
+			host = net.IP(readN(net.IPv4len)).String()
+		case 3:
+			host = string(readN(int(readN(1)[0])))
+		case 4:
+			host = net.IP(readN(net.IPv6len)).String()
+		}
+		port := readN(2)
+		req.target = net.JoinHostPort(host, fmt.Sprint(int(port[0])<<8|int(port[1])))
+		requests <- req
+		_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+		tunnel(conn, r, req.target)
+	}()
+	return lis.Addr().String(), requests
+}
+
+func TestDialViaSOCKS5(t *testing.T) {
+	cases := map[string]struct {
+		scheme       string
+		user         *url.Userinfo
+		resolved     bool
+		expectedUser string
+	}{
+		"socks5 resolves locally": {
+			scheme:   "socks5",
+			resolved: true,
+		},
+		"socks5h resolves remotely": {
+			scheme: "socks5h",
+		},
+		"socks5h with authentication": {
+			scheme:       "socks5h",
+			user:         url.UserPassword("user", "pass"),
+			expectedUser: "user",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			proxyAddr, requests := fakeSOCKS5Proxy(t)
+			proxyURL := &url.URL{Scheme: c.scheme, Host: proxyAddr, User: c.user}
+
+			conn, err := (&endpointDialer{proxy: http.ProxyURL(proxyURL)}).DialContext(context.Background(), "tcp", "localhost:443")
+			require.NoError(t, err)
+			defer func() { _ = conn.Close() }()
+
+			req := <-requests
+			host, port, err := net.SplitHostPort(req.target)
+			require.NoError(t, err)
+			assert.Equal(t, "443", port)
+			if c.resolved {
+				ip := net.ParseIP(host)
+				require.NotNil(t, ip, "expected an IP address, got %q", host)
+				assert.True(t, ip.IsLoopback())
+			} else {
+				assert.Equal(t, "localhost", host)
+			}
+			assert.Equal(t, c.expectedUser, req.user)
+
+			_, err = conn.Write([]byte("hello"))
+			require.NoError(t, err)
+			buf := make([]byte, 5)
+			_, err = io.ReadFull(conn, buf)
+			require.NoError(t, err)
+			assert.Equal(t, "hello", string(buf))
+		})
+	}
+}
+
+func TestConnectViaProxy_TLSServerName(t *testing.T) {
+	grpcSrv := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcSrv, health.NewServer())
+	defer grpcSrv.Stop()
+
+	var mutex sync.Mutex
+	var serverNames []string
+	srv := httptest.NewUnstartedServer(grpcSrv)
+	srv.EnableHTTP2 = true
+	srv.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			serverNames = append(serverNames, hello.ServerName)
+			return nil, nil
+		},
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	certPool := x509.NewCertPool()
+	certPool.AddCert(srv.Certificate())
+	tlsConf := &tls.Config{RootCAs: certPool}
+
+	call := func(opts ...ConnectOption) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		cc, err := ConnectViaProxy(ctx, srv.Listener.Addr().String(), tlsConf, opts...)
+		require.NoError(t, err)
+		defer func() { _ = cc.Close() }()
+		_, err = healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{})
+		return err
+	}
+
+	// The certificate of the test server is not valid for the authority of the client connection.
+	assert.ErrorContains(t, call(), "certificate is valid for")
+
+	mutex.Lock()
+	serverNames = nil
+	mutex.Unlock()
+	require.NoError(t, call(WithTLSServerName("example.com")))
+	mutex.Lock()
+	defer mutex.Unlock()
+	// Both the side channel and the connection carrying the call present the server name.
+	require.Len(t, serverNames, 2)
+	assert.Equal(t, []string{"example.com", "example.com"}, serverNames)
+	// The TLS config passed in is not modified.
+	assert.Empty(t, tlsConf.ServerName)
+}
+
+func TestConnectViaProxy_SideChannelALPN(t *testing.T) {
+	grpcSrv := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcSrv, health.NewServer())
+	defer grpcSrv.Stop()
+
+	var mutex sync.Mutex
+	var offered [][]string
+	srv := httptest.NewUnstartedServer(grpcSrv)
+	srv.EnableHTTP2 = true
+	srv.TLS = &tls.Config{
+		NextProtos: []string{"h2", "http/1.1"},
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			offered = append(offered, hello.SupportedProtos)
+			return nil, nil
+		},
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	certPool := x509.NewCertPool()
+	certPool.AddCert(srv.Certificate())
+	tlsConf := &tls.Config{RootCAs: certPool, ServerName: "example.com"}
+
+	for _, proto := range []string{"http/1.1", "h2"} {
+		t.Run(proto, func(t *testing.T) {
+			mutex.Lock()
+			offered = nil
+			mutex.Unlock()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			var sideChannel SideChannel
+			cc, err := ConnectViaProxy(ctx, srv.Listener.Addr().String(), tlsConf, WithSideChannel(&sideChannel), WithSideChannelALPN(proto))
+			require.NoError(t, err)
+			defer func() { _ = cc.Close() }()
+			_, err = healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{})
+			require.NoError(t, err)
+
+			authInfo, ok := sideChannel.AuthInfo()
+			require.True(t, ok)
+			assert.Equal(t, proto, authInfo.(credentials.TLSInfo).State.NegotiatedProtocol)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			// The side channel offers the configured protocol only, while the connection carrying the call offers h2.
+			require.Len(t, offered, 2)
+			assert.Equal(t, []string{proto}, offered[0])
+			assert.Contains(t, offered[1], "h2")
+		})
+	}
+}
+
+func TestConnectViaProxy_TunnelTLSConfig(t *testing.T) {
+	grpcSrv := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcSrv, health.NewServer())
+	defer grpcSrv.Stop()
+
+	var mutex sync.Mutex
+	var hellos []*tls.ClientHelloInfo
+	srv := httptest.NewUnstartedServer(grpcSrv)
+	srv.EnableHTTP2 = true
+	srv.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			hellos = append(hellos, hello)
+			return nil, nil
+		},
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	certPool := x509.NewCertPool()
+	certPool.AddCert(srv.Certificate())
+	tlsConf := &tls.Config{RootCAs: certPool}
+	tunnelTLSConf := &tls.Config{RootCAs: certPool, NextProtos: []string{"h2", "x-tunnel"}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cc, err := ConnectViaProxy(ctx, srv.Listener.Addr().String(), tlsConf,
+		WithTLSServerName("example.com"), WithTunnelTLSConfig(tunnelTLSConf))
+	require.NoError(t, err)
+	defer func() { _ = cc.Close() }()
+	_, err = healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.Len(t, hellos, 2)
+	var sideChannelHellos, tunnelHellos int
+	for _, hello := range hellos {
+		assert.Equal(t, "example.com", hello.ServerName)
+		if sliceutils.Find(hello.SupportedProtos, "x-tunnel") != -1 {
+			tunnelHellos++
+		} else {
+			sideChannelHellos++
+		}
+	}
+	assert.Equal(t, 1, sideChannelHellos)
+	assert.Equal(t, 1, tunnelHellos)
+	// The TLS configs passed in are not modified.
+	assert.Empty(t, tunnelTLSConf.ServerName)
+	assert.Equal(t, []string{"h2", "x-tunnel"}, tunnelTLSConf.NextProtos)
+}
+
+// newClientCertificate returns a self-signed client certificate with the given common name.
+func newClientCertificate(t *testing.T, commonName string) *tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestConnectViaProxy_GetClientCertificate(t *testing.T) {
+	grpcSrv := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcSrv, health.NewServer())
+	defer grpcSrv.Stop()
+
+	var mutex sync.Mutex
+	var presented []string
+	srv := httptest.NewUnstartedServer(grpcSrv)
+	srv.EnableHTTP2 = true
+	srv.TLS = &tls.Config{
+		ClientAuth: tls.RequireAnyClientCert,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			presented = append(presented, cs.PeerCertificates[0].Subject.CommonName)
+			return nil
+		},
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	certPool := x509.NewCertPool()
+	certPool.AddCert(srv.Certificate())
+	// Simulate rotating certificates by issuing a new one on every handshake.
+	var issued []string
+	tlsConf := &tls.Config{
+		RootCAs:    certPool,
+		ServerName: "example.com",
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			commonName := fmt.Sprintf("client-%d", len(issued))
+			issued = append(issued, commonName)
+			return newClientCertificate(t, commonName), nil
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		cc, err := ConnectViaProxy(ctx, srv.Listener.Addr().String(), tlsConf)
+		require.NoError(t, err)
+		_, err = healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+		_ = cc.Close()
+		cancel()
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	// Both the side channel and the connection carrying the calls fetch a fresh certificate for every handshake.
+	assert.Equal(t, []string{"client-0", "client-1", "client-2", "client-3"}, issued)
+	assert.ElementsMatch(t, issued, presented)
+}
+
+// failoverTestDialer is a dialer that records the dialed addresses, and only succeeds in connecting to reachableAddr.
+type failoverTestDialer struct {
+	reachableAddr string
+	dialedAddrs   []string
+}
+
+func (d *failoverTestDialer) DialContext(_ context.Context, _, address string) (net.Conn, error) {
+	d.dialedAddrs = append(d.dialedAddrs, address)
+	if address != d.reachableAddr {
+		return nil, fmt.Errorf("connecting to %s: connection refused", address)
+	}
+	clientConn, serverConn := net.Pipe()
+	_ = serverConn.Close()
+	return clientConn, nil
+}
+
+func TestEndpointDialer_Failover(t *testing.T) {
+	failoverAddrs := []string{"b.example.com:443", "c.example.com:443"}
+
+	t.Run("first reachable endpoint", func(t *testing.T) {
+		dialer := &failoverTestDialer{reachableAddr: "b.example.com:443"}
+		conn, err := (&endpointDialer{dialer: dialer, failoverAddrs: failoverAddrs}).DialContext(context.Background(), "tcp", "a.example.com:443")
+		require.NoError(t, err)
+		_ = conn.Close()
+		assert.Equal(t, []string{"a.example.com:443", "b.example.com:443"}, dialer.dialedAddrs)
+	})
+
+	t.Run("no reachable endpoint", func(t *testing.T) {
+		dialer := &failoverTestDialer{}
+		_, err := (&endpointDialer{dialer: dialer, failoverAddrs: failoverAddrs}).DialContext(context.Background(), "tcp", "a.example.com:443")
+		require.Error(t, err)
+		assert.Equal(t, []string{"a.example.com:443", "b.example.com:443", "c.example.com:443"}, dialer.dialedAddrs)
+
+		var failoverErr *FailoverError
+		require.ErrorAs(t, err, &failoverErr)
+		require.Len(t, failoverErr.Errs, 3)
+		var endpointErr *EndpointDialError
+		require.ErrorAs(t, failoverErr.Errs[2], &endpointErr)
+		assert.Equal(t, "c.example.com:443", endpointErr.Addr)
+		assert.Contains(t, err.Error(), "connecting to a.example.com:443: connection refused")
+	})
+
+	t.Run("context expired", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		dialer := &failoverTestDialer{reachableAddr: "b.example.com:443"}
+		_, err := (&endpointDialer{dialer: dialer, failoverAddrs: failoverAddrs}).DialContext(ctx, "tcp", "a.example.com:443")
+		require.Error(t, err)
+		assert.Equal(t, []string{"a.example.com:443"}, dialer.dialedAddrs)
+	})
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import "time"
+
+// HandshakeKind is the kind of handshake the client performs for establishing a connection.
+type HandshakeKind string
+
+const (
+	// HandshakeProxyConnect denotes establishing a tunnel to the endpoint via an HTTP CONNECT or SOCKS5 proxy,
+	// including connecting to the proxy.
+	HandshakeProxyConnect HandshakeKind = "proxy-connect"
+	// HandshakeSideChannel denotes the side channel handshake performed for obtaining the auth info of the
+	// endpoint, excluding establishing the connection.
+	HandshakeSideChannel HandshakeKind = "side-channel"
+	// HandshakeWebSocket denotes the WebSocket handshake performed for a gRPC-WebSocket call, including establishing
+	// the connection, unless it is reused.
+	HandshakeWebSocket HandshakeKind = "websocket"
+)
+
+// HandshakeStats describes a handshake that has completed or failed.
+type HandshakeStats struct {
+	// Kind is the kind of handshake.
+	Kind HandshakeKind
+	// Addr is the address of the endpoint the handshake was performed for.
+	Addr string
+	// Duration is the time the handshake took.
+	Duration time.Duration
+	// Err is the error the handshake failed with, or nil if it succeeded.
+	Err error
+}
+
+// StreamInfo describes a gRPC stream forwarded by the client.
+type StreamInfo struct {
+	// Method is the full method name, e.g., `/grpc.health.v1.Health/Check`.
+	Method string
+	// StartTime is the time at which the client started forwarding the stream.
+	StartTime time.Time
+}
+
+// StreamStats describes a gRPC stream that has been forwarded by the client.
+type StreamStats struct {
+	StreamInfo
+
+	// Duration is the time it took to forward the stream.
+	Duration time.Duration
+	// BytesSent and BytesReceived are the number of bytes sent to and received from the endpoint, as reported to the
+	// function passed to `WithByteCounter`.
+	BytesSent, BytesReceived int64
+	// FramesSent and FramesReceived are the number of gRPC frames sent to and received from the endpoint, including
+	// the headers and trailers frames of downgraded and WebSocket responses.
+	FramesSent, FramesReceived int64
+}
+
+// StatsHandler receives callbacks whenever the client starts and finishes forwarding a gRPC stream, and whenever a
+// handshake for establishing a connection has completed or failed. The callbacks are invoked synchronously and may be
+// invoked concurrently, hence implementations should not block.
+type StatsHandler interface {
+	// StreamStarted is called when the client starts forwarding a gRPC stream.
+	StreamStarted(info StreamInfo)
+	// StreamFinished is called when the client has finished forwarding a gRPC stream, including streams that failed.
+	StreamFinished(stats StreamStats)
+	// HandshakeFinished is called when a handshake has completed or failed.
+	HandshakeFinished(stats HandshakeStats)
+}
+
+// reportHandshake notifies the given stats handler, if any, of a handshake that started at the given time.
+func reportHandshake(handler StatsHandler, kind HandshakeKind, addr string, start time.Time, err error) {
+	if handler == nil {
+		return
+	}
+	handler.HandshakeFinished(HandshakeStats{
+		Kind:     kind,
+		Addr:     addr,
+		Duration: time.Since(start),
+		Err:      err,
+	})
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// recordingStatsHandler records the handshakes it is notified of.
+type recordingStatsHandler struct {
+	mutex      sync.Mutex
+	handshakes []HandshakeStats
+}
+
+func (h *recordingStatsHandler) StreamStarted(StreamInfo) {}
+
+func (h *recordingStatsHandler) StreamFinished(StreamStats) {}
+
+func (h *recordingStatsHandler) HandshakeFinished(stats HandshakeStats) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.handshakes = append(h.handshakes, stats)
+}
+
+func TestClientHandshake_StatsHandler(t *testing.T) {
+	const endpoint = "grpc.example.com:443"
+
+	cases := map[string]struct {
+		proxyResponse string
+		expectedKinds []HandshakeKind
+		expectErr     bool
+	}{
+		"success": {
+			proxyResponse: "HTTP/1.1 200 Connection Established\r\n\r\n",
+			expectedKinds: []HandshakeKind{HandshakeProxyConnect, HandshakeSideChannel},
+		},
+		"proxy failure": {
+			proxyResponse: "HTTP/1.1 403 Forbidden\r\n\r\n",
+			expectedKinds: []HandshakeKind{HandshakeProxyConnect},
+			expectErr:     true,
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			proxyURL := fakeProxy(t, func(conn net.Conn, _ *http.Request) {
+				_, _ = conn.Write([]byte(c.proxyResponse))
+			})
+
+			stats := &recordingStatsHandler{}
+			var opts connectOptions
+			WithProxyFunc(func(*http.Request) (*url.URL, error) { return proxyURL, nil }).apply(&opts)
+			WithStatsHandler(stats).apply(&opts)
+			sideChannel := newCredsFromSideChannel(endpoint, &countingCreds{TransportCredentials: insecure.NewCredentials()}, opts)
+			_, _, err := sideChannel.ClientHandshake(context.Background(), endpoint, nil)
+			if c.expectErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			require.Len(t, stats.handshakes, len(c.expectedKinds))
+			for i, kind := range c.expectedKinds {
+				handshake := stats.handshakes[i]
+				assert.Equal(t, kind, handshake.Kind)
+				assert.Equal(t, endpoint, handshake.Addr)
+			}
+			assert.Equal(t, c.expectErr, stats.handshakes[0].Err != nil)
+		})
+	}
+}
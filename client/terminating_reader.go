@@ -0,0 +1,75 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"google.golang.org/grpc/codes"
+)
+
+// terminatingReader wraps a response body such that, if reading fails because the deadline of the request has been
+// exceeded or because a gRPC frame or the response exceeds the maximum frame or response size, the response is
+// terminated with a `DeadlineExceeded` or `ResourceExhausted` gRPC status, respectively, instead of being aborted. Otherwise, the gRPC
+// client would observe an aborted stream and report an internal error.
+type terminatingReader struct {
+	io.ReadCloser
+	ctx      context.Context
+	trailers *http.Header
+	logger   Logger
+}
+
+func newTerminatingReader(ctx context.Context, body io.ReadCloser, trailers *http.Header, logger Logger) io.ReadCloser {
+	return &terminatingReader{
+		ReadCloser: body,
+		ctx:        ctx,
+		trailers:   trailers,
+		logger:     logger,
+	}
+}
+
+func (r *terminatingReader) Read(buf []byte) (int, error) {
+	n, err := r.ReadCloser.Read(buf)
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+	r.logger.Warnf("Reading gRPC response failed: %v", err)
+
+	var frameErr *grpcproto.FrameTooLargeError
+	switch {
+	case r.ctx.Err() == context.DeadlineExceeded:
+		r.setStatus(codes.DeadlineExceeded, "deadline exceeded while reading response")
+	case errors.As(err, &frameErr):
+		r.setStatus(codes.ResourceExhausted, frameErr.Error())
+	case isResponseTooLarge(err):
+		r.setStatus(codes.ResourceExhausted, err.Error())
+	default:
+		return n, err
+	}
+	return n, io.EOF
+}
+
+func (r *terminatingReader) setStatus(code codes.Code, msg string) {
+	if *r.trailers == nil {
+		*r.trailers = make(http.Header)
+	}
+	r.trailers.Set("Grpc-Status", fmt.Sprintf("%d", code))
+	r.trailers.Set("Grpc-Message", grpcproto.EncodeGrpcMessage(msg))
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"golang.stackrox.io/grpc-http1/internal/grpcweb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestTrailersOnlyResponse(t *testing.T) {
+	cases := map[string]http.HandlerFunc{
+		"trailer frame only": func(w http.ResponseWriter, _ *http.Request) {
+			trailers := "grpc-status: 5\r\ngrpc-message: not here\r\n"
+			w.Header().Set("Content-Type", "application/grpc-web+proto")
+			_, _ = w.Write(grpcproto.MakeMessageHeader(grpcproto.MetadataFlags, uint32(len(trailers))))
+			_, _ = w.Write([]byte(trailers))
+		},
+		"status in headers with empty body": func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "application/grpc-web+proto")
+			w.Header().Set("Grpc-Status", "5")
+			w.Header().Set("Grpc-Message", "not here")
+			w.Header().Set("Content-Length", "0")
+			w.WriteHeader(http.StatusOK)
+		},
+		"status in headers with empty chunked body": func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "application/grpc-web+proto")
+			w.Header().Set("Grpc-Status", "5")
+			w.Header().Set("Grpc-Message", "not here")
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+		},
+		"status in HTTP trailers with empty body": func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "application/grpc-web+proto")
+			w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			w.Header().Set("Grpc-Status", "5")
+			w.Header().Set("Grpc-Message", "not here")
+		},
+	}
+
+	for name, handler := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(handler)
+			defer srv.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			cc, err := ConnectViaProxy(ctx, strings.TrimPrefix(srv.URL, "http://"), nil,
+				DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())))
+			require.NoError(t, err)
+			defer func() { _ = cc.Close() }()
+
+			_, err = healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{})
+			st, ok := status.FromError(err)
+			require.True(t, ok)
+			assert.Equal(t, codes.NotFound, st.Code(), fmt.Sprintf("unexpected status: %v", st))
+			assert.Equal(t, "not here", st.Message())
+		})
+	}
+}
+
+func TestDowngradedRequestAcceptsTrailers(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests <- req
+		w.Header().Set("Content-Type", "application/grpc-web+proto")
+		w.Header().Set("Grpc-Status", "5")
+		w.Header().Set("Grpc-Message", "not here")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cc, err := ConnectViaProxy(ctx, strings.TrimPrefix(srv.URL, "http://"), nil, ForceDowngrade(true),
+		DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())))
+	require.NoError(t, err)
+	defer func() { _ = cc.Close() }()
+
+	_, err = healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	req := <-requests
+	assert.Equal(t, 1, req.ProtoMajor)
+	assert.Equal(t, "trailers", req.Header.Get("TE"))
+	assert.Equal(t, "true", req.Header.Get(grpcweb.GRPCWebOnlyHeader))
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// TunnelDialer returns a dialer for use with `grpc.WithContextDialer`, for composing the transport of this library with
+// a custom `grpc.Dial` call, e.g., to use a custom resolver or load balancer. Every connection returned by the dialer
+// is served by a dedicated in-process proxy, which forwards the gRPC calls sent over it to the dialed address in the
+// same way as for `ConnectViaProxy`, and which is shut down once the connection is closed.
+//
+// The connections are plaintext HTTP/2 connections to the proxy, hence the gRPC client must be created with
+// `grpc.WithTransportCredentials(insecure.NewCredentials())`. TLS connections to the endpoint are configured via
+// `WithTunnelTLSConfig`, which must also verify the identity of the endpoint, as there is no side channel; without it,
+// the endpoint is connected to in plaintext. A server name set via `WithTLSServerName` applies to these connections.
+// As for `ConnectViaProxy`, HTTPS proxies are connected to with the config passed to `WithProxyTLSConfig`, if any, and
+// never with the tunnel TLS config.
+//
+// The options configuring how calls are forwarded are honored, i.e., the options selecting the transport (such as
+// `UseWebSocket`, `ForceDowngrade` or `UseGRPCWeb`), the proxy options, and the options for requests, responses and
+// connections to the endpoint (such as `WithRequestHeaders`, `WithMaxFrameSize` or `WithKeepAlive`). Options applying
+// to the gRPC client connection or the side channel have no effect; these are `DialOpts`, `WithDialTimeout`,
+// `WithMaxMetadataBytes`, `WebSocketResume`, `WithFailoverEndpoints`, `WithPeerCertPinning` and the `WithSideChannel...`
+// options. As unary calls cannot be told apart from streams without an interceptor on the gRPC client connection,
+// `WithStreamIdleTimeout` applies to unary calls as well.
+// Unix domain socket endpoints are not supported.
+func TunnelDialer(opts ...ConnectOption) func(ctx context.Context, addr string) (net.Conn, error) {
+	connectOpts := newConnectOptions(opts)
+	// Failing over is up to the resolver and load balancer of the gRPC client.
+	connectOpts.failoverEndpoints = nil
+	// Resuming calls requires marking resumable calls in the gRPC client.
+	connectOpts.wsResume = 0
+
+	tunnelTLSConf := connectOpts.tunnelTLSConfig.Clone()
+	if tunnelTLSConf != nil && connectOpts.tlsServerName != "" {
+		tunnelTLSConf.ServerName = connectOpts.tlsServerName
+	}
+
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		createProxy := createClientProxy
+		if connectOpts.useWebSocket {
+			createProxy = createClientWSProxy
+		}
+		proxy, dialCtx, err := createProxy(addr, tunnelTLSConf, connectOpts)
+		if err != nil {
+			return nil, errors.Wrap(err, "creating client proxy")
+		}
+		conn, err := dialCtx(ctx)
+		if err != nil {
+			_ = proxy.Close()
+			return nil, err
+		}
+		return &tunnelConn{Conn: conn, proxy: proxy}, nil
+	}
+}
+
+// tunnelConn is a connection to an in-process proxy, which is shut down once the connection is closed.
+type tunnelConn struct {
+	net.Conn
+	proxy *http.Server
+}
+
+func (c *tunnelConn) Close() error {
+	err := c.Conn.Close()
+	_ = c.proxy.Close()
+	return err
+}
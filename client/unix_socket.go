@@ -0,0 +1,52 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"net"
+	"strings"
+)
+
+const (
+	// unixSocketHost is the host used in HTTP requests to endpoints listening on a Unix domain socket.
+	unixSocketHost = "localhost"
+)
+
+// unixSocketPath checks whether the given endpoint denotes a Unix domain socket, i.e., is of the form
+// `unix:///absolute/path` or `unix:relative/path` as in gRPC target names, and returns the path of the socket. The
+// path is empty if the endpoint is malformed.
+func unixSocketPath(endpoint string) (string, bool) {
+	if path := strings.TrimPrefix(endpoint, "unix://"); path != endpoint {
+		if !strings.HasPrefix(path, "/") {
+			return "", true
+		}
+		return path, true
+	}
+	if path := strings.TrimPrefix(endpoint, "unix:"); path != endpoint {
+		return path, true
+	}
+	return "", false
+}
+
+// unixSocketDialer dials the Unix domain socket at the given path, regardless of the requested address.
+type unixSocketDialer struct {
+	path   string
+	dialer ContextDialer
+}
+
+func (d unixSocketDialer) DialContext(ctx context.Context, _, _ string) (net.Conn, error) {
+	return d.dialer.DialContext(ctx, "unix", d.path)
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestUnixSocketPath(t *testing.T) {
+	cases := map[string]struct {
+		path   string
+		isUnix bool
+	}{
+		"unix:///var/run/grpc.sock": {path: "/var/run/grpc.sock", isUnix: true},
+		"unix:/var/run/grpc.sock":   {path: "/var/run/grpc.sock", isUnix: true},
+		"unix:grpc.sock":            {path: "grpc.sock", isUnix: true},
+		"unix://grpc.sock":          {isUnix: true},
+		"unix:":                     {isUnix: true},
+		"localhost:8443":            {},
+		"unixhost:8443":             {},
+	}
+	for endpoint, c := range cases {
+		t.Run(endpoint, func(t *testing.T) {
+			path, isUnix := unixSocketPath(endpoint)
+			assert.Equal(t, c.path, path)
+			assert.Equal(t, c.isUnix, isUnix)
+		})
+	}
+}
+
+func TestConnectViaProxy_InvalidUnixSocket(t *testing.T) {
+	_, err := ConnectViaProxy(context.Background(), "unix://relative.sock", nil,
+		DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid Unix domain socket endpoint")
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"golang.stackrox.io/grpc-http1/internal/grpcweb"
+)
+
+const (
+	modulePath       = "golang.stackrox.io/grpc-http1"
+	userAgentProduct = "go-grpc-http1"
+)
+
+// defaultUserAgent is the User-Agent of HTTP CONNECT requests to proxies unless overridden via WithUserAgent.
+var defaultUserAgent = userAgentWithVersion(moduleVersion())
+
+func userAgentWithVersion(version string) string {
+	if version == "" || version == "(devel)" {
+		return userAgentProduct
+	}
+	return userAgentProduct + "/" + version
+}
+
+// moduleVersion returns the version of this module the running binary was built with, if known.
+func moduleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	if info.Main.Path == modulePath {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			return dep.Version
+		}
+	}
+	return ""
+}
+
+// setUserAgent sets the User-Agent header of a tunneling request to the given user agent, if non-empty. The user agent
+// of the gRPC client is then moved to the X-User-Agent header, from which the downgrading handler restores the
+// `user-agent` metadata, unless the X-User-Agent header is set to the given non-empty xUserAgent instead. If both are
+// empty, the request is left untouched, such that any server sees the user agent of the gRPC client.
+func setUserAgent(hdr http.Header, userAgent, xUserAgent string) {
+	if xUserAgent != "" {
+		hdr.Set(grpcweb.UserAgentHeader, xUserAgent)
+	}
+	if userAgent == "" {
+		return
+	}
+	if grpcUserAgent := hdr.Get("User-Agent"); grpcUserAgent != "" && hdr.Get(grpcweb.UserAgentHeader) == "" {
+		hdr.Set(grpcweb.UserAgentHeader, grpcUserAgent)
+	}
+	hdr.Set("User-Agent", userAgent)
+}
+
+// proxyUserAgent returns the User-Agent of HTTP CONNECT requests to proxies, which is the given user agent, if
+// non-empty, and defaultUserAgent otherwise.
+func proxyUserAgent(userAgent string) string {
+	if userAgent == "" {
+		return defaultUserAgent
+	}
+	return userAgent
+}
+
+// proxyConnectHeader returns the headers to send with HTTP CONNECT requests to proxies.
+func proxyConnectHeader(userAgent string) http.Header {
+	return http.Header{"User-Agent": {proxyUserAgent(userAgent)}}
+}
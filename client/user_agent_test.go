@@ -0,0 +1,101 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserAgentWithVersion(t *testing.T) {
+	assert.Equal(t, "go-grpc-http1/v0.3.0", userAgentWithVersion("v0.3.0"))
+	assert.Equal(t, "go-grpc-http1", userAgentWithVersion("(devel)"))
+	assert.Equal(t, "go-grpc-http1", userAgentWithVersion(""))
+}
+
+func TestProxyConnectHeader(t *testing.T) {
+	assert.Equal(t, http.Header{"User-Agent": {defaultUserAgent}}, proxyConnectHeader(""))
+	assert.Equal(t, http.Header{"User-Agent": {"tunnel/1.0"}}, proxyConnectHeader("tunnel/1.0"))
+}
+
+func TestSetUserAgent(t *testing.T) {
+	cases := map[string]struct {
+		hdr        http.Header
+		userAgent  string
+		xUserAgent string
+		expected   http.Header
+	}{
+		"gRPC user agent is moved": {
+			hdr:       http.Header{"User-Agent": {"grpc-go/1.60.1"}},
+			userAgent: "tunnel/1.0",
+			expected:  http.Header{"User-Agent": {"tunnel/1.0"}, "X-User-Agent": {"grpc-go/1.60.1"}},
+		},
+		"existing X-User-Agent is kept": {
+			hdr:       http.Header{"User-Agent": {"grpc-go/1.60.1"}, "X-User-Agent": {"grpc-web-javascript/0.1"}},
+			userAgent: "tunnel/1.0",
+			expected:  http.Header{"User-Agent": {"tunnel/1.0"}, "X-User-Agent": {"grpc-web-javascript/0.1"}},
+		},
+		"no gRPC user agent": {
+			hdr:       http.Header{},
+			userAgent: "tunnel/1.0",
+			expected:  http.Header{"User-Agent": {"tunnel/1.0"}},
+		},
+		"no user agent": {
+			hdr:      http.Header{"User-Agent": {"grpc-go/1.60.1"}},
+			expected: http.Header{"User-Agent": {"grpc-go/1.60.1"}},
+		},
+		"X-User-Agent replaces gRPC user agent": {
+			hdr:        http.Header{"User-Agent": {"grpc-go/1.60.1"}},
+			userAgent:  "tunnel/1.0",
+			xUserAgent: "grpc-web-javascript/0.1",
+			expected:   http.Header{"User-Agent": {"tunnel/1.0"}, "X-User-Agent": {"grpc-web-javascript/0.1"}},
+		},
+		"X-User-Agent without user agent": {
+			hdr:        http.Header{"User-Agent": {"grpc-go/1.60.1"}},
+			xUserAgent: "grpc-web-javascript/0.1",
+			expected:   http.Header{"User-Agent": {"grpc-go/1.60.1"}, "X-User-Agent": {"grpc-web-javascript/0.1"}},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			setUserAgent(c.hdr, c.userAgent, c.xUserAgent)
+			assert.Equal(t, c.expected, c.hdr)
+		})
+	}
+}
+
+func TestDialViaCONNECT_UserAgent(t *testing.T) {
+	for _, userAgent := range []string{"tunnel/1.0", ""} {
+		userAgents := make(chan []string, 1)
+		proxyURL := fakeProxy(t, func(conn net.Conn, req *http.Request) {
+			userAgents <- req.Header.Values("User-Agent")
+			_, _ = conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+		})
+
+		conn, err := (&endpointDialer{userAgent: userAgent}).dialViaCONNECT(context.Background(), "example.com:443", proxyURL)
+		require.NoError(t, err)
+		_ = conn.Close()
+		if userAgent == "" {
+			assert.Empty(t, <-userAgents)
+		} else {
+			assert.Equal(t, []string{userAgent}, <-userAgents)
+		}
+	}
+}
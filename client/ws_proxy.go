@@ -23,17 +23,17 @@ import (
 	"io"
 	"net/http"
 	"net/textproto"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
-	"github.com/golang/glog"
 	"github.com/pkg/errors"
 	"golang.stackrox.io/grpc-http1/internal/grpcproto"
 	"golang.stackrox.io/grpc-http1/internal/grpcwebsocket"
 	"golang.stackrox.io/grpc-http1/internal/httputils"
 	"golang.stackrox.io/grpc-http1/internal/pipeconn"
-	"golang.stackrox.io/grpc-http1/internal/size"
 	"google.golang.org/grpc/codes"
 	"nhooyr.io/websocket"
 )
@@ -43,44 +43,98 @@ const (
 )
 
 var (
-	subprotocols = []string{grpcwebsocket.SubprotocolName}
+	errWebSocketUnsupported = errors.New("server does not support WebSocket tunneling")
 )
 
 type http2WebSocketProxy struct {
-	insecure   bool
-	endpoint   string
-	httpClient *http.Client
+	insecure        bool
+	endpoint        string
+	httpClient      *http.Client
+	compressionMode websocket.CompressionMode
+	statusMapper    func(int) codes.Code
+	keepalive       wsKeepaliveOption
+	maxFrameSize    uint32
+	maxRespBytes    int64
+	resumeAttempts  int
+	path            string
+	subprotocol     string
+	window          uint32
+	requestHeaders  http.Header
+	hostHeader      string
+	pathRewriter    func(method string) string
+	userAgent       string
+	xUserAgent      string
+	logger          Logger
+	stats           StatsHandler
+	// fallback handles calls if the server does not support WebSocket tunneling. If nil, such calls fail.
+	fallback http.Handler
 }
 
 type websocketConn struct {
-	ctx  context.Context
-	conn *websocket.Conn
-	w    http.ResponseWriter
-
-	url string
+	ctx          context.Context
+	conn         *websocket.Conn
+	w            http.ResponseWriter
+	maxFrameSize uint32
+	// maxRespBytes limits the total size of the frames read. Zero or negative means no limit.
+	maxRespBytes int64
+	received     int64
+
+	// headerWritten indicates whether the response header has been written to the gRPC client, such that it is not
+	// written again when resuming the call.
+	headerWritten bool
+	// dataFrames is the number of data frames written to the gRPC client.
+	dataFrames uint64
+
+	// window is the flow-control window the server confirmed for the connection, or zero if it does not use flow
+	// control. unacked is the number of bytes of data frames consumed since the last window update.
+	window  uint32
+	unacked uint32
+
+	url    string
+	logger Logger
 
 	errFlag int32
 	err     error
 }
 
+// readFrame reads a single WebSocket message, rejecting gRPC frames exceeding the maximum frame size, as well as
+// frames exceeding the maximum response size in total.
+func (c *websocketConn) readFrame() (websocket.MessageType, []byte, error) {
+	mt, r, err := c.conn.Reader(c.ctx)
+	if err != nil {
+		return 0, nil, markTunnelLost(err)
+	}
+	var msg bytes.Buffer
+	err = grpcwebsocket.ReadFrame(r, &msg, c.maxFrameSize)
+	addReceived(c.ctx, msg.Len())
+	if err != nil {
+		return 0, nil, markTunnelLost(err)
+	}
+	c.received += int64(msg.Len())
+	if c.maxRespBytes > 0 && c.received > c.maxRespBytes {
+		return 0, nil, &responseTooLargeError{limit: c.maxRespBytes}
+	}
+	return mt, msg.Bytes(), nil
+}
+
 // readHeader reads gRPC response headers. Trailers-Only messages are treated as response headers.
-func (c *websocketConn) readHeader() error {
-	mt, msg, err := c.conn.Read(c.ctx)
+func (c *websocketConn) readHeader() (http.Header, error) {
+	mt, msg, err := c.readFrame()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if mt != websocket.MessageBinary {
-		return errors.Errorf("incorrect message type; expected MessageBinary but got %v", mt)
+		return nil, errors.Errorf("incorrect message type; expected MessageBinary but got %v", mt)
 	}
 
 	if err := grpcproto.ValidateGRPCFrame(msg); err != nil {
-		return err
+		return nil, err
 	}
 	if !grpcproto.IsMetadataFrame(msg) {
-		return errors.New("did not receive metadata message")
+		return nil, errors.New("did not receive metadata message")
 	}
 
-	return setHeader(c.w, msg[grpcproto.MessageHeaderLength:], false)
+	return parseHeader(msg[grpcproto.MessageHeaderLength:])
 }
 
 // Read gRPC response messages from the server and write them back to the gRPC client.
@@ -89,36 +143,50 @@ func (c *websocketConn) readFromServer() error {
 
 	// Handle normal and trailers-only messages.
 	// Treat trailers-only the same as a headers-only response.
-	if err := c.readHeader(); err != nil {
+	hdr, err := c.readHeader()
+	if err != nil {
 		return errors.Wrap(err, "reading response header")
 	}
+	trailersOnly := len(hdr["Grpc-Status"]) > 0
+	if !c.headerWritten {
+		addHeader(c.w, hdr, false)
+	} else if trailersOnly {
+		// The call was resumed after the response header had already been written. The status of the call can only be
+		// conveyed in the trailers.
+		addHeader(c.w, hdr, true)
+	}
 
-	if len(c.w.Header()["Grpc-Status"]) > 0 {
+	if trailersOnly {
 		// Trailers-Only response.
 		// Grpc-Status will always be sent in the trailers.
 		return nil
 	}
 
-	c.w.WriteHeader(http.StatusOK)
+	if !c.headerWritten {
+		c.w.WriteHeader(http.StatusOK)
+		c.headerWritten = true
+	}
 
 	// "State" variable.
 	// Data is expected after receiving the headers (above), but not after receiving trailers.
 	// When false, we expect EOF.
 	dataExpected := true
 	for {
-		mt, msg, err := c.conn.Read(c.ctx)
+		mt, msg, err := c.readFrame()
 		if err != nil {
 			if dataExpected {
 				return errors.Wrap(err, "reading response body")
 			}
 
 			switch websocket.CloseStatus(err) {
-			case websocket.StatusNormalClosure, websocket.StatusGoingAway:
-				return nil
 			case -1:
 				if err == io.EOF {
 					return nil
 				}
+			default:
+				// The status of the call has already been received with the trailers, the close status (e.g.,
+				// an internal error for a call that failed with such) does not add any information.
+				return nil
 			}
 
 			return errors.Wrap(err, "non-EOF error while reading response body")
@@ -138,6 +206,8 @@ func (c *websocketConn) readFromServer() error {
 			if _, err := c.w.Write(msg); err != nil {
 				return err
 			}
+			c.dataFrames++
+			c.grantWindow(len(msg))
 		} else if grpcproto.IsMetadataFrame(msg) {
 			if grpcproto.IsCompressed(msg) {
 				return errors.New("compression flag is set; compressed metadata is not supported")
@@ -154,6 +224,16 @@ func (c *websocketConn) readFromServer() error {
 
 // Set the http.Header. If isTrailers is true, http.TrailerPrefix is prepended to each key.
 func setHeader(w http.ResponseWriter, msg []byte, isTrailers bool) error {
+	hdr, err := parseHeader(msg)
+	if err != nil {
+		return err
+	}
+	addHeader(w, hdr, isTrailers)
+	return nil
+}
+
+// parseHeader parses the payload of a gRPC-WebSocket metadata frame.
+func parseHeader(msg []byte) (http.Header, error) {
 	hdr, err := textproto.NewReader(
 		bufio.NewReader(
 			io.MultiReader(
@@ -163,9 +243,15 @@ func setHeader(w http.ResponseWriter, msg []byte, isTrailers bool) error {
 		),
 	).ReadMIMEHeader()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	grpcproto.SplitBinaryMetadata(http.Header(hdr))
+	return http.Header(hdr), nil
+}
+
+// addHeader adds hdr to the header of w. If isTrailers is true, http.TrailerPrefix is prepended to each key.
+func addHeader(w http.ResponseWriter, hdr http.Header, isTrailers bool) {
 	wHdr := w.Header()
 	for k, vs := range hdr {
 		if isTrailers {
@@ -176,24 +262,42 @@ func setHeader(w http.ResponseWriter, msg []byte, isTrailers bool) error {
 			wHdr.Add(k, v)
 		}
 	}
-
-	return nil
 }
 
 func (c *websocketConn) writeToServer(body io.Reader) error {
-	if err := grpcwebsocket.Write(c.ctx, c.conn, body, name); err != nil {
-		glog.V(2).Infof("Error writing to %q: %v", c.url, err)
+	if err := grpcwebsocket.Write(c.ctx, c.conn, body, nil); err != nil {
 		return err
 	}
 	// Signal to the server there are no more messages in the stream.
 	if err := c.conn.Write(c.ctx, websocket.MessageBinary, grpcproto.EndStreamHeader); err != nil {
-		glog.V(2).Infof("Error writing EOS to %q: %v", c.url, err)
-		return err
+		return errors.Wrap(err, "writing end of stream")
 	}
+	addSent(c.ctx, len(grpcproto.EndStreamHeader))
 
 	return nil
 }
 
+// grantWindow records that a data frame of the given size has been consumed by the gRPC client, and sends a window
+// update to the server once half of the window has been consumed, as HTTP/2 implementations commonly do.
+func (c *websocketConn) grantWindow(n int) {
+	if c.window == 0 {
+		return
+	}
+	c.unacked += uint32(n)
+	if c.unacked < c.window/2 {
+		return
+	}
+	// The server may have finished sending the response already, in which case writing fails, but the response is
+	// still read completely.
+	update := grpcproto.MakeWindowUpdate(c.unacked)
+	if err := c.conn.Write(c.ctx, websocket.MessageBinary, update); err != nil {
+		c.logger.Debugf("Error writing window update to %q: %v", c.url, err)
+		return
+	}
+	addSent(c.ctx, len(update))
+	c.unacked = 0
+}
+
 func (c *websocketConn) setError(err error) {
 	if atomic.SwapInt32(&c.errFlag, 1) == 0 {
 		c.err = err
@@ -207,17 +311,45 @@ func (c *websocketConn) writeErrorIfNecessary() {
 		return
 	}
 
+	if c.w.Header().Get("Content-Type") == "" {
+		// The error occurred before the response headers were received.
+		c.w.Header().Set("Content-Type", "application/grpc")
+	}
 	c.w.WriteHeader(http.StatusOK)
 
-	c.w.Header().Set("Trailer:Grpc-Status", fmt.Sprintf("%d", codes.Unavailable))
+	code := grpcwebsocket.CodeForCloseStatus(websocket.CloseStatus(c.err))
+	if isFrameTooLarge(c.err) || isResponseTooLarge(c.err) {
+		code = codes.ResourceExhausted
+	}
+	c.w.Header().Set("Trailer:Grpc-Status", fmt.Sprintf("%d", code))
 	errMsg := errors.Wrap(c.err, "transport").Error()
 	c.w.Header().Set("Trailer:Grpc-Message", grpcproto.EncodeGrpcMessage(errMsg))
 }
 
+// isFrameTooLarge checks whether err was caused by a gRPC frame exceeding the maximum frame size, either on this
+// side or on the server side of the connection.
+func isFrameTooLarge(err error) bool {
+	var frameErr *grpcproto.FrameTooLargeError
+	return errors.As(err, &frameErr) || websocket.CloseStatus(err) == websocket.StatusMessageTooBig
+}
+
+// isWebSocketUnsupported checks whether the response to a failed WebSocket handshake indicates that the server does not
+// support WebSocket tunneling at all, as opposed to a failure to handle this particular call.
+func isWebSocketUnsupported(resp *http.Response) bool {
+	if resp == nil {
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusUpgradeRequired, http.StatusNotImplemented:
+		return true
+	}
+	return false
+}
+
 // ServeHTTP handles gRPC-WebSocket traffic.
 func (h *http2WebSocketProxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	if req.ProtoMajor != 2 || !strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc") {
-		glog.Error("Request is not a valid gRPC request")
+		h.logger.Warnf("Request is not a valid gRPC request")
 		w.WriteHeader(http.StatusUnsupportedMediaType)
 		return
 	}
@@ -227,81 +359,259 @@ func (h *http2WebSocketProxy) ServeHTTP(w http.ResponseWriter, req *http.Request
 		scheme = "http"
 	}
 
+	// Calls marked as resumable send a single request message, which is buffered such that it can be sent again when
+	// resuming the call.
+	resumable := h.resumeAttempts > 0 && req.Header.Get(grpcproto.ResumableHeader) != ""
+	req.Header.Del(grpcproto.ResumableHeader)
+	var reqBody []byte
+	if resumable {
+		var err error
+		if reqBody, err = io.ReadAll(req.Body); err != nil {
+			writeError(w, errors.Wrap(err, "reading request"), h.statusMapper)
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	addRequestHeaders(req.Header, h.requestHeaders)
+	setUserAgent(req.Header, h.userAgent, h.xUserAgent)
+	if h.window > 0 {
+		req.Header.Set(grpcproto.WindowHeader, strconv.FormatUint(uint64(h.window), 10))
+	}
+
 	url := *req.URL // Copy the value, so we do not overwrite the URL.
 	url.Scheme = scheme
 	url.Host = h.endpoint
-	conn, resp, err := websocket.Dial(req.Context(), url.String(), &websocket.DialOptions{
-		// Add the gRPC headers to the WebSocket handshake request.
-		HTTPHeader:   req.Header,
-		HTTPClient:   h.httpClient,
-		Subprotocols: subprotocols,
-		// gRPC already performs compression, so no need for WebSocket to add compression as well.
-		CompressionMode: websocket.CompressionDisabled,
-	})
+	if h.path != "" {
+		rewritePath(&url, req.Header, func(string) string { return h.path })
+	} else {
+		rewritePath(&url, req.Header, h.pathRewriter)
+	}
+	start := time.Now()
+	conn, resp, err := websocket.Dial(req.Context(), url.String(), h.dialOptions(req.Header))
+	reportHandshake(h.stats, HandshakeWebSocket, h.endpoint, start, err)
 	if resp != nil && resp.Body != nil {
 		// Not strictly necessary because the library already replaces resp.Body with a NopCloser,
 		// but seems too easy to miss should we switch to a different library.
 		defer func() { _ = resp.Body.Close() }()
 	}
+	if err != nil && isWebSocketUnsupported(resp) {
+		if h.fallback != nil {
+			req.Header.Del(grpcproto.WindowHeader)
+			h.logger.Debugf("Server does not support WebSocket tunneling (HTTP status %d), downgrading call to %q", resp.StatusCode, url.String())
+			h.fallback.ServeHTTP(w, req)
+			return
+		}
+		err = errors.Wrapf(errWebSocketUnsupported, "WebSocket handshake failed with HTTP status %d", resp.StatusCode)
+	}
 	if err != nil {
 		if resp != nil && resp.Body != nil {
 			if respErr := httputils.ExtractResponseError(resp); respErr != nil {
-				err = fmt.Errorf("%w; response error: %v", err, respErr)
+				err = &httpStatusError{
+					statusCode: resp.StatusCode,
+					err:        fmt.Errorf("%w; response error: %v", err, respErr),
+				}
 			}
 		}
-		writeError(w, errors.Wrapf(err, "connecting to gRPC endpoint %q", url.String()))
+		writeError(w, errors.Wrapf(err, "connecting to gRPC endpoint %q", url.String()), h.statusMapper)
 		return
 	}
-	conn.SetReadLimit(64 * size.MB)
+	conn.SetReadLimit(int64(h.maxFrameSize) + grpcproto.MessageHeaderLength)
+	// Only resume calls if the server supports it, as the client would otherwise receive messages twice.
+	resumable = resumable && resp.Header.Get(grpcproto.ResumableHeader) != ""
 
 	wsConn := &websocketConn{
-		ctx:  req.Context(),
-		conn: conn,
-		w:    w,
-		url:  url.String(),
+		ctx:          req.Context(),
+		conn:         conn,
+		w:            w,
+		maxFrameSize: h.maxFrameSize,
+		maxRespBytes: h.maxRespBytes,
+		window:       confirmedWindow(resp),
+		url:          url.String(),
+		logger:       h.logger,
+	}
+
+	h.serveConn(wsConn, req.Body)
+	delay := wsResumeBaseDelay
+	for attempt := 1; resumable && attempt <= h.resumeAttempts && isTunnelLost(wsConn.err) && req.Context().Err() == nil; attempt++ {
+		h.logger.Warnf("WebSocket connection with %q lost after %d messages, resuming call (attempt %d of %d): %v", wsConn.url, wsConn.dataFrames, attempt, h.resumeAttempts, wsConn.err)
+		req.Header.Set(grpcproto.ResumeFromHeader, strconv.FormatUint(wsConn.dataFrames, 10))
+		conn, resp, err := h.redial(req.Context(), wsConn.url, req.Header, delay)
+		if err != nil {
+			wsConn.err = errors.Wrapf(err, "resuming call after %v", wsConn.err)
+			break
+		}
+		delay *= 2
+		wsConn.conn = conn
+		wsConn.window, wsConn.unacked = confirmedWindow(resp), 0
+		wsConn.err, wsConn.errFlag = nil, 0
+		h.serveConn(wsConn, io.NopCloser(bytes.NewReader(reqBody)))
+	}
+
+	// If the connection had an error, write it back to the client.
+	wsConn.writeErrorIfNecessary()
+
+	h.logger.Debugf("Closing WebSocket connection with %q", wsConn.url)
+	// It's ok to potentially close the connection multiple times.
+	// Only the first time matters.
+	_ = wsConn.conn.Close(websocket.StatusNormalClosure, "")
+}
+
+func (h *http2WebSocketProxy) dialOptions(hdr http.Header) *websocket.DialOptions {
+	return &websocket.DialOptions{
+		// Add the gRPC headers to the WebSocket handshake request.
+		HTTPHeader:   hdr,
+		HTTPClient:   h.httpClient,
+		Host:         h.hostHeader,
+		Subprotocols: []string{h.subprotocol},
+		// Compression is only used if the server agrees to it.
+		CompressionMode: h.compressionMode,
 	}
+}
 
+// redial establishes a new WebSocket connection for resuming a call after waiting for the given delay.
+func (h *http2WebSocketProxy) redial(ctx context.Context, url string, hdr http.Header, delay time.Duration) (*websocket.Conn, *http.Response, error) {
+	timer := time.NewTimer(delay)
+	select {
+	case <-ctx.Done():
+		timer.Stop()
+		return nil, nil, ctx.Err()
+	case <-timer.C:
+	}
+
+	start := time.Now()
+	conn, resp, err := websocket.Dial(ctx, url, h.dialOptions(hdr))
+	reportHandshake(h.stats, HandshakeWebSocket, h.endpoint, start, err)
+	if resp != nil && resp.Body != nil {
+		_ = resp.Body.Close()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetReadLimit(int64(h.maxFrameSize) + grpcproto.MessageHeaderLength)
+	return conn, resp, nil
+}
+
+// confirmedWindow returns the flow-control window the server confirmed in its response to the WebSocket handshake, or
+// zero if it did not confirm any.
+func confirmedWindow(resp *http.Response) uint32 {
+	n, err := strconv.ParseUint(resp.Header.Get(grpcproto.WindowHeader), 10, 32)
+	if err != nil {
+		return 0
+	}
+	return uint32(n)
+}
+
+// serveConn forwards the call via the WebSocket connection of c until the response has been read completely or an
+// error occurs, which is recorded in c.
+func (h *http2WebSocketProxy) serveConn(c *websocketConn, body io.ReadCloser) {
 	var wg sync.WaitGroup
 
+	keepaliveCtx, cancel := context.WithCancel(c.ctx)
+	defer cancel()
+	if h.keepalive.interval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := grpcwebsocket.Keepalive(keepaliveCtx, c.conn, h.keepalive.interval, h.keepalive.timeout); err != nil {
+				h.logger.Debugf("Closing WebSocket connection with %q: %v", c.url, err)
+				c.setError(&tunnelLostError{err: err})
+			}
+		}()
+	}
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := wsConn.writeToServer(req.Body); err != nil {
-			wsConn.setError(err)
-			_ = conn.Close(websocket.StatusInternalError, err.Error())
+		if err := c.writeToServer(body); err != nil {
+			h.logger.Debugf("Error writing to %q: %v", c.url, err)
+			c.setError(err)
+			_ = c.conn.Close(websocket.StatusInternalError, grpcwebsocket.CloseReason(err.Error()))
 		}
 	}()
 
-	if err := wsConn.readFromServer(); err != nil {
-		glog.V(2).Infof("Error reading from %q: %v", wsConn.url, err)
-		wsConn.setError(err)
+	if err := c.readFromServer(); err != nil {
+		h.logger.Warnf("Error reading from %q: %v", c.url, err)
+		c.setError(err)
+		if isFrameTooLarge(err) {
+			_ = c.conn.Close(websocket.StatusMessageTooBig, "gRPC frame too large")
+		} else {
+			_ = c.conn.Close(websocket.StatusInternalError, grpcwebsocket.CloseReason(err.Error()))
+		}
 	}
 
 	// In-case of error, the request body may not be closed.
 	// Close it here to ensure no leaks.
-	_ = req.Body.Close()
+	_ = body.Close()
+	cancel()
 
 	wg.Wait()
-
-	// If the connection had an error, write it back to the client.
-	wsConn.writeErrorIfNecessary()
-
-	glog.V(2).Infof("Closing websocket connection with %q", wsConn.url)
-	// It's ok to potentially close the connection multiple times.
-	// Only the first time matters.
-	_ = conn.Close(websocket.StatusNormalClosure, "")
 }
 
-func createClientWSProxy(endpoint string, tlsClientConf *tls.Config) (*http.Server, pipeconn.DialContextFunc, error) {
+func createClientWSProxy(endpoint string, tlsClientConf *tls.Config, connectOpts connectOptions) (*http.Server, pipeconn.DialContextFunc, error) {
+	// gRPC already performs compression, so WebSocket compression is disabled unless explicitly requested.
+	compressionMode := websocket.CompressionDisabled
+	if connectOpts.wsCompression {
+		// Every RPC uses its own WebSocket connection, so avoid the fixed memory cost of context takeover.
+		compressionMode = websocket.CompressionNoContextTakeover
+	}
+	transport := &http.Transport{
+		TLSClientConfig:    tlsClientConf,
+		Proxy:              connectOpts.proxyFunc(),
+		ProxyConnectHeader: proxyConnectHeader(connectOpts.userAgent),
+		ReadBufferSize:     connectOpts.readBufferSize,
+		WriteBufferSize:    connectOpts.writeBufferSize,
+		// The handshake response is the only response received over the connection.
+		MaxResponseHeaderBytes: int64(connectOpts.maxResponseHeaderBytes),
+	}
+	if connectOpts.unixSocket {
+		transport.DialContext = connectOpts.dialer.DialContext
+	} else if len(connectOpts.failoverEndpoints) > 0 || tlsClientConf != nil {
+		// Connect via the same proxy the side channel uses, if any, which also takes care of failing over. For TLS
+		// endpoints, this also keeps the TLS config of the endpoint from being used for HTTPS proxies, as
+		// http.Transport would do, which would offer the client certificate of the endpoint to the proxy.
+		dialer := newEndpointDialer(connectOpts)
+		transport.Proxy = nil
+		transport.DialContext = dialer.DialContext
+	}
+	if tlsClientConf == nil {
+		detectHTTP2Preface(transport)
+	}
+	subprotocol := grpcwebsocket.SubprotocolName
+	if connectOpts.wsSubprotocol != "" {
+		subprotocol = connectOpts.wsSubprotocol
+	}
 	handler := &http2WebSocketProxy{
-		insecure: tlsClientConf == nil,
-		endpoint: endpoint,
+		insecure:        tlsClientConf == nil,
+		endpoint:        endpoint,
+		compressionMode: compressionMode,
+		statusMapper:    connectOpts.httpStatusMapper,
+		keepalive:       connectOpts.wsKeepalive,
+		maxFrameSize:    connectOpts.maxFrameSize,
+		maxRespBytes:    connectOpts.maxResponseBytes,
+		resumeAttempts:  connectOpts.wsResume,
+		path:            connectOpts.wsPath,
+		subprotocol:     subprotocol,
+		window:          connectOpts.wsWindow,
+		requestHeaders:  connectOpts.requestHeaders,
+		hostHeader:      connectOpts.hostHeader,
+		pathRewriter:    connectOpts.pathRewriter,
+		userAgent:       connectOpts.userAgent,
+		xUserAgent:      connectOpts.xUserAgent,
+		logger:          connectOpts.getLogger(),
+		stats:           connectOpts.statsHandler,
 		httpClient: &http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: tlsClientConf,
-				Proxy:           http.ProxyFromEnvironment,
-			},
+			Transport: withRoundTripInterceptor(transport, connectOpts.onRequest, connectOpts.onResponse),
 		},
 	}
-	return makeProxyServer(handler)
+	if connectOpts.wsFallback {
+		fallbackOpts := connectOpts
+		fallbackOpts.forceDowngrade = true
+		fallback, err := createProxyHandler(endpoint, tlsClientConf, fallbackOpts)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "creating fallback handler")
+		}
+		handler.fallback = fallback
+	}
+	return makeProxyServer(withStreamIdleTimeout(withByteCounter(handler, connectOpts.byteCounter, connectOpts.statsHandler), connectOpts.streamIdleTimeout), connectOpts.getLogger())
 }
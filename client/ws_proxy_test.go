@@ -0,0 +1,104 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"nhooyr.io/websocket"
+)
+
+func TestWebSocketCloseStatusIsMapped(t *testing.T) {
+	cases := map[websocket.StatusCode]codes.Code{
+		websocket.StatusInternalError: codes.Internal,
+		websocket.StatusGoingAway:     codes.Unavailable,
+		websocket.StatusMessageTooBig: codes.ResourceExhausted,
+	}
+
+	for closeStatus, expectedCode := range cases {
+		t.Run(closeStatus.String(), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				conn, err := websocket.Accept(w, req, nil)
+				if err != nil {
+					return
+				}
+				_ = conn.Close(closeStatus, "closed by test")
+			}))
+			defer srv.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			cc, err := ConnectViaProxy(ctx, strings.TrimPrefix(srv.URL, "http://"), nil, UseWebSocket(true),
+				DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())))
+			require.NoError(t, err)
+			defer func() { _ = cc.Close() }()
+
+			_, err = healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{})
+			st, ok := status.FromError(err)
+			require.True(t, ok)
+			assert.Equal(t, expectedCode, st.Code())
+			assert.Contains(t, st.Message(), "closed by test")
+		})
+	}
+}
+
+func TestWebSocketUnsupportedIsMapped(t *testing.T) {
+	cases := map[int]struct {
+		expectedCode    codes.Code
+		expectedMessage string
+	}{
+		http.StatusNotFound:         {codes.Unimplemented, "server does not support WebSocket tunneling"},
+		http.StatusMethodNotAllowed: {codes.Unimplemented, "server does not support WebSocket tunneling"},
+		http.StatusUpgradeRequired:  {codes.Unimplemented, "server does not support WebSocket tunneling"},
+		http.StatusNotImplemented:   {codes.Unimplemented, "server does not support WebSocket tunneling"},
+		http.StatusForbidden:        {codes.PermissionDenied, "rejected by test"},
+	}
+
+	for statusCode, c := range cases {
+		t.Run(http.StatusText(statusCode), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				http.Error(w, "rejected by test", statusCode)
+			}))
+			defer srv.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			cc, err := ConnectViaProxy(ctx, strings.TrimPrefix(srv.URL, "http://"), nil, UseWebSocket(true),
+				DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())))
+			require.NoError(t, err)
+			defer func() { _ = cc.Close() }()
+
+			_, err = healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{})
+			st, ok := status.FromError(err)
+			require.True(t, ok)
+			assert.Equal(t, c.expectedCode, st.Code())
+			assert.Contains(t, st.Message(), c.expectedMessage)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package client
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"nhooyr.io/websocket"
+)
+
+const (
+	// wsResumeBaseDelay is the time to wait before the first attempt to resume a call. The delay doubles with every
+	// further attempt.
+	wsResumeBaseDelay = 100 * time.Millisecond
+)
+
+// tunnelLostError indicates that the WebSocket connection of a call was lost, as opposed to being closed by the server
+// or failing due to an invalid response.
+type tunnelLostError struct {
+	err error
+}
+
+func (e *tunnelLostError) Error() string {
+	return e.err.Error()
+}
+
+func (e *tunnelLostError) Unwrap() error {
+	return e.err
+}
+
+// markTunnelLost wraps err, as returned when reading from a WebSocket connection, in a *tunnelLostError if the
+// connection was not closed by the server, and err was not caused by an invalid message.
+func markTunnelLost(err error) error {
+	if err == io.EOF || websocket.CloseStatus(err) != -1 || isFrameTooLarge(err) {
+		return err
+	}
+	return &tunnelLostError{err: err}
+}
+
+func isTunnelLost(err error) bool {
+	var lostErr *tunnelLostError
+	return errors.As(err, &lostErr)
+}
+
+// markResumableStreams is a stream interceptor that marks server-streaming calls as resumable, such that the WebSocket
+// proxy resumes them if their connection is lost.
+func markResumableStreams(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	if desc.ServerStreams && !desc.ClientStreams {
+		ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(grpcproto.ResumableHeader), "true")
+	}
+	return streamer(ctx, desc, cc, method, opts...)
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcproto
+
+import (
+	"io"
+
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"google.golang.org/grpc/metadata"
+)
+
+// MessageFlags represents the flags set in the header of a gRPC frame.
+type MessageFlags = grpcproto.MessageFlags
+
+const (
+	// MetadataFlags marks a gRPC-Web trailers frame.
+	MetadataFlags = grpcproto.MetadataFlags
+	// CompressedFlags marks a frame with a compressed payload.
+	CompressedFlags = grpcproto.CompressedFlags
+)
+
+// FrameTooLargeError is the error returned by ReadMessage if a frame header announces a payload exceeding the maximum
+// length.
+type FrameTooLargeError = grpcproto.FrameTooLargeError
+
+// WriteMessage writes a gRPC frame with the given flags and payload to w.
+func WriteMessage(w io.Writer, flags MessageFlags, payload []byte) error {
+	return grpcproto.WriteMessage(w, flags, payload)
+}
+
+// ReadMessage reads a single gRPC frame from r, and returns its flags and payload. A frame announcing a payload larger
+// than maxLength is rejected with a *FrameTooLargeError without reading the payload; a maxLength of 0 means that there
+// is no limit. If r is at EOF before the frame starts, io.EOF is returned; if it ends within the frame,
+// io.ErrUnexpectedEOF is returned.
+func ReadMessage(r io.Reader, maxLength uint32) (MessageFlags, []byte, error) {
+	return grpcproto.ReadMessage(r, maxLength)
+}
+
+// EncodeTrailers encodes the given metadata as a gRPC-Web trailers frame, including the frame header. The values of
+// binary metadata are base64-encoded. Reserved keys such as `grpc-status` and `grpc-message` are encoded as is, i.e.,
+// the status message must already be percent-encoded as per the gRPC spec.
+func EncodeTrailers(md metadata.MD) []byte {
+	return grpcproto.EncodeTrailers(md)
+}
+
+// DecodeTrailers decodes a gRPC-Web trailers frame, including the frame header, into metadata with lower-case keys.
+// The values of binary metadata are base64-decoded. Compressed trailers frames are not supported.
+func DecodeTrailers(frame []byte) (metadata.MD, error) {
+	return grpcproto.DecodeTrailers(frame)
+}
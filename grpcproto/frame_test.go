@@ -0,0 +1,57 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcproto
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestFraming(t *testing.T) {
+	md := metadata.Pairs("grpc-status", "0", "x-payload-bin", "\x00\xff")
+	trailers := EncodeTrailers(md)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteMessage(&buf, 0, []byte("hello")))
+	_, err := buf.Write(trailers)
+	require.NoError(t, err)
+
+	flags, payload, err := ReadMessage(&buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, MessageFlags(0), flags)
+	assert.Equal(t, []byte("hello"), payload)
+
+	flags, payload, err = ReadMessage(&buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, MetadataFlags, flags)
+	assert.Equal(t, trailers[len(trailers)-len(payload):], payload)
+	decoded, err := DecodeTrailers(trailers)
+	require.NoError(t, err)
+	assert.Equal(t, md, decoded)
+
+	_, _, err = ReadMessage(&buf, 0)
+	assert.Equal(t, io.EOF, err)
+
+	require.NoError(t, WriteMessage(&buf, CompressedFlags, []byte("hello")))
+	_, _, err = ReadMessage(&buf, 4)
+	var frameErr *FrameTooLargeError
+	require.ErrorAs(t, err, &frameErr)
+	assert.Equal(t, uint32(5), frameErr.Length)
+}
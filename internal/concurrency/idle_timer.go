@@ -0,0 +1,59 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package concurrency
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// IdleTimer calls a function once it has not been touched for a given duration. It only fires once.
+type IdleTimer struct {
+	timeout time.Duration
+	timer   *time.Timer
+	expired int32
+}
+
+// NewIdleTimer returns a running timer that calls onIdle once the timer has not been touched for the given duration.
+func NewIdleTimer(timeout time.Duration, onIdle func()) *IdleTimer {
+	t := &IdleTimer{timeout: timeout}
+	t.timer = time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&t.expired, 1)
+		onIdle()
+	})
+	return t
+}
+
+// Touch restarts the timer, unless it has already expired.
+func (t *IdleTimer) Touch() {
+	if atomic.LoadInt32(&t.expired) == 0 {
+		t.timer.Reset(t.timeout)
+	}
+}
+
+// Stop stops the timer. It has no effect if the timer has already expired.
+func (t *IdleTimer) Stop() {
+	t.timer.Stop()
+}
+
+// Expired checks whether the timer has expired.
+func (t *IdleTimer) Expired() bool {
+	return atomic.LoadInt32(&t.expired) != 0
+}
+
+// Timeout returns the duration after which the timer expires if it is not touched.
+func (t *IdleTimer) Timeout() time.Duration {
+	return t.timeout
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package concurrency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdleTimerExpires(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	s := NewSignal()
+	timer := NewIdleTimer(50*time.Millisecond, func() { s.Signal() })
+	a.True(WaitWithTimeout(&s, time.Second), "timer should expire")
+	a.True(timer.Expired(), "timer should be marked as expired")
+}
+
+func TestIdleTimerTouchDelaysExpiry(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	s := NewSignal()
+	timer := NewIdleTimer(100*time.Millisecond, func() { s.Signal() })
+	defer timer.Stop()
+	for i := 0; i < 5; i++ {
+		time.Sleep(40 * time.Millisecond)
+		timer.Touch()
+	}
+	a.False(s.IsDone(), "timer should not expire while being touched")
+	a.False(timer.Expired(), "timer should not be marked as expired")
+	a.True(WaitWithTimeout(&s, time.Second), "timer should expire once no longer touched")
+}
+
+func TestIdleTimerStop(t *testing.T) {
+	t.Parallel()
+	a := assert.New(t)
+
+	s := NewSignal()
+	timer := NewIdleTimer(50*time.Millisecond, func() { s.Signal() })
+	timer.Stop()
+	a.False(WaitWithTimeout(&s, 200*time.Millisecond), "stopped timer should not expire")
+	a.False(timer.Expired(), "stopped timer should not be marked as expired")
+}
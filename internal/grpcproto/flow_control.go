@@ -0,0 +1,50 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcproto
+
+import (
+	"encoding/binary"
+)
+
+const (
+	// WindowHeader is the header by which a client requests credit-based flow control for the responses of a
+	// gRPC-WebSocket call in the WebSocket handshake, and by which the server confirms it. Its value is the initial
+	// window, i.e., the number of bytes of data frames the server may send before receiving any window updates.
+	WindowHeader = "Grpc-Http1-Window"
+
+	// windowUpdateMask marks a metadata frame as a window update. Its 4-byte payload is the number of bytes of data
+	// frames the receiver has consumed since its last window update, which the sender adds to the window.
+	windowUpdateMask = 1 << 6
+
+	// WindowUpdateFlags is flags marking a window update frame.
+	WindowUpdateFlags MessageFlags = metadataMask | windowUpdateMask
+
+	windowUpdateLength = 4
+)
+
+// MakeWindowUpdate creates a window update frame granting the given number of bytes to the sender.
+func MakeWindowUpdate(increment uint32) []byte {
+	msg := MakeMessageHeader(WindowUpdateFlags, windowUpdateLength)
+	return binary.BigEndian.AppendUint32(msg, increment)
+}
+
+// ParseWindowUpdate returns the increment conveyed by a well-formed gRPC frame, and whether the frame is a window
+// update at all.
+func ParseWindowUpdate(msg []byte) (uint32, bool) {
+	if MessageFlags(msg[0]) != WindowUpdateFlags || len(msg) != MessageHeaderLength+windowUpdateLength {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(msg[MessageHeaderLength:]), true
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcproto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindowUpdate(t *testing.T) {
+	msg := MakeWindowUpdate(1 << 20)
+	require.NoError(t, ValidateGRPCFrame(msg))
+	assert.True(t, IsMetadataFrame(msg))
+	assert.False(t, IsEndOfStream(msg))
+	increment, ok := ParseWindowUpdate(msg)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(1<<20), increment)
+
+	for _, other := range [][]byte{
+		EndStreamHeader,
+		append(MakeMessageHeader(0, 4), 0, 0, 0, 1),
+		append(MakeMessageHeader(MetadataFlags, 4), 0, 0, 0, 1),
+		append(MakeMessageHeader(WindowUpdateFlags, 2), 0, 1),
+	} {
+		_, ok := ParseWindowUpdate(other)
+		assert.False(t, ok, "%x", other)
+	}
+}
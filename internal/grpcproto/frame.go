@@ -0,0 +1,135 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/metadata"
+)
+
+// WriteMessage writes a gRPC frame with the given flags and payload to w.
+func WriteMessage(w io.Writer, flags MessageFlags, payload []byte) error {
+	if err := WriteMessageHeader(w, flags, uint32(len(payload))); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// ReadMessage reads a single gRPC frame from r, and returns its flags and payload. A frame announcing a payload larger
+// than maxLength is rejected with a *FrameTooLargeError without reading the payload; a maxLength of 0 means that there
+// is no limit. If r is at EOF before the frame starts, io.EOF is returned; if it ends within the frame,
+// io.ErrUnexpectedEOF is returned.
+func ReadMessage(r io.Reader, maxLength uint32) (MessageFlags, []byte, error) {
+	var hdr [MessageHeaderLength]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	flags, length, err := ParseMessageHeader(hdr[:])
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := CheckFrameLength(length, maxLength); err != nil {
+		return 0, nil, err
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	return flags, payload, nil
+}
+
+// EncodeTrailers encodes the given metadata as a gRPC-Web trailers frame, including the frame header. The values of
+// binary metadata are base64-encoded. Reserved keys such as `grpc-status` and `grpc-message` are encoded as is, i.e.,
+// the status message must already be encoded via EncodeGrpcMessage.
+func EncodeTrailers(md metadata.MD) []byte {
+	hdr := make(http.Header, len(md))
+	for k, vs := range md {
+		k = strings.ToLower(k)
+		if IsBinaryMetadataKey(k) {
+			encoded := make([]string, 0, len(vs))
+			for _, v := range vs {
+				encoded = append(encoded, base64.RawStdEncoding.EncodeToString([]byte(v)))
+			}
+			vs = encoded
+		}
+		hdr[k] = append(hdr[k], vs...)
+	}
+
+	var buf bytes.Buffer
+	_ = hdr.Write(&buf) // only errors if (*bytes.Buffer).Write errors, which it does not.
+	return append(MakeMessageHeader(MetadataFlags, uint32(buf.Len())), buf.Bytes()...)
+}
+
+// DecodeTrailers decodes a gRPC-Web trailers frame, including the frame header, into metadata with lower-case keys.
+// The values of binary metadata are base64-decoded. Compressed trailers frames are not supported.
+func DecodeTrailers(frame []byte) (metadata.MD, error) {
+	if err := ValidateGRPCFrame(frame); err != nil {
+		return nil, err
+	}
+	if !IsMetadataFrame(frame) {
+		return nil, errors.New("not a trailers frame")
+	}
+	if IsCompressed(frame) {
+		return nil, errors.New("compressed trailers frames are not supported")
+	}
+
+	hdr, err := textproto.NewReader(bufio.NewReader(io.MultiReader(
+		bytes.NewReader(frame[MessageHeaderLength:]),
+		strings.NewReader("\r\n"),
+	))).ReadMIMEHeader()
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing trailers")
+	}
+	SplitBinaryMetadata(http.Header(hdr))
+
+	md := make(metadata.MD, len(hdr))
+	for k, vs := range hdr {
+		k = strings.ToLower(k)
+		if IsBinaryMetadataKey(k) {
+			decoded := make([]string, 0, len(vs))
+			for _, v := range vs {
+				b, err := decodeBinaryValue(v)
+				if err != nil {
+					return nil, errors.Wrapf(err, "decoding value of binary trailer %q", k)
+				}
+				decoded = append(decoded, string(b))
+			}
+			vs = decoded
+		}
+		md[k] = append(md[k], vs...)
+	}
+	return md, nil
+}
+
+// decodeBinaryValue decodes a base64-encoded binary metadata value, which may or may not be padded.
+func decodeBinaryValue(v string) ([]byte, error) {
+	if len(v)%4 == 0 {
+		return base64.StdEncoding.DecodeString(v)
+	}
+	return base64.RawStdEncoding.DecodeString(v)
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcproto
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestWriteAndReadMessage(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteMessage(&buf, 0, []byte("hello")))
+	require.NoError(t, WriteMessage(&buf, CompressedFlags, nil))
+	assert.Equal(t, []byte{0, 0, 0, 0, 5, 'h', 'e', 'l', 'l', 'o', 1, 0, 0, 0, 0}, buf.Bytes())
+
+	flags, payload, err := ReadMessage(&buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, MessageFlags(0), flags)
+	assert.Equal(t, []byte("hello"), payload)
+
+	flags, payload, err = ReadMessage(&buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, CompressedFlags, flags)
+	assert.Empty(t, payload)
+
+	_, _, err = ReadMessage(&buf, 0)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestReadMessage_Errors(t *testing.T) {
+	_, _, err := ReadMessage(bytes.NewReader([]byte{0, 0, 0}), 0)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	_, _, err = ReadMessage(bytes.NewReader([]byte{0, 0, 0, 0, 5, 'h', 'i'}), 0)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	_, _, err = ReadMessage(bytes.NewReader([]byte{0, 0, 0, 0, 5, 'h', 'e', 'l', 'l', 'o'}), 4)
+	var frameErr *FrameTooLargeError
+	require.ErrorAs(t, err, &frameErr)
+	assert.Equal(t, uint32(5), frameErr.Length)
+}
+
+func TestEncodeAndDecodeTrailers(t *testing.T) {
+	md := metadata.MD{
+		"grpc-status":   []string{"3"},
+		"grpc-message":  []string{EncodeGrpcMessage("bad request: 100%")},
+		"x-custom":      []string{"a", "b"},
+		"x-payload-bin": []string{"\x00\x01\xff", "\xfe"},
+	}
+
+	frame := EncodeTrailers(md)
+	require.NoError(t, ValidateGRPCFrame(frame))
+	assert.True(t, IsMetadataFrame(frame))
+	assert.False(t, IsCompressed(frame))
+	assert.Contains(t, string(frame), "x-payload-bin: AAH/\r\n")
+
+	decoded, err := DecodeTrailers(frame)
+	require.NoError(t, err)
+	assert.Equal(t, md, decoded)
+	assert.Equal(t, "bad request: 100%", DecodeGrpcMessage(decoded.Get("grpc-message")[0]))
+}
+
+func TestDecodeTrailers(t *testing.T) {
+	trailers := func(payload string) []byte {
+		return append(MakeMessageHeader(MetadataFlags, uint32(len(payload))), payload...)
+	}
+
+	md, err := DecodeTrailers(trailers("Grpc-Status: 0\r\nX-Bin: AAE=, /w\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, metadata.MD{
+		"grpc-status": []string{"0"},
+		"x-bin":       []string{"\x00\x01", "\xff"},
+	}, md)
+
+	_, err = DecodeTrailers(append(MakeMessageHeader(0, 2), "hi"...))
+	assert.Error(t, err, "data frame")
+
+	_, err = DecodeTrailers(append(MakeMessageHeader(MetadataFlags|CompressedFlags, 2), "hi"...))
+	assert.Error(t, err, "compressed frame")
+
+	_, err = DecodeTrailers(trailers("grpc-status: 0\r\n")[:8])
+	assert.Error(t, err, "truncated frame")
+
+	_, err = DecodeTrailers(trailers("x-bin: !!!\r\n"))
+	assert.Error(t, err, "invalid base64")
+}
@@ -3,11 +3,12 @@ package grpcproto
 import (
 	"bytes"
 	"fmt"
+	"strconv"
 	"unicode/utf8"
 )
 
-// This code is copied from google.golang.org/grpc@v1.31.1/internal/transport/http_util.go, ll.443-494,
-// and has been adjusted to make the `EncodeGrpcMessage` function exported.
+// This code is copied from google.golang.org/grpc@v1.31.1/internal/transport/http_util.go, ll.443-517,
+// and has been adjusted to make the `EncodeGrpcMessage` and `DecodeGrpcMessage` functions exported.
 // The original code is Copyright (c) by the gRPC authors and was distributed under the
 // Apache License, version 2.0.
 
@@ -63,3 +64,37 @@ func encodeGrpcMessageUnchecked(msg string) string {
 	}
 	return buf.String()
 }
+
+// DecodeGrpcMessage decodes the msg encoded by EncodeGrpcMessage.
+func DecodeGrpcMessage(msg string) string {
+	if msg == "" {
+		return ""
+	}
+	lenMsg := len(msg)
+	for i := 0; i < lenMsg; i++ {
+		if msg[i] == percentByte && i+2 < lenMsg {
+			return decodeGrpcMessageUnchecked(msg)
+		}
+	}
+	return msg
+}
+
+func decodeGrpcMessageUnchecked(msg string) string {
+	var buf bytes.Buffer
+	lenMsg := len(msg)
+	for i := 0; i < lenMsg; i++ {
+		c := msg[i]
+		if c == percentByte && i+2 < lenMsg {
+			parsed, err := strconv.ParseUint(msg[i+1:i+3], 16, 8)
+			if err != nil {
+				buf.WriteByte(c)
+			} else {
+				buf.WriteByte(byte(parsed))
+				i += 2
+			}
+		} else {
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
@@ -16,6 +16,9 @@ package grpcproto
 
 import (
 	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
 
 	"github.com/pkg/errors"
 )
@@ -33,6 +36,13 @@ const (
 
 	// MetadataFlags is flags with the MSB set to 1 to indicate a metadata gRPC message.
 	MetadataFlags MessageFlags = metadataMask
+
+	// CompressedFlags is flags with the LSB set to 1 to indicate a compressed gRPC message.
+	CompressedFlags MessageFlags = compressionMask
+
+	// DefaultMaxFrameSize is the default maximum payload length of a single gRPC frame. This matches the default
+	// maximum message size of gRPC.
+	DefaultMaxFrameSize = 4 << 20
 )
 
 var (
@@ -42,11 +52,37 @@ var (
 	// which implies we may also use it for our own purposes.
 	// We use it to indicate that the stream is complete.
 	EndStreamHeader = []byte{metadataMask, 0, 0, 0, 0}
+
+	messageHeaderPool = sync.Pool{
+		New: func() interface{} {
+			return new([MessageHeaderLength]byte)
+		},
+	}
 )
 
 // MessageFlags type represents the flags set in the header of a gRPC data frame.
 type MessageFlags uint8
 
+// FrameTooLargeError is the error returned if a gRPC frame header announces a payload exceeding the maximum frame
+// size.
+type FrameTooLargeError struct {
+	Length    uint32
+	MaxLength uint32
+}
+
+func (e *FrameTooLargeError) Error() string {
+	return fmt.Sprintf("gRPC frame of %d bytes exceeds the maximum frame size of %d bytes", e.Length, e.MaxLength)
+}
+
+// CheckFrameLength returns a *FrameTooLargeError if the given payload length exceeds maxLength. A maxLength of 0
+// means that there is no limit.
+func CheckFrameLength(length, maxLength uint32) error {
+	if maxLength > 0 && length > maxLength {
+		return &FrameTooLargeError{Length: length, MaxLength: maxLength}
+	}
+	return nil
+}
+
 // ParseMessageHeader parses a byte slice into a gRPC data frame header.
 func ParseMessageHeader(header []byte) (MessageFlags, uint32, error) {
 	if len(header) != MessageHeaderLength {
@@ -62,3 +98,16 @@ func MakeMessageHeader(flags MessageFlags, length uint32) []byte {
 	binary.BigEndian.PutUint32(hdr[1:], length)
 	return hdr
 }
+
+// WriteMessageHeader writes a gRPC message frame header based on the given flags and message length to w. The
+// header is assembled in a pooled scratch buffer, which is returned to the pool once the write returns. As per the
+// `io.Writer` contract, w must not retain the written slice.
+func WriteMessageHeader(w io.Writer, flags MessageFlags, length uint32) error {
+	hdr := messageHeaderPool.Get().(*[MessageHeaderLength]byte)
+	defer messageHeaderPool.Put(hdr)
+
+	hdr[0] = uint8(flags)
+	binary.BigEndian.PutUint32(hdr[1:], length)
+	_, err := w.Write(hdr[:])
+	return err
+}
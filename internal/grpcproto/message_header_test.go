@@ -0,0 +1,47 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcproto
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteMessageHeader(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteMessageHeader(&buf, 0, 42))
+	require.NoError(t, WriteMessageHeader(&buf, MetadataFlags, 1<<24))
+
+	// Headers written earlier must not be affected by reuse of the scratch buffer.
+	assert.Equal(t, append(MakeMessageHeader(0, 42), MakeMessageHeader(MetadataFlags, 1<<24)...), buf.Bytes())
+}
+
+func BenchmarkMakeMessageHeader(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = io.Discard.Write(MakeMessageHeader(0, uint32(i)))
+	}
+}
+
+func BenchmarkWriteMessageHeader(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = WriteMessageHeader(io.Discard, 0, uint32(i))
+	}
+}
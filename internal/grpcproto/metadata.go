@@ -0,0 +1,58 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcproto
+
+import (
+	"net/http"
+	"strings"
+)
+
+const binaryMetadataSuffix = "-bin"
+
+// IsBinaryMetadataKey checks if the given header key denotes binary metadata, the values of which are base64-encoded.
+func IsBinaryMetadataKey(key string) bool {
+	return len(key) >= len(binaryMetadataSuffix) &&
+		strings.EqualFold(key[len(key)-len(binaryMetadataSuffix):], binaryMetadataSuffix)
+}
+
+// SplitBinaryMetadata splits comma-separated values of binary metadata headers into individual values. HTTP/1.x
+// intermediaries and gRPC-Web implementations may combine multiple values of a header into a single one, which gRPC
+// fails to decode, as it expects every value to be base64-encoded on its own. As commas are not part of the base64
+// alphabet, the values can be split unambiguously.
+func SplitBinaryMetadata(hdr http.Header) {
+	for k, vs := range hdr {
+		if !IsBinaryMetadataKey(k) {
+			continue
+		}
+		var split []string
+		for i, v := range vs {
+			if !strings.Contains(v, ",") {
+				if split != nil {
+					split = append(split, v)
+				}
+				continue
+			}
+			if split == nil {
+				split = append(make([]string, 0, len(vs)+1), vs[:i]...)
+			}
+			for _, part := range strings.Split(v, ",") {
+				split = append(split, strings.TrimSpace(part))
+			}
+		}
+		if split != nil {
+			hdr[k] = split
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcproto
+
+import (
+	"encoding/base64"
+	"math/rand"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsBinaryMetadataKey(t *testing.T) {
+	assert.True(t, IsBinaryMetadataKey("grpc-status-details-bin"))
+	assert.True(t, IsBinaryMetadataKey("Custom-Bin"))
+	assert.True(t, IsBinaryMetadataKey("-bin"))
+	assert.False(t, IsBinaryMetadataKey("bin"))
+	assert.False(t, IsBinaryMetadataKey("Custom-Binary"))
+	assert.False(t, IsBinaryMetadataKey("Custom-Key"))
+}
+
+func TestSplitBinaryMetadata(t *testing.T) {
+	hdr := http.Header{
+		"Custom-Bin":  {"AAEC, /w", "gA==", "AQ,Ag"},
+		"Custom-Key":  {"a, b"},
+		"Trailer-Bin": {"AAEC"},
+	}
+	SplitBinaryMetadata(hdr)
+	assert.Equal(t, http.Header{
+		"Custom-Bin":  {"AAEC", "/w", "gA==", "AQ", "Ag"},
+		"Custom-Key":  {"a, b"},
+		"Trailer-Bin": {"AAEC"},
+	}, hdr)
+}
+
+func TestSplitBinaryMetadata_Random(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	encodings := []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding}
+	separators := []string{",", ", ", " ,\t"}
+
+	for i := 0; i < 1000; i++ {
+		values := make([][]byte, 1+rng.Intn(5))
+		var encoded []string
+		for j := range values {
+			values[j] = make([]byte, rng.Intn(32))
+			_, _ = rng.Read(values[j])
+			encoded = append(encoded, encodings[rng.Intn(len(encodings))].EncodeToString(values[j]))
+		}
+
+		// Combine a random number of adjacent values into a single header value.
+		var headerValues []string
+		for len(encoded) > 0 {
+			n := 1 + rng.Intn(len(encoded))
+			headerValues = append(headerValues, strings.Join(encoded[:n], separators[rng.Intn(len(separators))]))
+			encoded = encoded[n:]
+		}
+
+		hdr := http.Header{"Custom-Bin": headerValues}
+		SplitBinaryMetadata(hdr)
+		require.Len(t, hdr["Custom-Bin"], len(values))
+		for j, v := range hdr["Custom-Bin"] {
+			enc := base64.StdEncoding
+			if len(v)%4 != 0 {
+				enc = base64.RawStdEncoding
+			}
+			decoded, err := enc.DecodeString(v)
+			require.NoError(t, err)
+			assert.Equal(t, values[j], decoded)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcproto
+
+const (
+	// MethodHeader is the header in which the full gRPC method name (e.g., `/grpc.health.v1.Health/Check`) of a call
+	// is conveyed if the HTTP request path differs from it.
+	MethodHeader = "Grpc-Http1-Method"
+)
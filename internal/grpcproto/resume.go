@@ -0,0 +1,24 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcproto
+
+const (
+	// ResumableHeader is the header by which a server announces in its response to a WebSocket handshake that it
+	// supports resuming server-streaming calls.
+	ResumableHeader = "Grpc-Http1-Resumable"
+	// ResumeFromHeader is the header of a WebSocket handshake request resuming an interrupted server-streaming call.
+	// Its value is the number of response messages the client has already received.
+	ResumeFromHeader = "Grpc-Http1-Resume-From"
+)
@@ -0,0 +1,65 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcproto
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// TimeoutHeader is the header in which gRPC clients convey the deadline of a call.
+	TimeoutHeader = "Grpc-Timeout"
+
+	// The spec allows for at most 8 digits plus the unit.
+	maxTimeoutLen = 9
+)
+
+var (
+	timeoutUnits = map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+)
+
+// DecodeTimeout decodes the value of a `grpc-timeout` header, such as `100m` or `5S`.
+func DecodeTimeout(s string) (time.Duration, error) {
+	if len(s) < 2 {
+		return 0, errors.Errorf("timeout string is too short: %q", s)
+	}
+	if len(s) > maxTimeoutLen {
+		return 0, errors.Errorf("timeout string is too long: %q", s)
+	}
+	unit, ok := timeoutUnits[s[len(s)-1]]
+	if !ok {
+		return 0, errors.Errorf("timeout unit is not recognized: %q", s)
+	}
+	value, err := strconv.ParseUint(s[:len(s)-1], 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid timeout value %q", s)
+	}
+	if value > uint64(math.MaxInt64/int64(unit)) {
+		// This timeout would overflow; clamp it.
+		return time.Duration(math.MaxInt64), nil
+	}
+	return time.Duration(value) * unit, nil
+}
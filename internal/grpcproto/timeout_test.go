@@ -0,0 +1,48 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcproto
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeTimeout(t *testing.T) {
+	cases := map[string]time.Duration{
+		"2H":        2 * time.Hour,
+		"3M":        3 * time.Minute,
+		"5S":        5 * time.Second,
+		"100m":      100 * time.Millisecond,
+		"7u":        7 * time.Microsecond,
+		"99999999n": 99999999 * time.Nanosecond,
+		"99999999H": time.Duration(math.MaxInt64),
+	}
+
+	for s, expected := range cases {
+		d, err := DecodeTimeout(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, expected, d, s)
+	}
+}
+
+func TestDecodeTimeout_Malformed(t *testing.T) {
+	for _, s := range []string{"", "m", "100", "100x", "-1S", "1.5S", "123456789S"} {
+		_, err := DecodeTimeout(s)
+		assert.Error(t, err, s)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcproto
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameFlags(t *testing.T) {
+	cases := []struct {
+		flags      MessageFlags
+		isMetadata bool
+		compressed bool
+	}{
+		{flags: 0},
+		{flags: CompressedFlags, compressed: true},
+		{flags: MetadataFlags, isMetadata: true},
+		{flags: MetadataFlags | CompressedFlags, isMetadata: true, compressed: true},
+		// Reserved bits do not affect the interpretation of the flags.
+		{flags: 0x02},
+		{flags: 0x7f, compressed: true},
+		{flags: 0xfe, isMetadata: true},
+	}
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%#02x", uint8(c.flags)), func(t *testing.T) {
+			hdr := MakeMessageHeader(c.flags, 0)
+			assert.Equal(t, !c.isMetadata, IsDataFrame(hdr))
+			assert.Equal(t, c.isMetadata, IsMetadataFrame(hdr))
+			assert.Equal(t, c.compressed, IsCompressed(hdr))
+		})
+	}
+}
+
+func TestIsEndOfStream(t *testing.T) {
+	assert.True(t, IsEndOfStream(EndStreamHeader))
+	assert.False(t, IsEndOfStream(MakeMessageHeader(0, 0)))
+	assert.False(t, IsEndOfStream(MakeMessageHeader(MetadataFlags|CompressedFlags, 0)))
+	assert.False(t, IsEndOfStream(append(MakeMessageHeader(MetadataFlags, 1), 'a')))
+}
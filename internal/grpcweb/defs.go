@@ -25,4 +25,8 @@ const (
 	// is sufficient, however it is recommended that a client chooses "true" as the only value
 	// whenver the header is used.
 	GRPCWebOnlyHeader = `Grpc-Web-Only`
+
+	// UserAgentHeader is the header carrying the user agent of gRPC-Web clients, as the User-Agent header is
+	// controlled by browsers, or set to identify the tunnel.
+	UserAgentHeader = `X-User-Agent`
 )
@@ -25,6 +25,7 @@ import (
 	"strings"
 
 	"github.com/pkg/errors"
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
 	"golang.stackrox.io/grpc-http1/internal/ioutils"
 )
 
@@ -46,6 +47,7 @@ type responseReader struct {
 	io.ReadCloser
 	decompressor Decompressor
 	trailers     *http.Header
+	maxFrameSize uint32
 
 	// err is the error condition encountered, if any (sticky!)
 	err error
@@ -53,7 +55,8 @@ type responseReader struct {
 	// Indicates how many bytes of the current gRPC web message remain to be read. If 0, we expect the start of the next
 	// message header.
 	currMessageRemaining int64
-	// A partially read message header
+	// A partially read message header. This is held back until the header is complete, such that a header announcing
+	// an oversized frame is never passed on.
 	currPartialMsgHeader []byte
 
 	// partialTrailerData stores data read from a trailer in a previous read call.
@@ -65,12 +68,17 @@ type responseReader struct {
 }
 
 // NewResponseReader returns a response reader that on-the-fly transcodes a gRPC web response into normal gRPC framing.
-// Once the reader has reached EOF, the given trailers (which must be non-nil) are populated.
-func NewResponseReader(origResp io.ReadCloser, trailers *http.Header, decompressor Decompressor) io.ReadCloser {
+// Once the reader has reached EOF, the given trailers (which must be non-nil) are populated. If the response does not
+// contain a trailers frame, the trailers must have been populated from the trailer section of the HTTP response by the
+// time the underlying reader reaches EOF.
+// If a frame header announces a payload larger than maxFrameSize, reading fails with a *grpcproto.FrameTooLargeError
+// after all preceding frames have been returned. A maxFrameSize of 0 means that there is no limit.
+func NewResponseReader(origResp io.ReadCloser, trailers *http.Header, decompressor Decompressor, maxFrameSize uint32) io.ReadCloser {
 	return &responseReader{
 		ReadCloser:   origResp,
 		trailers:     trailers,
 		decompressor: decompressor,
+		maxFrameSize: maxFrameSize,
 	}
 }
 
@@ -86,13 +94,26 @@ func (r *responseReader) adjustResult(n int, err error) (int, error) {
 			// EOF at this point. This is relevant if the reader returns EOF *with* the last bytes read, as opposed to
 			// return `0, EOF` in a subsequent call.
 			err = nil
-		} else {
+		} else if !r.hasHTTPTrailers() {
 			err = io.ErrUnexpectedEOF
 		}
 	}
 	return n, err
 }
 
+// hasHTTPTrailers checks whether the response ended after a complete message, and the gRPC status was sent in the
+// trailer section of the HTTP response instead of a trailers frame, as some gRPC-Web implementations do.
+func (r *responseReader) hasHTTPTrailers() bool {
+	if r.currMessageRemaining > 0 || len(r.currPartialMsgHeader) > 0 || *r.trailers == nil {
+		return false
+	}
+	if r.trailers.Get("Grpc-Status") == "" {
+		return false
+	}
+	grpcproto.SplitBinaryMetadata(*r.trailers)
+	return true
+}
+
 func (r *responseReader) Read(buf []byte) (int, error) {
 	if r.err != nil {
 		return 0, r.err
@@ -113,7 +134,14 @@ func (r *responseReader) doRead(buf []byte) (int, error) {
 		r.partialTrailerData = nil
 	}
 
-	n, err := r.ReadCloser.Read(buf)
+	// Prepend the held back bytes of a partially read message header, leaving room for reading more data.
+	if len(r.currPartialMsgHeader) > 0 && len(buf) <= len(r.currPartialMsgHeader) {
+		return 0, io.ErrShortBuffer
+	}
+	numHeaderBytes := copy(buf, r.currPartialMsgHeader)
+	r.currPartialMsgHeader = r.currPartialMsgHeader[:0]
+
+	n, err := r.ReadCloser.Read(buf[numHeaderBytes:])
 	if n > 0 {
 		r.hasReadData = true
 	}
@@ -124,15 +152,19 @@ func (r *responseReader) doRead(buf []byte) (int, error) {
 		return n, err
 	}
 
-	buf = buf[:n]
-	nPayload := r.consume(buf)
-	extraDataBytes := n - nPayload
-	if extraDataBytes > 0 {
-		r.partialTrailerData = append(r.partialTrailerData, buf[nPayload:n]...)
+	n += numHeaderBytes
+	data := buf[:n]
+	nPayload, frameErr := r.consume(data)
+	if frameErr != nil {
+		return nPayload, frameErr
+	}
+	if len(r.currPartialMsgHeader) == 0 && n > nPayload {
+		r.partialTrailerData = append(r.partialTrailerData, data[nPayload:]...)
 	}
 
-	// Special case: read buffer only contains trailers. In this case, simply repeat the read.
-	if nPayload == 0 && len(r.partialTrailerData) > 0 {
+	// Special case: read buffer only contains trailers or an incomplete message header. In this case, simply repeat
+	// the read.
+	if nPayload == 0 && (len(r.partialTrailerData) > 0 || (len(r.currPartialMsgHeader) > 0 && err == nil)) {
 		return r.doRead(buf)
 	}
 
@@ -149,6 +181,9 @@ func (r *responseReader) readFullTrailers() error {
 	}
 
 	frameLen := binary.BigEndian.Uint32(frameHeader[1:])
+	if err := grpcproto.CheckFrameLength(frameLen, r.maxFrameSize); err != nil {
+		return err
+	}
 	var numBytesRead int64
 	trailersDataReader := ioutils.NewCountingReader(io.LimitReader(reader, int64(frameLen)), &numBytesRead)
 	if frameHeader[0]&compressedFlag != 0 {
@@ -205,11 +240,13 @@ func (r *responseReader) populateTrailers(trailers textproto.MIMEHeader) {
 		canonicalK := http.CanonicalHeaderKey(k)
 		(*r.trailers)[canonicalK] = append((*r.trailers)[canonicalK], vs...)
 	}
+	grpcproto.SplitBinaryMetadata(*r.trailers)
 }
 
 // consume reads regular frame data from buf, stopping as soon as the first byte of a trailer frame is encountered.
-// The return value is the number of bytes consumed without any trailer frame data.
-func (r *responseReader) consume(buf []byte) int {
+// The return value is the number of bytes consumed without any trailer frame data. An incomplete message header at
+// the end of buf is not consumed, but stored in r.currPartialMsgHeader.
+func (r *responseReader) consume(buf []byte) (int, error) {
 	n := int64(0)
 	for len(buf) > 0 {
 		lastMsgBytes := r.currMessageRemaining
@@ -225,28 +262,23 @@ func (r *responseReader) consume(buf []byte) int {
 		}
 
 		// At beginning of header - check if the next message is a trailer message
-		if len(r.currPartialMsgHeader) == 0 {
-			if buf[0]&trailerMessageFlag != 0 {
-				break
-			}
+		if buf[0]&trailerMessageFlag != 0 {
+			break
 		}
 
-		// Read header data
-		remainingHeaderBytes := completeHeaderLen - len(r.currPartialMsgHeader)
-		if remainingHeaderBytes > len(buf) {
-			remainingHeaderBytes = len(buf)
+		if len(buf) < completeHeaderLen {
+			r.currPartialMsgHeader = append(r.currPartialMsgHeader, buf...)
+			break
 		}
 
-		r.currPartialMsgHeader = append(r.currPartialMsgHeader, buf[:remainingHeaderBytes]...)
-		n += int64(remainingHeaderBytes)
-		buf = buf[remainingHeaderBytes:]
-
-		// Check for complete header
-		if len(r.currPartialMsgHeader) == completeHeaderLen {
-			r.currMessageRemaining = int64(binary.BigEndian.Uint32(r.currPartialMsgHeader[1:]))
-			r.currPartialMsgHeader = r.currPartialMsgHeader[:0]
+		msgLen := binary.BigEndian.Uint32(buf[1:completeHeaderLen])
+		if err := grpcproto.CheckFrameLength(msgLen, r.maxFrameSize); err != nil {
+			return int(n), err
 		}
+		r.currMessageRemaining = int64(msgLen)
+		n += completeHeaderLen
+		buf = buf[completeHeaderLen:]
 	}
 
-	return int(n)
+	return int(n), nil
 }
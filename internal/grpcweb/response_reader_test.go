@@ -16,12 +16,16 @@ package grpcweb
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/binary"
 	"io"
 	"net/http"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
 )
 
 func frame(trailers bool, dataStr string) []byte {
@@ -64,7 +68,7 @@ func TestReadOK(t *testing.T) {
 
 	trailers := make(http.Header)
 
-	webResponseReader := NewResponseReader(input, &trailers, nil)
+	webResponseReader := NewResponseReader(input, &trailers, nil, 0)
 
 	readData, err := io.ReadAll(webResponseReader)
 	assert.NoError(t, err)
@@ -78,7 +82,7 @@ func TestNoDataOK(t *testing.T) {
 
 	trailers := make(http.Header)
 
-	webResponseReader := NewResponseReader(input, &trailers, nil)
+	webResponseReader := NewResponseReader(input, &trailers, nil, 0)
 
 	readData, err := io.ReadAll(webResponseReader)
 	assert.NoError(t, err)
@@ -86,6 +90,33 @@ func TestNoDataOK(t *testing.T) {
 	assert.Empty(t, trailers)
 }
 
+func TestTrailersOnlyOK(t *testing.T) {
+	input := stream(frame(true, "Grpc-Status: 5\r\nGrpc-Message: not here\r\n"))
+
+	trailers := make(http.Header)
+
+	webResponseReader := NewResponseReader(input, &trailers, nil, 0)
+
+	readData, err := io.ReadAll(webResponseReader)
+	assert.NoError(t, err)
+	assert.Empty(t, readData)
+	assert.Equal(t, "5", trailers.Get("Grpc-Status"))
+	assert.Equal(t, "not here", trailers.Get("Grpc-Message"))
+}
+
+func TestCombinedBinaryTrailersAreSplit(t *testing.T) {
+	input := stream(frame(true, "Grpc-Status: 0\r\nCustom-Bin: AAEC, /w\r\nCustom-Bin: gA==\r\nCustom-Key: a, b\r\n"))
+
+	trailers := make(http.Header)
+
+	webResponseReader := NewResponseReader(input, &trailers, nil, 0)
+
+	_, err := io.ReadAll(webResponseReader)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"AAEC", "/w", "gA=="}, trailers.Values("Custom-Bin"))
+	assert.Equal(t, []string{"a, b"}, trailers.Values("Custom-Key"))
+}
+
 func TestExtraDataError(t *testing.T) {
 	messagePayload := concat(
 		frame(false, "foo bar baz"),
@@ -104,7 +135,7 @@ func TestExtraDataError(t *testing.T) {
 
 	trailers := make(http.Header)
 
-	webResponseReader := NewResponseReader(input, &trailers, nil)
+	webResponseReader := NewResponseReader(input, &trailers, nil, 0)
 
 	readData, err := io.ReadAll(webResponseReader)
 	assert.Error(t, err)
@@ -122,10 +153,237 @@ func TestNoTrailersError(t *testing.T) {
 
 	trailers := make(http.Header)
 
-	webResponseReader := NewResponseReader(input, &trailers, nil)
+	webResponseReader := NewResponseReader(input, &trailers, nil, 0)
 
 	readData, err := io.ReadAll(webResponseReader)
 	assert.Error(t, err)
 	assert.Equal(t, messagePayload, readData)
 	assert.Empty(t, trailers)
 }
+
+func TestReadSplitHeadersOK(t *testing.T) {
+	messagePayload := concat(
+		frame(false, "foo bar baz"),
+		frame(false, "qux"),
+	)
+
+	input := io.NopCloser(iotest.OneByteReader(bytes.NewReader(concat(
+		messagePayload,
+		frame(true, "Trailer-Value: foo\r\n"),
+	))))
+
+	trailers := make(http.Header)
+
+	webResponseReader := NewResponseReader(input, &trailers, nil, 32)
+
+	readData, err := io.ReadAll(webResponseReader)
+	assert.NoError(t, err)
+	assert.Equal(t, messagePayload, readData)
+	assert.Equal(t, "foo", trailers.Get("Trailer-Value"))
+}
+
+// twoByteReader returns at most two bytes from the underlying reader on every read.
+type twoByteReader struct {
+	io.Reader
+}
+
+func (r twoByteReader) Read(buf []byte) (int, error) {
+	if len(buf) > 2 {
+		buf = buf[:2]
+	}
+	return r.Reader.Read(buf)
+}
+
+func TestReadSplitTrailersOK(t *testing.T) {
+	messagePayload := concat(
+		frame(false, "foo bar baz"),
+		frame(false, "qux"),
+	)
+	data := concat(
+		messagePayload,
+		frame(true, "Grpc-Status: 5\r\nGrpc-Message: not found\r\n"),
+	)
+
+	for name, wrap := range map[string]func(io.Reader) io.Reader{
+		"separate EOF":  func(r io.Reader) io.Reader { return twoByteReader{Reader: r} },
+		"EOF with data": func(r io.Reader) io.Reader { return iotest.DataErrReader(twoByteReader{Reader: r}) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			input := io.NopCloser(wrap(bytes.NewReader(data)))
+
+			trailers := make(http.Header)
+
+			webResponseReader := NewResponseReader(input, &trailers, nil, 0)
+
+			readData, err := io.ReadAll(webResponseReader)
+			assert.NoError(t, err)
+			assert.Equal(t, messagePayload, readData)
+			assert.Equal(t, "5", trailers.Get("Grpc-Status"))
+			assert.Equal(t, "not found", trailers.Get("Grpc-Message"))
+		})
+	}
+}
+
+func TestFrameTooLargeError(t *testing.T) {
+	messagePayload := frame(false, "foo bar baz")
+
+	// A frame header claiming an enormous payload, without any payload following it.
+	hugeFrameHeader := grpcproto.MakeMessageHeader(0, 0xffffffff)
+
+	for name, input := range map[string]io.ReadCloser{
+		"single read": stream(messagePayload, hugeFrameHeader),
+		"split reads": io.NopCloser(iotest.OneByteReader(bytes.NewReader(concat(messagePayload, hugeFrameHeader)))),
+	} {
+		t.Run(name, func(t *testing.T) {
+			trailers := make(http.Header)
+
+			webResponseReader := NewResponseReader(input, &trailers, nil, grpcproto.DefaultMaxFrameSize)
+
+			readData, err := io.ReadAll(webResponseReader)
+			var frameErr *grpcproto.FrameTooLargeError
+			require.ErrorAs(t, err, &frameErr)
+			assert.Equal(t, uint32(0xffffffff), frameErr.Length)
+			// None of the oversized frame header must be passed on.
+			assert.Equal(t, messagePayload, readData)
+			assert.Empty(t, trailers)
+		})
+	}
+}
+
+func TestTrailersFrameTooLargeError(t *testing.T) {
+	messagePayload := frame(false, "foo bar baz")
+
+	input := stream(
+		messagePayload,
+		grpcproto.MakeMessageHeader(grpcproto.MetadataFlags, 0xffffffff),
+	)
+
+	trailers := make(http.Header)
+
+	webResponseReader := NewResponseReader(input, &trailers, nil, grpcproto.DefaultMaxFrameSize)
+
+	readData, err := io.ReadAll(webResponseReader)
+	var frameErr *grpcproto.FrameTooLargeError
+	assert.ErrorAs(t, err, &frameErr)
+	assert.Equal(t, messagePayload, readData)
+	assert.Empty(t, trailers)
+}
+
+// trailerSectionReader populates the given trailers once the underlying reader reaches EOF, like the body of an
+// `http.Response` does with the trailer section.
+type trailerSectionReader struct {
+	io.ReadCloser
+	trailers      *http.Header
+	trailerValues http.Header
+}
+
+func (r *trailerSectionReader) Read(buf []byte) (int, error) {
+	n, err := r.ReadCloser.Read(buf)
+	if err == io.EOF {
+		*r.trailers = r.trailerValues
+	}
+	return n, err
+}
+
+func TestHTTPTrailersOK(t *testing.T) {
+	messagePayload := concat(
+		frame(false, "foo bar baz"),
+		frame(false, "qux"),
+	)
+
+	var trailers http.Header
+	input := &trailerSectionReader{
+		ReadCloser: io.NopCloser(iotest.OneByteReader(bytes.NewReader(messagePayload))),
+		trailers:   &trailers,
+		trailerValues: http.Header{
+			"Grpc-Status": {"0"},
+			"Custom-Bin":  {"AAEC, /w"},
+		},
+	}
+
+	webResponseReader := NewResponseReader(input, &trailers, nil, 0)
+
+	readData, err := io.ReadAll(webResponseReader)
+	require.NoError(t, err)
+	assert.Equal(t, messagePayload, readData)
+	assert.Equal(t, "0", trailers.Get("Grpc-Status"))
+	assert.Equal(t, []string{"AAEC", "/w"}, trailers.Values("Custom-Bin"))
+}
+
+func TestHTTPTrailersTruncatedMessageError(t *testing.T) {
+	messagePayload := frame(false, "foo bar baz")
+
+	var trailers http.Header
+	input := &trailerSectionReader{
+		ReadCloser:    stream(messagePayload[:len(messagePayload)-1]),
+		trailers:      &trailers,
+		trailerValues: http.Header{"Grpc-Status": {"0"}},
+	}
+
+	webResponseReader := NewResponseReader(input, &trailers, nil, 0)
+
+	_, err := io.ReadAll(webResponseReader)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestFrameFlagCombinations(t *testing.T) {
+	var compressedTrailers bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressedTrailers)
+	_, err := gzipWriter.Write([]byte("Grpc-Status: 0\r\nTrailer-Value: foo\r\n"))
+	require.NoError(t, err)
+	require.NoError(t, gzipWriter.Close())
+	decompressor := func(r io.ReadCloser) io.ReadCloser {
+		gzipReader, err := gzip.NewReader(r)
+		require.NoError(t, err)
+		return gzipReader
+	}
+
+	// Data frames are passed through regardless of the compression flag. Compressed messages are decompressed by the
+	// gRPC client.
+	uncompressedData := frame(false, "foo")
+	compressedData := frame(false, "bar")
+	compressedData[0] |= compressedFlag
+	messagePayload := concat(uncompressedData, compressedData)
+
+	cases := map[string]struct {
+		trailersFrame []byte
+		decompressor  Decompressor
+		expectedErr   error
+	}{
+		"uncompressed trailers": {
+			trailersFrame: frame(true, "Grpc-Status: 0\r\nTrailer-Value: foo\r\n"),
+		},
+		"compressed trailers": {
+			trailersFrame: func() []byte {
+				f := frame(true, compressedTrailers.String())
+				f[0] |= compressedFlag
+				return f
+			}(),
+			decompressor: decompressor,
+		},
+		"compressed trailers without decompressor": {
+			trailersFrame: func() []byte {
+				f := frame(true, compressedTrailers.String())
+				f[0] |= compressedFlag
+				return f
+			}(),
+			expectedErr: ErrNoDecompressor,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			trailers := make(http.Header)
+			reader := NewResponseReader(stream(messagePayload, c.trailersFrame), &trailers, c.decompressor, 0)
+
+			readData, err := io.ReadAll(reader)
+			assert.Equal(t, messagePayload, readData)
+			if c.expectedErr != nil {
+				assert.ErrorIs(t, err, c.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "0", trailers.Get("Grpc-Status"))
+			assert.Equal(t, "foo", trailers.Get("Trailer-Value"))
+		})
+	}
+}
@@ -16,10 +16,10 @@ package grpcweb
 
 import (
 	"bytes"
-	"encoding/binary"
 	"net/http"
 	"strings"
 
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
 	"golang.stackrox.io/grpc-http1/internal/sliceutils"
 	"golang.stackrox.io/grpc-http1/internal/stringutils"
 )
@@ -30,6 +30,10 @@ type responseWriter struct {
 	// List of trailers that were announced via the `Trailer` header at the time headers were written. Also used to keep
 	// track of whether headers were already written (in which case this is non-nil, even if it is the empty slice).
 	announcedTrailers []string
+
+	// httpTrailers indicates whether trailers are sent in the trailer section of the HTTP response instead of in a
+	// data frame.
+	httpTrailers bool
 }
 
 // NewResponseWriter returns a response writer that transparently transcodes an gRPC HTTP/2 response to a gRPC-Web
@@ -44,6 +48,16 @@ func NewResponseWriter(w http.ResponseWriter) (http.ResponseWriter, func() error
 	return rw, rw.Finalize
 }
 
+// NewHTTPTrailersResponseWriter is like NewResponseWriter, but sends trailers in the trailer section of the HTTP
+// response instead of in a data frame, as some gRPC-Web gateways expect. Trailers-only responses are unaffected.
+func NewHTTPTrailersResponseWriter(w http.ResponseWriter) (http.ResponseWriter, func() error) {
+	rw := &responseWriter{
+		w:            w,
+		httpTrailers: true,
+	}
+	return rw, rw.Finalize
+}
+
 // Header returns the HTTP Header of the underlying response writer.
 func (w *responseWriter) Header() http.Header {
 	return w.w.Header()
@@ -127,19 +141,17 @@ func (w *responseWriter) Finalize() error {
 		return nil // trailer-only response, don't send data frame.
 	}
 
+	if w.httpTrailers {
+		for k, vs := range trailers {
+			hdr[http.TrailerPrefix+k] = vs
+		}
+		return nil
+	}
+
 	var buf bytes.Buffer
 	if err := trailers.Write(&buf); err != nil {
 		return err // should not happen, only errors if (*bytes.Buffer).Write errors.
 	}
 
-	trailerFrameHeader := []byte{trailerMessageFlag, 0, 0, 0, 0}
-	binary.BigEndian.PutUint32(trailerFrameHeader[1:], uint32(buf.Len()))
-	if _, err := w.w.Write(trailerFrameHeader); err != nil {
-		return err
-	}
-	if _, err := w.w.Write(buf.Bytes()); err != nil {
-		return err
-	}
-
-	return nil
+	return grpcproto.WriteMessage(w.w, grpcproto.MetadataFlags, buf.Bytes())
 }
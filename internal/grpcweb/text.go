@@ -0,0 +1,155 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcweb
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+
+	"golang.stackrox.io/grpc-http1/internal/stringutils"
+)
+
+const (
+	// TextContentType is the content type of base64-encoded gRPC-Web requests and responses.
+	TextContentType = "application/grpc-web-text"
+
+	base64GroupLen = 4
+	textReadSize   = 4096
+)
+
+// IsTextContentType checks if the given content type denotes a base64-encoded gRPC-Web request or response.
+func IsTextContentType(contentType string) bool {
+	ct, _ := stringutils.Split2(contentType, "+")
+	return ct == TextContentType
+}
+
+type textReader struct {
+	io.ReadCloser
+
+	// encoded holds encoded data that has not been decoded yet. This is always less than a complete group of 4
+	// characters, except while decoding.
+	encoded []byte
+	// decoded holds decoded data that has not been returned to the caller yet.
+	decoded []byte
+
+	err error
+}
+
+// NewTextReader returns a reader that decodes a base64-encoded gRPC-Web request body. The body may consist of several
+// individually padded base64 chunks, and groups of 4 characters may be split arbitrarily across reads.
+func NewTextReader(body io.ReadCloser) io.ReadCloser {
+	return &textReader{
+		ReadCloser: body,
+	}
+}
+
+func (r *textReader) Read(buf []byte) (int, error) {
+	for len(r.decoded) == 0 {
+		if r.err != nil {
+			if r.err == io.EOF && len(r.encoded) > 0 {
+				r.err = io.ErrUnexpectedEOF
+			}
+			return 0, r.err
+		}
+		r.fill()
+	}
+
+	n := copy(buf, r.decoded)
+	r.decoded = r.decoded[n:]
+	return n, nil
+}
+
+// fill reads more data from the underlying reader and decodes all complete groups.
+func (r *textReader) fill() {
+	var chunk [textReadSize]byte
+	n, err := r.ReadCloser.Read(chunk[:])
+	r.err = err
+	r.encoded = append(r.encoded, chunk[:n]...)
+
+	numGroups := len(r.encoded) / base64GroupLen
+	decoded := make([]byte, 0, numGroups*3)
+	var group [3]byte
+	// Decode each group individually, as padding may occur at the end of every chunk.
+	for i := 0; i < numGroups; i++ {
+		k, err := base64.StdEncoding.Decode(group[:], r.encoded[i*base64GroupLen:(i+1)*base64GroupLen])
+		if err != nil {
+			r.err = err
+			return
+		}
+		decoded = append(decoded, group[:k]...)
+	}
+	r.decoded = decoded
+	r.encoded = append(r.encoded[:0], r.encoded[numGroups*base64GroupLen:]...)
+}
+
+type textResponseWriter struct {
+	http.ResponseWriter
+	encoder io.WriteCloser
+
+	headerWritten bool
+}
+
+// NewTextResponseWriter returns a response writer that base64-encodes all data written to it. Every flush terminates
+// the current base64 chunk (including padding) such that all data written so far can be decoded by the client. The
+// second return value is a finalization function that *needs* to be called after all data has been written.
+func NewTextResponseWriter(w http.ResponseWriter) (http.ResponseWriter, func() error) {
+	tw := &textResponseWriter{
+		ResponseWriter: w,
+	}
+	tw.encoder = base64.NewEncoder(base64.StdEncoding, w)
+	return tw, tw.Close
+}
+
+// prepareHeadersIfNecessary sets the text content type before headers are sent.
+func (w *textResponseWriter) prepareHeadersIfNecessary() {
+	if w.headerWritten {
+		return
+	}
+	w.headerWritten = true
+
+	hdr := w.ResponseWriter.Header()
+	_, contentSubtype := stringutils.Split2(hdr.Get("Content-Type"), "+")
+	respContentType := TextContentType
+	if contentSubtype != "" {
+		respContentType += "+" + contentSubtype
+	}
+	hdr.Set("Content-Type", respContentType)
+}
+
+func (w *textResponseWriter) WriteHeader(statusCode int) {
+	w.prepareHeadersIfNecessary()
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *textResponseWriter) Write(buf []byte) (int, error) {
+	w.prepareHeadersIfNecessary()
+	return w.encoder.Write(buf)
+}
+
+// Flush terminates the current base64 chunk and flushes the underlying response writer.
+func (w *textResponseWriter) Flush() {
+	_ = w.encoder.Close()
+	w.encoder = base64.NewEncoder(base64.StdEncoding, w.ResponseWriter)
+	if flusher, _ := w.ResponseWriter.(http.Flusher); flusher != nil {
+		flusher.Flush()
+	}
+}
+
+// Close writes any pending encoded data.
+func (w *textResponseWriter) Close() error {
+	w.prepareHeadersIfNecessary()
+	return w.encoder.Close()
+}
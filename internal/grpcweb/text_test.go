@@ -0,0 +1,71 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcweb
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTextReader(t *testing.T) {
+	payload := concat(
+		frame(false, "foo bar baz"),
+		frame(true, "Trailer-Value: foo\r\n"),
+	)
+
+	// Encode the payload in individually padded chunks of varying lengths.
+	var encoded strings.Builder
+	for _, chunk := range [][]byte{payload[:1], payload[1:5], payload[5:12], payload[12:]} {
+		encoded.WriteString(base64.StdEncoding.EncodeToString(chunk))
+	}
+
+	r := NewTextReader(io.NopCloser(iotest.OneByteReader(strings.NewReader(encoded.String()))))
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, payload, data)
+}
+
+func TestTextReader_Truncated(t *testing.T) {
+	r := NewTextReader(io.NopCloser(strings.NewReader("AAAAAA")))
+	_, err := io.ReadAll(r)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestTextResponseWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Content-Type", "application/grpc-web+proto")
+
+	w, finalize := NewTextResponseWriter(rec)
+	_, err := w.Write([]byte("hello"))
+	require.NoError(t, err)
+	w.(interface{ Flush() }).Flush()
+	_, err = w.Write([]byte(" world"))
+	require.NoError(t, err)
+	require.NoError(t, finalize())
+
+	assert.Equal(t, "application/grpc-web-text+proto", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "aGVsbG8=IHdvcmxk", rec.Body.String())
+
+	data, err := io.ReadAll(NewTextReader(io.NopCloser(rec.Body)))
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+}
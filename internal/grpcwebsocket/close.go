@@ -0,0 +1,72 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcwebsocket
+
+import (
+	"unicode/utf8"
+
+	"google.golang.org/grpc/codes"
+	"nhooyr.io/websocket"
+)
+
+const (
+	// maxCloseReasonLength is the maximum length of the reason in a close frame. Control frame payloads are limited
+	// to 125 bytes, two of which are taken by the status code.
+	maxCloseReasonLength = 123
+)
+
+// CloseStatusForCode returns the WebSocket close status to use after a gRPC call completed with the given code.
+// Errors that indicate a fault of the server are reported as internal errors, such that intermediaries can tell them
+// apart from regular completions; all other calls, including those failing with application errors, are closed
+// normally.
+func CloseStatusForCode(code codes.Code) websocket.StatusCode {
+	switch code {
+	case codes.Internal, codes.Unknown, codes.DataLoss:
+		return websocket.StatusInternalError
+	default:
+		return websocket.StatusNormalClosure
+	}
+}
+
+// CodeForCloseStatus returns the gRPC status code for a call whose WebSocket connection was closed with the given
+// status before the call completed. A status of -1 (i.e., the connection was not closed via a close frame) is
+// mapped to `Unavailable`.
+func CodeForCloseStatus(status websocket.StatusCode) codes.Code {
+	switch status {
+	case websocket.StatusMessageTooBig:
+		return codes.ResourceExhausted
+	case websocket.StatusInternalError, websocket.StatusProtocolError, websocket.StatusUnsupportedData,
+		websocket.StatusInvalidFramePayloadData, websocket.StatusPolicyViolation:
+		return codes.Internal
+	default:
+		return codes.Unavailable
+	}
+}
+
+// CloseReason truncates the given reason such that it fits into a close frame. Closing a connection with a longer
+// reason fails without sending a close frame at all.
+func CloseReason(reason string) string {
+	if len(reason) <= maxCloseReasonLength {
+		return reason
+	}
+	reason = reason[:maxCloseReasonLength]
+	for len(reason) > 0 {
+		if r, size := utf8.DecodeLastRuneInString(reason); r != utf8.RuneError || size != 1 {
+			break
+		}
+		reason = reason[:len(reason)-1]
+	}
+	return reason
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcwebsocket
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"nhooyr.io/websocket"
+)
+
+func TestCloseStatusMapping(t *testing.T) {
+	assert.Equal(t, websocket.StatusNormalClosure, CloseStatusForCode(codes.OK))
+	assert.Equal(t, websocket.StatusNormalClosure, CloseStatusForCode(codes.NotFound))
+	assert.Equal(t, websocket.StatusInternalError, CloseStatusForCode(codes.Internal))
+
+	assert.Equal(t, codes.Internal, CodeForCloseStatus(websocket.StatusInternalError))
+	assert.Equal(t, codes.ResourceExhausted, CodeForCloseStatus(websocket.StatusMessageTooBig))
+	assert.Equal(t, codes.Unavailable, CodeForCloseStatus(websocket.StatusGoingAway))
+	assert.Equal(t, codes.Unavailable, CodeForCloseStatus(-1))
+}
+
+func TestCloseReason(t *testing.T) {
+	assert.Equal(t, "short", CloseReason("short"))
+
+	long := CloseReason(strings.Repeat("a", 200))
+	assert.Len(t, long, maxCloseReasonLength)
+
+	// Multi-byte runes must not be cut in half.
+	multiByte := CloseReason(strings.Repeat("ä", 100))
+	assert.Equal(t, strings.Repeat("ä", maxCloseReasonLength/2), multiByte)
+}
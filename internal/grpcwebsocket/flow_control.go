@@ -0,0 +1,68 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcwebsocket
+
+import (
+	"context"
+	"sync"
+)
+
+// Window tracks the number of bytes of data frames the receiving side of a WebSocket connection has granted the
+// sending side via window updates. As gRPC frames cannot be split, a frame may be sent as long as the window is
+// positive, hence the sender may exceed the window by less than the size of a single frame.
+type Window struct {
+	mutex   sync.Mutex
+	credits int64
+	// updated is closed and replaced whenever credits are added.
+	updated chan struct{}
+}
+
+// NewWindow returns a window granting the given initial number of bytes.
+func NewWindow(initial uint32) *Window {
+	return &Window{
+		credits: int64(initial),
+		updated: make(chan struct{}),
+	}
+}
+
+// Add grants the given number of bytes to the sender.
+func (w *Window) Add(n uint32) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.credits += int64(n)
+	close(w.updated)
+	w.updated = make(chan struct{})
+}
+
+// Acquire waits until the window is positive, and then deducts n bytes from it. It returns an error if the given
+// context is done before.
+func (w *Window) Acquire(ctx context.Context, n int64) error {
+	for {
+		w.mutex.Lock()
+		if w.credits > 0 {
+			w.credits -= n
+			w.mutex.Unlock()
+			return nil
+		}
+		updated := w.updated
+		w.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-updated:
+		}
+	}
+}
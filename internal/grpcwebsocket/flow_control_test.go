@@ -0,0 +1,57 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcwebsocket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindow(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	w := NewWindow(10)
+	// A frame may exceed the remaining window, as long as it is positive.
+	require.NoError(t, w.Acquire(ctx, 4))
+	require.NoError(t, w.Acquire(ctx, 8))
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- w.Acquire(ctx, 1) }()
+	select {
+	case err := <-acquired:
+		t.Fatalf("acquired exhausted window: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The window is still exhausted after this update.
+	w.Add(2)
+	select {
+	case err := <-acquired:
+		t.Fatalf("acquired exhausted window: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	w.Add(1)
+	assert.NoError(t, <-acquired)
+
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, w.Acquire(canceledCtx, 1), context.Canceled)
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcwebsocket
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"nhooyr.io/websocket"
+)
+
+const (
+	// DefaultKeepaliveTimeout is the time to wait for a pong if no timeout is specified. This is the same default
+	// as for gRPC's own keepalive pings.
+	DefaultKeepaliveTimeout = 20 * time.Second
+)
+
+// Keepalive sends a ping to the peer every interval, until the given context is done. If the peer does not respond
+// with a pong within the given timeout, the connection is closed and an error is returned.
+// Pongs are only processed while the connection is being read from, hence Keepalive must be called concurrently
+// with reading from the connection.
+func Keepalive(ctx context.Context, conn *websocket.Conn, interval, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = DefaultKeepaliveTimeout
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if err := ping(ctx, conn, timeout); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			// The connection may still be open if writing the ping failed.
+			_ = conn.CloseNow()
+			return errors.Wrap(err, "keepalive")
+		}
+	}
+}
+
+func ping(ctx context.Context, conn *websocket.Conn, timeout time.Duration) error {
+	pingCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return conn.Ping(pingCtx)
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcwebsocket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"nhooyr.io/websocket"
+)
+
+// dialPeer connects to a WebSocket peer that either responds to pings or ignores them.
+func dialPeer(t *testing.T, respond bool) *websocket.Conn {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := websocket.Accept(w, req, nil)
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.CloseNow() }()
+		if respond {
+			// Reading from the connection answers pings.
+			_, _, _ = conn.Read(req.Context())
+		} else {
+			<-req.Context().Done()
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	conn, _, err := websocket.Dial(context.Background(), srv.URL, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.CloseNow() })
+	// Process pongs. CloseRead is not used, as it races with the connection being closed by a failed ping.
+	go func() {
+		for {
+			if _, _, err := conn.Read(context.Background()); err != nil {
+				return
+			}
+		}
+	}()
+	return conn
+}
+
+func TestKeepalive_PeerResponds(t *testing.T) {
+	conn := dialPeer(t, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	assert.NoError(t, Keepalive(ctx, conn, 20*time.Millisecond, 50*time.Millisecond))
+}
+
+func TestKeepalive_PeerUnresponsive(t *testing.T) {
+	conn := dialPeer(t, false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := Keepalive(ctx, conn, 20*time.Millisecond, 50*time.Millisecond)
+	require.Error(t, err)
+	assert.NoError(t, ctx.Err(), "keepalive should fail before the context expires")
+
+	// The connection must be closed.
+	assert.Error(t, conn.Write(context.Background(), websocket.MessageBinary, []byte("hello")))
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcwebsocket
+
+import (
+	"bytes"
+	"io"
+
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"golang.stackrox.io/grpc-http1/internal/ioutils"
+)
+
+// ReadFrame appends the WebSocket message read from r, which is expected to be a gRPC frame, to buf.
+// The frame header is checked before the payload is read, such that a frame announcing a payload larger than
+// maxFrameSize is rejected with a *grpcproto.FrameTooLargeError without reading the payload. A maxFrameSize of 0
+// means that there is no limit. Validating the frame otherwise is left to the caller.
+func ReadFrame(r io.Reader, buf *bytes.Buffer, maxFrameSize uint32) error {
+	if _, err := ioutils.CopyNFull(buf, r, grpcproto.MessageHeaderLength); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// The message is too short to be a gRPC frame, which is detected by validation.
+			return nil
+		}
+		return err
+	}
+
+	_, length, err := grpcproto.ParseMessageHeader(buf.Bytes()[buf.Len()-grpcproto.MessageHeaderLength:])
+	if err != nil {
+		return err
+	}
+	if err := grpcproto.CheckFrameLength(length, maxFrameSize); err != nil {
+		return err
+	}
+
+	_, err = buf.ReadFrom(r)
+	return err
+}
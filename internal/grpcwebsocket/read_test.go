@@ -0,0 +1,66 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcwebsocket
+
+import (
+	"bytes"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+)
+
+func TestReadFrame(t *testing.T) {
+	msg := append(grpcproto.MakeMessageHeader(0, 3), "foo"...)
+
+	var buf bytes.Buffer
+	require.NoError(t, ReadFrame(bytes.NewReader(msg), &buf, 3))
+	assert.Equal(t, msg, buf.Bytes())
+}
+
+func TestReadFrame_TooLarge(t *testing.T) {
+	// The header claims an enormous payload, which must be rejected before attempting to read it.
+	msg := append(grpcproto.MakeMessageHeader(0, 0xffffffff), "foo"...)
+
+	var buf bytes.Buffer
+	err := ReadFrame(bytes.NewReader(msg), &buf, grpcproto.DefaultMaxFrameSize)
+	var frameErr *grpcproto.FrameTooLargeError
+	require.ErrorAs(t, err, &frameErr)
+	assert.Equal(t, uint32(grpcproto.DefaultMaxFrameSize), frameErr.MaxLength)
+	assert.Equal(t, grpcproto.MessageHeaderLength, buf.Len())
+}
+
+func TestReadFrame_Short(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, ReadFrame(bytes.NewReader([]byte{0, 0}), &buf, 0))
+	assert.Error(t, grpcproto.ValidateGRPCFrame(buf.Bytes()))
+}
+
+func TestReadFrame_OneByteReads(t *testing.T) {
+	msg := append(grpcproto.MakeMessageHeader(0, 3), "foo"...)
+
+	var buf bytes.Buffer
+	require.NoError(t, ReadFrame(iotest.OneByteReader(bytes.NewReader(msg)), &buf, 3))
+	assert.Equal(t, msg, buf.Bytes())
+	assert.NoError(t, grpcproto.ValidateGRPCFrame(buf.Bytes()))
+
+	// The frame size is checked based on the full header, even if it is read byte by byte.
+	buf.Reset()
+	err := ReadFrame(iotest.OneByteReader(bytes.NewReader(msg)), &buf, 2)
+	var frameErr *grpcproto.FrameTooLargeError
+	assert.ErrorAs(t, err, &frameErr)
+}
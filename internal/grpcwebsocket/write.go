@@ -19,18 +19,23 @@ import (
 	"context"
 	"io"
 
-	"github.com/golang/glog"
 	"golang.stackrox.io/grpc-http1/internal/grpcproto"
 	"golang.stackrox.io/grpc-http1/internal/ioutils"
 	"nhooyr.io/websocket"
 )
 
+// streamedFrameThreshold is the payload size above which gRPC frames are streamed to the WebSocket connection, instead
+// of being read into a buffer first. Smaller frames are buffered, such that they are sent in a single WebSocket frame.
+const streamedFrameThreshold = 64 << 10
+
 // Write the contents of the reader along the WebSocket connection.
 // This is done by sending each WebSocket message as a gRPC message frame.
 // Each message frame is length-prefixed message, where the prefix is 5 bytes.
 // gRPC request format is specified here: https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md.
-func Write(ctx context.Context, conn *websocket.Conn, r io.Reader, sender string) error {
+// If window is non-nil, data frames are only sent as long as the receiver has granted enough bytes via window updates.
+func Write(ctx context.Context, conn *websocket.Conn, r io.Reader, window *Window) error {
 	var msg bytes.Buffer
+	var copyBuf []byte
 	for {
 		// Reset the message buffer to start with a clean slate.
 		msg.Reset()
@@ -40,8 +45,6 @@ func Write(ctx context.Context, conn *websocket.Conn, r io.Reader, sender string
 				// EOF here means the sender has no more messages to send.
 				return nil
 			}
-
-			glog.V(2).Infof("Malformed gRPC message when reading header sent from %s: %v", sender, err)
 			return err
 		}
 
@@ -49,22 +52,53 @@ func Write(ctx context.Context, conn *websocket.Conn, r io.Reader, sender string
 		if err != nil {
 			return err
 		}
+		if window != nil && grpcproto.IsDataFrame(msg.Bytes()) {
+			if err := window.Acquire(ctx, grpcproto.MessageHeaderLength+int64(length)); err != nil {
+				return err
+			}
+		}
 
-		// Read the rest of the message into the msg buffer.
-		if n, err := io.CopyN(&msg, r, int64(length)); err != nil {
-			if err == io.EOF || err == io.ErrUnexpectedEOF {
-				err = io.ErrUnexpectedEOF
-				glog.V(2).Infof("Malformed gRPC message: fewer than the announced %d bytes in payload %s wants to send: %d", length, sender, n)
-			} else {
-				glog.V(2).Infof("Unable to read gRPC message %s wants to send: %v", sender, err)
+		if length > streamedFrameThreshold {
+			if copyBuf == nil {
+				copyBuf = make([]byte, 32<<10)
 			}
+			err = writeStreamed(ctx, conn, msg.Bytes(), r, length, copyBuf)
+		} else {
+			err = writeBuffered(ctx, conn, &msg, r, length)
+		}
+		if err != nil {
 			return err
 		}
+	}
+}
 
-		// Write the entire message frame along the WebSocket connection.
-		if err := conn.Write(ctx, websocket.MessageBinary, msg.Bytes()); err != nil {
-			glog.V(2).Infof("Unable to write gRPC message from %s: %v", sender, err)
-			return err
+// writeBuffered reads the payload of a gRPC frame from r into msg, which holds the header, and writes the entire frame
+// as a single WebSocket message.
+func writeBuffered(ctx context.Context, conn *websocket.Conn, msg *bytes.Buffer, r io.Reader, length uint32) error {
+	if _, err := io.CopyN(msg, r, int64(length)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
 		}
+		return err
+	}
+	return conn.Write(ctx, websocket.MessageBinary, msg.Bytes())
+}
+
+// writeStreamed writes a gRPC frame as a single WebSocket message, copying the payload from r directly to the
+// connection after the given header. This avoids holding the entire frame in memory. If the payload is truncated, the
+// message is left incomplete, and the connection must be closed.
+func writeStreamed(ctx context.Context, conn *websocket.Conn, hdr []byte, r io.Reader, length uint32, buf []byte) error {
+	w, err := conn.Writer(ctx, websocket.MessageBinary)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	if n, err := io.CopyBuffer(w, io.LimitReader(r, int64(length)), buf); err != nil {
+		return err
+	} else if n < int64(length) {
+		return io.ErrUnexpectedEOF
 	}
+	return w.Close()
 }
@@ -0,0 +1,157 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package grpcwebsocket
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"nhooyr.io/websocket"
+)
+
+// writeAndReceive writes the frames read from r via Write, and returns the WebSocket messages received by the peer.
+func writeAndReceive(t *testing.T, r io.Reader) ([][]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	received := make(chan [][]byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := websocket.Accept(w, req, nil)
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.CloseNow() }()
+		conn.SetReadLimit(-1)
+		var msgs [][]byte
+		defer func() { received <- msgs }()
+		for {
+			_, msg, err := conn.Read(ctx)
+			if err != nil {
+				return
+			}
+			msgs = append(msgs, msg)
+		}
+	}))
+	defer srv.Close()
+
+	conn, _, err := websocket.Dial(ctx, srv.URL, nil)
+	require.NoError(t, err)
+	writeErr := Write(ctx, conn, r, nil)
+	require.NoError(t, conn.Close(websocket.StatusNormalClosure, ""))
+	return <-received, writeErr
+}
+
+func TestWrite_OneByteReads(t *testing.T) {
+	frames := [][]byte{
+		append(grpcproto.MakeMessageHeader(0, 3), "foo"...),
+		grpcproto.MakeMessageHeader(0, 0),
+		append(grpcproto.MakeMessageHeader(grpcproto.CompressedFlags, 6), "barbaz"...),
+	}
+
+	msgs, err := writeAndReceive(t, iotest.OneByteReader(bytes.NewReader(bytes.Join(frames, nil))))
+	require.NoError(t, err)
+	// Every frame is sent as a single message, regardless of how it was fragmented when reading.
+	assert.Equal(t, frames, msgs)
+}
+
+func TestWrite_Truncated(t *testing.T) {
+	cases := map[string][]byte{
+		"truncated header":        {0, 0, 0},
+		"truncated payload":       append(grpcproto.MakeMessageHeader(0, 3), "fo"...),
+		"truncated large payload": append(grpcproto.MakeMessageHeader(0, streamedFrameThreshold+2), make([]byte, streamedFrameThreshold+1)...),
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			msgs, err := writeAndReceive(t, iotest.OneByteReader(bytes.NewReader(data)))
+			assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+			assert.Empty(t, msgs)
+		})
+	}
+}
+
+func TestWrite_LargeFrames(t *testing.T) {
+	frames := [][]byte{
+		append(grpcproto.MakeMessageHeader(0, 3), "foo"...),
+		append(grpcproto.MakeMessageHeader(0, streamedFrameThreshold+1), bytes.Repeat([]byte("x"), streamedFrameThreshold+1)...),
+		append(grpcproto.MakeMessageHeader(0, 3), "bar"...),
+	}
+
+	msgs, err := writeAndReceive(t, iotest.HalfReader(bytes.NewReader(bytes.Join(frames, nil))))
+	require.NoError(t, err)
+	// Large frames are streamed, but still sent as a single message.
+	assert.Equal(t, frames, msgs)
+}
+
+func BenchmarkWrite(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := websocket.Accept(w, req, nil)
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.CloseNow() }()
+		conn.SetReadLimit(-1)
+		for {
+			_, r, err := conn.Reader(ctx)
+			if err != nil {
+				return
+			}
+			if _, err := io.Copy(io.Discard, r); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	conn, _, err := websocket.Dial(ctx, srv.URL, nil)
+	require.NoError(b, err)
+	defer func() { _ = conn.CloseNow() }()
+
+	const length = 1 << 20
+	hdr := grpcproto.MakeMessageHeader(0, length)
+	payload := make([]byte, length)
+	var msg bytes.Buffer
+	copyBuf := make([]byte, 32<<10)
+	benchmarks := map[string]func() error{
+		"buffered": func() error {
+			msg.Reset()
+			msg.Write(hdr)
+			return writeBuffered(ctx, conn, &msg, bytes.NewReader(payload), length)
+		},
+		"streamed": func() error {
+			return writeStreamed(ctx, conn, hdr, bytes.NewReader(payload), length, copyBuf)
+		},
+	}
+	for name, write := range benchmarks {
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(hdr) + len(payload)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				require.NoError(b, write())
+			}
+		})
+	}
+}
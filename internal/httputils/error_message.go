@@ -7,47 +7,82 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+	"unicode"
 	"unicode/utf8"
 )
 
 const (
-	maxBodyBytes = 1024
+	maxBodyBytes = 512
 )
 
 var (
 	httpHeaderOptSeparatorRegex = regexp.MustCompile(`;\s*`)
 )
 
-// ExtractResponseError extracts an error from an HTTP response, reading at most 1024 bytes of the
-// response body.
+// ExtractResponseError extracts an error from an HTTP error response (see ResponseError). It returns nil if the
+// response does not have an error status.
 func ExtractResponseError(resp *http.Response) error {
 	if resp.StatusCode < 400 {
 		return nil
 	}
-	contentTypeFields := httpHeaderOptSeparatorRegex.Split(resp.Header.Get("Content-Type"), 2)
-	if len(contentTypeFields) == 0 {
-		return errors.New(resp.Status)
-	}
+	return ResponseError(resp)
+}
 
-	if contentTypeFields[0] != "text/plain" {
-		return fmt.Errorf("%s, content-type %s", resp.Status, contentTypeFields[0])
+// ResponseError returns an error describing the given HTTP response, consisting of the status line, the content type,
+// and a prefix of at most 512 bytes of the response body. Binary bodies are not included verbatim.
+func ResponseError(resp *http.Response) error {
+	msg := resp.Status
+	if resp.Proto != "" {
+		msg = resp.Proto + " " + msg
+	}
+	if contentType := httpHeaderOptSeparatorRegex.Split(resp.Header.Get("Content-Type"), 2)[0]; contentType != "" {
+		msg += ", content-type " + contentType
+	}
+	if resp.Body == nil {
+		return errors.New(msg)
 	}
 
-	bodyReader := io.LimitReader(resp.Body, maxBodyBytes)
-	contents, err := io.ReadAll(bodyReader)
-	contentsStr := strings.TrimSpace(string(contents))
-	if !utf8.Valid(contents) {
-		contentsStr = "invalid UTF-8 characters in response"
+	contents, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes+1))
+	truncated := len(contents) > maxBodyBytes
+	if truncated {
+		contents = contents[:maxBodyBytes]
 	}
+	contentsStr := describeBody(contents, truncated)
 	if err != nil {
 		if contentsStr == "" {
-			return fmt.Errorf("%s, error reading response body: %v", resp.Status, err)
+			return fmt.Errorf("%s, error reading response body: %v", msg, err)
 		}
-		return fmt.Errorf("%s: %s, error reading response body after %d bytes: %v", resp.Status, contentsStr, len(contents), err)
+		return fmt.Errorf("%s: %s, error reading response body after %d bytes: %v", msg, contentsStr, len(contents), err)
 	}
 
 	if contentsStr == "" {
-		return errors.New(resp.Status)
+		return errors.New(msg)
+	}
+	return fmt.Errorf("%s: %s", msg, contentsStr)
+}
+
+// describeBody returns a printable single-line representation of the given (prefix of a) response body.
+func describeBody(contents []byte, truncated bool) string {
+	if truncated {
+		// Do not mistake a rune cut off at the end for invalid UTF-8.
+		for i := 0; i < utf8.UTFMax-1 && len(contents) > 0 && !utf8.Valid(contents); i++ {
+			contents = contents[:len(contents)-1]
+		}
+	}
+	if !utf8.Valid(contents) || strings.IndexFunc(string(contents), isBinaryRune) != -1 {
+		if truncated {
+			return fmt.Sprintf("<more than %d bytes of binary data>", maxBodyBytes)
+		}
+		return fmt.Sprintf("<%d bytes of binary data>", len(contents))
 	}
-	return fmt.Errorf("%s: %s", resp.Status, contentsStr)
+
+	contentsStr := strings.Join(strings.Fields(string(contents)), " ")
+	if truncated {
+		contentsStr += "..."
+	}
+	return contentsStr
+}
+
+func isBinaryRune(r rune) bool {
+	return unicode.IsControl(r) && !unicode.IsSpace(r)
 }
@@ -0,0 +1,84 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package httputils
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseError(t *testing.T) {
+	cases := map[string]struct {
+		contentType string
+		body        string
+		expected    string
+	}{
+		"plain text": {
+			contentType: "text/plain; charset=utf-8",
+			body:        "go away\n",
+			expected:    "HTTP/1.1 404 Not Found, content-type text/plain: go away",
+		},
+		"html page": {
+			contentType: "text/html",
+			body:        "<html>\n  <body>\n    <h1>404 Not Found</h1>\n  </body>\n</html>\n",
+			expected:    "HTTP/1.1 404 Not Found, content-type text/html: <html> <body> <h1>404 Not Found</h1> </body> </html>",
+		},
+		"no body": {
+			expected: "HTTP/1.1 404 Not Found",
+		},
+		"truncated": {
+			body:     strings.Repeat("ä", maxBodyBytes),
+			expected: "HTTP/1.1 404 Not Found: " + strings.Repeat("ä", maxBodyBytes/2) + "...",
+		},
+		"binary": {
+			contentType: "application/octet-stream",
+			body:        "\x00\x01\x02\x03",
+			expected:    "HTTP/1.1 404 Not Found, content-type application/octet-stream: <4 bytes of binary data>",
+		},
+		"truncated binary": {
+			body:     strings.Repeat("\xff", 2*maxBodyBytes),
+			expected: "HTTP/1.1 404 Not Found: <more than 512 bytes of binary data>",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			resp := &http.Response{
+				Status:     "404 Not Found",
+				StatusCode: http.StatusNotFound,
+				Proto:      "HTTP/1.1",
+				Header:     make(http.Header),
+				Body:       io.NopCloser(strings.NewReader(c.body)),
+			}
+			if c.contentType != "" {
+				resp.Header.Set("Content-Type", c.contentType)
+			}
+			assert.EqualError(t, ExtractResponseError(resp), c.expected)
+		})
+	}
+}
+
+func TestExtractResponseError_NoError(t *testing.T) {
+	resp := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+	}
+	assert.NoError(t, ExtractResponseError(resp))
+}
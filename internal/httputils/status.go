@@ -0,0 +1,26 @@
+package httputils
+
+import (
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+)
+
+// GRPCCodeFromHTTPStatus maps an HTTP status code to a gRPC status code, following the mapping in the gRPC
+// documentation (https://github.com/grpc/grpc/blob/master/doc/http-grpc-status-mapping.md).
+func GRPCCodeFromHTTPStatus(statusCode int) codes.Code {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return codes.Internal
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.Unimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return codes.Unavailable
+	default:
+		return codes.Unknown
+	}
+}
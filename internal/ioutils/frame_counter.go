@@ -0,0 +1,86 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package ioutils
+
+import (
+	"encoding/binary"
+	"io"
+	"sync/atomic"
+
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+)
+
+// FrameCounter counts the gRPC frames in a byte stream that is written to it in arbitrary chunks. Writes must not be
+// concurrent, but the count may be read at any time.
+type FrameCounter struct {
+	header    [grpcproto.MessageHeaderLength]byte
+	headerLen int
+	remaining uint32
+	frames    int64
+}
+
+// Write counts the frames whose header is completed by buf. It never fails.
+func (c *FrameCounter) Write(buf []byte) (int, error) {
+	n := len(buf)
+	for len(buf) > 0 {
+		if c.remaining > 0 {
+			skip := uint32(len(buf))
+			if skip > c.remaining {
+				skip = c.remaining
+			}
+			c.remaining -= skip
+			buf = buf[skip:]
+			continue
+		}
+		copied := copy(c.header[c.headerLen:], buf)
+		c.headerLen += copied
+		buf = buf[copied:]
+		if c.headerLen == len(c.header) {
+			atomic.AddInt64(&c.frames, 1)
+			c.remaining = binary.BigEndian.Uint32(c.header[1:])
+			c.headerLen = 0
+		}
+	}
+	return n, nil
+}
+
+// Add adds n frames that were not written to the counter, e.g., because they were transferred as whole messages.
+func (c *FrameCounter) Add(n int64) {
+	atomic.AddInt64(&c.frames, n)
+}
+
+// Frames returns the number of frames counted so far.
+func (c *FrameCounter) Frames() int64 {
+	return atomic.LoadInt64(&c.frames)
+}
+
+type frameCountingReader struct {
+	io.ReadCloser
+	frames *FrameCounter
+}
+
+// NewFrameCountingReader returns a reader that counts the gRPC frames read from the given reader.
+func NewFrameCountingReader(reader io.ReadCloser, frames *FrameCounter) io.ReadCloser {
+	return &frameCountingReader{
+		ReadCloser: reader,
+		frames:     frames,
+	}
+}
+
+func (r *frameCountingReader) Read(buf []byte) (int, error) {
+	n, err := r.ReadCloser.Read(buf)
+	_, _ = r.frames.Write(buf[:n])
+	return n, err
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package ioutils
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+)
+
+func TestFrameCounter(t *testing.T) {
+	var stream bytes.Buffer
+	stream.Write(grpcproto.MakeMessageHeader(0, 3))
+	stream.WriteString("abc")
+	stream.Write(grpcproto.MakeMessageHeader(0, 0))
+	stream.Write(grpcproto.MakeMessageHeader(grpcproto.MetadataFlags, 1000))
+	stream.Write(make([]byte, 1000))
+
+	for _, chunkSize := range []int{1, 2, 5, 7, 4096} {
+		var counter FrameCounter
+		data := stream.Bytes()
+		for len(data) > 0 {
+			n := chunkSize
+			if n > len(data) {
+				n = len(data)
+			}
+			written, err := counter.Write(data[:n])
+			require.NoError(t, err)
+			require.Equal(t, n, written)
+			data = data[n:]
+		}
+		assert.EqualValues(t, 3, counter.Frames(), "chunk size %d", chunkSize)
+	}
+}
+
+func TestFrameCountingReader(t *testing.T) {
+	var stream bytes.Buffer
+	stream.Write(grpcproto.MakeMessageHeader(0, 3))
+	stream.WriteString("abc")
+	stream.Write(grpcproto.EndStreamHeader)
+
+	var counter FrameCounter
+	counter.Add(1)
+	r := NewFrameCountingReader(io.NopCloser(&stream), &counter)
+	_, err := io.Copy(io.Discard, r)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, counter.Frames())
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package metrics
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/server"
+)
+
+const (
+	namespace = "grpc_http1"
+
+	directionSent     = "sent"
+	directionReceived = "received"
+
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
+var (
+	_ prometheus.Collector = (*Collector)(nil)
+	_ client.StatsHandler  = (*Collector)(nil)
+	_ server.StatsHandler  = (*Collector)(nil)
+)
+
+// Collector is a Prometheus collector for metrics about the gRPC streams tunneled by the client and the server, as
+// well as about the handshakes of the client. It is a stats handler for both, hence pass it to
+// `client.WithStatsHandler` and `server.WithStatsHandler`, and register it with a Prometheus registry. The Prometheus
+// client library is only a dependency of this package, such that users not importing it are not burdened with it.
+type Collector struct {
+	clientActiveStreams prometheus.Gauge
+	clientBytes         *prometheus.CounterVec
+	clientFrames        *prometheus.CounterVec
+	handshakeDuration   *prometheus.HistogramVec
+	proxyConnects       *prometheus.CounterVec
+
+	serverActiveStreams *prometheus.GaugeVec
+	serverBytes         *prometheus.CounterVec
+	serverFrames        *prometheus.CounterVec
+}
+
+// NewCollector returns a new collector. Metrics are only reported for the clients and servers it is passed to.
+func NewCollector() *Collector {
+	return &Collector{
+		clientActiveStreams: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "active_streams",
+			Help:      "Number of gRPC streams currently being tunneled by the client.",
+		}),
+		clientBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "bytes_total",
+			Help:      "Number of bytes of gRPC frames sent to and received from the endpoint by the client.",
+		}, []string{"direction"}),
+		clientFrames: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "frames_total",
+			Help:      "Number of gRPC frames sent to and received from the endpoint by the client.",
+		}, []string{"direction"}),
+		handshakeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "handshake_duration_seconds",
+			Help:      "Duration of the handshakes performed by the client for connecting to the endpoint.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"kind", "result"}),
+		proxyConnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "client",
+			Name:      "proxy_connects_total",
+			Help:      "Number of attempts of the client to establish a tunnel to the endpoint via a proxy.",
+		}, []string{"result"}),
+
+		serverActiveStreams: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "server",
+			Name:      "active_streams",
+			Help:      "Number of gRPC streams currently being handled by the server.",
+		}, []string{"transport"}),
+		serverBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "server",
+			Name:      "bytes_total",
+			Help:      "Number of bytes of gRPC frames sent to and received from clients by the server.",
+		}, []string{"transport", "direction"}),
+		serverFrames: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "server",
+			Name:      "frames_total",
+			Help:      "Number of gRPC frames sent to and received from clients by the server.",
+		}, []string{"transport", "direction"}),
+	}
+}
+
+func (c *Collector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.clientActiveStreams,
+		c.clientBytes,
+		c.clientFrames,
+		c.handshakeDuration,
+		c.proxyConnects,
+		c.serverActiveStreams,
+		c.serverBytes,
+		c.serverFrames,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, collector := range c.collectors() {
+		collector.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, collector := range c.collectors() {
+		collector.Collect(ch)
+	}
+}
+
+// StreamStarted implements client.StatsHandler.
+func (c *Collector) StreamStarted(client.StreamInfo) {
+	c.clientActiveStreams.Inc()
+}
+
+// StreamFinished implements client.StatsHandler.
+func (c *Collector) StreamFinished(stats client.StreamStats) {
+	c.clientActiveStreams.Dec()
+	c.clientBytes.WithLabelValues(directionSent).Add(float64(stats.BytesSent))
+	c.clientBytes.WithLabelValues(directionReceived).Add(float64(stats.BytesReceived))
+	c.clientFrames.WithLabelValues(directionSent).Add(float64(stats.FramesSent))
+	c.clientFrames.WithLabelValues(directionReceived).Add(float64(stats.FramesReceived))
+}
+
+// HandshakeFinished implements client.StatsHandler.
+func (c *Collector) HandshakeFinished(stats client.HandshakeStats) {
+	result := resultSuccess
+	if stats.Err != nil {
+		result = resultFailure
+	}
+	c.handshakeDuration.WithLabelValues(string(stats.Kind), result).Observe(stats.Duration.Seconds())
+	if stats.Kind == client.HandshakeProxyConnect {
+		c.proxyConnects.WithLabelValues(result).Inc()
+	}
+}
+
+// RPCStarted implements server.StatsHandler.
+func (c *Collector) RPCStarted(_ context.Context, info server.RPCInfo) {
+	c.serverActiveStreams.WithLabelValues(string(info.Transport)).Inc()
+}
+
+// RPCFinished implements server.StatsHandler.
+func (c *Collector) RPCFinished(_ context.Context, stats server.RPCStats) {
+	transport := string(stats.Transport)
+	c.serverActiveStreams.WithLabelValues(transport).Dec()
+	c.serverBytes.WithLabelValues(transport, directionSent).Add(float64(stats.BytesSent))
+	c.serverBytes.WithLabelValues(transport, directionReceived).Add(float64(stats.BytesReceived))
+	c.serverFrames.WithLabelValues(transport, directionSent).Add(float64(stats.FramesSent))
+	c.serverFrames.WithLabelValues(transport, directionReceived).Add(float64(stats.FramesReceived))
+}
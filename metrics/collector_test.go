@@ -0,0 +1,108 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestCollector(t *testing.T) {
+	collector := NewCollector()
+	registry := prometheus.NewPedanticRegistry()
+	require.NoError(t, registry.Register(collector))
+
+	grpcSrv := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcSrv, health.NewServer())
+	defer grpcSrv.Stop()
+
+	httpSrv := httptest.NewServer(server.CreateDowngradingHandler(grpcSrv, http.NotFoundHandler(), server.WithStatsHandler(collector)))
+	defer httpSrv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cc, err := client.ConnectViaProxy(ctx, httpSrv.Listener.Addr().String(), nil,
+		client.DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())),
+		client.UseWebSocket(true),
+		client.WithStatsHandler(collector))
+	require.NoError(t, err)
+	defer func() { _ = cc.Close() }()
+
+	_, err = healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	// The streams are only finished once the response has been forwarded.
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(collector.clientActiveStreams) == 0 &&
+			testutil.ToFloat64(collector.serverActiveStreams.WithLabelValues(string(server.TransportGRPCWebSocket))) == 0 &&
+			testutil.ToFloat64(collector.serverFrames.WithLabelValues(string(server.TransportGRPCWebSocket), directionSent)) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// A request frame and the end-of-stream frame are sent, and the headers, a response frame and the trailers are
+	// received.
+	assert.EqualValues(t, 2, testutil.ToFloat64(collector.clientFrames.WithLabelValues(directionSent)))
+	assert.EqualValues(t, 3, testutil.ToFloat64(collector.clientFrames.WithLabelValues(directionReceived)))
+	assert.Positive(t, testutil.ToFloat64(collector.clientBytes.WithLabelValues(directionReceived)))
+
+	assert.EqualValues(t, 1, testutil.ToFloat64(collector.serverFrames.WithLabelValues(string(server.TransportGRPCWebSocket), directionReceived)))
+	assert.EqualValues(t, 1, testutil.ToFloat64(collector.serverFrames.WithLabelValues(string(server.TransportGRPCWebSocket), directionSent)))
+	assert.Positive(t, testutil.ToFloat64(collector.serverBytes.WithLabelValues(string(server.TransportGRPCWebSocket), directionSent)))
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	var handshakes uint64
+	for _, family := range families {
+		if family.GetName() != "grpc_http1_client_handshake_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["kind"] == string(client.HandshakeWebSocket) && labels["result"] == resultSuccess {
+				handshakes += metric.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	assert.EqualValues(t, 1, handshakes)
+}
+
+func TestCollector_ProxyConnects(t *testing.T) {
+	collector := NewCollector()
+
+	collector.HandshakeFinished(client.HandshakeStats{Kind: client.HandshakeProxyConnect, Duration: time.Second})
+	collector.HandshakeFinished(client.HandshakeStats{Kind: client.HandshakeProxyConnect, Err: context.DeadlineExceeded})
+	collector.HandshakeFinished(client.HandshakeStats{Kind: client.HandshakeSideChannel, Err: context.DeadlineExceeded})
+
+	assert.EqualValues(t, 1, testutil.ToFloat64(collector.proxyConnects.WithLabelValues(resultSuccess)))
+	assert.EqualValues(t, 1, testutil.ToFloat64(collector.proxyConnects.WithLabelValues(resultFailure)))
+	assert.Equal(t, 3, testutil.CollectAndCount(collector.handshakeDuration))
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+)
+
+// rejection describes why a gRPC request is not served.
+type rejection struct {
+	code codes.Code
+	msg  string
+	// httpStatus is the status of the plain HTTP error response used by transports that cannot convey a gRPC status
+	// when rejecting a request, i.e., WebSocket handshakes.
+	httpStatus int
+}
+
+// serveTrailersOnly responds to a gRPC request with a Trailers-Only response carrying the status of the rejection.
+func (r *rejection) serveTrailersOnly(w http.ResponseWriter, req *http.Request) {
+	writeTrailersOnlyStatus(w, req, r.code, r.msg)
+}
+
+// writeTrailersOnlyStatus responds to a gRPC request with a Trailers-Only response carrying the given status.
+func writeTrailersOnlyStatus(w http.ResponseWriter, req *http.Request, code codes.Code, msg string) {
+	hdr := w.Header()
+	hdr.Set("Content-Type", req.Header.Get("Content-Type"))
+	hdr.Set("Grpc-Status", fmt.Sprintf("%d", code))
+	hdr.Set("Grpc-Message", msg)
+	w.WriteHeader(http.StatusOK)
+}
+
+// admission decides whether a gRPC request is served, regardless of the transport it was received via.
+type admission struct {
+	opts         *options
+	streams      *streamTracker
+	limiter      *streamLimiter
+	frameLimiter *frameRateLimiter
+}
+
+// admit checks whether the given request may be served. If so, it returns the frame limit applying to the request, if
+// any, and a function that must be called once the request has been served. Otherwise, it returns the reason for
+// rejecting the request. The method filter, the metadata size limit and the frame rate limit only apply to downgraded
+// requests, i.e., requests not received via native gRPC. The frame rate is limited per connection, which is identified
+// by connAddr, the remote address of the request before honoring any forwarding headers.
+func (a *admission) admit(req *http.Request, connAddr string, downgraded bool) (*frameLimit, func(), *rejection) {
+	if downgraded && !a.opts.isMethodAllowed(req.URL.Path) {
+		return nil, nil, &rejection{code: codes.PermissionDenied, msg: methodNotAllowedMessage, httpStatus: http.StatusForbidden}
+	}
+	if downgraded {
+		if msg := a.opts.checkMetadataSize(req); msg != "" {
+			return nil, nil, &rejection{code: codes.ResourceExhausted, msg: msg, httpStatus: http.StatusRequestHeaderFieldsTooLarge}
+		}
+	}
+	if !a.streams.begin() {
+		return nil, nil, &rejection{code: codes.Unavailable, msg: drainingMessage, httpStatus: http.StatusServiceUnavailable}
+	}
+	if !a.limiter.acquire(req.Context()) {
+		a.streams.end()
+		return nil, nil, &rejection{code: codes.ResourceExhausted, msg: overloadedMessage, httpStatus: http.StatusTooManyRequests}
+	}
+	var limit *frameLimit
+	releaseLimit := func() {}
+	if downgraded {
+		limit, releaseLimit = a.frameLimiter.begin(connAddr)
+	}
+	return limit, func() {
+		releaseLimit()
+		a.limiter.release()
+		a.streams.end()
+	}, nil
+}
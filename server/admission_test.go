@@ -0,0 +1,167 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestAdmission(t *testing.T) {
+	var opts options
+	for _, opt := range []Option{
+		WithMethodFilter(func(fullMethod string) bool { return fullMethod != healthWatchPath }),
+		WithMaxMetadataBytes(1024),
+	} {
+		opt.apply(&opts)
+	}
+	newAdmission := func() *admission {
+		return &admission{
+			opts:    &opts,
+			streams: &streamTracker{},
+			limiter: newStreamLimiter(1, 0),
+		}
+	}
+	newRequest := func(path string, hdr http.Header) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		for k, vs := range hdr {
+			req.Header[k] = vs
+		}
+		return req
+	}
+	largeHeader := http.Header{"Large": {strings.Repeat("x", 1024)}}
+
+	cases := map[string]struct {
+		req        *http.Request
+		downgraded bool
+		code       codes.Code
+		httpStatus int
+	}{
+		"method not allowed": {
+			req:        newRequest(healthWatchPath, nil),
+			downgraded: true,
+			code:       codes.PermissionDenied,
+			httpStatus: http.StatusForbidden,
+		},
+		"metadata too large": {
+			req:        newRequest(healthCheckPath, largeHeader),
+			downgraded: true,
+			code:       codes.ResourceExhausted,
+			httpStatus: http.StatusRequestHeaderFieldsTooLarge,
+		},
+		"native gRPC is not filtered": {
+			req: newRequest(healthWatchPath, largeHeader),
+		},
+		"admitted": {
+			req:        newRequest(healthCheckPath, nil),
+			downgraded: true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, release, rej := newAdmission().admit(c.req, c.req.RemoteAddr, c.downgraded)
+			if c.code == codes.OK {
+				require.Nil(t, rej)
+				release()
+				return
+			}
+			require.NotNil(t, rej)
+			assert.Equal(t, c.code, rej.code)
+			assert.Equal(t, c.httpStatus, rej.httpStatus)
+			assert.NotEmpty(t, rej.msg)
+		})
+	}
+
+	t.Run("overloaded", func(t *testing.T) {
+		adm := newAdmission()
+		_, release, rej := adm.admit(newRequest(healthCheckPath, nil), "192.0.2.1:1234", true)
+		require.Nil(t, rej)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, _, rej = adm.admit(newRequest(healthCheckPath, nil).WithContext(ctx), "192.0.2.1:1234", true)
+		require.NotNil(t, rej)
+		assert.Equal(t, codes.ResourceExhausted, rej.code)
+		assert.Equal(t, http.StatusTooManyRequests, rej.httpStatus)
+
+		// Releasing frees the slot, and a rejected request does not count as active.
+		release()
+		_, release, rej = adm.admit(newRequest(healthCheckPath, nil), "192.0.2.1:1234", true)
+		require.Nil(t, rej)
+		release()
+		assert.Zero(t, adm.streams.numActiveStreams())
+	})
+
+	t.Run("draining", func(t *testing.T) {
+		adm := newAdmission()
+		<-adm.streams.drain()
+		_, _, rej := adm.admit(newRequest(healthCheckPath, nil), "192.0.2.1:1234", true)
+		require.NotNil(t, rej)
+		assert.Equal(t, codes.Unavailable, rej.code)
+		assert.Equal(t, http.StatusServiceUnavailable, rej.httpStatus)
+	})
+
+	t.Run("frame limit with trusted proxies", func(t *testing.T) {
+		var opts options
+		for _, opt := range []Option{
+			WithTrustedProxies(netip.MustParsePrefix("192.0.2.0/24")),
+			WithFrameRateLimit(1, 1),
+		} {
+			opt.apply(&opts)
+		}
+		adm := &admission{
+			opts:         &opts,
+			streams:      &streamTracker{},
+			limiter:      newStreamLimiter(0, 0),
+			frameLimiter: newFrameRateLimiter(opts.framesPerSecond, opts.frameBurst),
+		}
+		// Requests from the same connection claiming to forward different clients share the limit of the connection.
+		var limits []*frameLimit
+		for _, clientAddr := range []string{"198.51.100.1", "198.51.100.2"} {
+			req := newRequest(healthCheckPath, http.Header{"X-Forwarded-For": {clientAddr}})
+			req = withClientAddr(req, opts.trustedProxies)
+			require.Equal(t, clientAddr+":0", req.RemoteAddr)
+			limit, release, rej := adm.admit(req, "192.0.2.1:1234", true)
+			require.Nil(t, rej)
+			defer release()
+			limits = append(limits, limit)
+		}
+		assert.Len(t, adm.frameLimiter.buckets, 1)
+		assert.True(t, limits[0].allowFrame())
+		assert.False(t, limits[1].allowFrame())
+	})
+}
+
+func TestWriteTrailersOnlyStatus(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, healthCheckPath, nil)
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+
+	rec := httptest.NewRecorder()
+	writeTrailersOnlyStatus(rec, req, codes.Unavailable, "server draining")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/grpc-web+proto", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "14", rec.Header().Get("Grpc-Status"))
+	assert.Equal(t, "server draining", rec.Header().Get("Grpc-Message"))
+	assert.Zero(t, rec.Body.Len())
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// trustedProxies are the address ranges of proxies whose forwarding headers are trusted.
+type trustedProxies []netip.Prefix
+
+func (p trustedProxies) contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range p {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr determines the address of the client that originated req. If req was received from a trusted proxy, the
+// hops recorded by proxies are traversed from the right, skipping the addresses of further trusted proxies, and the
+// first untrusted (or else, the leftmost) address is returned. Otherwise, or if no hops are recorded, the remote address
+// of req is returned unmodified. As proxies append the address they received a request from, addresses to the left of
+// the first untrusted one may have been set by the client, and are ignored. The traversal also stops at hops whose
+// address is unknown, e.g., because it was obfuscated.
+func (p trustedProxies) clientAddr(req *http.Request) string {
+	remote, err := netip.ParseAddrPort(req.RemoteAddr)
+	if err != nil || !p.contains(remote.Addr()) {
+		return req.RemoteAddr
+	}
+
+	hops := forwardedHops(req.Header)
+	addr, client := remote.Addr(), netip.AddrPort{}
+	for i := len(hops) - 1; i >= 0 && p.contains(addr); i-- {
+		if !hops[i].IsValid() {
+			// The address of the client cannot be determined beyond this hop.
+			break
+		}
+		addr, client = hops[i].Addr(), hops[i]
+	}
+	if !client.IsValid() {
+		return req.RemoteAddr
+	}
+	return netip.AddrPortFrom(client.Addr().Unmap(), client.Port()).String()
+}
+
+// forwardedHops returns the addresses recorded in the `Forwarded` header (RFC 7239) or, if there is none, in the
+// `X-Forwarded-For` header, from the leftmost to the rightmost hop. Hops whose address is unknown are returned as
+// invalid addresses. The port of a hop is zero unless conveyed by the `Forwarded` header.
+func forwardedHops(hdr http.Header) []netip.AddrPort {
+	var hops []netip.AddrPort
+	if vals := hdr.Values("Forwarded"); len(vals) > 0 {
+		for _, val := range vals {
+			for _, elem := range splitQuoted(val, ',') {
+				var hop netip.AddrPort
+				for _, pair := range splitQuoted(elem, ';') {
+					name, value, _ := strings.Cut(pair, "=")
+					if strings.EqualFold(strings.TrimSpace(name), "for") {
+						hop = parseForwardedNode(unquote(strings.TrimSpace(value)))
+					}
+				}
+				hops = append(hops, hop)
+			}
+		}
+		return hops
+	}
+
+	for _, val := range hdr.Values("X-Forwarded-For") {
+		for _, elem := range strings.Split(val, ",") {
+			var hop netip.AddrPort
+			if addr, err := netip.ParseAddr(strings.TrimSpace(elem)); err == nil {
+				hop = netip.AddrPortFrom(addr, 0)
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// parseForwardedNode parses the node of a `for` parameter of the `Forwarded` header, i.e., an IPv4 address or an IPv6
+// address in brackets, optionally followed by a port. Unknown and obfuscated identifiers (e.g., `unknown` or `_hidden`)
+// yield an invalid address; obfuscated ports yield a port of zero.
+func parseForwardedNode(node string) netip.AddrPort {
+	host, port := node, ""
+	if strings.HasPrefix(node, "[") {
+		end := strings.IndexByte(node, ']')
+		if end < 0 {
+			return netip.AddrPort{}
+		}
+		host, port = node[1:end], node[end+1:]
+		if port != "" && !strings.HasPrefix(port, ":") {
+			return netip.AddrPort{}
+		}
+		port = strings.TrimPrefix(port, ":")
+	} else if i := strings.IndexByte(node, ':'); i >= 0 {
+		host, port = node[:i], node[i+1:]
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || addr.Zone() != "" {
+		return netip.AddrPort{}
+	}
+	n, _ := strconv.ParseUint(port, 10, 16)
+	return netip.AddrPortFrom(addr, uint16(n))
+}
+
+// splitQuoted splits s at every occurrence of sep outside of quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	start, quoted := 0, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unquote returns the value of a quoted string, or s if it is not quoted.
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	var b strings.Builder
+	for i := 1; i < len(s)-1; i++ {
+		if s[i] == '\\' && i+1 < len(s)-1 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// withClientAddr returns a shallow copy of req whose remote address is that of the client that originated it, as
+// determined via the forwarding headers set by trusted proxies.
+func withClientAddr(req *http.Request, proxies trustedProxies) *http.Request {
+	addr := proxies.clientAddr(req)
+	if addr == req.RemoteAddr {
+		return req
+	}
+	clientReq := new(http.Request)
+	*clientReq = *req
+	clientReq.RemoteAddr = addr
+	return clientReq
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+)
+
+func TestClientAddr(t *testing.T) {
+	proxies := trustedProxies{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("fd00::/8")}
+
+	cases := map[string]struct {
+		remoteAddr    string
+		forwarded     []string
+		xForwardedFor []string
+		expected      string
+	}{
+		"untrusted remote address": {
+			remoteAddr:    "192.0.2.1:1234",
+			xForwardedFor: []string{"198.51.100.1"},
+			expected:      "192.0.2.1:1234",
+		},
+		"trusted proxy without header": {
+			remoteAddr: "10.0.0.1:1234",
+			expected:   "10.0.0.1:1234",
+		},
+		"trusted proxy": {
+			remoteAddr:    "10.0.0.1:1234",
+			xForwardedFor: []string{"198.51.100.1"},
+			expected:      "198.51.100.1:0",
+		},
+		"chain of trusted proxies": {
+			remoteAddr:    "10.0.0.1:1234",
+			xForwardedFor: []string{"198.51.100.1, 10.0.0.3", "10.0.0.2"},
+			expected:      "198.51.100.1:0",
+		},
+		"spoofed address": {
+			remoteAddr:    "10.0.0.1:1234",
+			xForwardedFor: []string{"203.0.113.1, 198.51.100.1"},
+			expected:      "198.51.100.1:0",
+		},
+		"spoofed address of trusted proxy": {
+			remoteAddr:    "10.0.0.1:1234",
+			xForwardedFor: []string{"10.0.0.2, 198.51.100.1"},
+			expected:      "198.51.100.1:0",
+		},
+		"only trusted proxies": {
+			remoteAddr:    "10.0.0.1:1234",
+			xForwardedFor: []string{"10.0.0.3, 10.0.0.2"},
+			expected:      "10.0.0.3:0",
+		},
+		"malformed hop": {
+			remoteAddr:    "10.0.0.1:1234",
+			xForwardedFor: []string{"198.51.100.1, garbage, 10.0.0.2"},
+			expected:      "10.0.0.2:0",
+		},
+		"IPv6": {
+			remoteAddr:    "[fd00::1]:1234",
+			xForwardedFor: []string{"2001:db8::1"},
+			expected:      "[2001:db8::1]:0",
+		},
+		"IPv4-mapped IPv6 proxy": {
+			remoteAddr:    "[::ffff:10.0.0.1]:1234",
+			xForwardedFor: []string{"198.51.100.1"},
+			expected:      "198.51.100.1:0",
+		},
+		"Forwarded": {
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"for=198.51.100.1;proto=https;by=10.0.0.1"},
+			expected:   "198.51.100.1:0",
+		},
+		"Forwarded with port": {
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{`for="198.51.100.1:4711"`},
+			expected:   "198.51.100.1:4711",
+		},
+		"Forwarded IPv6": {
+			remoteAddr: "[fd00::1]:1234",
+			forwarded:  []string{`For="[2001:db8:cafe::17]:4711"`},
+			expected:   "[2001:db8:cafe::17]:4711",
+		},
+		"Forwarded IPv6 without port": {
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{`for="[2001:db8:cafe::17]"`},
+			expected:   "[2001:db8:cafe::17]:0",
+		},
+		"Forwarded chain of trusted proxies": {
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{`for=203.0.113.1, for="198.51.100.1";host="a,b", for=10.0.0.3`, "for=10.0.0.2"},
+			expected:   "198.51.100.1:0",
+		},
+		"Forwarded obfuscated identifier": {
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"for=198.51.100.1, for=_hidden, for=10.0.0.2"},
+			expected:   "10.0.0.2:0",
+		},
+		"Forwarded unknown identifier": {
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"for=unknown"},
+			expected:   "10.0.0.1:1234",
+		},
+		"Forwarded obfuscated port": {
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{`for="198.51.100.1:_port"`},
+			expected:   "198.51.100.1:0",
+		},
+		"Forwarded without for": {
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"for=198.51.100.1, proto=https"},
+			expected:   "10.0.0.1:1234",
+		},
+		"Forwarded unbracketed IPv6": {
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{`for="2001:db8::1"`},
+			expected:   "10.0.0.1:1234",
+		},
+		"Forwarded preferred over X-Forwarded-For": {
+			remoteAddr:    "10.0.0.1:1234",
+			forwarded:     []string{"for=198.51.100.1"},
+			xForwardedFor: []string{"203.0.113.1"},
+			expected:      "198.51.100.1:0",
+		},
+		"Forwarded from untrusted remote address": {
+			remoteAddr: "192.0.2.1:1234",
+			forwarded:  []string{"for=198.51.100.1"},
+			expected:   "192.0.2.1:1234",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.RemoteAddr = c.remoteAddr
+			for _, val := range c.forwarded {
+				req.Header.Add("Forwarded", val)
+			}
+			for _, val := range c.xForwardedFor {
+				req.Header.Add("X-Forwarded-For", val)
+			}
+			assert.Equal(t, c.expected, proxies.clientAddr(req))
+		})
+	}
+}
+
+// peerRecordingHealthServer records the address of the peer of every health check.
+type peerRecordingHealthServer struct {
+	healthpb.UnimplementedHealthServer
+	addrs []string
+}
+
+func (s *peerRecordingHealthServer) Check(ctx context.Context, _ *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if p, ok := peer.FromContext(ctx); ok {
+		s.addrs = append(s.addrs, p.Addr.String())
+	}
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+func TestWithTrustedProxies(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	healthSrv := &peerRecordingHealthServer{}
+	grpcSrv := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcSrv, healthSrv)
+	defer grpcSrv.Stop()
+
+	call := func(handler http.Handler) {
+		// The remote address of test requests is 192.0.2.1:1234.
+		req := newGRPCWebRequest(ctx, healthCheckPath)
+		req.Header.Set("X-Forwarded-For", "198.51.100.1")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	call(CreateDowngradingHandler(grpcSrv, http.NotFoundHandler()))
+	call(CreateDowngradingHandler(grpcSrv, http.NotFoundHandler(), WithTrustedProxies(netip.MustParsePrefix("203.0.113.0/24"))))
+	call(CreateDowngradingHandler(grpcSrv, http.NotFoundHandler(), WithTrustedProxies(netip.MustParsePrefix("192.0.2.0/24"))))
+
+	// The header is only honored for requests from trusted proxies.
+	assert.Equal(t, []string{"192.0.2.1:1234", "192.0.2.1:1234", "198.51.100.1:0"}, healthSrv.addrs)
+}
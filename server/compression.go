@@ -0,0 +1,230 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"golang.stackrox.io/grpc-http1/internal/sliceutils"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+)
+
+const (
+	grpcEncodingHeader       = "Grpc-Encoding"
+	grpcAcceptEncodingHeader = "Grpc-Accept-Encoding"
+)
+
+// acceptedEncodings returns the message encodings the client of the given request accepts for the response. If the
+// client does not advertise any, the request header is set to only accept the identity encoding, such that the gRPC
+// server does not choose a compression for the response on its own.
+func acceptedEncodings(req *http.Request) []string {
+	var encodings []string
+	for _, v := range req.Header.Values(grpcAcceptEncodingHeader) {
+		for _, enc := range strings.Split(v, ",") {
+			if enc = strings.TrimSpace(enc); enc != "" {
+				encodings = append(encodings, enc)
+			}
+		}
+	}
+	if len(encodings) > 0 {
+		// The client advertised what it accepts (e.g., only identity, as is common for gRPC-Web clients), even if it
+		// compresses its request messages.
+		return encodings
+	}
+	req.Header.Set(grpcAcceptEncodingHeader, "identity")
+	// A client that compresses its request messages certainly can decompress response messages in the same way.
+	if enc := req.Header.Get(grpcEncodingHeader); enc != "" {
+		encodings = append(encodings, enc)
+	}
+	return encodings
+}
+
+// decompressingResponseWriter is a response writer that decompresses the gRPC message frames written by the gRPC
+// server if the response uses a message encoding the client does not accept (e.g., because the server was configured
+// to always compress responses).
+type decompressingResponseWriter struct {
+	http.ResponseWriter
+
+	acceptedEncodings []string
+
+	headersPrepared bool
+	encoding        string
+	// decompress is non-nil if messages need to be decompressed.
+	decompress func(io.Reader) (io.Reader, error)
+	err        error
+	logger     Logger
+
+	// State of the frame currently being written.
+	frameHdr      []byte
+	compressed    bool
+	remaining     uint32
+	compressedBuf bytes.Buffer
+}
+
+func newDecompressingResponseWriter(w http.ResponseWriter, acceptedEncodings []string, logger Logger) *decompressingResponseWriter {
+	return &decompressingResponseWriter{
+		ResponseWriter:    w,
+		acceptedEncodings: acceptedEncodings,
+		logger:            logger,
+		frameHdr:          make([]byte, 0, grpcproto.MessageHeaderLength),
+	}
+}
+
+// prepareHeaders is called on any action that might cause headers to be sent, and determines whether messages need to
+// be decompressed.
+func (w *decompressingResponseWriter) prepareHeaders() {
+	if w.headersPrepared {
+		return
+	}
+	w.headersPrepared = true
+
+	hdr := w.Header()
+	w.encoding = hdr.Get(grpcEncodingHeader)
+	if w.encoding == "" || w.encoding == "identity" || sliceutils.Find(w.acceptedEncodings, w.encoding) != -1 {
+		return
+	}
+	w.decompress = decompressorFor(w.encoding)
+	if w.decompress == nil {
+		w.logger.Warnf("Client does not accept response message encoding %q, and it is unknown to this server", w.encoding)
+		return
+	}
+	hdr.Del(grpcEncodingHeader)
+}
+
+// decompressorFor returns a function that decompresses messages using the given encoding, or nil if the encoding is
+// unknown. Compressors registered with gRPC are used, falling back to the standard library for gzip.
+func decompressorFor(enc string) func(io.Reader) (io.Reader, error) {
+	if compressor := encoding.GetCompressor(enc); compressor != nil {
+		return compressor.Decompress
+	}
+	if enc == "gzip" {
+		return func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		}
+	}
+	return nil
+}
+
+func (w *decompressingResponseWriter) WriteHeader(statusCode int) {
+	w.prepareHeaders()
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *decompressingResponseWriter) Flush() {
+	w.prepareHeaders()
+	if flusher, _ := w.ResponseWriter.(http.Flusher); flusher != nil {
+		flusher.Flush()
+	}
+}
+
+func (w *decompressingResponseWriter) Write(buf []byte) (int, error) {
+	w.prepareHeaders()
+	if w.decompress == nil {
+		return w.ResponseWriter.Write(buf)
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	n := len(buf)
+	for len(buf) > 0 {
+		if w.remaining == 0 && len(w.frameHdr) < grpcproto.MessageHeaderLength {
+			k := copy(w.frameHdr[len(w.frameHdr):grpcproto.MessageHeaderLength], buf)
+			w.frameHdr, buf = w.frameHdr[:len(w.frameHdr)+k], buf[k:]
+			if len(w.frameHdr) < grpcproto.MessageHeaderLength {
+				break
+			}
+			flags, length, err := grpcproto.ParseMessageHeader(w.frameHdr)
+			if err != nil {
+				return 0, w.fail(err)
+			}
+			w.compressed, w.remaining = flags&grpcproto.CompressedFlags != 0, length
+			if !w.compressed {
+				if _, err := w.ResponseWriter.Write(w.frameHdr); err != nil {
+					return 0, err
+				}
+			}
+			if length == 0 {
+				if err := w.finishFrame(); err != nil {
+					return 0, err
+				}
+			}
+			continue
+		}
+
+		chunk := buf
+		if uint32(len(chunk)) > w.remaining {
+			chunk = chunk[:w.remaining]
+		}
+		buf = buf[len(chunk):]
+		w.remaining -= uint32(len(chunk))
+		if w.compressed {
+			w.compressedBuf.Write(chunk)
+		} else if _, err := w.ResponseWriter.Write(chunk); err != nil {
+			return 0, err
+		}
+		if w.remaining == 0 {
+			if err := w.finishFrame(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// finishFrame writes the decompressed message of a completely received compressed frame, and resets the frame state.
+func (w *decompressingResponseWriter) finishFrame() error {
+	defer func() {
+		w.frameHdr = w.frameHdr[:0]
+		w.compressedBuf.Reset()
+	}()
+	if !w.compressed {
+		return nil
+	}
+
+	var msg []byte
+	if w.compressedBuf.Len() > 0 {
+		r, err := w.decompress(&w.compressedBuf)
+		if err != nil {
+			return w.fail(err)
+		}
+		if msg, err = io.ReadAll(r); err != nil {
+			return w.fail(err)
+		}
+	}
+	return grpcproto.WriteMessage(w.ResponseWriter, 0, msg)
+}
+
+func (w *decompressingResponseWriter) fail(err error) error {
+	w.err = fmt.Errorf("decompressing %s-encoded response message: %w", w.encoding, err)
+	return w.err
+}
+
+// reportError sets the status of the response to `Internal` if decompressing a message failed, as the response is
+// truncated in that case. This relies on trailers not having been sent yet, which is the case for downgraded responses.
+func (w *decompressingResponseWriter) reportError() {
+	if w.err == nil {
+		return
+	}
+	w.logger.Warnf("Error sending downgraded gRPC response: %v", w.err)
+	setTrailerStatus(w.Header(), codes.Internal, w.err.Error())
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"google.golang.org/grpc"
+	_ "google.golang.org/grpc/encoding/gzip" // Register the gzip compressor.
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestDowngradedResponseIsDecompressed(t *testing.T) {
+	// Configure the server to compress all responses, regardless of what the client accepts. The deprecated option is
+	// the only way to make the server do so.
+	grpcSrv := grpc.NewServer(grpc.RPCCompressor(grpc.NewGZIPCompressor()))
+	healthpb.RegisterHealthServer(grpcSrv, health.NewServer())
+	t.Cleanup(grpcSrv.Stop)
+	handler := CreateDowngradingHandler(grpcSrv, http.NotFoundHandler())
+
+	cases := map[string]struct {
+		acceptEncoding   string
+		expectCompressed bool
+	}{
+		"no accepted encodings": {},
+		"gzip not accepted": {
+			acceptEncoding: "identity, deflate",
+		},
+		"gzip accepted": {
+			acceptEncoding:   "identity,gzip",
+			expectCompressed: true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			req := newGRPCWebRequest(context.Background(), healthCheckPath)
+			if c.acceptEncoding != "" {
+				req.Header.Set("Grpc-Accept-Encoding", c.acceptEncoding)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			data, trailers := readGRPCWebResponse(t, rec.Body)
+			assert.Equal(t, "0", trailers.Get("Grpc-Status"))
+			require.GreaterOrEqual(t, len(data), grpcproto.MessageHeaderLength)
+			flags, length, err := grpcproto.ParseMessageHeader(data[:grpcproto.MessageHeaderLength])
+			require.NoError(t, err)
+			msg := data[grpcproto.MessageHeaderLength:]
+			require.Len(t, msg, int(length))
+
+			if c.expectCompressed {
+				assert.Equal(t, grpcproto.CompressedFlags, flags)
+				assert.Equal(t, "gzip", rec.Header().Get("Grpc-Encoding"))
+				gzipReader, err := gzip.NewReader(bytes.NewReader(msg))
+				require.NoError(t, err)
+				var decompressed bytes.Buffer
+				_, err = decompressed.ReadFrom(gzipReader)
+				require.NoError(t, err)
+				msg = decompressed.Bytes()
+			} else {
+				assert.Zero(t, flags)
+				assert.Empty(t, rec.Header().Get("Grpc-Encoding"))
+			}
+
+			var resp healthpb.HealthCheckResponse
+			require.NoError(t, proto.Unmarshal(msg, &resp))
+			assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+		})
+	}
+}
+
+func TestCompressedRequestWithIdentityAccepted(t *testing.T) {
+	// With the gzip compressor registered, the gRPC server compresses responses the same way as the request.
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler())
+
+	reqMsg, err := proto.Marshal(&healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	_, err = gzipWriter.Write(reqMsg)
+	require.NoError(t, err)
+	require.NoError(t, gzipWriter.Close())
+
+	for name, acceptEncoding := range map[string]string{"no accepted encodings": "", "identity accepted": "identity"} {
+		t.Run(name, func(t *testing.T) {
+			body := append(grpcproto.MakeMessageHeader(grpcproto.CompressedFlags, uint32(compressed.Len())), compressed.Bytes()...)
+			req := newGRPCWebRequest(context.Background(), healthCheckPath)
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			req.Header.Set("Grpc-Encoding", "gzip")
+			if acceptEncoding != "" {
+				req.Header.Set("Grpc-Accept-Encoding", acceptEncoding)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			data, trailers := readGRPCWebResponse(t, rec.Body)
+			assert.Equal(t, "0", trailers.Get("Grpc-Status"))
+			require.GreaterOrEqual(t, len(data), grpcproto.MessageHeaderLength)
+			flags, _, err := grpcproto.ParseMessageHeader(data[:grpcproto.MessageHeaderLength])
+			require.NoError(t, err)
+			if acceptEncoding == "" {
+				// The client is assumed to accept the encoding of its request.
+				assert.Equal(t, grpcproto.CompressedFlags, flags)
+				assert.Equal(t, "gzip", rec.Header().Get("Grpc-Encoding"))
+			} else {
+				assert.Zero(t, flags)
+				assert.Empty(t, rec.Header().Get("Grpc-Encoding"))
+			}
+		})
+	}
+}
+
+func TestDecompressingResponseWriter_SplitWrites(t *testing.T) {
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	_, err := gzipWriter.Write([]byte("hello world"))
+	require.NoError(t, err)
+	require.NoError(t, gzipWriter.Close())
+
+	var frames []byte
+	frames = append(frames, grpcproto.MakeMessageHeader(grpcproto.CompressedFlags, uint32(compressed.Len()))...)
+	frames = append(frames, compressed.Bytes()...)
+	frames = append(frames, grpcproto.MakeMessageHeader(0, 3)...)
+	frames = append(frames, "foo"...)
+	frames = append(frames, grpcproto.MakeMessageHeader(grpcproto.CompressedFlags, 0)...)
+
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Grpc-Encoding", "gzip")
+	w := newDecompressingResponseWriter(rec, nil, nopLogger{})
+	for _, b := range frames {
+		n, err := w.Write([]byte{b})
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+	}
+
+	var expected []byte
+	expected = append(expected, grpcproto.MakeMessageHeader(0, 11)...)
+	expected = append(expected, "hello world"...)
+	expected = append(expected, grpcproto.MakeMessageHeader(0, 3)...)
+	expected = append(expected, "foo"...)
+	expected = append(expected, grpcproto.MakeMessageHeader(0, 0)...)
+	assert.Equal(t, expected, rec.Body.Bytes())
+	assert.Empty(t, rec.Header().Get("Grpc-Encoding"))
+}
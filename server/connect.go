@@ -0,0 +1,362 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"golang.stackrox.io/grpc-http1/internal/httputils"
+	"golang.stackrox.io/grpc-http1/internal/stringutils"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	connectTimeoutHeader = "Connect-Timeout-Ms"
+	// connectTrailerPrefix is the prefix of headers carrying trailers in Connect unary responses.
+	connectTrailerPrefix = "Trailer-"
+)
+
+var (
+	// connectCodeNames maps gRPC status codes to the names used in Connect error envelopes.
+	connectCodeNames = map[codes.Code]string{
+		codes.Canceled:           "canceled",
+		codes.Unknown:            "unknown",
+		codes.InvalidArgument:    "invalid_argument",
+		codes.DeadlineExceeded:   "deadline_exceeded",
+		codes.NotFound:           "not_found",
+		codes.AlreadyExists:      "already_exists",
+		codes.PermissionDenied:   "permission_denied",
+		codes.ResourceExhausted:  "resource_exhausted",
+		codes.FailedPrecondition: "failed_precondition",
+		codes.Aborted:            "aborted",
+		codes.OutOfRange:         "out_of_range",
+		codes.Unimplemented:      "unimplemented",
+		codes.Internal:           "internal",
+		codes.Unavailable:        "unavailable",
+		codes.DataLoss:           "data_loss",
+		codes.Unauthenticated:    "unauthenticated",
+	}
+
+	// connectHTTPStatuses maps gRPC status codes to the HTTP status codes of Connect error responses.
+	connectHTTPStatuses = map[codes.Code]int{
+		codes.Canceled:           499,
+		codes.Unknown:            http.StatusInternalServerError,
+		codes.InvalidArgument:    http.StatusBadRequest,
+		codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+		codes.NotFound:           http.StatusNotFound,
+		codes.AlreadyExists:      http.StatusConflict,
+		codes.PermissionDenied:   http.StatusForbidden,
+		codes.ResourceExhausted:  http.StatusTooManyRequests,
+		codes.FailedPrecondition: http.StatusBadRequest,
+		codes.Aborted:            http.StatusConflict,
+		codes.OutOfRange:         http.StatusBadRequest,
+		codes.Unimplemented:      http.StatusNotImplemented,
+		codes.Internal:           http.StatusInternalServerError,
+		codes.Unavailable:        http.StatusServiceUnavailable,
+		codes.DataLoss:           http.StatusInternalServerError,
+		codes.Unauthenticated:    http.StatusUnauthorized,
+	}
+
+	// connectProtocolHeaders are request headers that are specific to the Connect protocol, and hence not passed on
+	// as metadata.
+	connectProtocolHeaders = []string{"Connect-Protocol-Version", connectTimeoutHeader, "Content-Encoding", "Accept-Encoding", "Content-Length"}
+)
+
+// connectCodec returns the codec of a Connect unary request, if the request is one.
+func connectCodec(req *http.Request) (string, bool) {
+	if req.Method != http.MethodPost {
+		return "", false
+	}
+	contentType, _ := stringutils.Split2(req.Header.Get("Content-Type"), ";")
+	switch strings.TrimSpace(contentType) {
+	case "application/proto":
+		return "proto", true
+	case "application/json":
+		return "json", true
+	default:
+		return "", false
+	}
+}
+
+// connectError is the JSON envelope of an error in a Connect unary response.
+type connectError struct {
+	Code    string                `json:"code"`
+	Message string                `json:"message,omitempty"`
+	Details []connectErrorDetails `json:"details,omitempty"`
+}
+
+type connectErrorDetails struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// handleConnectUnary handles a Connect unary request by bridging it to the gRPC server.
+func handleConnectUnary(w http.ResponseWriter, req *http.Request, codec string, grpcSrv *grpc.Server, srvOpts *options, rec *statsRecorder) {
+	if codec != "proto" && encoding.GetCodec(codec) == nil {
+		// The gRPC server would silently fall back to the proto codec.
+		writeConnectError(w, srvOpts.logger, nil, codes.Unimplemented, fmt.Sprintf("no gRPC codec registered for %q", codec))
+		return
+	}
+
+	msg, err := io.ReadAll(io.LimitReader(req.Body, int64(srvOpts.maxFrameSize)+1))
+	if err != nil {
+		writeConnectError(w, srvOpts.logger, nil, codes.Canceled, fmt.Sprintf("reading request: %v", err))
+		return
+	}
+	if uint32(len(msg)) > srvOpts.maxFrameSize {
+		writeConnectError(w, srvOpts.logger, nil, codes.ResourceExhausted, fmt.Sprintf("request message exceeds the maximum size of %d bytes", srvOpts.maxFrameSize))
+		return
+	}
+
+	var flags grpcproto.MessageFlags
+	hdr := req.Header
+	if contentEncoding := hdr.Get("Content-Encoding"); contentEncoding != "" && contentEncoding != "identity" {
+		hdr.Set("Grpc-Encoding", contentEncoding)
+		flags |= grpcproto.CompressedFlags
+	}
+	if timeoutMs, err := strconv.ParseUint(hdr.Get(connectTimeoutHeader), 10, 64); err == nil {
+		hdr.Set(grpcproto.TimeoutHeader, connectTimeoutToGRPC(timeoutMs))
+	}
+	for _, k := range connectProtocolHeaders {
+		hdr.Del(k)
+	}
+	restoreMetadataHeaders(hdr)
+	contentType := "application/grpc"
+	if codec != "proto" {
+		contentType += "+" + codec
+	}
+	hdr.Set("Content-Type", contentType)
+	hdr.Set("TE", "trailers")
+
+	req.ProtoMajor, req.ProtoMinor, req.Proto = 2, 0, "HTTP/2.0"
+	req.Body = io.NopCloser(io.MultiReader(bytes.NewReader(grpcproto.MakeMessageHeader(flags, uint32(len(msg)))), bytes.NewReader(msg)))
+	req.ContentLength = -1
+
+	req, cancel := withGRPCDeadline(req, srvOpts.logger)
+	defer cancel()
+
+	grpcResp := newConnectResponseWriter()
+	rec.serve(grpcResp, req, func(w http.ResponseWriter, req *http.Request) {
+		serveWithRecovery(grpcSrv, w, req, srvOpts.logger)
+		reportDeadlineExceeded(w, req)
+	})
+	grpcResp.finish(w, codec, srvOpts.logger)
+}
+
+// connectTimeoutToGRPC converts the value of a Connect timeout header to a grpc-timeout header value, which allows
+// for at most 8 digits.
+func connectTimeoutToGRPC(timeoutMs uint64) string {
+	if timeoutMs < 1e8 {
+		return fmt.Sprintf("%dm", timeoutMs)
+	}
+	return fmt.Sprintf("%dS", timeoutMs/1000)
+}
+
+// connectResponseWriter buffers the response of the gRPC server to a unary request, for converting it to a Connect
+// response once it is complete.
+type connectResponseWriter struct {
+	hdr        http.Header
+	statusCode int
+	body       bytes.Buffer
+
+	// sentHeaders is a snapshot of the headers at the time they would have been sent, nil if they were not yet.
+	sentHeaders http.Header
+}
+
+func newConnectResponseWriter() *connectResponseWriter {
+	return &connectResponseWriter{
+		hdr: make(http.Header),
+	}
+}
+
+func (w *connectResponseWriter) Header() http.Header {
+	return w.hdr
+}
+
+func (w *connectResponseWriter) WriteHeader(statusCode int) {
+	if w.sentHeaders != nil {
+		return
+	}
+	w.statusCode = statusCode
+	w.sentHeaders = w.hdr.Clone()
+}
+
+func (w *connectResponseWriter) Write(buf []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(buf)
+}
+
+// Flush marks the headers as sent. Nothing is actually sent, as the response is only sent once it is complete.
+func (w *connectResponseWriter) Flush() {
+	w.WriteHeader(http.StatusOK)
+}
+
+// headersAndTrailers returns the headers and trailers of the buffered gRPC response.
+func (w *connectResponseWriter) headersAndTrailers() (http.Header, http.Header) {
+	hdr, trailers := w.sentHeaders, make(http.Header)
+	if hdr == nil {
+		// Trailers-only response.
+		hdr = make(http.Header)
+		for k, vs := range w.hdr {
+			if !strings.HasPrefix(k, http.TrailerPrefix) {
+				trailers[k] = vs
+			}
+		}
+	}
+
+	for _, k := range hdr["Trailer"] {
+		k = http.CanonicalHeaderKey(k)
+		if vs, ok := w.hdr[k]; ok {
+			trailers[k] = vs
+		}
+	}
+	for k, vs := range w.hdr {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			k = http.CanonicalHeaderKey(strings.TrimPrefix(k, http.TrailerPrefix))
+			trailers[k] = append(trailers[k], vs...)
+		}
+	}
+	return hdr, trailers
+}
+
+// finish writes the buffered gRPC response as a Connect unary response.
+func (w *connectResponseWriter) finish(connectW http.ResponseWriter, codec string, logger Logger) {
+	hdr, trailers := w.headersAndTrailers()
+
+	code, msg := codes.Unknown, "no gRPC status received"
+	statusStr := trailers.Get("Grpc-Status")
+	if statusStr == "" {
+		statusStr = hdr.Get("Grpc-Status")
+	}
+	if statusStr != "" {
+		if c, err := strconv.ParseUint(statusStr, 10, 32); err == nil {
+			code, msg = codes.Code(c), grpcproto.DecodeGrpcMessage(trailers.Get("Grpc-Message"))
+		}
+	} else if w.statusCode != 0 && w.statusCode != http.StatusOK {
+		// Request was rejected by the gRPC server before it reached the service method.
+		code, msg = httputils.GRPCCodeFromHTTPStatus(w.statusCode), strings.TrimSpace(w.body.String())
+	}
+
+	if code != codes.OK {
+		copyConnectMetadata(connectW.Header(), hdr, trailers)
+		writeConnectError(connectW, logger, decodeStatusDetails(trailers.Get("Grpc-Status-Details-Bin"), logger), code, msg)
+		return
+	}
+
+	frame := w.body.Bytes()
+	if len(frame) < grpcproto.MessageHeaderLength {
+		writeConnectError(connectW, logger, nil, codes.Internal, "no response message received")
+		return
+	}
+	flags, length, err := grpcproto.ParseMessageHeader(frame[:grpcproto.MessageHeaderLength])
+	if err != nil || int(length) != len(frame)-grpcproto.MessageHeaderLength {
+		writeConnectError(connectW, logger, nil, codes.Internal, "malformed response message received")
+		return
+	}
+
+	respHdr := connectW.Header()
+	copyConnectMetadata(respHdr, hdr, trailers)
+	respHdr.Set("Content-Type", "application/"+codec)
+	if flags&grpcproto.CompressedFlags != 0 {
+		respHdr.Set("Content-Encoding", hdr.Get("Grpc-Encoding"))
+	}
+	respHdr.Set("Content-Length", strconv.Itoa(int(length)))
+	connectW.WriteHeader(http.StatusOK)
+	if _, err := connectW.Write(frame[grpcproto.MessageHeaderLength:]); err != nil {
+		logger.Debugf("Error writing Connect response: %v", err)
+	}
+}
+
+// copyConnectMetadata copies the metadata of a gRPC response to the headers of a Connect unary response.
+func copyConnectMetadata(dst, hdr, trailers http.Header) {
+	isMetadata := func(k string) bool {
+		return !strings.HasPrefix(k, "Grpc-") && !strings.HasPrefix(k, http.TrailerPrefix) &&
+			k != "Content-Type" && k != "Content-Length" && k != "Trailer"
+	}
+	for k, vs := range hdr {
+		if isMetadata(k) {
+			dst[k] = append(dst[k], vs...)
+		}
+	}
+	for k, vs := range trailers {
+		if isMetadata(k) {
+			dst[connectTrailerPrefix+k] = append(dst[connectTrailerPrefix+k], vs...)
+		}
+	}
+}
+
+// decodeStatusDetails decodes the details of a gRPC status from the value of a grpc-status-details-bin header. Malformed
+// details are reported to the given logger and ignored.
+func decodeStatusDetails(detailsBin string, logger Logger) []connectErrorDetails {
+	if detailsBin == "" {
+		return nil
+	}
+	enc := base64.RawStdEncoding
+	if len(detailsBin)%4 == 0 {
+		enc = base64.StdEncoding
+	}
+	statusBytes, err := enc.DecodeString(detailsBin)
+	if err != nil {
+		logger.Debugf("Ignoring malformed gRPC status details: %v", err)
+		return nil
+	}
+	var st spb.Status
+	if err := proto.Unmarshal(statusBytes, &st); err != nil {
+		logger.Debugf("Ignoring malformed gRPC status details: %v", err)
+		return nil
+	}
+
+	details := make([]connectErrorDetails, 0, len(st.GetDetails()))
+	for _, detail := range st.GetDetails() {
+		typeURL := detail.GetTypeUrl()
+		details = append(details, connectErrorDetails{
+			Type:  typeURL[strings.LastIndex(typeURL, "/")+1:],
+			Value: base64.RawStdEncoding.EncodeToString(detail.GetValue()),
+		})
+	}
+	return details
+}
+
+// writeConnectError writes a Connect unary error response with the given status.
+func writeConnectError(w http.ResponseWriter, logger Logger, details []connectErrorDetails, code codes.Code, msg string) {
+	name, ok := connectCodeNames[code]
+	if !ok {
+		name, code = connectCodeNames[codes.Unknown], codes.Unknown
+	}
+	body, err := json.Marshal(connectError{Code: name, Message: msg, Details: details})
+	if err != nil {
+		body = []byte(`{"code":"internal"}`) // should not happen.
+	}
+
+	hdr := w.Header()
+	hdr.Set("Content-Type", "application/json")
+	hdr.Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(connectHTTPStatuses[code])
+	if _, err := w.Write(body); err != nil {
+		logger.Debugf("Error writing Connect error response: %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func newConnectRequest(path, contentType string, msg []byte) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(msg))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Connect-Protocol-Version", "1")
+	return req
+}
+
+func TestConnectUnary(t *testing.T) {
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithConnectProtocol())
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newConnectRequest(healthCheckPath, "application/proto", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/proto", rec.Header().Get("Content-Type"))
+
+	var resp healthpb.HealthCheckResponse
+	require.NoError(t, proto.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+}
+
+func TestConnectUnary_Error(t *testing.T) {
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithConnectProtocol())
+
+	reqMsg, err := proto.Marshal(&healthpb.HealthCheckRequest{Service: "unknown"})
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newConnectRequest(healthCheckPath, "application/proto", reqMsg))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"code":"not_found","message":"unknown service"}`, rec.Body.String())
+}
+
+// statusDetailsHealthServer fails every health check with an error carrying details and metadata.
+type statusDetailsHealthServer struct {
+	healthpb.UnimplementedHealthServer
+}
+
+func (statusDetailsHealthServer) Check(ctx context.Context, _ *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	_ = grpc.SetHeader(ctx, metadata.Pairs("x-header", "header value"))
+	_ = grpc.SetTrailer(ctx, metadata.Pairs("x-trailer", "trailer value"))
+	st, err := status.New(codes.Unavailable, "try again – later").WithDetails(durationpb.New(42))
+	if err != nil {
+		return nil, err
+	}
+	return nil, st.Err()
+}
+
+func TestConnectUnary_ErrorDetailsAndMetadata(t *testing.T) {
+	grpcSrv := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcSrv, statusDetailsHealthServer{})
+	t.Cleanup(grpcSrv.Stop)
+	handler := CreateDowngradingHandler(grpcSrv, http.NotFoundHandler(), WithConnectProtocol())
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newConnectRequest(healthCheckPath, "application/proto", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "header value", rec.Header().Get("X-Header"))
+	assert.Equal(t, "trailer value", rec.Header().Get("Trailer-X-Trailer"))
+
+	var connectErr connectError
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &connectErr))
+	assert.Equal(t, "unavailable", connectErr.Code)
+	assert.Equal(t, "try again – later", connectErr.Message)
+	require.Len(t, connectErr.Details, 1)
+	assert.Equal(t, "google.protobuf.Duration", connectErr.Details[0].Type)
+	expectedValue, err := proto.Marshal(durationpb.New(42))
+	require.NoError(t, err)
+	assert.Equal(t, base64.RawStdEncoding.EncodeToString(expectedValue), connectErr.Details[0].Value)
+}
+
+func TestConnectUnary_NoJSONCodec(t *testing.T) {
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithConnectProtocol())
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newConnectRequest(healthCheckPath, "application/json", []byte("{}")))
+	assert.Equal(t, http.StatusNotImplemented, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"code":"unimplemented"`)
+}
+
+func TestConnectUnary_NotEnabledOrNotUnary(t *testing.T) {
+	var fallbackCalls int
+	fallback := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fallbackCalls++
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	// Connect requests are passed on to the HTTP handler unless enabled.
+	rec := httptest.NewRecorder()
+	CreateDowngradingHandler(newHealthServer(t), fallback).ServeHTTP(rec, newConnectRequest(healthCheckPath, "application/proto", nil))
+	assert.Equal(t, http.StatusTeapot, rec.Code)
+
+	// Requests to paths other than unary gRPC methods are passed on as well.
+	handler := CreateDowngradingHandler(newHealthServer(t), fallback, WithConnectProtocol())
+	for _, path := range []string{healthWatchPath, "/api/v1/health"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newConnectRequest(path, "application/json", []byte("{}")))
+		assert.Equal(t, http.StatusTeapot, rec.Code)
+	}
+	assert.Equal(t, 3, fallbackCalls)
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.stackrox.io/grpc-http1/internal/sliceutils"
+)
+
+var (
+	corsAllowedHeaders = []string{"content-type", "x-grpc-web", "x-user-agent", "grpc-timeout"}
+	corsExposedHeaders = []string{"grpc-status", "grpc-message", "grpc-status-details-bin"}
+)
+
+// CORSConfig configures the handling of cross-origin requests from browser-based gRPC-Web clients.
+type CORSConfig struct {
+	// AllowedOrigins is the list of origins that may issue cross-origin requests. The special value "*" allows
+	// requests from any origin.
+	AllowedOrigins []string
+	// AllowedHeaders is a list of request headers that are allowed in addition to the headers required by the
+	// gRPC-Web protocol (e.g., custom metadata keys).
+	AllowedHeaders []string
+	// ExposedHeaders is a list of response headers that are exposed to the client in addition to the gRPC status
+	// headers.
+	ExposedHeaders []string
+	// AllowCredentials indicates whether requests may include credentials such as cookies.
+	AllowCredentials bool
+	// MaxAge specifies for how long the result of a preflight request may be cached. If zero, no caching
+	// duration is indicated.
+	MaxAge time.Duration
+}
+
+func (c *CORSConfig) isOriginAllowed(origin string) bool {
+	return sliceutils.Find(c.AllowedOrigins, "*") != -1 || sliceutils.Find(c.AllowedOrigins, origin) != -1
+}
+
+func (c *CORSConfig) setAllowOrigin(hdr http.Header, origin string) {
+	hdr.Add("Vary", "Origin")
+	if c.AllowCredentials || sliceutils.Find(c.AllowedOrigins, "*") == -1 {
+		hdr.Set("Access-Control-Allow-Origin", origin)
+	} else {
+		hdr.Set("Access-Control-Allow-Origin", "*")
+	}
+	if c.AllowCredentials {
+		hdr.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// handlePreflight answers a CORS preflight request.
+func (c *CORSConfig) handlePreflight(w http.ResponseWriter, req *http.Request) {
+	origin := req.Header.Get("Origin")
+	if !c.isOriginAllowed(origin) {
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	hdr := w.Header()
+	c.setAllowOrigin(hdr, origin)
+	hdr.Set("Access-Control-Allow-Methods", http.MethodPost)
+	hdr.Set("Access-Control-Allow-Headers", strings.Join(append(sliceutils.ShallowClone(corsAllowedHeaders), c.AllowedHeaders...), ", "))
+	if c.MaxAge > 0 {
+		hdr.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge/time.Second)))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// addResponseHeaders adds the CORS headers to the response to a cross-origin request, if the origin is allowed.
+func (c *CORSConfig) addResponseHeaders(w http.ResponseWriter, req *http.Request) {
+	origin := req.Header.Get("Origin")
+	if origin == "" || !c.isOriginAllowed(origin) {
+		return
+	}
+
+	hdr := w.Header()
+	c.setAllowOrigin(hdr, origin)
+	hdr.Set("Access-Control-Expose-Headers", strings.Join(append(sliceutils.ShallowClone(corsExposedHeaders), c.ExposedHeaders...), ", "))
+}
+
+func isCORSPreflight(req *http.Request) bool {
+	return req.Method == http.MethodOptions && req.Header.Get("Origin") != "" && req.Header.Get("Access-Control-Request-Method") != ""
+}
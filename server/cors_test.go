@@ -0,0 +1,94 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPreflightRequest(path, origin string) *http.Request {
+	req := httptest.NewRequest(http.MethodOptions, path, nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web")
+	return req
+}
+
+func TestCORSPreflight(t *testing.T) {
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithCORS(CORSConfig{
+		AllowedOrigins: []string{"https://example.com"},
+		AllowedHeaders: []string{"authorization"},
+		MaxAge:         10 * time.Minute,
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newPreflightRequest(healthCheckPath, "https://example.com"))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, http.MethodPost, w.Header().Get("Access-Control-Allow-Methods"))
+	for _, hdr := range []string{"content-type", "x-grpc-web", "grpc-timeout", "authorization"} {
+		assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), hdr)
+	}
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+
+	// Disallowed origin.
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, newPreflightRequest(healthCheckPath, "https://evil.com"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	// Preflight requests for non-gRPC paths are passed through to the HTTP handler.
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, newPreflightRequest("/index.html", "https://example.com"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestCORSPreflight_Disabled(t *testing.T) {
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newPreflightRequest(healthCheckPath, "https://example.com"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSResponseHeaders(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithCORS(CORSConfig{
+		AllowedOrigins: []string{"*"},
+	}))
+
+	req := newGRPCWebRequest(ctx, healthCheckPath)
+	req.Header.Set("Origin", "https://example.com")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, w.Header().Get("Access-Control-Expose-Headers"), "grpc-status")
+	assert.Contains(t, w.Header().Get("Access-Control-Expose-Headers"), "grpc-message")
+
+	_, trailers := readGRPCWebResponse(t, w.Body)
+	assert.Equal(t, "0", trailers.Get("Grpc-Status"))
+}
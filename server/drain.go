@@ -0,0 +1,98 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+const (
+	drainingMessage = "server draining"
+)
+
+// DowngradingHandler is an HTTP handler that serves gRPC requests, downgrading the responses to gRPC-Web or
+// gRPC-WebSocket if necessary, and passes all other requests on to a plain HTTP handler.
+type DowngradingHandler struct {
+	handler http.Handler
+	streams streamTracker
+}
+
+// ServeHTTP implements http.Handler.
+func (h *DowngradingHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.handler.ServeHTTP(w, req)
+}
+
+// Drain stops the handler from accepting new gRPC requests, which are instead rejected with an `Unavailable`
+// status, and blocks until all in-flight gRPC requests have completed or the given context expires. Requests
+// passed on to the plain HTTP handler are not affected. Since `(*grpc.Server).GracefulStop` does not know about
+// requests served through this handler, Drain should be called before stopping the gRPC server.
+func (h *DowngradingHandler) Drain(ctx context.Context) error {
+	select {
+	case <-h.streams.drain():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// streamTracker keeps track of in-flight gRPC requests.
+type streamTracker struct {
+	mutex     sync.Mutex
+	draining  bool
+	numActive int
+	// drainedC is closed once draining has started and no requests are in flight.
+	drainedC chan struct{}
+}
+
+// begin registers a new request. It returns false if the request must be rejected because of draining.
+func (t *streamTracker) begin() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.draining {
+		return false
+	}
+	t.numActive++
+	return true
+}
+
+// end unregisters a request previously registered via begin.
+func (t *streamTracker) end() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.numActive--
+	if t.draining && t.numActive == 0 {
+		close(t.drainedC)
+	}
+}
+
+// drain starts draining, if it has not been started yet, and returns a channel that is closed once all in-flight
+// requests have completed.
+func (t *streamTracker) drain() <-chan struct{} {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.draining {
+		t.draining = true
+		t.drainedC = make(chan struct{})
+		if t.numActive == 0 {
+			close(t.drainedC)
+		}
+	}
+	return t.drainedC
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func (t *streamTracker) numActiveStreams() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.numActive
+}
+
+func TestDrain(t *testing.T) {
+	handler := NewDowngradingHandler(newHealthServer(t), http.NotFoundHandler())
+
+	// Start a long-running server-streaming call.
+	watchCtx, cancelWatch := context.WithCancel(context.Background())
+	defer cancelWatch()
+	watchDoneC := make(chan struct{})
+	go func() {
+		defer close(watchDoneC)
+		handler.ServeHTTP(httptest.NewRecorder(), newGRPCWebRequest(watchCtx, "/grpc.health.v1.Health/Watch"))
+	}()
+	require.Eventually(t, func() bool {
+		return handler.streams.numActiveStreams() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Draining does not complete while the call is in flight.
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelDrain()
+	assert.ErrorIs(t, handler.Drain(drainCtx), context.DeadlineExceeded)
+
+	// New gRPC requests are rejected.
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newGRPCWebRequest(context.Background(), healthCheckPath))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/grpc-web", w.Header().Get("Content-Type"))
+	assert.Equal(t, fmt.Sprintf("%d", codes.Unavailable), w.Header().Get("Grpc-Status"))
+	assert.Equal(t, drainingMessage, w.Header().Get("Grpc-Message"))
+
+	// Plain HTTP requests are still served.
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Draining completes once the in-flight call has finished.
+	cancelWatch()
+	<-watchDoneC
+	drainCtx, cancelDrain = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelDrain()
+	assert.NoError(t, handler.Drain(drainCtx))
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"bytes"
+	"io"
+
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+)
+
+// endOfStreamReader is a request body consisting of gRPC frames that ends at an empty end-of-stream frame (see
+// grpcproto.EndStreamHeader). Some clients and gateways send such a frame after the last request message when
+// half-closing the stream, which the gRPC server would reject as it is not a data frame. Anything following the
+// end-of-stream frame is ignored. Reading fails once the frame limit, if any, is exceeded. Frames are read until EOF
+// or the end-of-stream frame, so the request's Content-Length is never consulted and chunked bodies work as well.
+type endOfStreamReader struct {
+	io.ReadCloser
+	limit *frameLimit
+
+	hdr       [grpcproto.MessageHeaderLength]byte
+	pending   []byte
+	remaining uint32
+	eos       bool
+}
+
+func newEndOfStreamReader(body io.ReadCloser, limit *frameLimit) io.ReadCloser {
+	return &endOfStreamReader{ReadCloser: body, limit: limit}
+}
+
+func (r *endOfStreamReader) Read(p []byte) (int, error) {
+	if r.eos {
+		return 0, io.EOF
+	}
+	if len(r.pending) == 0 && r.remaining == 0 {
+		if _, err := io.ReadFull(r.ReadCloser, r.hdr[:]); err != nil {
+			return 0, err
+		}
+		if bytes.Equal(r.hdr[:], grpcproto.EndStreamHeader) {
+			r.eos = true
+			return 0, io.EOF
+		}
+		if !r.limit.allowFrame() {
+			return 0, errFrameRateExceeded
+		}
+		_, length, err := grpcproto.ParseMessageHeader(r.hdr[:])
+		if err != nil {
+			return 0, err
+		}
+		r.pending, r.remaining = r.hdr[:], length
+	}
+
+	if len(r.pending) > 0 {
+		n := copy(p, r.pending)
+		r.pending = r.pending[n:]
+		return n, nil
+	}
+	if uint32(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.remaining -= uint32(n)
+	if err == io.EOF && r.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
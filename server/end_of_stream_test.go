@@ -0,0 +1,179 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func frame(flags grpcproto.MessageFlags, payload string) []byte {
+	return append(grpcproto.MakeMessageHeader(flags, uint32(len(payload))), payload...)
+}
+
+func TestEndOfStreamReader(t *testing.T) {
+	cases := map[string]struct {
+		body        [][]byte
+		expected    [][]byte
+		expectedErr error
+	}{
+		"no end-of-stream frame": {
+			body:     [][]byte{frame(0, "hello"), frame(0, "world")},
+			expected: [][]byte{frame(0, "hello"), frame(0, "world")},
+		},
+		"end-of-stream frame": {
+			body:     [][]byte{frame(0, "hello"), grpcproto.EndStreamHeader},
+			expected: [][]byte{frame(0, "hello")},
+		},
+		"empty messages are kept": {
+			body:     [][]byte{frame(0, ""), grpcproto.EndStreamHeader},
+			expected: [][]byte{frame(0, "")},
+		},
+		"data after end-of-stream frame is ignored": {
+			body:     [][]byte{frame(0, "hello"), grpcproto.EndStreamHeader, frame(0, "world")},
+			expected: [][]byte{frame(0, "hello")},
+		},
+		"truncated message": {
+			body:        [][]byte{frame(0, "hello")[:7]},
+			expected:    [][]byte{frame(0, "hello")[:7]},
+			expectedErr: io.ErrUnexpectedEOF,
+		},
+		"truncated header": {
+			body:        [][]byte{frame(0, "hello"), {0, 0}},
+			expected:    [][]byte{frame(0, "hello")},
+			expectedErr: io.ErrUnexpectedEOF,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			body := io.NopCloser(iotest.OneByteReader(bytes.NewReader(bytes.Join(c.body, nil))))
+			data, err := io.ReadAll(newEndOfStreamReader(body, nil))
+			assert.ErrorIs(t, err, c.expectedErr)
+			assert.Equal(t, bytes.Join(c.expected, nil), data)
+		})
+	}
+}
+
+func TestUnaryRequestWithEndOfStreamFrame(t *testing.T) {
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler())
+
+	msg, err := proto.Marshal(&healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	body := append(frame(0, string(msg)), grpcproto.EndStreamHeader...)
+	req := httptest.NewRequest(http.MethodPost, healthCheckPath, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/grpc-web")
+	req.Header.Set("Accept", "application/grpc-web")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req.WithContext(context.Background()))
+
+	data, trailers := readGRPCWebResponse(t, rec.Body)
+	assert.Equal(t, fmt.Sprintf("%d", codes.OK), trailers.Get("Grpc-Status"))
+	require.GreaterOrEqual(t, len(data), grpcproto.MessageHeaderLength)
+	var resp healthpb.HealthCheckResponse
+	require.NoError(t, proto.Unmarshal(data[grpcproto.MessageHeaderLength:], &resp))
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+}
+
+// countingService is a client-streaming service that counts the messages it receives.
+type countingService struct {
+	received int
+}
+
+func (s *countingService) count(_ interface{}, stream grpc.ServerStream) error {
+	for {
+		if err := stream.RecvMsg(&emptypb.Empty{}); err != nil {
+			if err == io.EOF {
+				return stream.SendMsg(&emptypb.Empty{})
+			}
+			return err
+		}
+		s.received++
+	}
+}
+
+func TestChunkedRequestBody(t *testing.T) {
+	svc := &countingService{}
+	grpcSrv := grpc.NewServer()
+	grpcSrv.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "test.Counter",
+		HandlerType: (*interface{})(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "Count",
+			Handler:       svc.count,
+			ClientStreams: true,
+		}},
+	}, svc)
+	t.Cleanup(grpcSrv.Stop)
+
+	var contentLength int64
+	var transferEncoding []string
+	handler := CreateDowngradingHandler(grpcSrv, http.NotFoundHandler())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		contentLength, transferEncoding = req.ContentLength, req.TransferEncoding
+		handler.ServeHTTP(w, req)
+	}))
+	defer srv.Close()
+
+	for name, endOfStream := range map[string]bool{"until EOF": false, "until end-of-stream frame": true} {
+		t.Run(name, func(t *testing.T) {
+			svc.received = 0
+
+			// Writing the body through a pipe leaves its length unknown, so it is sent chunked.
+			pr, pw := io.Pipe()
+			go func() {
+				for i := 0; i < 3; i++ {
+					if _, err := pw.Write(frame(0, "")); err != nil {
+						return
+					}
+				}
+				if endOfStream {
+					_, _ = pw.Write(grpcproto.EndStreamHeader)
+				}
+				_ = pw.Close()
+			}()
+
+			req, err := http.NewRequest(http.MethodPost, srv.URL+"/test.Counter/Count", pr)
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/grpc-web")
+			req.Header.Set("Accept", "application/grpc-web")
+
+			resp, err := srv.Client().Do(req)
+			require.NoError(t, err)
+			defer func() { _ = resp.Body.Close() }()
+
+			_, trailers := readGRPCWebResponse(t, resp.Body)
+			assert.Equal(t, fmt.Sprintf("%d", codes.OK), trailers.Get("Grpc-Status"))
+			assert.Equal(t, int64(-1), contentLength)
+			assert.Equal(t, []string{"chunked"}, transferEncoding)
+			assert.Equal(t, 3, svc.received)
+		})
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	frameRateExceededMessage = "frame rate limit exceeded"
+)
+
+var (
+	errFrameRateExceeded = errors.New(frameRateExceededMessage)
+)
+
+// frameRateLimiter limits the rate at which gRPC frames are read from each client connection, using a token bucket per
+// connection that is shared by all requests received over it, including subsequent requests over a keep-alive
+// connection. All methods are safe to call on a nil limiter, which does not impose a limit.
+type frameRateLimiter struct {
+	rate  float64
+	burst float64
+	// idleTTL is the time after which the bucket of a connection without requests is full again, and can hence be
+	// dropped.
+	idleTTL time.Duration
+
+	mutex     sync.Mutex
+	buckets   map[string]*frameBucket
+	lastSweep time.Time
+}
+
+// frameBucket is the token bucket of a single connection.
+type frameBucket struct {
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+
+	// refs is the number of requests using the bucket, and idleSince the time the last of them was released. Both are
+	// guarded by the mutex of the limiter.
+	refs      int
+	idleSince time.Time
+}
+
+func newFrameRateLimiter(framesPerSecond float64, burst int) *frameRateLimiter {
+	if framesPerSecond <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &frameRateLimiter{
+		rate:      framesPerSecond,
+		burst:     float64(burst),
+		idleTTL:   time.Duration(float64(burst) / framesPerSecond * float64(time.Second)),
+		buckets:   make(map[string]*frameBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// begin returns the frame limit for a request received over the connection with the given remote address, as well as
+// a function to call once the request has been handled. The address must be that of the connection rather than of the
+// client derived from headers set by proxies, which would let clients pick their own limit.
+func (l *frameRateLimiter) begin(connAddr string) (*frameLimit, func()) {
+	if l == nil {
+		return nil, func() {}
+	}
+	key := connAddr
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.sweep(time.Now())
+	bucket := l.buckets[key]
+	if bucket == nil {
+		bucket = &frameBucket{tokens: l.burst, last: time.Now()}
+		l.buckets[key] = bucket
+	}
+	bucket.refs++
+
+	release := func() {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		bucket.refs--
+		if bucket.refs == 0 {
+			bucket.idleSince = time.Now()
+		}
+	}
+	return &frameLimit{limiter: l, bucket: bucket}, release
+}
+
+// sweep drops the buckets of connections that have been without requests for long enough for their buckets to be full
+// again. Dropping them earlier would let clients reset their limit by sending requests one after the other. Buckets
+// are swept at most once per idleTTL. The mutex of the limiter must be held.
+func (l *frameRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.idleTTL {
+		return
+	}
+	l.lastSweep = now
+	for key, bucket := range l.buckets {
+		if bucket.refs == 0 && now.Sub(bucket.idleSince) >= l.idleTTL {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// take consumes a token from the bucket, and returns false if none is available.
+func (l *frameRateLimiter) take(bucket *frameBucket) bool {
+	bucket.mutex.Lock()
+	defer bucket.mutex.Unlock()
+
+	now := time.Now()
+	bucket.tokens += now.Sub(bucket.last).Seconds() * l.rate
+	if bucket.tokens > l.burst {
+		bucket.tokens = l.burst
+	}
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// frameLimit limits the rate at which gRPC frames are read for a single request. All methods are safe to call on a
+// nil limit, which does not impose a limit.
+type frameLimit struct {
+	limiter  *frameRateLimiter
+	bucket   *frameBucket
+	exceeded int32
+}
+
+// allowFrame returns whether another frame may be read, and records if the limit has been exceeded.
+func (l *frameLimit) allowFrame() bool {
+	if l == nil {
+		return true
+	}
+	if !l.limiter.take(l.bucket) {
+		atomic.StoreInt32(&l.exceeded, 1)
+		return false
+	}
+	return true
+}
+
+// reportExceeded sets the status of the response to `ResourceExhausted` if the limit has been exceeded. The gRPC
+// server would otherwise report the failure to read the request as an internal error. This relies on trailers not
+// having been sent yet.
+func (l *frameLimit) reportExceeded(w http.ResponseWriter) {
+	if l == nil || atomic.LoadInt32(&l.exceeded) == 0 {
+		return
+	}
+	setTrailerStatus(w.Header(), codes.ResourceExhausted, frameRateExceededMessage)
+}
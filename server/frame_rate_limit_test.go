@@ -0,0 +1,90 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameRateLimiter(t *testing.T) {
+	limiter := newFrameRateLimiter(10, 3)
+
+	limit, release := limiter.begin("10.0.0.1:1234")
+	defer release()
+	// Requests over the same connection share the limit.
+	sameConnLimit, sameConnRelease := limiter.begin("10.0.0.1:1234")
+	defer sameConnRelease()
+	otherConnLimit, otherConnRelease := limiter.begin("10.0.0.1:5678")
+	defer otherConnRelease()
+
+	assert.True(t, limit.allowFrame())
+	assert.True(t, sameConnLimit.allowFrame())
+	assert.True(t, limit.allowFrame())
+	assert.False(t, sameConnLimit.allowFrame())
+	assert.True(t, otherConnLimit.allowFrame())
+
+	// The bucket refills at the given rate.
+	time.Sleep(150 * time.Millisecond)
+	assert.True(t, limit.allowFrame())
+
+	rec := httptest.NewRecorder()
+	limit.reportExceeded(rec)
+	assert.Empty(t, rec.Header())
+	sameConnLimit.reportExceeded(rec)
+	assert.Equal(t, "8", rec.Header().Get("Trailer:Grpc-Status"))
+}
+
+func TestFrameRateLimiter_SequentialRequests(t *testing.T) {
+	limiter := newFrameRateLimiter(1, 2)
+
+	// Requests one after the other over a keep-alive connection share the limit.
+	for i := 0; i < 2; i++ {
+		limit, release := limiter.begin("10.0.0.1:1234")
+		assert.True(t, limit.allowFrame())
+		release()
+	}
+	limit, release := limiter.begin("10.0.0.1:1234")
+	defer release()
+	assert.False(t, limit.allowFrame())
+}
+
+func TestFrameRateLimiter_IdleBucketIsRemoved(t *testing.T) {
+	limiter := newFrameRateLimiter(10, 1)
+
+	_, release1 := limiter.begin("10.0.0.1:1234")
+	_, release2 := limiter.begin("10.0.0.1:1234")
+	release1()
+	release2()
+	assert.Len(t, limiter.buckets, 1)
+
+	// The bucket is only dropped once it would have been refilled.
+	time.Sleep(150 * time.Millisecond)
+	_, release3 := limiter.begin("10.0.0.1:5678")
+	defer release3()
+	assert.Len(t, limiter.buckets, 1)
+	assert.Contains(t, limiter.buckets, "10.0.0.1:5678")
+}
+
+func TestFrameRateLimiter_NoLimit(t *testing.T) {
+	limit, release := newFrameRateLimiter(0, 10).begin("10.0.0.1:1234")
+	defer release()
+	for i := 0; i < 100; i++ {
+		assert.True(t, limit.allowFrame())
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// bodyDoneReader is a request body that signals once it has been read to completion (or failed), or was closed.
+type bodyDoneReader struct {
+	io.ReadCloser
+
+	doneOnce sync.Once
+	done     chan struct{}
+}
+
+func (r *bodyDoneReader) signalDone() {
+	r.doneOnce.Do(func() { close(r.done) })
+}
+
+func (r *bodyDoneReader) Read(buf []byte) (int, error) {
+	n, err := r.ReadCloser.Read(buf)
+	if err != nil {
+		r.signalDone()
+	}
+	return n, err
+}
+
+func (r *bodyDoneReader) Close() error {
+	r.signalDone()
+	return r.ReadCloser.Close()
+}
+
+// halfDuplexResponseWriter is a response writer that holds back the response until the request body has been read
+// to completion.
+type halfDuplexResponseWriter struct {
+	http.ResponseWriter
+
+	ctx      context.Context
+	bodyDone <-chan struct{}
+}
+
+// makeHalfDuplex ensures that no part of the response to the given HTTP/1.x request is sent before the client has
+// half-closed the stream by finishing the (chunked) request body. Once the response headers are written, the HTTP/1.x
+// server of the standard library discards any unread part of the request body, hence responding early would cause
+// request messages of a client-streaming call to be lost.
+func makeHalfDuplex(w http.ResponseWriter, req *http.Request) http.ResponseWriter {
+	body := &bodyDoneReader{
+		ReadCloser: req.Body,
+		done:       make(chan struct{}),
+	}
+	req.Body = body
+	return &halfDuplexResponseWriter{
+		ResponseWriter: w,
+		ctx:            req.Context(),
+		bodyDone:       body.done,
+	}
+}
+
+func (w *halfDuplexResponseWriter) waitForBody() {
+	select {
+	case <-w.bodyDone:
+	case <-w.ctx.Done():
+	}
+}
+
+func (w *halfDuplexResponseWriter) WriteHeader(statusCode int) {
+	w.waitForBody()
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *halfDuplexResponseWriter) Write(buf []byte) (int, error) {
+	w.waitForBody()
+	return w.ResponseWriter.Write(buf)
+}
+
+func (w *halfDuplexResponseWriter) Flush() {
+	w.waitForBody()
+	if flusher, _ := w.ResponseWriter.(http.Flusher); flusher != nil {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"golang.stackrox.io/grpc-http1/internal/concurrency"
+	"google.golang.org/grpc/codes"
+)
+
+// idleStream aborts a tunneled stream once no frame has been exchanged for the configured idle timeout.
+type idleStream struct {
+	timer *concurrency.IdleTimer
+}
+
+// withStreamIdleTimeout returns a request whose context is canceled once neither has a frame been read from its body,
+// nor has one been written via a response writer wrapped by the returned idle stream for the given duration. The
+// returned idle stream is nil if the timeout is not positive.
+func withStreamIdleTimeout(req *http.Request, timeout time.Duration) (*http.Request, *idleStream) {
+	if timeout <= 0 {
+		return req, nil
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	s := &idleStream{timer: concurrency.NewIdleTimer(timeout, cancel)}
+	req = req.WithContext(ctx)
+	req.Body = &idleReader{ReadCloser: req.Body, timer: s.timer}
+	return req, s
+}
+
+// wrap returns a response writer that restarts the idle timer whenever a frame is written.
+func (s *idleStream) wrap(w http.ResponseWriter) http.ResponseWriter {
+	if s == nil {
+		return w
+	}
+	return &idleResponseWriter{ResponseWriter: w, timer: s.timer}
+}
+
+func (s *idleStream) stop() {
+	if s != nil {
+		s.timer.Stop()
+	}
+}
+
+// reportExpired sets the status of the response to `DeadlineExceeded` if the stream was aborted for being idle. The
+// gRPC server does not send a status for such a stream, as its request was canceled.
+func (s *idleStream) reportExpired(w http.ResponseWriter) {
+	if s == nil || !s.timer.Expired() {
+		return
+	}
+	hdr := w.Header()
+	okStatus := fmt.Sprintf("%d", codes.OK)
+	if hdr.Get("Grpc-Status") == okStatus || hdr.Get(http.TrailerPrefix+"Grpc-Status") == okStatus {
+		// The RPC completed just before the stream became idle.
+		return
+	}
+	if hdr.Get("Content-Type") == "" {
+		// Nothing was sent for the stream yet.
+		hdr.Set("Content-Type", "application/grpc")
+	}
+	setTrailerStatus(hdr, codes.DeadlineExceeded, fmt.Sprintf("stream idle for more than %v", s.timer.Timeout()))
+}
+
+type idleReader struct {
+	io.ReadCloser
+	timer *concurrency.IdleTimer
+}
+
+func (r *idleReader) Read(buf []byte) (int, error) {
+	n, err := r.ReadCloser.Read(buf)
+	if n > 0 {
+		r.timer.Touch()
+	}
+	return n, err
+}
+
+type idleResponseWriter struct {
+	http.ResponseWriter
+	timer *concurrency.IdleTimer
+}
+
+func (w *idleResponseWriter) Write(buf []byte) (int, error) {
+	w.timer.Touch()
+	return w.ResponseWriter.Write(buf)
+}
+
+func (w *idleResponseWriter) Flush() {
+	if flusher, _ := w.ResponseWriter.(http.Flusher); flusher != nil {
+		flusher.Flush()
+	}
+}
+
+func (w *idleResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
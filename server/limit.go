@@ -0,0 +1,76 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	overloadedMessage = "too many concurrent streams"
+)
+
+// streamLimiter limits the number of gRPC requests handled concurrently. All methods are safe to call on a nil
+// limiter, which does not impose a limit.
+type streamLimiter struct {
+	slots        chan struct{}
+	queueTimeout time.Duration
+}
+
+func newStreamLimiter(maxStreams int, queueTimeout time.Duration) *streamLimiter {
+	if maxStreams <= 0 {
+		return nil
+	}
+	return &streamLimiter{
+		slots:        make(chan struct{}, maxStreams),
+		queueTimeout: queueTimeout,
+	}
+}
+
+// acquire obtains a slot for a request, waiting for one to become available for at most the queue timeout, or until
+// the given context is done. It returns false if no slot could be obtained.
+func (l *streamLimiter) acquire(ctx context.Context) bool {
+	if l == nil {
+		return true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if l.queueTimeout <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release frees a slot previously obtained via acquire.
+func (l *streamLimiter) release() {
+	if l == nil {
+		return
+	}
+	<-l.slots
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/internal/grpcwebsocket"
+	"google.golang.org/grpc/codes"
+	"nhooyr.io/websocket"
+)
+
+// startWatch starts a long-running server-streaming call, and waits until the handler tracks the given number of
+// streams. The returned function cancels the call and waits for it to finish.
+func startWatch(t *testing.T, handler *DowngradingHandler, numStreams int) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	doneC := make(chan struct{})
+	go func() {
+		defer close(doneC)
+		handler.ServeHTTP(httptest.NewRecorder(), newGRPCWebRequest(ctx, healthWatchPath))
+	}()
+	require.Eventually(t, func() bool {
+		return handler.streams.numActiveStreams() == numStreams
+	}, 5*time.Second, 10*time.Millisecond)
+	return func() {
+		cancel()
+		<-doneC
+	}
+}
+
+func TestMaxConcurrentStreams_Reject(t *testing.T) {
+	handler := NewDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithMaxConcurrentStreams(1, 0))
+
+	stopWatch := startWatch(t, handler, 1)
+	defer stopWatch()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newGRPCWebRequest(context.Background(), healthCheckPath))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/grpc-web", w.Header().Get("Content-Type"))
+	assert.Equal(t, fmt.Sprintf("%d", codes.ResourceExhausted), w.Header().Get("Grpc-Status"))
+	assert.Equal(t, overloadedMessage, w.Header().Get("Grpc-Message"))
+
+	// Once the call has finished, the slot is available again.
+	stopWatch()
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, newGRPCWebRequest(context.Background(), healthCheckPath))
+	_, trailers := readGRPCWebResponse(t, w.Body)
+	assert.Equal(t, "0", trailers.Get("Grpc-Status"))
+}
+
+func TestMaxConcurrentStreams_Queue(t *testing.T) {
+	handler := NewDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithMaxConcurrentStreams(1, 5*time.Second))
+
+	stopWatch := startWatch(t, handler, 1)
+	defer stopWatch()
+
+	// The request waits for the call to finish.
+	w := httptest.NewRecorder()
+	checkDoneC := make(chan struct{})
+	go func() {
+		defer close(checkDoneC)
+		handler.ServeHTTP(w, newGRPCWebRequest(context.Background(), healthCheckPath))
+	}()
+	require.Eventually(t, func() bool {
+		return handler.streams.numActiveStreams() == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	select {
+	case <-checkDoneC:
+		t.Fatal("request should be queued")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	stopWatch()
+	<-checkDoneC
+	_, trailers := readGRPCWebResponse(t, w.Body)
+	assert.Equal(t, "0", trailers.Get("Grpc-Status"))
+}
+
+func TestMaxConcurrentStreams_QueueTimeout(t *testing.T) {
+	handler := NewDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithMaxConcurrentStreams(1, 20*time.Millisecond))
+
+	stopWatch := startWatch(t, handler, 1)
+	defer stopWatch()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newGRPCWebRequest(context.Background(), healthCheckPath))
+	assert.Equal(t, fmt.Sprintf("%d", codes.ResourceExhausted), w.Header().Get("Grpc-Status"))
+}
+
+func TestStreamLimiter_CanceledWhileQueued(t *testing.T) {
+	limiter := newStreamLimiter(1, time.Minute)
+	require.True(t, limiter.acquire(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.False(t, limiter.acquire(ctx))
+
+	// A failed acquisition does not hold a slot.
+	limiter.release()
+	assert.True(t, limiter.acquire(context.Background()))
+	limiter.release()
+
+	// A nil limiter does not impose a limit.
+	assert.Nil(t, newStreamLimiter(0, time.Minute))
+	var noLimit *streamLimiter
+	assert.True(t, noLimit.acquire(context.Background()))
+	noLimit.release()
+}
+
+func TestMaxConcurrentStreams_WebSocket(t *testing.T) {
+	handler := NewDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithMaxConcurrentStreams(1, 0))
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	stopWatch := startWatch(t, handler, 1)
+	defer stopWatch()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	hdr := make(http.Header)
+	hdr.Set("Content-Type", "application/grpc")
+	_, resp, err := websocket.Dial(ctx, srv.URL+healthCheckPath, &websocket.DialOptions{
+		HTTPHeader:   hdr,
+		Subprotocols: []string{grpcwebsocket.SubprotocolName},
+	})
+	require.Error(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+}
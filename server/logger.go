@@ -0,0 +1,31 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+// Logger receives diagnostic messages about serving gRPC requests, e.g., to find out why requests of a particular
+// client fail. Implementations must be safe for concurrent use.
+type Logger interface {
+	// Debugf logs a message about the regular course of serving a request.
+	Debugf(format string, args ...interface{})
+	// Warnf logs a message about a request that could not be served.
+	Warnf(format string, args ...interface{})
+}
+
+// nopLogger is a Logger that discards all messages.
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...interface{}) {}
+
+func (nopLogger) Warnf(string, ...interface{}) {}
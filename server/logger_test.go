@@ -0,0 +1,61 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingLogger struct {
+	mutex    sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) Debugf(format string, args ...interface{}) {
+	l.record("DEBUG: "+format, args...)
+}
+
+func (l *recordingLogger) Warnf(format string, args ...interface{}) {
+	l.record("WARN: "+format, args...)
+}
+
+func (l *recordingLogger) record(format string, args ...interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
+}
+
+func TestWithLogger(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger := &recordingLogger{}
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithLogger(logger))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newGRPCWebRequest(ctx, healthCheckPath))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, []string{"DEBUG: Serving grpc-web request for " + healthCheckPath + " via HTTP/1.1"}, logger.messages)
+}
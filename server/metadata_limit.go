@@ -0,0 +1,47 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// headerFieldOverhead is the overhead per header field in the size of an HTTP/2 header list (RFC 7540, section 6.5.2).
+const headerFieldOverhead = 32
+
+// headerListSize returns the size of the given headers, computed like the size of an HTTP/2 header list: the length of
+// every name and value plus an overhead of 32 bytes per value.
+func headerListSize(hdr http.Header) int {
+	size := 0
+	for k, vs := range hdr {
+		for _, v := range vs {
+			size += len(k) + len(v) + headerFieldOverhead
+		}
+	}
+	return size
+}
+
+// checkMetadataSize returns a message describing the violation if the headers of the given request exceed the
+// configured limit, or an empty string otherwise.
+func (o *options) checkMetadataSize(req *http.Request) string {
+	if o.maxMetadataBytes <= 0 {
+		return ""
+	}
+	if size := headerListSize(req.Header); size > o.maxMetadataBytes {
+		return fmt.Sprintf("request metadata of %d bytes exceeds the limit of %d bytes", size, o.maxMetadataBytes)
+	}
+	return ""
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/internal/grpcwebsocket"
+	"google.golang.org/grpc/codes"
+	"nhooyr.io/websocket"
+)
+
+func TestHeaderListSize(t *testing.T) {
+	hdr := http.Header{
+		"X-A":   {"1", "22"},
+		"X-Bin": {"AAE"},
+	}
+	assert.Equal(t, (3+1+32)+(3+2+32)+(5+3+32), headerListSize(hdr))
+	assert.Zero(t, headerListSize(nil))
+}
+
+func TestMaxMetadataBytes_GRPCWeb(t *testing.T) {
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithMaxMetadataBytes(1024))
+
+	req := newGRPCWebRequest(context.Background(), healthCheckPath)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	_, trailers := readGRPCWebResponse(t, rec.Body)
+	assert.Equal(t, fmt.Sprintf("%d", codes.OK), trailers.Get("Grpc-Status"))
+
+	req = newGRPCWebRequest(context.Background(), healthCheckPath)
+	req.Header.Set("X-Large", strings.Repeat("a", 1024))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, fmt.Sprintf("%d", codes.ResourceExhausted), rec.Header().Get("Grpc-Status"))
+	assert.Contains(t, rec.Header().Get("Grpc-Message"), "exceeds the limit of 1024 bytes")
+	assert.Zero(t, rec.Body.Len())
+}
+
+func TestMaxMetadataBytes_Connect(t *testing.T) {
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithConnectProtocol(), WithMaxMetadataBytes(1024))
+
+	req := newConnectRequest(healthCheckPath, "application/proto", nil)
+	req.Header.Set("X-Large", strings.Repeat("a", 1024))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"code":"resource_exhausted"`)
+}
+
+func TestMaxMetadataBytes_WebSocket(t *testing.T) {
+	srv := httptest.NewServer(CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithMaxMetadataBytes(1024)))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	hdr := make(http.Header)
+	hdr.Set("Content-Type", "application/grpc")
+	hdr.Set("X-Large", strings.Repeat("a", 1024))
+	_, resp, err := websocket.Dial(ctx, srv.URL+healthCheckPath, &websocket.DialOptions{
+		HTTPHeader:   hdr,
+		Subprotocols: []string{grpcwebsocket.SubprotocolName},
+	})
+	require.Error(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, resp.StatusCode)
+}
@@ -0,0 +1,34 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"net/http"
+)
+
+const (
+	methodNotAllowedMessage = "method is not available via gRPC-Web, gRPC-WebSocket or Connect"
+)
+
+// isNativeGRPC checks whether a request with the given content type is a native gRPC request, i.e., a gRPC request
+// received over HTTP/2, as opposed to a gRPC-Web request or a gRPC request tunneled over HTTP/1.
+func isNativeGRPC(req *http.Request, contentType string) bool {
+	return req.ProtoMajor == 2 && transportForContentType(contentType) == TransportGRPC
+}
+
+// isMethodAllowed checks whether the given gRPC method may be called via a transport other than native gRPC.
+func (o *options) isMethodAllowed(fullMethod string) bool {
+	return o.methodFilter == nil || o.methodFilter(fullMethod)
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"golang.stackrox.io/grpc-http1/internal/grpcwebsocket"
+	"google.golang.org/grpc/codes"
+	"nhooyr.io/websocket"
+)
+
+func denyHealthCheck(fullMethod string) bool {
+	return fullMethod != healthCheckPath
+}
+
+func TestMethodFilter_GRPCWeb(t *testing.T) {
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithMethodFilter(denyHealthCheck))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newGRPCWebRequest(context.Background(), healthCheckPath))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, fmt.Sprintf("%d", codes.PermissionDenied), rec.Header().Get("Grpc-Status"))
+	assert.Equal(t, methodNotAllowedMessage, rec.Header().Get("Grpc-Message"))
+	assert.Zero(t, rec.Body.Len())
+}
+
+func TestMethodFilter_TunneledGRPC(t *testing.T) {
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithMethodFilter(denyHealthCheck))
+
+	req := httptest.NewRequest(http.MethodPost, healthCheckPath, bytes.NewReader(grpcproto.MakeMessageHeader(0, 0)))
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, fmt.Sprintf("%d", codes.PermissionDenied), rec.Header().Get("Grpc-Status"))
+}
+
+func TestMethodFilter_NativeGRPCIsUnaffected(t *testing.T) {
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithMethodFilter(denyHealthCheck))
+
+	req := httptest.NewRequest(http.MethodPost, healthCheckPath, bytes.NewReader(grpcproto.MakeMessageHeader(0, 0)))
+	req.ProtoMajor, req.ProtoMinor, req.Proto = 2, 0, "HTTP/2.0"
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	resp := rec.Result()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, fmt.Sprintf("%d", codes.OK), resp.Trailer.Get("Grpc-Status"))
+}
+
+func TestMethodFilter_AllowedMethod(t *testing.T) {
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithMethodFilter(func(fullMethod string) bool {
+		return fullMethod == healthCheckPath
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newGRPCWebRequest(context.Background(), healthCheckPath))
+	require.Equal(t, http.StatusOK, rec.Code)
+	_, trailers := readGRPCWebResponse(t, rec.Body)
+	assert.Equal(t, fmt.Sprintf("%d", codes.OK), trailers.Get("Grpc-Status"))
+}
+
+func TestMethodFilter_Connect(t *testing.T) {
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithConnectProtocol(), WithMethodFilter(denyHealthCheck))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newConnectRequest(healthCheckPath, "application/proto", nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.JSONEq(t, fmt.Sprintf(`{"code":"permission_denied","message":%q}`, methodNotAllowedMessage), rec.Body.String())
+}
+
+func TestMethodFilter_WebSocket(t *testing.T) {
+	srv := httptest.NewServer(CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithMethodFilter(denyHealthCheck)))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	hdr := make(http.Header)
+	hdr.Set("Content-Type", "application/grpc")
+	_, resp, err := websocket.Dial(ctx, srv.URL+healthCheckPath, &websocket.DialOptions{
+		HTTPHeader:   hdr,
+		Subprotocols: []string{grpcwebsocket.SubprotocolName},
+	})
+	require.Error(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
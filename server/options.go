@@ -1,7 +1,51 @@
 package server
 
+import (
+	"net/netip"
+	"strings"
+	"time"
+)
+
 type options struct {
 	preferGRPCWeb bool
+	wsCompression bool
+	cors          *CORSConfig
+
+	wsKeepaliveInterval time.Duration
+	wsKeepaliveTimeout  time.Duration
+
+	statsHandler StatsHandler
+
+	maxFrameSize uint32
+
+	pathPrefix   string
+	methodHeader bool
+
+	connectProtocol bool
+
+	maxConcurrentStreams int
+	streamQueueTimeout   time.Duration
+
+	httpTrailers bool
+
+	methodFilter func(fullMethod string) bool
+
+	framesPerSecond float64
+	frameBurst      int
+
+	gzipResponses bool
+
+	maxMetadataBytes int
+
+	wsResume      bool
+	wsPath        string
+	wsSubprotocol string
+
+	logger Logger
+
+	trustedProxies trustedProxies
+
+	streamIdleTimeout time.Duration
 }
 
 // Option is an object that controls the behavior of the downgrading gRPC server.
@@ -22,3 +66,226 @@ func PreferGRPCWeb(prefer bool) Option {
 		o.preferGRPCWeb = prefer
 	})
 }
+
+// WebSocketCompression instructs the server to accept the permessage-deflate extension (RFC 7692) if offered by
+// a gRPC-WebSocket client. Clients that do not offer the extension are still served without compression.
+func WebSocketCompression(enable bool) Option {
+	return optionFunc(func(o *options) {
+		o.wsCompression = enable
+	})
+}
+
+// WithCORS instructs the server to answer CORS preflight requests for gRPC methods, and to add the respective
+// CORS headers to responses to cross-origin gRPC requests, according to the given config. This is required for
+// browser-based gRPC-Web clients served from a different origin.
+func WithCORS(cfg CORSConfig) Option {
+	return optionFunc(func(o *options) {
+		o.cors = &cfg
+	})
+}
+
+// WebSocketKeepalive instructs the server to send a WebSocket ping to gRPC-WebSocket clients every interval. If no
+// pong is received within the given timeout (20 seconds if zero), the WebSocket connection is closed and the RPC on
+// it is canceled. This mirrors gRPC's own keepalive parameters.
+func WebSocketKeepalive(interval, timeout time.Duration) Option {
+	return optionFunc(func(o *options) {
+		o.wsKeepaliveInterval = interval
+		o.wsKeepaliveTimeout = timeout
+	})
+}
+
+// WithStatsHandler instructs the server to notify the given handler whenever a gRPC request is received and
+// whenever handling it has finished, e.g., for exporting metrics. Plain HTTP requests passed to the HTTP handler
+// are not reported.
+func WithStatsHandler(handler StatsHandler) Option {
+	return optionFunc(func(o *options) {
+		o.statsHandler = handler
+	})
+}
+
+// WithMaxFrameSize sets the maximum payload size of gRPC frames received from gRPC-WebSocket clients. Frames
+// exceeding this size abort the RPC, and the WebSocket connection is closed with status 1009 (message too big),
+// which the client of this library reports as a `ResourceExhausted` error. If size is zero, the default of 4MB is used.
+// The size also limits the request message of Connect unary requests (see `WithConnectProtocol`). Requests received
+// over HTTP are otherwise subject to the maximum message size of the gRPC server instead.
+func WithMaxFrameSize(size uint32) Option {
+	return optionFunc(func(o *options) {
+		o.maxFrameSize = size
+	})
+}
+
+// WithPathPrefix instructs the server to only handle gRPC requests whose path starts with the given prefix (e.g.,
+// `/api/grpc`), and to strip the prefix before deriving the gRPC method from the path. All other requests, as well as
+// non-gRPC requests below the prefix, are passed on to the HTTP handler unmodified. This allows serving gRPC methods
+// alongside other HTTP endpoints under a common path. A trailing slash in the prefix is ignored.
+func WithPathPrefix(prefix string) Option {
+	return optionFunc(func(o *options) {
+		o.pathPrefix = strings.TrimSuffix(prefix, "/")
+	})
+}
+
+// WithMethodHeader instructs the server to take the gRPC method of a request from the `Grpc-Http1-Method` header, if
+// present, instead of from the path. Clients of this library set this header if created with the
+// `client.WithPathRewriter` option, which allows passing path-based routers that cannot match arbitrary gRPC method
+// paths. Do not use this option if the path is used for authorizing requests (e.g., by a reverse proxy), as clients
+// may then call any method via a permitted path. If combined with `WithPathPrefix`, the prefix is stripped first, and
+// requests outside the prefix are still passed on to the HTTP handler.
+func WithMethodHeader() Option {
+	return optionFunc(func(o *options) {
+		o.methodHeader = true
+	})
+}
+
+// WithConnectProtocol instructs the server to additionally accept unary requests using the Connect protocol (i.e.,
+// POST requests with the `application/proto` or `application/json` content type to the path of a unary gRPC method),
+// and to bridge them to the gRPC server. Errors are sent in Connect's JSON error envelope. Serving JSON requests
+// requires a gRPC codec named "json" to be registered (see `google.golang.org/grpc/encoding`); otherwise, they fail
+// with an `unimplemented` error. Streaming requests and unary GET requests are not supported.
+func WithConnectProtocol() Option {
+	return optionFunc(func(o *options) {
+		o.connectProtocol = true
+	})
+}
+
+// WithMaxConcurrentStreams limits the number of gRPC requests the downgrading handler serves concurrently to n. If the
+// limit is reached, a new request waits for at most the given queue timeout for another request to finish, and is
+// rejected with a `ResourceExhausted` status afterwards, or right away if the timeout is zero. gRPC-WebSocket requests
+// are rejected with HTTP status 429 (too many requests) before the WebSocket handshake instead. A value of n less
+// than or equal to zero means no limit, which is the default.
+func WithMaxConcurrentStreams(n int, queueTimeout time.Duration) Option {
+	return optionFunc(func(o *options) {
+		o.maxConcurrentStreams = n
+		o.streamQueueTimeout = queueTimeout
+	})
+}
+
+// WithHTTPTrailers instructs the server to send the trailers (including the gRPC status) of downgraded gRPC-Web
+// responses in the trailer section of the HTTP response, instead of in an in-band trailers frame. This is needed for
+// interoperating with gRPC-Web gateways and clients that follow this convention; the client of this library accepts
+// both. Trailers-only responses, which carry the status in the headers, are unaffected. HTTP/1.x clients must declare
+// support for trailers via the `TE: trailers` request header; otherwise, the trailers are still sent in-band, as they
+// might be dropped.
+func WithHTTPTrailers() Option {
+	return optionFunc(func(o *options) {
+		o.httpTrailers = true
+	})
+}
+
+// WithMethodFilter restricts the gRPC methods that can be called via gRPC-Web, gRPC-WebSocket, the Connect protocol,
+// or tunneled over HTTP/1 to those for which the given filter returns true. The filter is passed the full method
+// name, e.g., `/grpc.health.v1.Health/Check`. Calls to other methods are rejected with a `PermissionDenied` status
+// (or HTTP status 403 for gRPC-WebSocket requests) before reaching the gRPC server. Native gRPC requests over HTTP/2
+// are not affected, such that a single port can expose a subset of methods to browser clients while serving all
+// methods to native gRPC clients.
+func WithMethodFilter(filter func(fullMethod string) bool) Option {
+	return optionFunc(func(o *options) {
+		o.methodFilter = filter
+	})
+}
+
+// WithFrameRateLimit limits the rate at which the downgrading handler reads gRPC frames from each client connection to
+// the given number of frames per second, allowing bursts of up to burst frames. The limit is shared by all downgraded,
+// gRPC-Web and gRPC-WebSocket requests received over the same connection, and only applies to the number of frames,
+// hence streaming large messages is not penalized. Requests exceeding the limit are terminated with a
+// `ResourceExhausted` status. Native gRPC requests are not limited. A rate less than or equal to zero means no limit,
+// which is the default.
+func WithFrameRateLimit(framesPerSecond float64, burst int) Option {
+	return optionFunc(func(o *options) {
+		o.framesPerSecond = framesPerSecond
+		o.frameBurst = burst
+	})
+}
+
+// WithGzipResponses instructs the server to gzip the bodies of downgraded gRPC-Web (and gRPC-Web text) responses at the
+// HTTP layer if the client accepts it via the `Accept-Encoding` header, which browsers do. This is independent of the
+// compression of individual gRPC messages, which gRPC-Web clients commonly do not support. Streamed messages are still
+// flushed individually.
+func WithGzipResponses() Option {
+	return optionFunc(func(o *options) {
+		o.gzipResponses = true
+	})
+}
+
+// WithMaxMetadataBytes instructs the server to reject downgraded, gRPC-Web, gRPC-WebSocket and Connect requests whose
+// headers exceed the given size with a `ResourceExhausted` status (or, for gRPC-WebSocket requests, which are rejected
+// before the WebSocket connection is established, a `431 Request Header Fields Too Large` response). The size is computed
+// like the size of an HTTP/2 header list, i.e., as the length of every name and value plus 32 bytes per value. Native
+// gRPC requests are subject to the limits of the gRPC server instead.
+//
+// Note that the HTTP server and intermediaries impose limits of their own (e.g., 1 MiB for `http.Server` by default,
+// and 8 KiB per header line for nginx), beyond which requests are rejected before reaching the handler, or headers
+// may be dropped. A non-positive size means no limit, which is the default.
+func WithMaxMetadataBytes(n int) Option {
+	return optionFunc(func(o *options) {
+		o.maxMetadataBytes = n
+	})
+}
+
+// WebSocketResume instructs the server to announce support for resuming server-streaming gRPC-WebSocket calls whose
+// WebSocket connection was lost, as requested by clients created with the `client.WebSocketResume` option. A
+// resumed call is a new invocation of the handler, which must use `ResumeFrom` to skip the response messages the
+// client has already received. Handlers not doing so cause clients to receive duplicate messages, hence this option
+// must only be enabled if all server-streaming handlers cooperate. Any side effects of a handler may be repeated when
+// a call is resumed.
+func WebSocketResume() Option {
+	return optionFunc(func(o *options) {
+		o.wsResume = true
+	})
+}
+
+// WithLogger instructs the server to log diagnostic messages to the given logger, such as the transport a request
+// was received over, and WebSocket connections that could not be established or carried invalid frames. By default,
+// these messages are discarded.
+func WithLogger(logger Logger) Option {
+	return optionFunc(func(o *options) {
+		o.logger = logger
+	})
+}
+
+// WithTrustedProxies instructs the server to take the address of the client from the `Forwarded` (RFC 7239) or, if
+// absent, the `X-Forwarded-For` header of gRPC requests received from proxies within the given address ranges, such
+// that `peer.FromContext` returns it to gRPC handlers instead of the address of the proxy. Addresses in the header are
+// only honored up to the first address not belonging to a trusted proxy, which prevents clients from spoofing their
+// address; unknown and obfuscated identifiers in the `Forwarded` header end the traversal as well. Unless conveyed by
+// the `Forwarded` header, the port of such addresses is zero. Requests from other addresses are served with their
+// remote address, which is also the default for all requests. Non-gRPC requests passed to the HTTP handler are not
+// modified.
+func WithTrustedProxies(cidrs ...netip.Prefix) Option {
+	return optionFunc(func(o *options) {
+		o.trustedProxies = append(trustedProxies{}, cidrs...)
+	})
+}
+
+// WithWebSocketPath instructs the server to only accept gRPC-WebSocket requests at the given path (e.g.,
+// `/grpc-tunnel`), taking the gRPC method from the `Grpc-Http1-Method` header, as sent by clients created with the
+// `client.WithWebSocketPath` option. This allows routing all WebSocket connections through a single path. WebSocket
+// upgrade requests for gRPC at other paths are rejected with HTTP status 404. As with `WithMethodHeader`, do not use this
+// option if the path is used for authorizing requests. If combined with `WithPathPrefix`, the path is relative to the
+// prefix. By default, gRPC-WebSocket requests are accepted at the path of the gRPC method.
+func WithWebSocketPath(path string) Option {
+	return optionFunc(func(o *options) {
+		o.wsPath = path
+	})
+}
+
+// WithWebSocketSubprotocol instructs the server to accept gRPC-WebSocket requests using the given WebSocket subprotocol
+// instead of the default `grpc-ws`, as sent by clients created with the `client.WithWebSocketSubprotocol` option.
+// WebSocket upgrade requests with other subprotocols are passed to the HTTP handler.
+func WithWebSocketSubprotocol(subprotocol string) Option {
+	return optionFunc(func(o *options) {
+		o.wsSubprotocol = subprotocol
+	})
+}
+
+// WithStreamIdleTimeout instructs the server to abort gRPC-WebSocket and downgraded gRPC-Web streams with a
+// `DeadlineExceeded` status once no gRPC frame has been sent or received for the given duration. This reclaims streams
+// abandoned by clients behind proxies that do not close idle connections. Keepalive pings do not count as frames.
+// Unary calls are not affected, as their clients cannot send anything while waiting for the response; their duration
+// is bounded by their deadline. Native gRPC streams are not affected either; use the keepalive options of the gRPC
+// server for these. A duration less than
+// or equal to zero disables the timeout, which is the default.
+func WithStreamIdleTimeout(d time.Duration) Option {
+	return optionFunc(func(o *options) {
+		o.streamIdleTimeout = d
+	})
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"context"
+	"runtime/debug"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryRecoveryInterceptor returns a unary server interceptor that recovers panics in gRPC service methods and fails
+// the call with an `Internal` status instead. Recovered panics are logged to the given logger, or discarded if it is
+// nil. gRPC service methods run in their own goroutines, hence a panic cannot be recovered by the downgrading handler;
+// install the interceptor on the gRPC server, e.g., via
+// `grpc.ChainUnaryInterceptor(server.UnaryRecoveryInterceptor(logger))`.
+func UnaryRecoveryInterceptor(logger Logger) grpc.UnaryServerInterceptor {
+	if logger == nil {
+		logger = nopLogger{}
+	}
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer recoverToStatus(info.FullMethod, &err, logger)
+		return handler(ctx, req)
+	}
+}
+
+// StreamRecoveryInterceptor is the stream counterpart of UnaryRecoveryInterceptor.
+func StreamRecoveryInterceptor(logger Logger) grpc.StreamServerInterceptor {
+	if logger == nil {
+		logger = nopLogger{}
+	}
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer recoverToStatus(info.FullMethod, &err, logger)
+		return handler(srv, ss)
+	}
+}
+
+// recoverToStatus recovers a panic, if any, and sets err to an `Internal` status. The panic value is only logged, as
+// it may contain details not meant for the client.
+func recoverToStatus(fullMethod string, err *error, logger Logger) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	logger.Warnf("Panic in gRPC method %s: %v\n%s", fullMethod, r, debug.Stack())
+	*err = status.Error(codes.Internal, "internal error while serving request")
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.stackrox.io/grpc-http1/internal/stringutils"
+)
+
+// acceptsGzip checks whether the client of the given request accepts responses with the gzip content encoding.
+func acceptsGzip(req *http.Request) bool {
+	for _, v := range req.Header.Values("Accept-Encoding") {
+		for _, enc := range strings.Split(v, ",") {
+			name, params := stringutils.Split2(enc, ";")
+			if !strings.EqualFold(strings.TrimSpace(name), "gzip") {
+				continue
+			}
+			key, value := stringutils.Split2(strings.TrimSpace(params), "=")
+			if strings.TrimSpace(key) == "q" {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && q == 0 {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter is a response writer that gzips the response body at the HTTP layer. This is independent of
+// the compression of gRPC messages, hence the gRPC-Web framing and trailers are written uncompressed and the whole
+// body is compressed afterwards. Flushing flushes the compressed data written so far, such that streamed messages are
+// still received incrementally.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+// newGzipResponseWriter returns a response writer that gzips the response body, and a function to call after the
+// response has been written in order to write the remainder of the compressed data.
+func newGzipResponseWriter(w http.ResponseWriter) (http.ResponseWriter, func() error) {
+	gw := &gzipResponseWriter{
+		ResponseWriter: w,
+		gz:             gzip.NewWriter(w),
+	}
+	return gw, gw.finalize
+}
+
+func (w *gzipResponseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	hdr := w.Header()
+	hdr.Set("Content-Encoding", "gzip")
+	hdr.Add("Vary", "Accept-Encoding")
+	hdr.Del("Content-Length")
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *gzipResponseWriter) Write(buf []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.gz.Write(buf)
+}
+
+func (w *gzipResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if err := w.gz.Flush(); err != nil {
+		return
+	}
+	if flusher, _ := w.ResponseWriter.(http.Flusher); flusher != nil {
+		flusher.Flush()
+	}
+}
+
+func (w *gzipResponseWriter) finalize() error {
+	if !w.wroteHeader {
+		// Nothing was written, e.g., for a Trailers-Only response with HTTP trailers.
+		return nil
+	}
+	return w.gz.Close()
+}
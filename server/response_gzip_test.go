@@ -0,0 +1,157 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"golang.stackrox.io/grpc-http1/internal/grpcweb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	cases := map[string]bool{
+		"":                      false,
+		"gzip":                  true,
+		"deflate, gzip;q=1.0":   true,
+		"GZIP":                  true,
+		"gzip;q=0":              false,
+		"gzip; q=0.5, identity": true,
+		"br, deflate":           false,
+	}
+	for acceptEncoding, expected := range cases {
+		t.Run(acceptEncoding, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			if acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", acceptEncoding)
+			}
+			assert.Equal(t, expected, acceptsGzip(req))
+		})
+	}
+}
+
+func TestGzipResponses(t *testing.T) {
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithGzipResponses())
+
+	cases := map[string]struct {
+		contentType    string
+		acceptEncoding string
+		expectGzip     bool
+	}{
+		"gzip accepted": {
+			contentType:    "application/grpc-web",
+			acceptEncoding: "gzip, deflate",
+			expectGzip:     true,
+		},
+		"gzip not accepted": {
+			contentType: "application/grpc-web",
+		},
+		"text": {
+			contentType:    grpcweb.TextContentType,
+			acceptEncoding: "gzip",
+			expectGzip:     true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			body := io.Reader(bytes.NewReader(grpcproto.MakeMessageHeader(0, 0)))
+			if c.contentType == grpcweb.TextContentType {
+				body = bytes.NewReader([]byte("AAAAAAA="))
+			}
+			req := httptest.NewRequest(http.MethodPost, healthCheckPath, body)
+			req.Header.Set("Content-Type", c.contentType)
+			req.Header.Set("Accept", c.contentType)
+			if c.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", c.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			respBody := io.Reader(rec.Body)
+			if c.expectGzip {
+				assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+				gzipReader, err := gzip.NewReader(rec.Body)
+				require.NoError(t, err)
+				respBody = gzipReader
+			} else {
+				assert.Empty(t, rec.Header().Get("Content-Encoding"))
+			}
+			if c.contentType == grpcweb.TextContentType {
+				respBody = grpcweb.NewTextReader(io.NopCloser(respBody))
+			}
+
+			data, trailers := readGRPCWebResponse(t, respBody)
+			assert.Equal(t, fmt.Sprintf("%d", codes.OK), trailers.Get("Grpc-Status"))
+			assert.NotEmpty(t, data)
+		})
+	}
+}
+
+func TestGzipResponses_StreamedMessagesAreFlushed(t *testing.T) {
+	grpcSrv := grpc.NewServer()
+	healthSrv := health.NewServer()
+	healthpb.RegisterHealthServer(grpcSrv, healthSrv)
+	t.Cleanup(grpcSrv.Stop)
+
+	srv := httptest.NewServer(CreateDowngradingHandler(grpcSrv, http.NotFoundHandler(), WithGzipResponses()))
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+healthWatchPath, bytes.NewReader(grpcproto.MakeMessageHeader(0, 0)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/grpc-web")
+	req.Header.Set("Accept", "application/grpc-web")
+	// Setting the header explicitly prevents the transport from transparently decompressing the response.
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+
+	gzipReader, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+
+	// The watch never ends on its own, hence receiving the messages at all means that they were flushed.
+	for _, expected := range []healthpb.HealthCheckResponse_ServingStatus{healthpb.HealthCheckResponse_SERVING, healthpb.HealthCheckResponse_NOT_SERVING} {
+		healthSrv.SetServingStatus("", expected)
+		hdr := make([]byte, grpcproto.MessageHeaderLength)
+		_, err := io.ReadFull(gzipReader, hdr)
+		require.NoError(t, err)
+		require.True(t, grpcproto.IsDataFrame(hdr))
+		_, length, err := grpcproto.ParseMessageHeader(hdr)
+		require.NoError(t, err)
+		_, err = io.CopyN(io.Discard, gzipReader, int64(length))
+		require.NoError(t, err)
+	}
+}
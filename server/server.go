@@ -15,41 +15,61 @@
 package server
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
+	"time"
 	"unicode"
 
-	"github.com/golang/glog"
+	"golang.org/x/net/http/httpguts"
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
 	"golang.stackrox.io/grpc-http1/internal/grpcweb"
 	"golang.stackrox.io/grpc-http1/internal/grpcwebsocket"
-	"golang.stackrox.io/grpc-http1/internal/size"
 	"golang.stackrox.io/grpc-http1/internal/sliceutils"
 	"golang.stackrox.io/grpc-http1/internal/stringutils"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"nhooyr.io/websocket"
 )
 
 const (
 	name = "server"
+
+	flusherRequiredMessage = "response writer does not implement http.Flusher, which is required for serving " +
+		"server-streaming gRPC requests (this usually means the downgrading handler is wrapped by a middleware that hides it)"
 )
 
 // handleGRPCWS handles gRPC requests via WebSockets.
-func handleGRPCWS(w http.ResponseWriter, req *http.Request, grpcSrv *grpc.Server) {
+func handleGRPCWS(w http.ResponseWriter, req *http.Request, grpcSrv *grpc.Server, srvOpts *options, idleTimeout time.Duration, limit *frameLimit, rec *statsRecorder) {
+	// Accept a WebSocket connection. Compression is disabled by default, as gRPC already compresses messages.
+	compressionMode := websocket.CompressionDisabled
+	if srvOpts.wsCompression {
+		compressionMode = websocket.CompressionNoContextTakeover
+	}
+	if srvOpts.wsResume {
+		w.Header().Set(grpcproto.ResumableHeader, "true")
+	}
+	window := acceptWindow(w.Header(), req.Header, srvOpts.logger)
 	// TODO: Accept the websocket on-demand. For now, this is fine.
-	// Accept a WebSocket connection. No need for compression, as gRPC already compresses messages.
 	conn, err := websocket.Accept(w, req, &websocket.AcceptOptions{
-		CompressionMode: websocket.CompressionDisabled,
+		CompressionMode: compressionMode,
 	})
 	if err != nil {
+		srvOpts.logger.Warnf("Accepting WebSocket connection for %s failed: %v", req.URL.Path, err)
 		http.Error(w, fmt.Sprintf("accepting websocket connection: %v", err), http.StatusInternalServerError)
 		return
 	}
-	conn.SetReadLimit(64 * size.MB)
+	conn.SetReadLimit(int64(srvOpts.maxFrameSize) + grpcproto.MessageHeaderLength)
 
-	ctx := req.Context()
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	if srvOpts.wsResume {
+		ctx = withResumeFrom(ctx, req.Header, srvOpts.logger)
+	}
 
 	grpcReq := req.Clone(ctx)
 	grpcReq.ProtoMajor, grpcReq.ProtoMinor, grpcReq.Proto = 2, 0, "HTTP/2.0"
@@ -59,6 +79,8 @@ func handleGRPCWS(w http.ResponseWriter, req *http.Request, grpcSrv *grpc.Server
 	hdr := grpcReq.Header
 	hdr.Del("Connection")
 	hdr.Del("Upgrade")
+	hdr.Del(grpcproto.ResumeFromHeader)
+	hdr.Del(grpcproto.WindowHeader)
 	for k := range hdr {
 		if strings.HasPrefix(k, "Sec-Websocket-") {
 			delete(hdr, k)
@@ -69,41 +91,64 @@ func handleGRPCWS(w http.ResponseWriter, req *http.Request, grpcSrv *grpc.Server
 	grpcReq.ContentLength = -1
 
 	// Set the body to a custom WebSocket reader.
-	grpcReq.Body = newWebSocketReader(ctx, conn)
+	grpcReq.Body = newWebSocketReader(ctx, cancel, conn, srvOpts.maxFrameSize, limit, window, srvOpts.logger)
+	// Only the gRPC request is aborted once the stream is idle, such that its status can still be sent.
+	grpcReq, idle := withStreamIdleTimeout(grpcReq, idleTimeout)
+	defer idle.stop()
 
 	// Use a custom WebSocket http.ResponseWriter to write messages back to the client.
-	grpcResponseWriter, respReader := newWebSocketResponseWriter()
+	grpcResponseWriter, respReader := newWebSocketResponseWriter(srvOpts.logger)
+
+	if srvOpts.wsKeepaliveInterval > 0 {
+		keepaliveCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			if err := grpcwebsocket.Keepalive(keepaliveCtx, conn, srvOpts.wsKeepaliveInterval, srvOpts.wsKeepaliveTimeout); err != nil {
+				srvOpts.logger.Debugf("Closing WebSocket connection for %s: %v", req.URL.Path, err)
+			}
+		}()
+	}
 
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := grpcwebsocket.Write(ctx, conn, respReader, name); err != nil {
-			_ = conn.Close(websocket.StatusInternalError, err.Error())
+		if err := grpcwebsocket.Write(ctx, conn, respReader, window); err != nil {
+			srvOpts.logger.Debugf("Error writing response for %s to WebSocket connection: %v", req.URL.Path, err)
+			_ = conn.Close(websocket.StatusInternalError, grpcwebsocket.CloseReason(err.Error()))
 		}
 	}()
 
-	grpcSrv.ServeHTTP(grpcResponseWriter, grpcReq)
+	rec.serve(idle.wrap(grpcResponseWriter), grpcReq, grpcSrv.ServeHTTP)
+	idle.reportExpired(grpcResponseWriter)
+	limit.reportExceeded(grpcResponseWriter)
 	if err := grpcResponseWriter.Close(); err != nil {
-		_ = conn.Close(websocket.StatusInternalError, err.Error())
+		_ = conn.Close(websocket.StatusInternalError, grpcwebsocket.CloseReason(err.Error()))
 	}
 
 	wg.Wait()
 	// It's ok to potentially close the connection multiple times.
 	// Only the first time matters.
-	_ = conn.Close(websocket.StatusNormalClosure, "")
+	_ = conn.Close(grpcResponseWriter.closeStatus())
 }
 
-func handleGRPCWeb(w http.ResponseWriter, req *http.Request, validPaths map[string]struct{}, grpcSrv *grpc.Server, srvOpts *options) {
+func handleGRPCWeb(w http.ResponseWriter, req *http.Request, validPaths map[string]struct{}, clientStreamingPaths map[string]struct{}, grpcSrv *grpc.Server, srvOpts *options, transport Transport, idleTimeout time.Duration, limit *frameLimit, rec *statsRecorder) {
 	_, isDowngradableMethod := validPaths[req.URL.Path]
+	_, isClientStreamingMethod := clientStreamingPaths[req.URL.Path]
+	// HTTP/2 clients always support trailers, while HTTP/1.x clients declare support via `TE: trailers`.
+	acceptsTrailers := req.ProtoMajor == 2 || httpguts.HeaderValuesContainsToken(req.Header["Te"], "trailers")
 
 	// Check for HTTP/2.
 	if req.ProtoMajor != 2 {
 		if !isDowngradableMethod {
-			// Client-streaming only works with HTTP/2.
+			// Bidi-streaming only works with HTTP/2.
 			http.Error(w, "Method cannot be downgraded", http.StatusInternalServerError)
 			return
 		}
+		if isClientStreamingMethod {
+			// The client half-closes the stream by terminating the request body. Only respond afterwards.
+			w = makeHalfDuplex(w, req)
+		}
 		req.ProtoMajor, req.ProtoMinor, req.Proto = 2, 0, "HTTP/2.0"
 	}
 
@@ -120,10 +165,18 @@ func handleGRPCWeb(w http.ResponseWriter, req *http.Request, validPaths map[stri
 		acceptGRPC = false
 	}
 
+	// Requests in gRPC-Web format can only be answered with a response in gRPC-Web format (and requests in gRPC-Web
+	// text format with a response in gRPC-Web text format), regardless of whether they were sent via HTTP/1.x or HTTP/2.
+	textMode := transport == TransportGRPCWebText
+	if transport == TransportGRPCWeb || textMode {
+		acceptGRPCWeb, acceptGRPC = true, false
+	}
+
 	// If the client accepts trailers, AND gRPC responses, AND did not set the "Grpc-Web-Only" header,
 	// return the response as a normal gRPC response.
-	if req.Header.Get("TE") == "trailers" && acceptGRPC && len(req.Header[grpcweb.GRPCWebOnlyHeader]) == 0 {
-		grpcSrv.ServeHTTP(w, req)
+	if httpguts.HeaderValuesContainsToken(req.Header["Te"], "trailers") && acceptGRPC && len(req.Header[grpcweb.GRPCWebOnlyHeader]) == 0 {
+		rec.serve(w, req, grpcSrv.ServeHTTP)
+		limit.reportExceeded(w)
 		return
 	}
 
@@ -142,28 +195,107 @@ func handleGRPCWeb(w http.ResponseWriter, req *http.Request, validPaths map[stri
 	// really should, as the purpose of the TE header according to the gRPC spec is to detect incompatible proxies).
 	req.Header.Set("TE", "trailers")
 
-	// Downgrade response to gRPC web.
-	transcodingWriter, finalize := grpcweb.NewResponseWriter(w)
-	grpcSrv.ServeHTTP(transcodingWriter, req)
+	// Bound bridging the request by its deadline. The gRPC server applies the deadline to the RPC on its own.
+	req, cancel := withGRPCDeadline(req, srvOpts.logger)
+	defer cancel()
+	req, idle := withStreamIdleTimeout(req, idleTimeout)
+	defer idle.stop()
+
+	finalizeGzip := func() error { return nil }
+	if srvOpts.gzipResponses && acceptsGzip(req) {
+		w, finalizeGzip = newGzipResponseWriter(w)
+	}
+	finalizeText := func() error { return nil }
+	if textMode {
+		w, finalizeText = grpcweb.NewTextResponseWriter(w)
+	}
+
+	// Downgrade response to gRPC web. Messages are decompressed if the client does not accept the compression chosen by
+	// the gRPC server, as gRPC-Web clients commonly do not support compression.
+	encodings := acceptedEncodings(req)
+	// Trailers in the trailer section of the response are lost (along with the status) if the client does not support
+	// them, hence they are only sent there if it does. Otherwise, an in-band trailers frame is sent, which every
+	// gRPC-Web client understands.
+	newResponseWriter := grpcweb.NewResponseWriter
+	if srvOpts.httpTrailers && acceptsTrailers {
+		newResponseWriter = grpcweb.NewHTTPTrailersResponseWriter
+	}
+	transcodingWriter, finalize := newResponseWriter(w)
+	rec.setDowngraded()
+	rec.serve(transcodingWriter, req, func(w http.ResponseWriter, req *http.Request) {
+		decompressingWriter := newDecompressingResponseWriter(w, encodings, srvOpts.logger)
+		serveWithRecovery(grpcSrv, idle.wrap(decompressingWriter), req, srvOpts.logger)
+		reportDeadlineExceeded(w, req)
+		idle.reportExpired(w)
+		limit.reportExceeded(w)
+		decompressingWriter.reportError()
+	})
 	if err := finalize(); err != nil {
-		glog.Errorf("Error sending trailers in downgraded gRPC web response: %v", err)
+		srvOpts.logger.Warnf("Error sending trailers in downgraded gRPC web response: %v", err)
 	}
+	if err := finalizeText(); err != nil {
+		srvOpts.logger.Warnf("Error finalizing gRPC web text response: %v", err)
+	}
+	if err := finalizeGzip(); err != nil {
+		srvOpts.logger.Warnf("Error finalizing gzipped gRPC web response: %v", err)
+	}
+}
+
+// serveWithRecovery serves the downgraded gRPC request. If serving the request panics, the response status is set to
+// `Internal`, such that a well-formed trailer frame is sent to the client instead of a truncated response.
+// This covers panics in the response writers of the handler only. gRPC service methods are invoked in separate
+// goroutines, hence panics in service methods are recovered by UnaryRecoveryInterceptor and StreamRecoveryInterceptor
+// if installed on the gRPC server.
+func serveWithRecovery(grpcSrv *grpc.Server, w http.ResponseWriter, req *http.Request, logger Logger) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		if r == http.ErrAbortHandler {
+			panic(r)
+		}
+		logger.Warnf("Panic while serving downgraded gRPC request for %s: %v", req.URL.Path, r)
+
+		setTrailerStatus(w.Header(), codes.Internal, "internal error while serving request")
+	}()
+
+	grpcSrv.ServeHTTP(w, req)
 }
 
 // CreateDowngradingHandler takes a gRPC server and a plain HTTP handler, and returns an HTTP handler that has the
 // capability of handling HTTP requests and gRPC requests that may require downgrading the response to gRPC-Web or gRPC-WebSocket.
 func CreateDowngradingHandler(grpcSrv *grpc.Server, httpHandler http.Handler, opts ...Option) http.Handler {
-	// Only allow paths corresponding to gRPC methods that do not use client streaming for gRPC-Web.
+	return NewDowngradingHandler(grpcSrv, httpHandler, opts...)
+}
+
+// NewDowngradingHandler is like CreateDowngradingHandler, but returns a handler that additionally supports
+// draining gRPC requests for a graceful shutdown.
+func NewDowngradingHandler(grpcSrv *grpc.Server, httpHandler http.Handler, opts ...Option) *DowngradingHandler {
+	// Only allow paths corresponding to gRPC methods that do not use bidi streaming for gRPC-Web. Client-streaming
+	// methods are allowed as the response is only sent after the client has finished sending.
 	validGRPCWebPaths := make(map[string]struct{})
+	clientStreamingPaths := make(map[string]struct{})
+	serverStreamingPaths := make(map[string]struct{})
+	unaryPaths := make(map[string]struct{})
+	allGRPCPaths := make(map[string]struct{})
 
 	for svcName, svcInfo := range grpcSrv.GetServiceInfo() {
 		for _, methodInfo := range svcInfo.Methods {
+			fullMethodName := fmt.Sprintf("/%s/%s", svcName, methodInfo.Name)
+			allGRPCPaths[fullMethodName] = struct{}{}
 			if methodInfo.IsClientStream {
-				// Filter out client-streaming methods.
-				continue
+				if methodInfo.IsServerStream {
+					// Filter out bidi-streaming methods.
+					continue
+				}
+				clientStreamingPaths[fullMethodName] = struct{}{}
+			} else if methodInfo.IsServerStream {
+				serverStreamingPaths[fullMethodName] = struct{}{}
+			} else {
+				unaryPaths[fullMethodName] = struct{}{}
 			}
 
-			fullMethodName := fmt.Sprintf("/%s/%s", svcName, methodInfo.Name)
 			validGRPCWebPaths[fullMethodName] = struct{}{}
 		}
 	}
@@ -172,37 +304,251 @@ func CreateDowngradingHandler(grpcSrv *grpc.Server, httpHandler http.Handler, op
 	for _, opt := range opts {
 		opt.apply(&serverOpts)
 	}
+	if serverOpts.maxFrameSize == 0 {
+		serverOpts.maxFrameSize = grpcproto.DefaultMaxFrameSize
+	}
+	if serverOpts.logger == nil {
+		serverOpts.logger = nopLogger{}
+	}
+	if serverOpts.wsSubprotocol == "" {
+		serverOpts.wsSubprotocol = grpcwebsocket.SubprotocolName
+	}
 
-	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		if isUpgrade, err := isWebSocketUpgrade(req.Header); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		} else if isUpgrade {
-			handleGRPCWS(w, req, grpcSrv)
+	h := &DowngradingHandler{}
+	adm := &admission{
+		opts:         &serverOpts,
+		streams:      &h.streams,
+		limiter:      newStreamLimiter(serverOpts.maxConcurrentStreams, serverOpts.streamQueueTimeout),
+		frameLimiter: newFrameRateLimiter(serverOpts.framesPerSecond, serverOpts.frameBurst),
+	}
+	// Unary calls are not subject to the stream idle timeout, as their clients cannot keep them active while waiting for
+	// the response. They are bounded by their deadline instead.
+	streamIdleTimeout := func(path string) time.Duration {
+		if _, isUnary := unaryPaths[path]; isUnary {
+			return 0
+		}
+		return serverOpts.streamIdleTimeout
+	}
+	h.handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		origReq := req
+		if serverOpts.pathPrefix != "" {
+			var ok bool
+			if req, ok = stripPathPrefix(req, serverOpts.pathPrefix); !ok {
+				httpHandler.ServeHTTP(w, origReq)
+				return
+			}
+		}
+		tunnelPath := req.URL.Path
+		if serverOpts.methodHeader {
+			if method := req.Header.Get(grpcproto.MethodHeader); method != "" {
+				req = withMethodPath(req, method)
+			}
+		}
+		if len(serverOpts.trustedProxies) > 0 {
+			req = withClientAddr(req, serverOpts.trustedProxies)
+		}
+
+		if serverOpts.cors != nil && isCORSPreflight(req) {
+			if _, isGRPCPath := allGRPCPaths[req.URL.Path]; isGRPCPath {
+				serverOpts.cors.handlePreflight(w, req)
+				return
+			}
+		}
+
+		if isUpgrade, err := isWebSocketUpgrade(req.Header, serverOpts.wsSubprotocol); err != nil || isUpgrade {
+			if serverOpts.wsPath != "" {
+				if tunnelPath != serverOpts.wsPath {
+					http.Error(w, fmt.Sprintf("gRPC-WebSocket requests are only accepted at %s", serverOpts.wsPath), http.StatusNotFound)
+					return
+				}
+				if method := req.Header.Get(grpcproto.MethodHeader); method != "" {
+					req = withMethodPath(req, method)
+				} else if req.URL.Path == tunnelPath {
+					http.Error(w, fmt.Sprintf("missing %s header in gRPC-WebSocket request", grpcproto.MethodHeader), http.StatusBadRequest)
+					return
+				}
+			}
+			req = withTransport(req, TransportGRPCWebSocket)
+			serverOpts.logger.Debugf("Serving %s request for %s", TransportGRPCWebSocket, req.URL.Path)
+			rec, w := startRecording(serverOpts.statsHandler, w, req, TransportGRPCWebSocket)
+			defer rec.finish()
+
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			limit, release, rej := adm.admit(req, origReq.RemoteAddr, true)
+			if rej != nil {
+				http.Error(w, rej.msg, rej.httpStatus)
+				return
+			}
+			defer release()
+			// Only sanitize the timeout header. The deadline is applied by the gRPC server, as the WebSocket connection
+			// needs to outlive it in order to send the final status.
+			grpcDeadline(req, time.Now(), serverOpts.logger)
+			restoreMetadataHeaders(req.Header)
+			handleGRPCWS(w, req, grpcSrv, &serverOpts, streamIdleTimeout(req.URL.Path), limit, rec)
 			return
 		}
 
-		if !isContentTypeValid(req.Header.Get("Content-Type")) {
+		if serverOpts.connectProtocol {
+			if _, isUnary := unaryPaths[req.URL.Path]; isUnary {
+				if codec, ok := connectCodec(req); ok {
+					if serverOpts.cors != nil {
+						serverOpts.cors.addResponseHeaders(w, req)
+					}
+
+					req = withTransport(req, TransportConnect)
+					serverOpts.logger.Debugf("Serving %s request for %s", TransportConnect, req.URL.Path)
+					rec, w := startRecording(serverOpts.statsHandler, w, req, TransportConnect)
+					defer rec.finish()
+
+					_, release, rej := adm.admit(req, origReq.RemoteAddr, true)
+					if rej != nil {
+						writeConnectError(w, serverOpts.logger, nil, rej.code, rej.msg)
+						return
+					}
+					defer release()
+
+					handleConnectUnary(w, req, codec, grpcSrv, &serverOpts, rec)
+					return
+				}
+			}
+		}
+
+		contentType := req.Header.Get("Content-Type")
+		if !isContentTypeValid(contentType) {
 			// Non-gRPC request to the same port.
-			httpHandler.ServeHTTP(w, req)
+			httpHandler.ServeHTTP(w, origReq)
+			return
+		}
+
+		if serverOpts.cors != nil {
+			serverOpts.cors.addResponseHeaders(w, req)
+		}
+
+		if req.Method != http.MethodPost {
+			// The gRPC server would reject the request as well, but its error would be garbled by bridging it.
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, fmt.Sprintf("gRPC requests must use the POST method, not %s", req.Method), http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Responses to server-streaming calls are sent incrementally by flushing the response writer after every
+		// message. Without flushing, the HTTP server would buffer messages until the response is complete, which is
+		// fine for calls with a single response message only.
+		_, canFlush := w.(http.Flusher)
+		_, isServerStreaming := serverStreamingPaths[req.URL.Path]
+
+		transport := transportForContentType(contentType)
+		req = withTransport(req, transport)
+		serverOpts.logger.Debugf("Serving %s request for %s via %s", transport, req.URL.Path, req.Proto)
+		rec, w := startRecording(serverOpts.statsHandler, w, req, transport)
+		defer rec.finish()
+
+		if !canFlush && isServerStreaming {
+			serverOpts.logger.Warnf("Cannot serve gRPC request for %s: %s", req.URL.Path, flusherRequiredMessage)
+			http.Error(w, flusherRequiredMessage, http.StatusInternalServerError)
+			return
+		}
+
+		downgraded := !isNativeGRPC(req, contentType)
+		limit, release, rej := adm.admit(req, origReq.RemoteAddr, downgraded)
+		if rej != nil {
+			rec.serve(w, req, rej.serveTrailersOnly)
 			return
 		}
+		defer release()
+
+		grpcDeadline(req, time.Now(), serverOpts.logger)
+		if downgraded {
+			restoreMetadataHeaders(req.Header)
+		} else {
+			// Native gRPC clients send their user agent in the User-Agent header, and X-User-Agent is regular metadata.
+			grpcproto.SplitBinaryMetadata(req.Header)
+		}
 
 		// Internally content type must be application/grpc,
 		// See: https://github.com/grpc/grpc-go/blob/9deee9b/internal/grpcutil/method.go#L61
 		req.Header.Set("Content-Type", "application/grpc")
 
-		handleGRPCWeb(w, req, validGRPCWebPaths, grpcSrv, &serverOpts)
+		if transport == TransportGRPCWebText {
+			req.Body = grpcweb.NewTextReader(req.Body)
+		}
+		if downgraded {
+			req.Body = newEndOfStreamReader(req.Body, limit)
+		}
+
+		handleGRPCWeb(w, req, validGRPCWebPaths, clientStreamingPaths, grpcSrv, &serverOpts, transport, streamIdleTimeout(req.URL.Path), limit, rec)
 	})
+	return h
+}
+
+// restoreMetadataHeaders undoes changes to the headers carrying gRPC metadata that are due to the request being sent
+// via HTTP/1.x, or by a gRPC-Web client. It must not be applied to native gRPC requests.
+func restoreMetadataHeaders(hdr http.Header) {
+	grpcproto.SplitBinaryMetadata(hdr)
+	// The User-Agent header identifies the browser or the tunnel rather than the gRPC client in this case.
+	if userAgent := hdr.Get(grpcweb.UserAgentHeader); userAgent != "" {
+		hdr.Set("User-Agent", userAgent)
+		hdr.Del(grpcweb.UserAgentHeader)
+	}
+}
+
+// stripPathPrefix returns a shallow copy of the given request with the given prefix removed from the URL path, in the
+// same way as `http.StripPrefix`. It returns false if the path does not start with the prefix, followed by a slash.
+func stripPathPrefix(req *http.Request, prefix string) (*http.Request, bool) {
+	path := strings.TrimPrefix(req.URL.Path, prefix)
+	if len(path) == len(req.URL.Path) || !strings.HasPrefix(path, "/") {
+		return nil, false
+	}
+	rawPath := strings.TrimPrefix(req.URL.RawPath, prefix)
+	if req.URL.RawPath != "" && len(rawPath) == len(req.URL.RawPath) {
+		return nil, false
+	}
+
+	strippedReq := new(http.Request)
+	*strippedReq = *req
+	strippedReq.URL = new(url.URL)
+	*strippedReq.URL = *req.URL
+	strippedReq.URL.Path = path
+	strippedReq.URL.RawPath = rawPath
+	return strippedReq, true
+}
+
+// withMethodPath returns a shallow copy of the given request with the URL path set to the given gRPC method, and the
+// header conveying it removed.
+func withMethodPath(req *http.Request, method string) *http.Request {
+	methodReq := new(http.Request)
+	*methodReq = *req
+	methodReq.URL = new(url.URL)
+	*methodReq.URL = *req.URL
+	methodReq.URL.Path = method
+	methodReq.URL.RawPath = ""
+	methodReq.Header = req.Header.Clone()
+	methodReq.Header.Del(grpcproto.MethodHeader)
+	return methodReq
 }
 
 func isContentTypeValid(contentType string) bool {
 	ct, _ := stringutils.Split2(contentType, "+")
-	return ct == "application/grpc" || ct == "application/grpc-web"
+	return ct == "application/grpc" || ct == "application/grpc-web" || ct == grpcweb.TextContentType
+}
+
+func transportForContentType(contentType string) Transport {
+	ct, _ := stringutils.Split2(contentType, "+")
+	switch ct {
+	case "application/grpc-web":
+		return TransportGRPCWeb
+	case grpcweb.TextContentType:
+		return TransportGRPCWebText
+	default:
+		return TransportGRPC
+	}
 }
 
-func isWebSocketUpgrade(header http.Header) (bool, error) {
-	if header.Get("Sec-Websocket-Protocol") != grpcwebsocket.SubprotocolName {
+func isWebSocketUpgrade(header http.Header, subprotocol string) (bool, error) {
+	if header.Get("Sec-Websocket-Protocol") != subprotocol {
 		return false, nil
 	}
 
@@ -0,0 +1,440 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"golang.stackrox.io/grpc-http1/internal/grpcweb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	healthCheckPath = "/grpc.health.v1.Health/Check"
+	healthWatchPath = "/grpc.health.v1.Health/Watch"
+)
+
+func newHealthServer(t *testing.T) *grpc.Server {
+	grpcSrv := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcSrv, health.NewServer())
+	t.Cleanup(grpcSrv.Stop)
+	return grpcSrv
+}
+
+// newGRPCWebRequest returns a gRPC-Web request carrying a single empty message.
+func newGRPCWebRequest(ctx context.Context, path string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(grpcproto.MakeMessageHeader(0, 0)))
+	req.Header.Set("Content-Type", "application/grpc-web")
+	req.Header.Set("Accept", "application/grpc-web")
+	return req.WithContext(ctx)
+}
+
+// readGRPCWebResponse returns the data and trailers of a gRPC-Web response.
+func readGRPCWebResponse(t *testing.T, body io.Reader) ([]byte, http.Header) {
+	var trailers http.Header
+	data, err := io.ReadAll(grpcweb.NewResponseReader(io.NopCloser(body), &trailers, nil, 0))
+	require.NoError(t, err)
+	return data, trailers
+}
+
+// panickingWriter is a response writer that panics on the first write.
+type panickingWriter struct {
+	*httptest.ResponseRecorder
+	panicked bool
+}
+
+func (w *panickingWriter) Write(buf []byte) (int, error) {
+	if !w.panicked {
+		w.panicked = true
+		panic("write failed")
+	}
+	return w.ResponseRecorder.Write(buf)
+}
+
+// panickingHealthServer is a health server whose methods panic.
+type panickingHealthServer struct {
+	healthpb.UnimplementedHealthServer
+}
+
+func (panickingHealthServer) Check(context.Context, *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	panic("check failed")
+}
+
+func (panickingHealthServer) Watch(*healthpb.HealthCheckRequest, healthpb.Health_WatchServer) error {
+	panic("watch failed")
+}
+
+func TestPanicInServiceMethodWritesInternalStatus(t *testing.T) {
+	grpcSrv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(UnaryRecoveryInterceptor(nil)),
+		grpc.ChainStreamInterceptor(StreamRecoveryInterceptor(nil)),
+	)
+	healthpb.RegisterHealthServer(grpcSrv, panickingHealthServer{})
+	t.Cleanup(grpcSrv.Stop)
+	handler := CreateDowngradingHandler(grpcSrv, http.NotFoundHandler())
+
+	for _, path := range []string{healthCheckPath, healthWatchPath} {
+		t.Run(path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, newGRPCWebRequest(context.Background(), path))
+
+			// The call fails before any message is sent, resulting in a Trailers-Only response.
+			assert.Equal(t, fmt.Sprintf("%d", codes.Internal), rec.Header().Get("Grpc-Status"))
+			assert.Equal(t, "internal error while serving request", rec.Header().Get("Grpc-Message"))
+		})
+	}
+}
+
+func TestPanicInResponseWriterWritesInternalStatus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler())
+
+	w := &panickingWriter{ResponseRecorder: httptest.NewRecorder()}
+	handler.ServeHTTP(w, newGRPCWebRequest(ctx, healthCheckPath))
+	assert.True(t, w.panicked)
+
+	_, trailers := readGRPCWebResponse(t, w.Body)
+	assert.Equal(t, fmt.Sprintf("%d", codes.Internal), trailers.Get("Grpc-Status"))
+	assert.NotEmpty(t, trailers.Get("Grpc-Message"))
+}
+
+// nonFlushingWriter is a response writer that hides the http.Flusher implementation of the underlying writer.
+type nonFlushingWriter struct {
+	http.ResponseWriter
+}
+
+func TestNonFlushingWriter(t *testing.T) {
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler())
+
+	t.Run("server streaming is rejected", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(nonFlushingWriter{ResponseWriter: rec}, newGRPCWebRequest(context.Background(), healthWatchPath))
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Contains(t, rec.Body.String(), "http.Flusher")
+	})
+
+	t.Run("unary is buffered", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(nonFlushingWriter{ResponseWriter: rec}, newGRPCWebRequest(context.Background(), healthCheckPath))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		data, trailers := readGRPCWebResponse(t, rec.Body)
+		assert.Equal(t, fmt.Sprintf("%d", codes.OK), trailers.Get("Grpc-Status"))
+		assert.NotEmpty(t, data)
+	})
+}
+
+func TestServerStreamingResponseIsFlushedPerMessage(t *testing.T) {
+	const (
+		numUpdates = 3
+		interval   = 50 * time.Millisecond
+	)
+
+	grpcSrv := grpc.NewServer()
+	healthSrv := health.NewServer()
+	healthpb.RegisterHealthServer(grpcSrv, healthSrv)
+	t.Cleanup(grpcSrv.Stop)
+
+	// The test server speaks HTTP/1.1 only, hence the response is downgraded to gRPC-Web.
+	srv := httptest.NewServer(CreateDowngradingHandler(grpcSrv, http.NotFoundHandler()))
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+healthWatchPath, bytes.NewReader(grpcproto.MakeMessageHeader(0, 0)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/grpc-web")
+	req.Header.Set("Accept", "application/grpc-web")
+
+	resp, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// readMessage reads a single message frame. As the watch never ends on its own, receiving a message at all
+	// means that it was flushed before the response was complete.
+	readMessage := func() {
+		hdr := make([]byte, grpcproto.MessageHeaderLength)
+		_, err := io.ReadFull(resp.Body, hdr)
+		require.NoError(t, err)
+		require.True(t, grpcproto.IsDataFrame(hdr))
+		_, length, err := grpcproto.ParseMessageHeader(hdr)
+		require.NoError(t, err)
+		_, err = io.CopyN(io.Discard, resp.Body, int64(length))
+		require.NoError(t, err)
+	}
+
+	// Initial status.
+	readMessage()
+
+	// Every update is only emitted once the previous one has been received, so each message must be received while
+	// the stream is still open, rather than being buffered until the response is complete.
+	statuses := []healthpb.HealthCheckResponse_ServingStatus{healthpb.HealthCheckResponse_NOT_SERVING, healthpb.HealthCheckResponse_SERVING}
+	for i := 0; i < numUpdates; i++ {
+		time.Sleep(interval)
+		healthSrv.SetServingStatus("", statuses[i%len(statuses)])
+		readMessage()
+	}
+}
+
+func TestPathPrefix(t *testing.T) {
+	var fallbackPaths []string
+	fallback := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fallbackPaths = append(fallbackPaths, req.URL.Path)
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := CreateDowngradingHandler(newHealthServer(t), fallback, WithPathPrefix("/api/grpc/"))
+
+	// gRPC request below the prefix.
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newGRPCWebRequest(context.Background(), "/api/grpc"+healthCheckPath))
+	require.Equal(t, http.StatusOK, rec.Code)
+	_, trailers := readGRPCWebResponse(t, rec.Body)
+	assert.Equal(t, "0", trailers.Get("Grpc-Status"))
+	assert.Empty(t, fallbackPaths)
+
+	// gRPC requests not matching the prefix, and non-gRPC requests below the prefix, are passed on unmodified.
+	for _, path := range []string{healthCheckPath, "/api/grpcfoo" + healthCheckPath, "/api/grpc"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newGRPCWebRequest(context.Background(), path))
+		assert.Equal(t, http.StatusTeapot, rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/grpc/index.html", nil))
+	assert.Equal(t, http.StatusTeapot, rec.Code)
+
+	assert.Equal(t, []string{healthCheckPath, "/api/grpcfoo" + healthCheckPath, "/api/grpc", "/api/grpc/index.html"}, fallbackPaths)
+}
+
+func TestNonPOSTRequestIsRejected(t *testing.T) {
+	var fallbackMethods []string
+	fallback := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fallbackMethods = append(fallbackMethods, req.Method)
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := CreateDowngradingHandler(newHealthServer(t), fallback)
+
+	methods := []string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions, http.MethodTrace}
+	for _, method := range methods {
+		for _, contentType := range []string{"application/grpc", "application/grpc-web", "application/grpc-web-text+proto"} {
+			t.Run(fmt.Sprintf("%s %s", method, contentType), func(t *testing.T) {
+				req := newGRPCWebRequest(context.Background(), healthCheckPath)
+				req.Method = method
+				req.Header.Set("Content-Type", contentType)
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+				assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+				assert.Equal(t, http.MethodPost, rec.Header().Get("Allow"))
+				assert.Contains(t, rec.Body.String(), "gRPC requests must use the POST method, not "+method)
+			})
+		}
+
+		// Non-gRPC requests are still passed to the HTTP handler.
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, healthCheckPath, nil))
+		assert.Equal(t, http.StatusTeapot, rec.Code)
+	}
+	assert.Equal(t, methods, fallbackMethods)
+}
+
+func TestMethodHeader(t *testing.T) {
+	newTunnelRequest := func() *http.Request {
+		req := newGRPCWebRequest(context.Background(), "/tunnel")
+		req.Header.Set("Grpc-Http1-Method", healthCheckPath)
+		return req
+	}
+
+	// Without the option, the header is ignored, and the path is not a known method.
+	rec := httptest.NewRecorder()
+	CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler()).ServeHTTP(rec, newTunnelRequest())
+	assert.NotEqual(t, http.StatusOK, rec.Code)
+
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithMethodHeader())
+	req := newTunnelRequest()
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	_, trailers := readGRPCWebResponse(t, rec.Body)
+	assert.Equal(t, "0", trailers.Get("Grpc-Status"))
+	// The request passed in must not be modified.
+	assert.Equal(t, "/tunnel", req.URL.Path)
+	assert.Equal(t, healthCheckPath, req.Header.Get("Grpc-Http1-Method"))
+}
+
+func TestCombinedBinaryMetadataIsSplit(t *testing.T) {
+	incomingMDs := make(chan metadata.MD, 1)
+	grpcSrv := grpc.NewServer(grpc.UnaryInterceptor(
+		func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			incomingMDs <- md
+			return handler(ctx, req)
+		}))
+	healthpb.RegisterHealthServer(grpcSrv, health.NewServer())
+	defer grpcSrv.Stop()
+
+	req := newGRPCWebRequest(context.Background(), healthCheckPath)
+	// Multiple values combined into one, as done by some HTTP/1.x intermediaries.
+	req.Header.Set("Custom-Bin", "AAEC, /w,gA==")
+	rec := httptest.NewRecorder()
+	CreateDowngradingHandler(grpcSrv, http.NotFoundHandler()).ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	_, trailers := readGRPCWebResponse(t, rec.Body)
+	require.Equal(t, "0", trailers.Get("Grpc-Status"))
+
+	md := <-incomingMDs
+	assert.Equal(t, []string{"\x00\x01\x02", "\xff", "\x80"}, md.Get("custom-bin"))
+}
+
+func TestHTTPTrailers(t *testing.T) {
+	srv := httptest.NewServer(CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithHTTPTrailers()))
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+healthCheckPath, bytes.NewReader(grpcproto.MakeMessageHeader(0, 0)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/grpc-web")
+	req.Header.Set("Accept", "application/grpc-web")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	// The body consists of the response message only, without a trailers frame.
+	require.GreaterOrEqual(t, len(body), grpcproto.MessageHeaderLength)
+	require.True(t, grpcproto.IsDataFrame(body))
+	_, length, err := grpcproto.ParseMessageHeader(body[:grpcproto.MessageHeaderLength])
+	require.NoError(t, err)
+	assert.Len(t, body, grpcproto.MessageHeaderLength+int(length))
+
+	assert.Equal(t, "0", resp.Trailer.Get("Grpc-Status"))
+	assert.Empty(t, resp.Header.Get("Grpc-Status"))
+}
+
+func TestHTTPTrailers_NotAccepted(t *testing.T) {
+	srv := httptest.NewServer(CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithHTTPTrailers()))
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Without `TE: trailers`, the HTTP/1.1 client might not support trailers, hence an in-band trailers frame is sent.
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+healthCheckPath, bytes.NewReader(grpcproto.MakeMessageHeader(0, 0)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/grpc-web")
+	req.Header.Set("Accept", "application/grpc-web")
+
+	resp, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	data, trailers := readGRPCWebResponse(t, resp.Body)
+	assert.NotEmpty(t, data)
+	assert.Equal(t, "0", trailers.Get("Grpc-Status"))
+	assert.Empty(t, resp.Trailer.Get("Grpc-Status"))
+}
+
+func TestGRPCWebOverH2C(t *testing.T) {
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler())
+	srv := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	t.Cleanup(srv.Close)
+
+	transport := &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return new(net.Dialer).DialContext(ctx, network, addr)
+		},
+	}
+	t.Cleanup(transport.CloseIdleConnections)
+
+	// The response format is determined by the content type of the request alone, even if the client would accept
+	// trailers.
+	cases := map[string]struct {
+		contentType string
+		header      http.Header
+	}{
+		"accept header": {
+			contentType: "application/grpc-web",
+			header:      http.Header{"Accept": {"application/grpc-web"}},
+		},
+		"no accept header": {
+			contentType: "application/grpc-web",
+		},
+		"trailers accepted": {
+			contentType: "application/grpc-web",
+			header:      http.Header{"Te": {"trailers"}},
+		},
+		"text": {
+			contentType: grpcweb.TextContentType,
+			header:      http.Header{"Te": {"trailers"}},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			body := grpcproto.MakeMessageHeader(0, 0)
+			if c.contentType == grpcweb.TextContentType {
+				body = []byte("AAAAAAA=")
+			}
+			req, err := http.NewRequest(http.MethodPost, srv.URL+healthCheckPath, bytes.NewReader(body))
+			require.NoError(t, err)
+			for k, vs := range c.header {
+				req.Header[k] = vs
+			}
+			req.Header.Set("Content-Type", c.contentType)
+
+			resp, err := transport.RoundTrip(req)
+			require.NoError(t, err)
+			defer func() { _ = resp.Body.Close() }()
+			require.Equal(t, 2, resp.ProtoMajor)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, c.contentType, resp.Header.Get("Content-Type"))
+
+			respBody := resp.Body
+			if c.contentType == grpcweb.TextContentType {
+				respBody = grpcweb.NewTextReader(respBody)
+			}
+			data, trailers := readGRPCWebResponse(t, respBody)
+			assert.NotEmpty(t, data)
+			assert.Equal(t, fmt.Sprintf("%d", codes.OK), trailers.Get("Grpc-Status"))
+			assert.Empty(t, resp.Trailer.Get("Grpc-Status"))
+		})
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"golang.stackrox.io/grpc-http1/internal/httputils"
+	"golang.stackrox.io/grpc-http1/internal/ioutils"
+	"google.golang.org/grpc/codes"
+)
+
+// Transport is the kind of transport a gRPC request was received over.
+type Transport string
+
+const (
+	// TransportGRPC denotes a native gRPC request.
+	TransportGRPC Transport = "grpc"
+	// TransportGRPCWeb denotes a gRPC-Web request.
+	TransportGRPCWeb Transport = "grpc-web"
+	// TransportGRPCWebText denotes a base64-encoded gRPC-Web request.
+	TransportGRPCWebText Transport = "grpc-web-text"
+	// TransportGRPCWebSocket denotes a gRPC request tunneled through a WebSocket connection.
+	TransportGRPCWebSocket Transport = "grpc-websocket"
+	// TransportConnect denotes a unary request using the Connect protocol.
+	TransportConnect Transport = "connect"
+)
+
+// RPCInfo describes a gRPC request received by the downgrading handler.
+type RPCInfo struct {
+	// Method is the full method name, e.g., `/grpc.health.v1.Health/Check`.
+	Method string
+	// Transport is the kind of transport the request was received over.
+	Transport Transport
+	// StartTime is the time at which the request was received.
+	StartTime time.Time
+}
+
+// RPCStats describes a gRPC request that has been handled by the downgrading handler.
+type RPCStats struct {
+	RPCInfo
+
+	// Duration is the time it took to handle the request.
+	Duration time.Duration
+	// Downgraded indicates whether the response was sent in the gRPC-Web format.
+	Downgraded bool
+	// BytesReceived is the number of bytes of gRPC message frames received from the client.
+	BytesReceived int64
+	// BytesSent is the number of bytes of gRPC message frames sent to the client.
+	BytesSent int64
+	// FramesReceived is the number of gRPC message frames received from the client.
+	FramesReceived int64
+	// FramesSent is the number of gRPC message frames sent to the client.
+	FramesSent int64
+	// HTTPStatus is the HTTP status code of the response.
+	HTTPStatus int
+	// Code is the final gRPC status code. If the request was rejected before reaching the gRPC server, this is
+	// derived from the HTTP status code.
+	Code codes.Code
+}
+
+// StatsHandler receives callbacks whenever the downgrading handler receives and finishes handling a gRPC request.
+// The callbacks are invoked synchronously, hence implementations should not block.
+type StatsHandler interface {
+	// RPCStarted is called when a gRPC request is received.
+	RPCStarted(ctx context.Context, info RPCInfo)
+	// RPCFinished is called when a gRPC request has been handled, including requests that failed early.
+	RPCFinished(ctx context.Context, stats RPCStats)
+}
+
+// statsRecorder collects the stats of a single request. All methods are safe to call on a nil recorder.
+type statsRecorder struct {
+	handler StatsHandler
+	ctx     context.Context
+	stats   RPCStats
+
+	grpcStatus     string
+	bytesReceived  int64
+	bytesSent      int64
+	framesReceived ioutils.FrameCounter
+	framesSent     ioutils.FrameCounter
+}
+
+// startRecording notifies the stats handler of a new request, and returns a recorder as well as a response writer
+// to use for the request. If the stats handler is nil, the recorder is nil.
+func startRecording(handler StatsHandler, w http.ResponseWriter, req *http.Request, transport Transport) (*statsRecorder, http.ResponseWriter) {
+	if handler == nil {
+		return nil, w
+	}
+	r := &statsRecorder{
+		handler: handler,
+		ctx:     req.Context(),
+	}
+	r.stats.RPCInfo = RPCInfo{
+		Method:    req.URL.Path,
+		Transport: transport,
+		StartTime: time.Now(),
+	}
+	handler.RPCStarted(r.ctx, r.stats.RPCInfo)
+	return r, &statusRecordingResponseWriter{ResponseWriter: w, stats: &r.stats}
+}
+
+// setDowngraded records that the response is sent in the gRPC-Web format.
+func (r *statsRecorder) setDowngraded() {
+	if r != nil {
+		r.stats.Downgraded = true
+	}
+}
+
+// serve invokes the given serve function with a response writer and a request body that record the number of bytes
+// and frames sent and received, and records the gRPC status afterwards.
+func (r *statsRecorder) serve(w http.ResponseWriter, req *http.Request, serveFn func(http.ResponseWriter, *http.Request)) {
+	if r == nil {
+		serveFn(w, req)
+		return
+	}
+
+	req.Body = ioutils.NewFrameCountingReader(ioutils.NewCountingReader(req.Body, &r.bytesReceived), &r.framesReceived)
+	serveFn(&countingResponseWriter{ResponseWriter: w, count: &r.bytesSent, frames: &r.framesSent}, req)
+
+	hdr := w.Header()
+	r.grpcStatus = hdr.Get("Grpc-Status")
+	if r.grpcStatus == "" {
+		r.grpcStatus = hdr.Get(http.TrailerPrefix + "Grpc-Status")
+	}
+}
+
+// finish notifies the stats handler that the request has been handled.
+func (r *statsRecorder) finish() {
+	if r == nil {
+		return
+	}
+	r.stats.Duration = time.Since(r.stats.StartTime)
+	r.stats.BytesReceived = atomic.LoadInt64(&r.bytesReceived)
+	r.stats.BytesSent = atomic.LoadInt64(&r.bytesSent)
+	r.stats.FramesReceived = r.framesReceived.Frames()
+	r.stats.FramesSent = r.framesSent.Frames()
+	if r.stats.HTTPStatus == 0 {
+		r.stats.HTTPStatus = http.StatusOK
+	}
+
+	r.stats.Code = httputils.GRPCCodeFromHTTPStatus(r.stats.HTTPStatus)
+	if code, err := strconv.ParseUint(r.grpcStatus, 10, 32); err == nil {
+		r.stats.Code = codes.Code(code)
+	} else if r.stats.HTTPStatus == http.StatusOK || r.stats.HTTPStatus == http.StatusSwitchingProtocols {
+		// No gRPC status was sent despite the request being accepted.
+		r.stats.Code = codes.Unknown
+	}
+	r.handler.RPCFinished(r.ctx, r.stats)
+}
+
+// statusRecordingResponseWriter records the HTTP status code of the response.
+type statusRecordingResponseWriter struct {
+	http.ResponseWriter
+	stats *RPCStats
+}
+
+func (w *statusRecordingResponseWriter) WriteHeader(statusCode int) {
+	if w.stats.HTTPStatus == 0 {
+		w.stats.HTTPStatus = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *statusRecordingResponseWriter) Write(buf []byte) (int, error) {
+	if w.stats.HTTPStatus == 0 {
+		w.stats.HTTPStatus = http.StatusOK
+	}
+	return w.ResponseWriter.Write(buf)
+}
+
+func (w *statusRecordingResponseWriter) Flush() {
+	if flusher, _ := w.ResponseWriter.(http.Flusher); flusher != nil {
+		flusher.Flush()
+	}
+}
+
+// Hijack is required for accepting WebSocket connections.
+func (w *statusRecordingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, _ := w.ResponseWriter.(http.Hijacker)
+	if hijacker == nil {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+func (w *statusRecordingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// countingResponseWriter records the number of bytes and frames written.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	count  *int64
+	frames *ioutils.FrameCounter
+}
+
+func (w *countingResponseWriter) Write(buf []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(buf)
+	atomic.AddInt64(w.count, int64(n))
+	_, _ = w.frames.Write(buf[:n])
+	return n, err
+}
+
+func (w *countingResponseWriter) Flush() {
+	if flusher, _ := w.ResponseWriter.(http.Flusher); flusher != nil {
+		flusher.Flush()
+	}
+}
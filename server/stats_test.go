@@ -0,0 +1,113 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"google.golang.org/grpc/codes"
+)
+
+type fakeStatsHandler struct {
+	started  []RPCInfo
+	finished []RPCStats
+}
+
+func (h *fakeStatsHandler) RPCStarted(_ context.Context, info RPCInfo) {
+	h.started = append(h.started, info)
+}
+
+func (h *fakeStatsHandler) RPCFinished(_ context.Context, stats RPCStats) {
+	h.finished = append(h.finished, stats)
+}
+
+func TestStatsHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stats := &fakeStatsHandler{}
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithStatsHandler(stats))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newGRPCWebRequest(ctx, healthCheckPath))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	require.Len(t, stats.started, 1)
+	assert.Equal(t, healthCheckPath, stats.started[0].Method)
+	assert.Equal(t, TransportGRPCWeb, stats.started[0].Transport)
+
+	require.Len(t, stats.finished, 1)
+	finished := stats.finished[0]
+	assert.Equal(t, stats.started[0], finished.RPCInfo)
+	assert.True(t, finished.Downgraded)
+	assert.Equal(t, codes.OK, finished.Code)
+	assert.Equal(t, http.StatusOK, finished.HTTPStatus)
+	assert.EqualValues(t, grpcproto.MessageHeaderLength, finished.BytesReceived)
+	assert.Greater(t, finished.BytesSent, int64(grpcproto.MessageHeaderLength))
+	assert.EqualValues(t, 1, finished.FramesReceived)
+	assert.EqualValues(t, 1, finished.FramesSent)
+}
+
+func TestStatsHandler_GRPCError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stats := &fakeStatsHandler{}
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithStatsHandler(stats))
+
+	// The announced message length exceeds the actual body.
+	req := newGRPCWebRequest(ctx, healthCheckPath)
+	req.Body = io.NopCloser(bytes.NewReader(grpcproto.MakeMessageHeader(0, 10)))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.Len(t, stats.finished, 1)
+	assert.NotEqual(t, codes.OK, stats.finished[0].Code)
+}
+
+func TestStatsHandler_EarlyError(t *testing.T) {
+	stats := &fakeStatsHandler{}
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithStatsHandler(stats))
+
+	// A gRPC request that accepts neither trailers nor gRPC-Web responses is rejected before reaching the gRPC server.
+	req := httptest.NewRequest(http.MethodPost, healthCheckPath, bytes.NewReader(grpcproto.MakeMessageHeader(0, 0)))
+	req.Header.Set("Content-Type", "application/grpc")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+
+	require.Len(t, stats.started, 1)
+	assert.Equal(t, TransportGRPC, stats.started[0].Transport)
+	require.Len(t, stats.finished, 1)
+	assert.Equal(t, http.StatusInternalServerError, stats.finished[0].HTTPStatus)
+	assert.Equal(t, codes.Unknown, stats.finished[0].Code)
+	assert.False(t, stats.finished[0].Downgraded)
+}
+
+func TestStatsHandler_NonGRPCRequest(t *testing.T) {
+	stats := &fakeStatsHandler{}
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler(), WithStatsHandler(stats))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/index.html", nil))
+	assert.Empty(t, stats.started)
+	assert.Empty(t, stats.finished)
+}
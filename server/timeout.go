@@ -0,0 +1,80 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"google.golang.org/grpc/codes"
+)
+
+// grpcDeadline returns the deadline conveyed by the grpc-timeout header of the request, if any. A malformed header is
+// removed from the request, as the gRPC spec mandates treating it as if no timeout was given, whereas the gRPC server
+// would reject the request, and reported to the given logger.
+func grpcDeadline(req *http.Request, now time.Time, logger Logger) (time.Time, bool) {
+	timeoutStr := req.Header.Get(grpcproto.TimeoutHeader)
+	if timeoutStr == "" {
+		return time.Time{}, false
+	}
+	timeout, err := grpcproto.DecodeTimeout(timeoutStr)
+	if err != nil {
+		logger.Debugf("Ignoring malformed timeout of gRPC request for %s: %v", req.URL.Path, err)
+		req.Header.Del(grpcproto.TimeoutHeader)
+		return time.Time{}, false
+	}
+	return now.Add(timeout), true
+}
+
+// withGRPCDeadline returns a request whose context expires at the deadline conveyed by the grpc-timeout header, such
+// that bridging the request is aborted as well once the deadline is exceeded.
+func withGRPCDeadline(req *http.Request, logger Logger) (*http.Request, context.CancelFunc) {
+	deadline, ok := grpcDeadline(req, time.Now(), logger)
+	if !ok {
+		return req, func() {}
+	}
+	ctx, cancel := context.WithDeadline(req.Context(), deadline)
+	return req.WithContext(ctx), cancel
+}
+
+// reportDeadlineExceeded sets the status of a downgraded response to `DeadlineExceeded` if the deadline of the request
+// has been exceeded before the RPC completed. The gRPC server would otherwise report the status returned by the service
+// method, if any, which typically is `Canceled`. This relies on trailers not having been sent yet, which is the case
+// for downgraded responses.
+func reportDeadlineExceeded(w http.ResponseWriter, req *http.Request) {
+	if req.Context().Err() != context.DeadlineExceeded {
+		return
+	}
+	hdr := w.Header()
+	okStatus := fmt.Sprintf("%d", codes.OK)
+	if hdr.Get("Grpc-Status") == okStatus || hdr.Get(http.TrailerPrefix+"Grpc-Status") == okStatus {
+		// The RPC completed in time.
+		return
+	}
+	setTrailerStatus(hdr, codes.DeadlineExceeded, "deadline exceeded")
+}
+
+// setTrailerStatus replaces any gRPC status in the trailers with the given one.
+func setTrailerStatus(hdr http.Header, code codes.Code, msg string) {
+	for _, k := range []string{"Grpc-Status", "Grpc-Message", "Grpc-Status-Details-Bin"} {
+		hdr.Del(k)
+		hdr.Del(http.TrailerPrefix + k)
+	}
+	hdr.Set(http.TrailerPrefix+"Grpc-Status", fmt.Sprintf("%d", code))
+	hdr.Set(http.TrailerPrefix+"Grpc-Message", msg)
+}
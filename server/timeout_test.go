@@ -0,0 +1,95 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"google.golang.org/grpc/codes"
+)
+
+func TestGRPCDeadline(t *testing.T) {
+	now := time.Now()
+	cases := map[string]time.Duration{
+		"2H":   2 * time.Hour,
+		"3M":   3 * time.Minute,
+		"5S":   5 * time.Second,
+		"100m": 100 * time.Millisecond,
+		"7u":   7 * time.Microsecond,
+		"42n":  42 * time.Nanosecond,
+	}
+	for timeoutStr, expectedTimeout := range cases {
+		t.Run(timeoutStr, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, healthCheckPath, nil)
+			req.Header.Set(grpcproto.TimeoutHeader, timeoutStr)
+
+			deadline, ok := grpcDeadline(req, now, nopLogger{})
+			require.True(t, ok)
+			assert.Equal(t, now.Add(expectedTimeout), deadline)
+			assert.Equal(t, timeoutStr, req.Header.Get(grpcproto.TimeoutHeader))
+		})
+	}
+}
+
+func TestGRPCDeadline_Malformed(t *testing.T) {
+	for _, timeoutStr := range []string{"100", "100x", "-1S", "123456789S"} {
+		t.Run(timeoutStr, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, healthCheckPath, nil)
+			req.Header.Set(grpcproto.TimeoutHeader, timeoutStr)
+
+			_, ok := grpcDeadline(req, time.Now(), nopLogger{})
+			assert.False(t, ok)
+			assert.Empty(t, req.Header.Values(grpcproto.TimeoutHeader))
+		})
+	}
+}
+
+func TestGRPCTimeout_MalformedIsIgnored(t *testing.T) {
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler())
+
+	req := newGRPCWebRequest(context.Background(), healthCheckPath)
+	req.Header.Set(grpcproto.TimeoutHeader, "1x")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	_, trailers := readGRPCWebResponse(t, w.Body)
+	assert.Equal(t, fmt.Sprintf("%d", codes.OK), trailers.Get("Grpc-Status"))
+}
+
+func TestGRPCTimeout_DeadlineExceeded(t *testing.T) {
+	handler := CreateDowngradingHandler(newHealthServer(t), http.NotFoundHandler())
+
+	// Watch only returns once the call is canceled.
+	req := newGRPCWebRequest(context.Background(), "/grpc.health.v1.Health/Watch")
+	req.Header.Set(grpcproto.TimeoutHeader, "50m")
+	w := httptest.NewRecorder()
+
+	start := time.Now()
+	handler.ServeHTTP(w, req)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	_, trailers := readGRPCWebResponse(t, w.Body)
+	assert.Equal(t, fmt.Sprintf("%d", codes.DeadlineExceeded), trailers.Get("Grpc-Status"))
+}
@@ -0,0 +1,36 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"context"
+	"net/http"
+)
+
+type transportKey struct{}
+
+// withTransport returns a shallow copy of the given request with the transport stored in its context.
+func withTransport(req *http.Request, transport Transport) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), transportKey{}, transport))
+}
+
+// TransportFromContext returns the transport over which the gRPC request with the given context was received by the
+// downgrading handler, as reported to the stats handler. This allows gRPC service implementations to adapt to their
+// clients, e.g., by sending smaller responses to gRPC-Web clients in browsers. The second return value is false if
+// the request was not received by the downgrading handler.
+func TransportFromContext(ctx context.Context) (Transport, bool) {
+	transport, ok := ctx.Value(transportKey{}).(Transport)
+	return transport, ok
+}
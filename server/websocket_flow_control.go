@@ -0,0 +1,41 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"golang.stackrox.io/grpc-http1/internal/grpcwebsocket"
+)
+
+// acceptWindow returns the flow-control window for the responses of a gRPC-WebSocket call, if requested via the
+// respective header of the WebSocket handshake request, and confirms it in the given response header. Otherwise, it
+// returns nil, and responses are only subject to the flow control of the underlying connection. A malformed header is
+// reported to the given logger and ignored.
+func acceptWindow(respHdr, reqHdr http.Header, logger Logger) *grpcwebsocket.Window {
+	val := reqHdr.Get(grpcproto.WindowHeader)
+	if val == "" {
+		return nil
+	}
+	n, err := strconv.ParseUint(val, 10, 32)
+	if err != nil || n == 0 {
+		logger.Debugf("Ignoring malformed %s header %q", grpcproto.WindowHeader, val)
+		return nil
+	}
+	respHdr.Set(grpcproto.WindowHeader, val)
+	return grpcwebsocket.NewWindow(uint32(n))
+}
@@ -21,6 +21,7 @@ import (
 
 	"github.com/pkg/errors"
 	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"golang.stackrox.io/grpc-http1/internal/grpcwebsocket"
 	"nhooyr.io/websocket"
 )
 
@@ -33,9 +34,18 @@ type readerResult struct {
 
 // wsReader is an io.ReadCloser that wraps around a WebSocket's io.Reader.
 type wsReader struct {
-	ctx     context.Context
-	conn    *websocket.Conn
-	currMsg []byte
+	ctx          context.Context
+	conn         *websocket.Conn
+	currMsg      []byte
+	maxFrameSize uint32
+	limit        *frameLimit
+	// window is the flow-control window of the responses, to which the window updates sent by the client are added.
+	// If nil, flow control was not negotiated, and window updates are rejected.
+	window *grpcwebsocket.Window
+	logger Logger
+	// cancelRequest cancels the gRPC request once reading from the connection fails, e.g., because the client
+	// disconnected. The request context is not canceled by the HTTP server for hijacked connections.
+	cancelRequest context.CancelFunc
 
 	// These are to prevent the WebSocket from closing due to
 	// (*websocket.Conn).Reader's context potentially expiring.
@@ -57,10 +67,15 @@ type wsReader struct {
 	err error
 }
 
-func newWebSocketReader(ctx context.Context, conn *websocket.Conn) io.ReadCloser {
+func newWebSocketReader(ctx context.Context, cancelRequest context.CancelFunc, conn *websocket.Conn, maxFrameSize uint32, limit *frameLimit, window *grpcwebsocket.Window, logger Logger) io.ReadCloser {
 	r := &wsReader{
 		ctx:           ctx,
 		conn:          conn,
+		maxFrameSize:  maxFrameSize,
+		limit:         limit,
+		window:        window,
+		logger:        logger,
+		cancelRequest: cancelRequest,
 		readerResultC: make(chan readerResult),
 		barrierC:      make(chan struct{}, 1),
 	}
@@ -81,6 +96,11 @@ func (r *wsReader) readerLoop() {
 		}
 
 		mt, reader, err := r.conn.Reader(r.ctx)
+		if err != nil {
+			// The handler might not read anymore (e.g., after the client half-closed the stream), hence it would
+			// otherwise only notice that the client is gone once it fails to write.
+			r.cancelRequest()
+		}
 		if err == nil && mt != websocket.MessageBinary {
 			err = errors.Errorf("incorrect message type; expected MessageBinary but got %v", mt)
 			reader = nil
@@ -109,7 +129,7 @@ func (r *wsReader) Read(p []byte) (int, error) {
 }
 
 func (r *wsReader) doRead(p []byte) (int, error) {
-	if len(r.currMsg) == 0 {
+	for len(r.currMsg) == 0 {
 		var rr readerResult
 		select {
 		case <-r.readCtx.Done():
@@ -124,7 +144,13 @@ func (r *wsReader) doRead(p []byte) (int, error) {
 		}
 
 		r.buf.Reset()
-		if _, err := r.buf.ReadFrom(rr.reader); err != nil {
+		if err := grpcwebsocket.ReadFrame(rr.reader, &r.buf, r.maxFrameSize); err != nil {
+			r.logger.Debugf("Reading gRPC frame from WebSocket connection failed: %v", err)
+			var frameErr *grpcproto.FrameTooLargeError
+			if errors.As(err, &frameErr) {
+				// Let the client know why the stream is aborted.
+				_ = r.conn.Close(websocket.StatusMessageTooBig, "gRPC frame too large")
+			}
 			return 0, err
 		}
 
@@ -135,15 +161,28 @@ func (r *wsReader) doRead(p []byte) (int, error) {
 		// Headers are not expected to be handled here.
 		msg := r.buf.Bytes()
 		if err := grpcproto.ValidateGRPCFrame(msg); err != nil {
+			r.logger.Debugf("Received invalid gRPC frame via WebSocket connection: %v", err)
 			return 0, err
 		}
+		if increment, ok := grpcproto.ParseWindowUpdate(msg); ok && r.window != nil {
+			r.window.Add(increment)
+			continue
+		}
 		if grpcproto.IsEndOfStream(msg) {
+			if r.window != nil {
+				// The client keeps sending window updates while receiving the response.
+				go r.readWindowUpdates()
+			}
 			// This is where a connection without errors will terminate.
 			return 0, io.EOF
 		}
 		if !grpcproto.IsDataFrame(msg) {
+			r.logger.Debugf("Received unexpected gRPC frame with flags %#x via WebSocket connection", msg[0])
 			return 0, errors.Errorf("message is not a gRPC data frame")
 		}
+		if !r.limit.allowFrame() {
+			return 0, errFrameRateExceeded
+		}
 
 		r.currMsg = msg
 	}
@@ -154,6 +193,44 @@ func (r *wsReader) doRead(p []byte) (int, error) {
 	return n, nil
 }
 
+// readWindowUpdates processes the window updates the client sends after the end of the request stream, until reading
+// from the connection fails or the reader is closed.
+func (r *wsReader) readWindowUpdates() {
+	var buf bytes.Buffer
+	for {
+		var rr readerResult
+		select {
+		case <-r.readCtx.Done():
+			return
+		case rr = <-r.readerResultC:
+		}
+		if rr.err != nil {
+			return
+		}
+
+		buf.Reset()
+		if err := grpcwebsocket.ReadFrame(rr.reader, &buf, r.maxFrameSize); err != nil {
+			r.logger.Debugf("Reading gRPC frame from WebSocket connection failed: %v", err)
+			return
+		}
+		r.barrierC <- struct{}{}
+
+		msg := buf.Bytes()
+		if err := grpcproto.ValidateGRPCFrame(msg); err != nil {
+			r.logger.Debugf("Received invalid gRPC frame via WebSocket connection: %v", err)
+			r.cancelRequest()
+			return
+		}
+		increment, ok := grpcproto.ParseWindowUpdate(msg)
+		if !ok {
+			r.logger.Debugf("Received unexpected gRPC frame with flags %#x via WebSocket connection after the end of the stream", msg[0])
+			r.cancelRequest()
+			return
+		}
+		r.window.Add(increment)
+	}
+}
+
 // Close signals readerLoop that we are no longer accepting messages.
 func (r *wsReader) Close() error {
 	// We cannot call (*websocket.Conn).CloseRead here. The WebSocket's closing handshake
@@ -0,0 +1,49 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+)
+
+type resumeFromKey struct{}
+
+// ResumeFrom returns the number of response messages the client has already received if the call is the resumption
+// of a server-streaming gRPC-WebSocket call whose connection was lost, in which case the handler must send the
+// remaining messages only, starting at the returned index. Calls are only resumed if the server was created with the
+// `WebSocketResume()` option.
+func ResumeFrom(ctx context.Context) (uint64, bool) {
+	n, ok := ctx.Value(resumeFromKey{}).(uint64)
+	return n, ok
+}
+
+// withResumeFrom returns a context conveying the position of the call to resume, as requested via the respective
+// header of the WebSocket handshake request, if any. A malformed header is reported to the given logger and ignored.
+func withResumeFrom(ctx context.Context, hdr http.Header, logger Logger) context.Context {
+	val := hdr.Get(grpcproto.ResumeFromHeader)
+	if val == "" {
+		return ctx
+	}
+	n, err := strconv.ParseUint(val, 10, 64)
+	if err != nil {
+		logger.Warnf("Ignoring malformed %s header: %v", grpcproto.ResumeFromHeader, err)
+		return ctx
+	}
+	return context.WithValue(ctx, resumeFromKey{}, n)
+}
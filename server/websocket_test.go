@@ -0,0 +1,108 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"golang.stackrox.io/grpc-http1/internal/grpcwebsocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"nhooyr.io/websocket"
+)
+
+// failingHealthServer fails every health check with the given code.
+type failingHealthServer struct {
+	healthpb.UnimplementedHealthServer
+	code codes.Code
+}
+
+func (s failingHealthServer) Check(context.Context, *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	return nil, status.Error(s.code, "health check failed")
+}
+
+// callViaWebSocket performs a unary health check via a raw WebSocket connection, and returns the trailers as well as
+// the error returned when reading past them.
+func callViaWebSocket(t *testing.T, code codes.Code) (string, error) {
+	grpcSrv := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcSrv, failingHealthServer{code: code})
+	t.Cleanup(grpcSrv.Stop)
+	srv := httptest.NewServer(CreateDowngradingHandler(grpcSrv, http.NotFoundHandler()))
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	hdr := make(http.Header)
+	hdr.Set("Content-Type", "application/grpc")
+	conn, _, err := websocket.Dial(ctx, srv.URL+healthCheckPath, &websocket.DialOptions{
+		HTTPHeader:   hdr,
+		Subprotocols: []string{grpcwebsocket.SubprotocolName},
+	})
+	require.NoError(t, err)
+	defer func() { _ = conn.CloseNow() }()
+
+	require.NoError(t, conn.Write(ctx, websocket.MessageBinary, grpcproto.MakeMessageHeader(0, 0)))
+	require.NoError(t, conn.Write(ctx, websocket.MessageBinary, grpcproto.EndStreamHeader))
+
+	var trailers string
+	for {
+		_, msg, err := conn.Read(ctx)
+		if err != nil {
+			return trailers, err
+		}
+		require.True(t, grpcproto.IsMetadataFrame(msg))
+		trailers = string(msg[grpcproto.MessageHeaderLength:])
+	}
+}
+
+func TestWebSocketCloseStatus(t *testing.T) {
+	trailers, err := callViaWebSocket(t, codes.Internal)
+	assert.Contains(t, trailers, fmt.Sprintf("Grpc-Status: %d", codes.Internal))
+	var closeErr websocket.CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, websocket.StatusInternalError, closeErr.Code)
+	assert.Equal(t, "health check failed", closeErr.Reason)
+
+	trailers, err = callViaWebSocket(t, codes.NotFound)
+	assert.Contains(t, trailers, fmt.Sprintf("Grpc-Status: %d", codes.NotFound))
+	assert.Equal(t, websocket.StatusNormalClosure, websocket.CloseStatus(err))
+}
+
+func TestWithResumeFrom(t *testing.T) {
+	logger := &recordingLogger{}
+	_, ok := ResumeFrom(withResumeFrom(context.Background(), http.Header{}, logger))
+	assert.False(t, ok)
+
+	_, ok = ResumeFrom(withResumeFrom(context.Background(), http.Header{grpcproto.ResumeFromHeader: {"-1"}}, logger))
+	assert.False(t, ok)
+	require.Len(t, logger.messages, 1)
+	assert.Contains(t, logger.messages[0], "WARN: Ignoring malformed "+grpcproto.ResumeFromHeader+" header")
+
+	n, ok := ResumeFrom(withResumeFrom(context.Background(), http.Header{grpcproto.ResumeFromHeader: {"42"}}, logger))
+	assert.True(t, ok)
+	assert.Equal(t, uint64(42), n)
+	assert.Len(t, logger.messages, 1)
+}
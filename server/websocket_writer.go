@@ -18,11 +18,14 @@ import (
 	"bytes"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
-	"github.com/golang/glog"
 	"golang.stackrox.io/grpc-http1/internal/grpcproto"
+	"golang.stackrox.io/grpc-http1/internal/grpcwebsocket"
 	"golang.stackrox.io/grpc-http1/internal/sliceutils"
+	"google.golang.org/grpc/codes"
+	"nhooyr.io/websocket"
 )
 
 // wsResponseWriter is a http.ResponseWriter to be used for WebSocket connections.
@@ -32,14 +35,17 @@ type wsResponseWriter struct {
 	header            http.Header
 	headerWritten     bool
 	announcedTrailers []string
+	trailers          http.Header
+	logger            Logger
 }
 
 // newWebSocketResponseWriter returns a new WebSocket response writer and its relative io.ReadCloser.
 // (*wsResponseWriter).Close *must* be called when the struct is no longer needed to signal
 // to the reader that there will be no more messages.
-func newWebSocketResponseWriter() (*wsResponseWriter, io.ReadCloser) {
+func newWebSocketResponseWriter(logger Logger) (*wsResponseWriter, io.ReadCloser) {
 	r, w := io.Pipe()
 	rw := &wsResponseWriter{
+		logger: logger,
 		writer: w,
 		header: make(http.Header),
 	}
@@ -63,7 +69,7 @@ func (w *wsResponseWriter) WriteHeader(statusCode int) {
 	}
 
 	if statusCode != http.StatusOK && statusCode != http.StatusUnsupportedMediaType {
-		glog.Errorf("gRPC server sending unexpected status code: %d", statusCode)
+		w.logger.Warnf("gRPC server sending unexpected status code: %d", statusCode)
 	}
 
 	hdr := w.header
@@ -79,8 +85,7 @@ func (w *wsResponseWriter) WriteHeader(statusCode int) {
 	_ = hdr.Write(&buf)
 
 	// Ignore errors, as WriteHeader does not seem to handle errors.
-	_, _ = w.writer.Write(grpcproto.MakeMessageHeader(grpcproto.MetadataFlags, uint32(buf.Len())))
-	_, _ = w.writer.Write(buf.Bytes())
+	_ = grpcproto.WriteMessage(w.writer, grpcproto.MetadataFlags, buf.Bytes())
 
 	// Mark down that we have written the headers.
 	w.headerWritten = true
@@ -119,6 +124,8 @@ func (w *wsResponseWriter) Close() error {
 		delete(hdr, k)
 	}
 
+	w.trailers = trailers
+
 	// Close the pipe when done, so the reader knows to stop.
 	// Ignore close error. The underlying writer is an io.Pipe, so errors should not happen.
 	defer w.writer.Close()
@@ -129,12 +136,19 @@ func (w *wsResponseWriter) Close() error {
 	}
 
 	// Write the trailers.
-	if _, err := w.writer.Write(grpcproto.MakeMessageHeader(grpcproto.MetadataFlags, uint32(buf.Len()))); err != nil {
-		return err
+	return grpcproto.WriteMessage(w.writer, grpcproto.MetadataFlags, buf.Bytes())
+}
+
+// closeStatus returns the WebSocket close status and reason for the gRPC status sent in the trailers. Must only be
+// called after Close.
+func (w *wsResponseWriter) closeStatus() (websocket.StatusCode, string) {
+	code, err := strconv.Atoi(w.trailers.Get("Grpc-Status"))
+	if err != nil {
+		return websocket.StatusInternalError, "no valid gRPC status sent"
 	}
-	if _, err := w.writer.Write(buf.Bytes()); err != nil {
-		return err
+	status := grpcwebsocket.CloseStatusForCode(codes.Code(code))
+	if status == websocket.StatusNormalClosure {
+		return status, ""
 	}
-
-	return nil
+	return status, grpcwebsocket.CloseReason(grpcproto.DecodeGrpcMessage(w.trailers.Get("Grpc-Message")))
 }
@@ -0,0 +1,140 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package testutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+type options struct {
+	grpcServerOpts []grpc.ServerOption
+	serverOpts     []server.Option
+	clientOpts     []client.ConnectOption
+	useTLS         bool
+}
+
+// Option controls the setup created by `NewDowngradedServer`.
+type Option interface {
+	apply(o *options)
+}
+
+type optionFunc func(o *options)
+
+func (f optionFunc) apply(o *options) {
+	f(o)
+}
+
+// WithGRPCServerOptions passes the given options to `grpc.NewServer`.
+func WithGRPCServerOptions(opts ...grpc.ServerOption) Option {
+	return optionFunc(func(o *options) {
+		o.grpcServerOpts = append(o.grpcServerOpts, opts...)
+	})
+}
+
+// WithServerOptions passes the given options to `server.CreateDowngradingHandler`.
+func WithServerOptions(opts ...server.Option) Option {
+	return optionFunc(func(o *options) {
+		o.serverOpts = append(o.serverOpts, opts...)
+	})
+}
+
+// WithClientOptions passes the given options to `client.ConnectViaProxy`, e.g., `client.UseWebSocket(true)` for
+// testing services over gRPC-WebSocket instead of downgraded gRPC-Web.
+func WithClientOptions(opts ...client.ConnectOption) Option {
+	return optionFunc(func(o *options) {
+		o.clientOpts = append(o.clientOpts, opts...)
+	})
+}
+
+// WithTLS serves the downgrading handler via TLS, using the certificate of `httptest.Server`, which the client is
+// configured to trust.
+func WithTLS() Option {
+	return optionFunc(func(o *options) {
+		o.useTLS = true
+	})
+}
+
+// NewDowngradedServer starts a gRPC server with the services registered by the given function, serves it via a
+// downgrading handler on an in-process HTTP/1.1 server, and returns a client connection established via
+// `client.ConnectViaProxy`. Unless overridden via client options, calls are downgraded to gRPC-Web, or tunneled via
+// WebSockets if the `client.UseWebSocket(true)` client option is given. The returned function closes the client
+// connection and stops the servers; it is also registered to be called when the test finishes, hence calling it is
+// only required for stopping the servers earlier.
+func NewDowngradedServer(t testing.TB, register func(*grpc.Server), opts ...Option) (*grpc.ClientConn, func()) {
+	t.Helper()
+
+	var o options
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+
+	grpcSrv := grpc.NewServer(o.grpcServerOpts...)
+	register(grpcSrv)
+
+	httpSrv := httptest.NewUnstartedServer(server.CreateDowngradingHandler(grpcSrv, http.NotFoundHandler(), o.serverOpts...))
+	var tlsConf *tls.Config
+	clientOpts := append([]client.ConnectOption{client.ForceDowngrade(true)}, o.clientOpts...)
+	if o.useTLS {
+		// Offer HTTP/2 via ALPN such that the client can establish its side channel. Calls are still downgraded, as
+		// the client does not use HTTP/2 when downgrading is forced.
+		httpSrv.EnableHTTP2 = true
+		httpSrv.StartTLS()
+		certPool := x509.NewCertPool()
+		certPool.AddCert(httpSrv.Certificate())
+		host, _, err := net.SplitHostPort(httpSrv.Listener.Addr().String())
+		if err != nil {
+			httpSrv.Close()
+			t.Fatalf("parsing server address: %v", err)
+		}
+		tlsConf = &tls.Config{
+			RootCAs:    certPool,
+			ServerName: host,
+		}
+	} else {
+		httpSrv.Start()
+		clientOpts = append(clientOpts, client.DialOpts(grpc.WithTransportCredentials(insecure.NewCredentials())))
+	}
+
+	cc, err := client.ConnectViaProxy(context.Background(), httpSrv.Listener.Addr().String(), tlsConf, clientOpts...)
+	if err != nil {
+		httpSrv.Close()
+		grpcSrv.Stop()
+		t.Fatalf("connecting to downgrading server: %v", err)
+	}
+
+	var once sync.Once
+	cleanup := func() {
+		once.Do(func() {
+			_ = cc.Close()
+			// Stop the gRPC server first, as closing the HTTP server waits for active requests to finish.
+			grpcSrv.Stop()
+			httpSrv.Close()
+		})
+	}
+	t.Cleanup(cleanup)
+	return cc, cleanup
+}
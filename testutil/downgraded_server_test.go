@@ -0,0 +1,112 @@
+// Copyright (c) 2020 StackRox Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package testutil
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.stackrox.io/grpc-http1/client"
+	"golang.stackrox.io/grpc-http1/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type statsRecorder struct {
+	mutex sync.Mutex
+	stats []server.RPCStats
+}
+
+func (r *statsRecorder) RPCStarted(context.Context, server.RPCInfo) {}
+
+func (r *statsRecorder) RPCFinished(_ context.Context, stats server.RPCStats) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.stats = append(r.stats, stats)
+}
+
+func (r *statsRecorder) first() (server.RPCStats, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.stats) == 0 {
+		return server.RPCStats{}, false
+	}
+	return r.stats[0], true
+}
+
+func registerHealth(s *grpc.Server) {
+	healthpb.RegisterHealthServer(s, health.NewServer())
+}
+
+func TestNewDowngradedServer(t *testing.T) {
+	cases := map[string]struct {
+		opts              []Option
+		expectedTransport server.Transport
+		expectDowngraded  bool
+	}{
+		"downgraded": {
+			expectedTransport: server.TransportGRPC,
+			expectDowngraded:  true,
+		},
+		"downgraded via TLS": {
+			opts:              []Option{WithTLS()},
+			expectedTransport: server.TransportGRPC,
+			expectDowngraded:  true,
+		},
+		"WebSocket": {
+			opts:              []Option{WithClientOptions(client.UseWebSocket(true))},
+			expectedTransport: server.TransportGRPCWebSocket,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			recorder := &statsRecorder{}
+			opts := append([]Option{WithServerOptions(server.WithStatsHandler(recorder))}, c.opts...)
+			cc, cleanup := NewDowngradedServer(t, registerHealth, opts...)
+			defer cleanup()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			healthClient := healthpb.NewHealthClient(cc)
+			resp, err := healthClient.Check(ctx, &healthpb.HealthCheckRequest{})
+			require.NoError(t, err)
+			assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+
+			stream, err := healthClient.Watch(ctx, &healthpb.HealthCheckRequest{})
+			require.NoError(t, err)
+			resp, err = stream.Recv()
+			require.NoError(t, err)
+			assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+
+			// The stats of the unary call are reported once the handler returns, which may be after the client
+			// received the response.
+			require.Eventually(t, func() bool {
+				_, ok := recorder.first()
+				return ok
+			}, 5*time.Second, 10*time.Millisecond)
+			stats, _ := recorder.first()
+			assert.Equal(t, "/grpc.health.v1.Health/Check", stats.Method)
+			assert.Equal(t, c.expectedTransport, stats.Transport)
+			assert.Equal(t, c.expectDowngraded, stats.Downgraded)
+		})
+	}
+}